@@ -4,69 +4,130 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"text/template"
 	"time"
 
+	"github.com/illenko/whodidthis/analyzer/rules"
 	"github.com/illenko/whodidthis/config"
 	"github.com/illenko/whodidthis/models"
 	"github.com/illenko/whodidthis/storage"
 	"google.golang.org/genai"
 )
 
-const maxAgenticIterations = 20
 const defaultGeminiModel = "gemini-2.5-pro"
 
 type Analyzer struct {
-	client       *genai.Client
-	model        string
-	geminiConfig config.GeminiConfig
-	toolExecutor *ToolExecutor
-	analysisRepo storage.AnalysisRepo
-	snapshots    storage.SnapshotsRepo
-	services     storage.ServicesRepo
-
-	mu                 sync.RWMutex
-	running            bool
-	currentSnapshotID  int64
-	previousSnapshotID int64
-	progress           string
-	logger             *slog.Logger
+	// client is nil without a Gemini API key; analyses then come from the
+	// rule engine.
+	client         *genai.Client
+	model          string
+	geminiConfig   config.GeminiConfig
+	detection      config.DetectionConfig
+	promptTemplate *template.Template
+	toolExecutor   *ToolExecutor
+	analysisRepo   storage.AnalysisRepo
+	snapshots      storage.SnapshotsRepo
+	services       storage.ServicesRepo
+	metrics        storage.MetricsRepo
+	findings       storage.FindingsRepo
+	logStreams     storage.LogStreamsRepo
+	rules          *rules.Engine
+	events         models.EventPublisher
+
+	mu sync.RWMutex
+	// runs holds the analyses in flight, one per snapshot pair, in start
+	// order.
+	runs   []*models.AnalysisProgress
+	logger *slog.Logger
 }
 
 type Config struct {
-	Gemini       config.GeminiConfig
+	Gemini config.GeminiConfig
+	// Detection tunes the anti-pattern heuristics in the prompt.
+	Detection    config.DetectionConfig
 	ToolExecutor *ToolExecutor
 	AnalysisRepo storage.AnalysisRepo
 	Snapshots    storage.SnapshotsRepo
 	Services     storage.ServicesRepo
+	Metrics      storage.MetricsRepo
+	// Findings stores the scored issues each analysis reports.
+	Findings storage.FindingsRepo
+	// LogStreams adds Loki stream counts to the prompt; optional.
+	LogStreams storage.LogStreamsRepo
+	// Rules finds label anti-patterns when there is no Gemini API key.
+	Rules *rules.Engine
+	// Events receives progress and completion notifications; optional.
+	Events models.EventPublisher
 }
 
+// New creates an analyzer backed by Gemini, or by the deterministic rule
+// engine when cfg.Gemini has no API key.
 func New(ctx context.Context, cfg Config) (*Analyzer, error) {
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  cfg.Gemini.APIKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create genai client: %w", err)
+	var client *genai.Client
+	if cfg.Gemini.APIKey != "" {
+		var err error
+		client, err = genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey:  cfg.Gemini.APIKey,
+			Backend: genai.BackendGeminiAPI,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create genai client: %w", err)
+		}
+	} else if cfg.Rules == nil {
+		return nil, fmt.Errorf("rule engine is required without a Gemini API key")
 	}
 
 	model := cfg.Gemini.Model
 	if model == "" {
 		model = defaultGeminiModel
 	}
+	promptTemplate, err := loadPromptTemplate(cfg.Gemini.Prompt.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Analyzer{
-		client:       client,
-		model:        model,
-		geminiConfig: cfg.Gemini,
-		toolExecutor: cfg.ToolExecutor,
-		analysisRepo: cfg.AnalysisRepo,
-		snapshots:    cfg.Snapshots,
-		services:     cfg.Services,
-		logger:       slog.Default().With("component", "analyzer"),
+		client:         client,
+		model:          model,
+		geminiConfig:   cfg.Gemini,
+		detection:      cfg.Detection,
+		promptTemplate: promptTemplate,
+		toolExecutor:   cfg.ToolExecutor,
+		analysisRepo:   cfg.AnalysisRepo,
+		snapshots:      cfg.Snapshots,
+		services:       cfg.Services,
+		metrics:        cfg.Metrics,
+		findings:       cfg.Findings,
+		logStreams:     cfg.LogStreams,
+		rules:          cfg.Rules,
+		events:         cfg.Events,
+		logger:         slog.Default().With("component", "analyzer"),
 	}, nil
 }
 
+// CheckGemini verifies that the API key works and the configured model
+// exists, without generating anything.
+func CheckGemini(ctx context.Context, cfg config.GeminiConfig) error {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  cfg.APIKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create genai client: %w", err)
+	}
+
+	model := cfg.Model
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	if _, err := client.Models.Get(ctx, model, nil); err != nil {
+		return fmt.Errorf("failed to get model %s: %w", model, err)
+	}
+	return nil
+}
+
 func (a *Analyzer) StartAnalysis(ctx context.Context, currentID, previousID int64) (*models.SnapshotAnalysis, error) {
 	currentSnapshot, err := a.snapshots.GetByID(ctx, currentID)
 	if err != nil {
@@ -94,21 +155,24 @@ func (a *Analyzer) StartAnalysis(ctx context.Context, currentID, previousID int6
 	}
 
 	a.mu.Lock()
-	if a.running {
+	if a.findRun(currentID, previousID) != nil {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("analysis of snapshots %d vs %d is already running", currentID, previousID)
+	}
+	if len(a.runs) >= a.geminiConfig.MaxConcurrent {
 		a.mu.Unlock()
-		return nil, fmt.Errorf("another analysis is already running (snapshots %d vs %d)", a.currentSnapshotID, a.previousSnapshotID)
+		return nil, fmt.Errorf("%d analyses are already running, try again later", len(a.runs))
 	}
-	a.running = true
-	a.currentSnapshotID = currentID
-	a.previousSnapshotID = previousID
-	a.progress = "Initializing"
+	a.runs = append(a.runs, &models.AnalysisProgress{
+		CurrentSnapshotID:  currentID,
+		PreviousSnapshotID: previousID,
+		Progress:           "Initializing",
+	})
 	a.mu.Unlock()
 
 	analysis, err := a.analysisRepo.Create(ctx, currentID, previousID)
 	if err != nil {
-		a.mu.Lock()
-		a.running = false
-		a.mu.Unlock()
+		a.finishRun(currentID, previousID)
 		return nil, fmt.Errorf("failed to create analysis record: %w", err)
 	}
 
@@ -130,16 +194,57 @@ func (a *Analyzer) DeleteAnalysis(ctx context.Context, currentID, previousID int
 	return a.analysisRepo.Delete(ctx, currentID, previousID)
 }
 
+// Usage returns token usage per month since the given time, priced with
+// the configured Gemini pricing.
+func (a *Analyzer) Usage(ctx context.Context, since time.Time) ([]models.AnalysisUsage, error) {
+	usage, err := a.analysisRepo.Usage(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum analysis usage: %w", err)
+	}
+	for i := range usage {
+		usage[i].Cost = a.geminiConfig.Pricing.Cost(usage[i].PromptTokens, usage[i].ResponseTokens)
+	}
+	return usage, nil
+}
+
 func (a *Analyzer) GetGlobalStatus() models.AnalysisGlobalStatus {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	return models.AnalysisGlobalStatus{
-		Running:            a.running,
-		CurrentSnapshotID:  a.currentSnapshotID,
-		PreviousSnapshotID: a.previousSnapshotID,
-		Progress:           a.progress,
+	status := models.AnalysisGlobalStatus{
+		Running:  len(a.runs) > 0,
+		Full:     len(a.runs) >= a.geminiConfig.MaxConcurrent,
+		Analyses: make([]models.AnalysisProgress, 0, len(a.runs)),
+	}
+	for _, run := range a.runs {
+		status.Analyses = append(status.Analyses, *run)
+	}
+	if len(a.runs) > 0 {
+		latest := a.runs[len(a.runs)-1]
+		status.CurrentSnapshotID = latest.CurrentSnapshotID
+		status.PreviousSnapshotID = latest.PreviousSnapshotID
+		status.Progress = latest.Progress
 	}
+	return status
+}
+
+// findRun returns the in-flight analysis of a snapshot pair, or nil. The
+// caller holds a.mu.
+func (a *Analyzer) findRun(currentID, previousID int64) *models.AnalysisProgress {
+	for _, run := range a.runs {
+		if run.CurrentSnapshotID == currentID && run.PreviousSnapshotID == previousID {
+			return run
+		}
+	}
+	return nil
+}
+
+func (a *Analyzer) finishRun(currentID, previousID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.runs = slices.DeleteFunc(a.runs, func(run *models.AnalysisProgress) bool {
+		return run.CurrentSnapshotID == currentID && run.PreviousSnapshotID == previousID
+	})
 }
 
 func (a *Analyzer) completeAnalysisWithError(ctx context.Context, analysis *models.SnapshotAnalysis, err error) {
@@ -151,10 +256,26 @@ func (a *Analyzer) completeAnalysisWithError(ctx context.Context, analysis *mode
 	if updateErr := a.analysisRepo.Update(ctx, analysis); updateErr != nil {
 		a.logger.Error("failed to update analysis with error", "error", updateErr)
 	}
+	a.publish(models.EventAnalysisFinished, analysis)
 }
 
-func (a *Analyzer) updateProgress(progress string) {
+func (a *Analyzer) updateProgress(analysis *models.SnapshotAnalysis, progress string) {
 	a.mu.Lock()
-	a.progress = progress
+	if run := a.findRun(analysis.CurrentSnapshotID, analysis.PreviousSnapshotID); run != nil {
+		run.Progress = progress
+	}
+	data := models.AnalysisProgress{
+		CurrentSnapshotID:  analysis.CurrentSnapshotID,
+		PreviousSnapshotID: analysis.PreviousSnapshotID,
+		Progress:           progress,
+	}
 	a.mu.Unlock()
+	a.publish(models.EventAnalysisProgress, data)
+}
+
+func (a *Analyzer) publish(typ models.EventType, data any) {
+	if a.events == nil {
+		return
+	}
+	a.events.Publish(models.Event{Type: typ, Time: time.Now(), Data: data})
 }
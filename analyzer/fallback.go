@@ -0,0 +1,161 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/illenko/whodidthis/analyzer/rules"
+	"github.com/illenko/whodidthis/models"
+)
+
+// Growth thresholds of the rule-based analysis, the same the Gemini prompt
+// asks for.
+const (
+	criticalGrowthPct = 50
+	notableGrowthPct  = 20
+	maxRuleIssues     = 10
+	maxRuleChanges    = 5
+)
+
+// ruleAnalysis writes the analysis from the service diff and the label
+// rules, in the same sections the Gemini prompt asks for. The inputs are
+// kept as tool calls so the UI can show them like Gemini's.
+func (a *Analyzer) ruleAnalysis(ctx context.Context, analysis *models.SnapshotAnalysis, current, previous *models.Snapshot, suppressed *suppressions) (string, []models.Finding, error) {
+	diffs, err := a.services.Diff(ctx, previous.ID, current.ID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to diff services: %w", err)
+	}
+	analysis.ToolCalls = append(analysis.ToolCalls, models.ToolCall{
+		Name:   "diff_snapshots",
+		Args:   map[string]any{"current_snapshot_id": current.ID, "previous_snapshot_id": previous.ID},
+		Result: diffs,
+	})
+
+	findings, err := a.rules.Run(ctx, current.ID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to run label rules: %w", err)
+	}
+	findings = slices.DeleteFunc(findings, func(f rules.Finding) bool {
+		return suppressed.covers(f.ServiceName, f.MetricName, f.LabelName, string(f.Kind))
+	})
+	analysis.ToolCalls = append(analysis.ToolCalls, models.ToolCall{
+		Name:   "detect_label_anti_patterns",
+		Args:   map[string]any{"snapshot_id": current.ID},
+		Result: findings,
+	})
+	if err := a.analysisRepo.Update(ctx, analysis); err != nil {
+		a.logger.Error("failed to update analysis with tool calls", "error", err)
+	}
+
+	scored := make([]models.Finding, 0, len(findings))
+	for _, f := range findings {
+		description := fmt.Sprintf("%s in label %s (%d unique values)", f.Kind.Description(), f.LabelName, f.UniqueValues)
+		if len(f.Examples) > 0 {
+			description += ": " + quoteValues(f.Examples)
+		}
+		finding, err := a.newFinding(ctx, analysis, f.ServiceName, f.MetricName, f.LabelName, string(f.Kind), description)
+		if err != nil {
+			return "", nil, err
+		}
+		scored = append(scored, finding)
+	}
+
+	return formatRuleAnalysis(diffs, findings), scored, nil
+}
+
+func formatRuleAnalysis(diffs []models.ServiceDiff, findings []rules.Finding) string {
+	var b strings.Builder
+
+	if len(findings) > 0 {
+		b.WriteString("## 🚨 High Cardinality Issues\n")
+		for i, f := range findings {
+			if i == maxRuleIssues {
+				fmt.Fprintf(&b, "\n_%d more labels not shown._\n", len(findings)-maxRuleIssues)
+				break
+			}
+			fmt.Fprintf(&b, "\n- **Metric**: %s.%s\n", f.ServiceName, f.MetricName)
+			fmt.Fprintf(&b, "- **Series count**: %d\n", f.SeriesCount)
+			fmt.Fprintf(&b, "- **Problem**: %s in label %s (%d unique values)", f.Kind.Description(), f.LabelName, f.UniqueValues)
+			if len(f.Examples) > 0 {
+				fmt.Fprintf(&b, ": %s", quoteValues(f.Examples))
+			}
+			b.WriteString("\n")
+			fmt.Fprintf(&b, "- **Fix**: Remove the %s label or replace it with a bounded value\n", f.LabelName)
+		}
+		b.WriteString("\n")
+	}
+
+	var critical, notable []string
+	for _, d := range diffs {
+		switch {
+		case d.Status == models.DiffAdded:
+			critical = append(critical, fmt.Sprintf("New service %s with %d series", d.ServiceName, d.CurrentSeries))
+		case d.Status == models.DiffRemoved:
+			critical = append(critical, fmt.Sprintf("Service %s removed (%d series)", d.ServiceName, d.PreviousSeries))
+		case d.PreviousSeries > 0:
+			pct := float64(d.SeriesDelta) * 100 / float64(d.PreviousSeries)
+			line := fmt.Sprintf("%s: %+d series (%+.0f%%, %d → %d)", d.ServiceName, d.SeriesDelta, pct, d.PreviousSeries, d.CurrentSeries)
+			if math.Abs(pct) > criticalGrowthPct {
+				critical = append(critical, line)
+			} else if math.Abs(pct) >= notableGrowthPct {
+				notable = append(notable, line)
+			}
+		}
+	}
+
+	b.WriteString("## 📊 Significant Changes\n")
+	if len(critical) == 0 && len(notable) == 0 {
+		fmt.Fprintf(&b, "\nNo service changed by more than %d%%.\n", notableGrowthPct)
+	}
+	writeChangeList(&b, "Critical", critical)
+	writeChangeList(&b, "Notable", notable)
+
+	b.WriteString("\n## ✅ Recommendations\n\n")
+	var recs []string
+	if len(findings) > 0 {
+		f := findings[0]
+		recs = append(recs, fmt.Sprintf("Drop or bound the %s label on %s.%s (%s)", f.LabelName, f.ServiceName, f.MetricName, f.Kind.Description()))
+	}
+	if len(critical) > 0 {
+		recs = append(recs, "Investigate the critical changes above with the service owners")
+	}
+	if len(findings) > 1 {
+		recs = append(recs, fmt.Sprintf("Review the other %d flagged labels", len(findings)-1))
+	}
+	if len(recs) == 0 {
+		recs = append(recs, "No action needed")
+	}
+	for i, r := range recs {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, r)
+	}
+
+	b.WriteString("\n_Generated by the built-in rules; set a Gemini API key for AI analysis._\n")
+	return b.String()
+}
+
+// writeChangeList writes the changes under a bold heading, biggest first as
+// the diff orders them.
+func writeChangeList(b *strings.Builder, title string, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n**%s**:\n", title)
+	for i, c := range changes {
+		if i == maxRuleChanges {
+			fmt.Fprintf(b, "- …and %d more\n", len(changes)-maxRuleChanges)
+			break
+		}
+		fmt.Fprintf(b, "- %s\n", c)
+	}
+}
+
+func quoteValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
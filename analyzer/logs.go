@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// logLabelsPerService is how many of a service's highest-cardinality stream
+// labels are shown in the prompt, each with a few sample values.
+const (
+	logLabelsPerService = 3
+	logSamplesPerLabel  = 3
+)
+
+// logStreamsSection describes the Loki streams of both snapshots for the
+// prompt. It is empty when the current snapshot has no log data, so metrics
+// only setups see the prompt unchanged.
+func (a *Analyzer) logStreamsSection(ctx context.Context, currentID, previousID int64) (string, error) {
+	current, err := a.logStreams.List(ctx, currentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list current log streams: %w", err)
+	}
+	if len(current) == 0 {
+		return "", nil
+	}
+
+	previous, err := a.logStreams.List(ctx, previousID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list previous log streams: %w", err)
+	}
+	previousStreams := make(map[string]int, len(previous))
+	for _, s := range previous {
+		previousStreams[s.ServiceName] = s.StreamCount
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+
+# Loki Streams
+
+Stream counts per service (current vs previous snapshot) with the highest-cardinality stream labels in the current snapshot. No tool returns more log data than this. An unbounded stream label (IDs, paths, pod hashes on long-lived streams) is the same anti-pattern as in metrics: report it under High Cardinality Issues as service_name (logs).label_name.
+`)
+	for _, svc := range current {
+		prev, ok := previousStreams[svc.ServiceName]
+		prevText := "new"
+		if ok {
+			prevText = fmt.Sprintf("previous %d", prev)
+		}
+		fmt.Fprintf(&b, "  - %s: %d streams (%s)", svc.ServiceName, svc.StreamCount, prevText)
+
+		labels, err := a.logStreams.ListLabels(ctx, svc.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to list log labels for %s: %w", svc.ServiceName, err)
+		}
+		var parts []string
+		for _, l := range labels[:min(len(labels), logLabelsPerService)] {
+			samples := l.SampleValues[:min(len(l.SampleValues), logSamplesPerLabel)]
+			parts = append(parts, fmt.Sprintf("%s=%d values [%s]", l.LabelName, l.UniqueValuesCount, strings.Join(samples, ", ")))
+		}
+		if len(parts) > 0 {
+			b.WriteString("; top labels: " + strings.Join(parts, "; "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
@@ -2,16 +2,28 @@ package analyzer
 
 import (
 	"context"
+	_ "embed"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/illenko/whodidthis/config"
 	"github.com/illenko/whodidthis/models"
 	"github.com/illenko/whodidthis/storage"
 	"google.golang.org/genai"
 )
 
-func getGenaiToolDefinitions() *genai.Tool {
-	return &genai.Tool{
+// reportFindingTool is answered by the analyzer itself rather than the
+// tool executor, since it records into the running analysis.
+const reportFindingTool = "report_finding"
+
+// getGenaiToolDefinitions declares query_prometheus only when live queries
+// are enabled.
+func getGenaiToolDefinitions(liveQueries bool) *genai.Tool {
+	tool := &genai.Tool{
 		FunctionDeclarations: []*genai.FunctionDeclaration{
 			{
 				Name:        "get_service_metrics",
@@ -38,6 +50,45 @@ func getGenaiToolDefinitions() *genai.Tool {
 					Required: []string{"snapshot_id", "service_name", "metric_name"},
 				},
 			},
+			{
+				Name:        "get_label_values",
+				Description: "Get up to 100 values of one label: the sample stored with the snapshot and, when available, the most common values in Prometheus now with their series counts",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"snapshot_id":  {Type: genai.TypeInteger, Description: "ID of the snapshot"},
+						"service_name": {Type: genai.TypeString, Description: "Name of the service"},
+						"metric_name":  {Type: genai.TypeString, Description: "Name of the metric"},
+						"label_name":   {Type: genai.TypeString, Description: "Name of the label"},
+					},
+					Required: []string{"snapshot_id", "service_name", "metric_name", "label_name"},
+				},
+			},
+			{
+				Name:        "search_metrics",
+				Description: "Find metrics by name across all services in a snapshot, largest first, to see which services emit a metric",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"snapshot_id": {Type: genai.TypeInteger, Description: "ID of the snapshot"},
+						"pattern":     {Type: genai.TypeString, Description: "Glob over metric names (e.g. http_*_total); without wildcards, a substring"},
+					},
+					Required: []string{"snapshot_id", "pattern"},
+				},
+			},
+			{
+				Name:        "get_top_changes",
+				Description: "Diff two whole snapshots and return only the services and service metrics with the biggest series changes",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"current_snapshot_id":  {Type: genai.TypeInteger, Description: "ID of the current snapshot"},
+						"previous_snapshot_id": {Type: genai.TypeInteger, Description: "ID of the previous snapshot"},
+						"limit":                {Type: genai.TypeInteger, Description: "How many services and metrics to return (default 10, max 50)"},
+					},
+					Required: []string{"current_snapshot_id", "previous_snapshot_id"},
+				},
+			},
 			{
 				Name:        "compare_services",
 				Description: "Compare a service between two snapshots to see added/removed metrics and series count changes",
@@ -53,9 +104,38 @@ func getGenaiToolDefinitions() *genai.Tool {
 			},
 		},
 	}
+	tool.FunctionDeclarations = append(tool.FunctionDeclarations, &genai.FunctionDeclaration{
+		Name:        reportFindingTool,
+		Description: "Record one issue for the findings list; severity is scored from the metric's series count and growth, so call it once per issue before the final answer",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"service_name": {Type: genai.TypeString, Description: "Name of the service"},
+				"metric_name":  {Type: genai.TypeString, Description: "Name of the metric in the current snapshot"},
+				"label_name":   {Type: genai.TypeString, Description: "The offending label, if the issue is about one"},
+				"kind":         {Type: genai.TypeString, Description: "One of uuid, numeric_id, prefixed_id, url, email, timestamp, high_entropy, unbounded, bucket_explosion, growth"},
+				"description":  {Type: genai.TypeString, Description: "One sentence with example values"},
+			},
+			Required: []string{"service_name", "metric_name", "kind", "description"},
+		},
+	})
+	if liveQueries {
+		tool.FunctionDeclarations = append(tool.FunctionDeclarations, &genai.FunctionDeclaration{
+			Name:        "query_prometheus",
+			Description: "Run a PromQL count or topk query against live Prometheus data to verify a hypothesis; results may postdate the snapshots",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"expr": {Type: genai.TypeString, Description: "count(...) or topk(N, count ...) with N at most 50, over a plain series selector that names its metric or pins the service label, e.g. count by (user_id) (http_requests_total{job=\"payments\"})"},
+				},
+				Required: []string{"expr"},
+			},
+		})
+	}
+	return tool
 }
 
-func (a *Analyzer) buildPrompt(ctx context.Context, current, previous *models.Snapshot) (string, error) {
+func (a *Analyzer) buildPrompt(ctx context.Context, current, previous *models.Snapshot, suppressed *suppressions) (string, error) {
 	currentServices, err := a.services.List(ctx, current.ID, storage.ServiceListOptions{})
 	if err != nil {
 		return "", fmt.Errorf("failed to list current services: %w", err)
@@ -66,137 +146,96 @@ func (a *Analyzer) buildPrompt(ctx context.Context, current, previous *models.Sn
 		return "", fmt.Errorf("failed to list previous services: %w", err)
 	}
 
-	prompt := fmt.Sprintf(`You are an expert monitoring system analyzer specializing in Prometheus metrics analysis. Your goals:
-1. Identify significant changes between two snapshots
-2. Detect high cardinality issues and anti-patterns (IDs, UUIDs, URLs in labels)
-
-# Available Tools
-
-You have EXACTLY 3 tools. Do NOT attempt to call any other tools or add parameters not listed:
-
-1. get_service_metrics(snapshot_id, service_name)
-   - Returns: All metrics for the specified service in the given snapshot
-
-2. get_metric_labels(snapshot_id, service_name, metric_name)
-   - Returns: All label combinations for a specific metric
-
-3. compare_services(current_snapshot_id, previous_snapshot_id, service_name)
-   - Returns: Comparison showing added/removed metrics and series count changes
----
-Current snapshot (ID: %d):
-- Collected at: %s
-- Total services: %d
-- Total series: %d
-Services in this snapshot:
-%s
----
-Previous snapshot (ID: %d):
-- Collected at: %s
-- Total services: %d
-- Total series: %d
-Services in previous snapshot:
-%s
----
-# Analysis Strategy
-
-## Phase 1: Change Detection (2-3 tool calls)
-- Use compare_services on 2-3 services with notable series count differences
-- Identify new/removed services from the lists above (no tool needed)
-
-## Phase 2: Cardinality Analysis (3-4 tool calls)
-**CRITICAL**: Focus on detecting anti-patterns in the CURRENT snapshot:
-
-For services with >1000 series OR >50 percents series growth:
-1. Use get_service_metrics to identify metrics with high series counts
-2. Use get_metric_labels on metrics with >100 series to examine label patterns
-
-**Red flags to detect:**
-- Label values containing UUIDs/GUIDs (patterns: 8-4-4-4-12 hex digits)
-- Transaction/payment/request IDs in labels (numeric IDs >6 digits, alphanumeric codes)
-- User IDs, account IDs, merchant IDs in labels
-- URLs or paths with variable IDs (e.g., /api/transactions/12345/status)
-- Timestamps or dates in label values
-- Session tokens or correlation IDs
-- Email addresses or personal identifiers
-
-**Healthy patterns:**
-- Bounded enums (status: success/failed/pending)
-- Service names, environment, region, availability zone
-- HTTP methods, response codes (2xx, 4xx, 5xx ranges)
-- Provider names (limited set)
-- Payment methods (card, wallet, bank_transfer - limited set)
-
-## Phase 3: Stop Condition
-- Never call the same tool with identical parameters twice
-- Stop after 7-8 total tool calls or when you have enough data
-- If a tool returns no useful insights, move to different service/metric
-
-# Output Format
-
-## 🚨 High Cardinality Issues (if found)
-For each problematic metric:
-- **Metric**: service_name.metric_name
-- **Series count**: X
-- **Problem**: [ID pattern in label_name: sample values]
-- **Impact**: Estimated memory/storage overhead
-- **Fix**: Remove label or use constant value
-
-## 📊 Significant Changes
-**Critical** (1-2 points):
-- New/removed services, >50 percents series changes, new metric types
-
-**Notable** (1-2 points):
-- 20-50 percents series changes, cardinality increases
-
-## ✅ Recommendations
-Priority-ordered action items (max 3):
-1. [Most urgent - usually cardinality fixes]
-2. [Investigation needed]
-3. [Monitoring adjustments]
-
-Keep total analysis under 200 words. Prioritize cardinality issues over normal changes.
-
-# Detection Heuristics
-
-When examining label values with get_metric_labels:
-
-**UUID/GUID patterns:**
-- 32 hex chars with/without dashes: 550e8400-e29b-41d4-a716-446655440000
-- Look for: [0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}
-
-**ID patterns:**
-- Long numeric sequences: transaction_id="123456789012"
-- Alphanumeric codes: payment_id="PAY_abc123xyz456"
-- Prefixed IDs: merchant_id="MER_12345"
-
-**URL/Path patterns:**
-- /api/users/12345/transactions
-- /payments/550e8400-e29b-41d4-a716-446655440000/status
-
-**Safe cardinality check:**
-If a label has >50 unique values, it's likely unbounded and needs investigation.
-
-# Important Constraints
-
-- Use ONLY the snapshot IDs provided above
-- Maximum %d tool calls total
-- Prioritize CURRENT snapshot cardinality analysis over historical comparison
-- Assume operator understands Prometheus and payment systems
-- Be specific: show actual problematic label values as examples`,
-		current.ID,
-		current.CollectedAt.Format(time.RFC3339),
-		current.TotalServices,
-		current.TotalSeries,
-		formatServiceList(currentServices),
-		previous.ID,
-		previous.CollectedAt.Format(time.RFC3339),
-		previous.TotalServices,
-		previous.TotalSeries,
-		formatServiceList(previousServices),
-		maxAgenticIterations,
-	)
-
-	return prompt, nil
+	liveQueries := a.toolExecutor.liveQueries()
+	tools := getGenaiToolDefinitions(liveQueries)
+
+	var logStreams string
+	if a.logStreams != nil {
+		logStreams, err = a.logStreamsSection(ctx, current.ID, previous.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data := promptData{
+		Current:       newPromptSnapshot(current, currentServices),
+		Previous:      newPromptSnapshot(previous, previousServices),
+		ToolCount:     len(tools.FunctionDeclarations),
+		LiveQueries:   liveQueries,
+		MaxIterations: a.geminiConfig.MaxIterations,
+		Detection:     a.detection,
+		DomainContext: a.geminiConfig.Prompt.DomainContext,
+		Sections:      a.geminiConfig.Prompt.Sections,
+		Accepted:      suppressed.promptLines(),
+		LogStreams:    logStreams,
+	}
+	var b strings.Builder
+	if err := a.promptTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return b.String(), nil
+}
+
+//go:embed prompt.tmpl
+var defaultPromptTemplate string
+
+// promptData is what prompt templates are rendered with; prompt.tmpl
+// documents the fields for template authors.
+type promptData struct {
+	Current       promptSnapshot
+	Previous      promptSnapshot
+	ToolCount     int
+	LiveQueries   bool
+	MaxIterations int
+	Detection     config.DetectionConfig
+	DomainContext string
+	Sections      []config.PromptSection
+	Accepted      []string
+	LogStreams    string
+}
+
+type promptSnapshot struct {
+	ID            int64
+	CollectedAt   string
+	TotalServices int
+	TotalSeries   int64
+	// Services is the formatted service list, one line per service.
+	Services string
+}
+
+func newPromptSnapshot(s *models.Snapshot, services []models.ServiceSnapshot) promptSnapshot {
+	return promptSnapshot{
+		ID:            s.ID,
+		CollectedAt:   s.CollectedAt.Format(time.RFC3339),
+		TotalServices: s.TotalServices,
+		TotalSeries:   s.TotalSeries,
+		Services:      formatServiceList(services),
+	}
+}
+
+// loadPromptTemplate parses the template at path, or the built-in one when
+// path is empty.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	source := defaultPromptTemplate
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		source = string(data)
+	}
+	tmpl, err := template.New("prompt").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"trim": strings.TrimSpace,
+	}).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	// Field typos only surface on execution, so render once up front.
+	if err := tmpl.Execute(io.Discard, promptData{}); err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	return tmpl, nil
 }
 
 func formatServiceList(services []models.ServiceSnapshot) string {
@@ -0,0 +1,287 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// validateLiveQuery accepts only counting queries over plain selectors:
+//
+//	count [by|without (labels)] (inner)
+//	topk(N, count ...)
+//	inner = selector | count ...
+//
+// Anything else — functions, ranges, arithmetic, other aggregations — is
+// rejected, so the model can't run expensive or data-returning queries.
+// Every selector must name its metric or pin one of serviceLabels to a
+// value, so no query scans the whole TSDB, and topk's k is capped.
+func validateLiveQuery(expr string, serviceLabels []string) error {
+	p := &queryParser{src: expr, serviceLabels: serviceLabels}
+	if err := p.aggregation(); err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return fmt.Errorf("unexpected %q at offset %d", p.rest(), p.pos)
+	}
+	return nil
+}
+
+// maxTopK caps topk's k; more than maxQuerySamples would be cut anyway.
+const maxTopK = maxQuerySamples
+
+type queryParser struct {
+	src           string
+	pos           int
+	serviceLabels []string
+}
+
+func (p *queryParser) aggregation() error {
+	switch word := p.word(); word {
+	case "count":
+		if err := p.optionalGrouping(); err != nil {
+			return err
+		}
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		if err := p.inner(); err != nil {
+			return err
+		}
+		if err := p.expect(")"); err != nil {
+			return err
+		}
+		return p.optionalGrouping()
+	case "topk":
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		k, ok := p.integer()
+		if !ok {
+			return fmt.Errorf("topk needs an integer k")
+		}
+		if k < 1 || k > maxTopK {
+			return fmt.Errorf("topk k must be between 1 and %d", maxTopK)
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if !strings.HasPrefix(p.src[p.pos:], "count") {
+			return fmt.Errorf("topk may only rank a count")
+		}
+		if err := p.aggregation(); err != nil {
+			return err
+		}
+		return p.expect(")")
+	case "":
+		return fmt.Errorf("expected count or topk at offset %d", p.pos)
+	default:
+		return fmt.Errorf("only count and topk are allowed, got %q", word)
+	}
+}
+
+func (p *queryParser) inner() error {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	if strings.HasPrefix(rest, "count") || strings.HasPrefix(rest, "topk") {
+		save := p.pos
+		word := p.word()
+		p.skipSpace()
+		next := p.peek()
+		p.pos = save
+		// count or topk followed by ( or a grouping is an aggregation;
+		// otherwise it's a metric name that happens to start that way.
+		if (word == "count" || word == "topk") && (next == '(' || next == 'b' || next == 'w') {
+			return p.aggregation()
+		}
+	}
+	return p.selector()
+}
+
+func (p *queryParser) selector() error {
+	p.skipSpace()
+	name := p.word()
+	p.skipSpace()
+	if p.peek() != '{' {
+		if name == "" {
+			return fmt.Errorf("expected a selector at offset %d", p.pos)
+		}
+		return nil
+	}
+	p.pos++
+	matchers := 0
+	bounded := name != ""
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			break
+		}
+		if matchers > 0 {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+			p.skipSpace()
+			if p.peek() == '}' {
+				p.pos++
+				break
+			}
+		}
+		label, op, value, err := p.matcher()
+		if err != nil {
+			return err
+		}
+		if op == "=" && value != "" && (label == "__name__" || slices.Contains(p.serviceLabels, label)) {
+			bounded = true
+		}
+		matchers++
+	}
+	if name == "" && matchers == 0 {
+		return fmt.Errorf("empty selector")
+	}
+	if !bounded {
+		return fmt.Errorf("selector needs a metric name or an exact %s matcher", strings.Join(p.serviceLabels, "/"))
+	}
+	p.skipSpace()
+	if p.peek() == '[' {
+		return fmt.Errorf("range selectors are not allowed")
+	}
+	return nil
+}
+
+// matcher reads label op "value", returning the value without its quotes.
+func (p *queryParser) matcher() (label, op, value string, err error) {
+	label = p.word()
+	if label == "" {
+		return "", "", "", fmt.Errorf("expected a label name at offset %d", p.pos)
+	}
+	p.skipSpace()
+	for _, candidate := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(p.src[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return "", "", "", fmt.Errorf("expected a matcher operator at offset %d", p.pos)
+	}
+	p.pos += len(op)
+	p.skipSpace()
+	value, err = p.quoted()
+	return label, op, value, err
+}
+
+func (p *queryParser) quoted() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return "", fmt.Errorf("expected a quoted string at offset %d", p.pos)
+	}
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			value := p.src[p.pos+1 : i]
+			p.pos = i + 1
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *queryParser) optionalGrouping() error {
+	p.skipSpace()
+	save := p.pos
+	word := p.word()
+	if word != "by" && word != "without" {
+		p.pos = save
+		return nil
+	}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for first := true; ; first = false {
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.pos++
+			return nil
+		}
+		if !first {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+			p.skipSpace()
+		}
+		if p.word() == "" {
+			return fmt.Errorf("expected a label name at offset %d", p.pos)
+		}
+	}
+}
+
+// word reads an identifier: a metric name (with colons) or label name.
+func (p *queryParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := rune(p.src[p.pos])
+		if r == '_' || r == ':' || r < unicode.MaxASCII && (unicode.IsLetter(r) || p.pos > start && unicode.IsDigit(r)) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *queryParser) integer() (int, bool) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		// Only overflow is left, which no bound accepts either.
+		return math.MaxInt, true
+	}
+	return n, true
+}
+
+func (p *queryParser) expect(token string) error {
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], token) {
+		return fmt.Errorf("expected %q at offset %d", token, p.pos)
+	}
+	p.pos += len(token)
+	return nil
+}
+
+func (p *queryParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) rest() string {
+	if len(p.src)-p.pos > 20 {
+		return p.src[p.pos:p.pos+20] + "…"
+	}
+	return p.src[p.pos:]
+}
@@ -0,0 +1,53 @@
+package analyzer
+
+import "testing"
+
+func TestValidateLiveQuery(t *testing.T) {
+	serviceLabels := []string{"job", "namespace"}
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "count of metric", expr: `count(http_requests_total)`},
+		{name: "count by label", expr: `count by (user_id) (http_requests_total{job="payments"})`},
+		{name: "count without label", expr: `count without (pod) (http_requests_total)`},
+		{name: "grouping after", expr: `count(http_requests_total) by (job)`},
+		{name: "nested count", expr: `count(count by (user_id) (http_requests_total))`},
+		{name: "topk of count", expr: `topk(10, count by (user_id) (http_requests_total))`},
+		{name: "topk at cap", expr: `topk(50, count by (user_id) (http_requests_total))`},
+		{name: "metric named count", expr: `count(count_total)`},
+		{name: "exact name matcher", expr: `count({__name__="http_requests_total"})`},
+		{name: "exact service matcher", expr: `count by (__name__) ({job="payments"})`},
+		{name: "second service label", expr: `count({namespace="shop", pod=~"api-.*"})`},
+
+		{name: "empty", expr: ``, wantErr: true},
+		{name: "plain selector", expr: `http_requests_total`, wantErr: true},
+		{name: "other aggregation", expr: `sum(http_requests_total)`, wantErr: true},
+		{name: "function", expr: `count(rate(http_requests_total[5m]))`, wantErr: true},
+		{name: "range selector", expr: `count(http_requests_total[5m])`, wantErr: true},
+		{name: "arithmetic", expr: `count(http_requests_total) * 2`, wantErr: true},
+		{name: "empty braces", expr: `count({})`, wantErr: true},
+		{name: "regex name matcher", expr: `count({__name__=~".+"})`, wantErr: true},
+		{name: "negative name matcher", expr: `count({__name__!="up"})`, wantErr: true},
+		{name: "empty name matcher", expr: `count({__name__=""})`, wantErr: true},
+		{name: "regex service matcher", expr: `count({job=~".*"})`, wantErr: true},
+		{name: "non-service label", expr: `count({pod="api-0"})`, wantErr: true},
+		{name: "unbounded nested selector", expr: `topk(5, count by (job) ({pod=~".+"}))`, wantErr: true},
+		{name: "topk zero", expr: `topk(0, count(http_requests_total))`, wantErr: true},
+		{name: "topk over cap", expr: `topk(51, count(http_requests_total))`, wantErr: true},
+		{name: "topk overflow", expr: `topk(99999999999999999999999, count(http_requests_total))`, wantErr: true},
+		{name: "topk without k", expr: `topk(count(http_requests_total))`, wantErr: true},
+		{name: "topk of selector", expr: `topk(5, http_requests_total)`, wantErr: true},
+		{name: "unterminated string", expr: `count(up{job="payments)`, wantErr: true},
+		{name: "trailing input", expr: `count(up) or vector(1)`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLiveQuery(tt.expr, serviceLabels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLiveQuery(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"google.golang.org/genai"
+)
+
+// retryInfoType marks the error detail in which the Gemini API says how
+// long to wait, its counterpart of a Retry-After header.
+const retryInfoType = "type.googleapis.com/google.rpc.RetryInfo"
+
+// send is chat.SendMessage with retries on rate limiting and overload. A
+// failed send leaves the chat history untouched, so retrying is safe.
+func (a *Analyzer) send(ctx context.Context, analysis *models.SnapshotAnalysis, chat *genai.Chat, part genai.Part) (*genai.GenerateContentResponse, error) {
+	cfg := a.geminiConfig.Retry
+	for attempt := 0; ; attempt++ {
+		resp, err := chat.SendMessage(ctx, part)
+		if err == nil || attempt >= cfg.MaxAttempts-1 || ctx.Err() != nil {
+			return resp, err
+		}
+		retryAfter, ok := retryableGeminiError(err)
+		if !ok {
+			return resp, err
+		}
+
+		backoff := min(cfg.InitialBackoff<<attempt, cfg.MaxBackoff)
+		wait := max(time.Duration(rand.Int64N(int64(backoff)+1)), retryAfter)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		a.logger.Warn("Gemini call failed, retrying", "attempt", attempt+1, "wait", wait, "error", err)
+		a.updateProgress(analysis, fmt.Sprintf("Gemini busy, retrying in %s", wait.Round(time.Second)))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryableGeminiError reports whether err is a 429 or 503 from the Gemini
+// API, along with the delay the API asked for, if any.
+func retryableGeminiError(err error) (time.Duration, bool) {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	if apiErr.Code != http.StatusTooManyRequests && apiErr.Code != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	for _, detail := range apiErr.Details {
+		if detail["@type"] != retryInfoType {
+			continue
+		}
+		if s, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d, true
+			}
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,72 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/illenko/whodidthis/storage"
+)
+
+// Engine runs the classifier over every label of a snapshot.
+type Engine struct {
+	services   storage.ServicesRepo
+	metrics    storage.MetricsRepo
+	labels     storage.LabelsRepo
+	classifier *Classifier
+}
+
+func NewEngine(services storage.ServicesRepo, metrics storage.MetricsRepo, labels storage.LabelsRepo, classifier *Classifier) *Engine {
+	return &Engine{
+		services:   services,
+		metrics:    metrics,
+		labels:     labels,
+		classifier: classifier,
+	}
+}
+
+// Run returns the snapshot's label anti-patterns, the metrics with the most
+// series first.
+func (e *Engine) Run(ctx context.Context, snapshotID int64) ([]Finding, error) {
+	services, err := e.services.List(ctx, snapshotID, storage.ServiceListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	var findings []Finding
+	for _, svc := range services {
+		metrics, err := e.metrics.List(ctx, svc.ID, storage.MetricListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list metrics for %s: %w", svc.ServiceName, err)
+		}
+		for _, m := range metrics {
+			labels, err := e.labels.List(ctx, m.ID)
+			if err != nil {
+				return nil, fmt.Errorf("list labels for %s/%s: %w", svc.ServiceName, m.MetricName, err)
+			}
+			for _, l := range labels {
+				kind, examples, ok := e.classifier.Classify(l)
+				if !ok {
+					continue
+				}
+				findings = append(findings, Finding{
+					ServiceName:  svc.ServiceName,
+					MetricName:   m.MetricName,
+					LabelName:    l.LabelName,
+					Kind:         kind,
+					SeriesCount:  m.SeriesCount,
+					UniqueValues: l.UniqueValuesCount,
+					Examples:     examples,
+				})
+			}
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		if a.SeriesCount != b.SeriesCount {
+			return b.SeriesCount - a.SeriesCount
+		}
+		return b.UniqueValues - a.UniqueValues
+	})
+	return findings, nil
+}
@@ -0,0 +1,210 @@
+// Package rules finds label anti-patterns — IDs, UUIDs, URLs and the like —
+// in stored label samples without asking a model.
+package rules
+
+import (
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+)
+
+// Kind is the anti-pattern a label's values follow.
+type Kind string
+
+const (
+	KindEmail       Kind = "email"
+	KindURL         Kind = "url"
+	KindUUID        Kind = "uuid"
+	KindTimestamp   Kind = "timestamp"
+	KindNumericID   Kind = "numeric_id"
+	KindPrefixedID  Kind = "prefixed_id"
+	KindHighEntropy Kind = "high_entropy"
+	// KindRedacted labels had values scrubbed by a redaction rule, so they
+	// held whatever that rule matches.
+	KindRedacted Kind = "redacted"
+	// KindUnbounded labels follow no known pattern but have too many
+	// values to be an enum.
+	KindUnbounded Kind = "unbounded"
+)
+
+var kindDescriptions = map[Kind]string{
+	KindEmail:       "email addresses",
+	KindURL:         "URLs or paths with variable segments",
+	KindUUID:        "UUIDs",
+	KindTimestamp:   "timestamps",
+	KindNumericID:   "numeric IDs",
+	KindPrefixedID:  "prefixed IDs",
+	KindHighEntropy: "tokens or hashes",
+	KindRedacted:    "redacted identifiers",
+	KindUnbounded:   "unbounded values",
+}
+
+// Description names the kind for people, e.g. "numeric IDs".
+func (k Kind) Description() string {
+	if d, ok := kindDescriptions[k]; ok {
+		return d
+	}
+	return string(k)
+}
+
+// Finding is a label whose values follow an anti-pattern.
+type Finding struct {
+	ServiceName  string   `json:"service"`
+	MetricName   string   `json:"metric"`
+	LabelName    string   `json:"label"`
+	Kind         Kind     `json:"kind"`
+	SeriesCount  int      `json:"series_count"`
+	UniqueValues int      `json:"unique_values"`
+	Examples     []string `json:"examples,omitempty"`
+}
+
+const (
+	maxExamples = 3
+	// Values at least this long with this much entropy per character look
+	// like tokens or hashes rather than words.
+	minEntropyLength = 16
+	minEntropyBits   = 3.5
+)
+
+type pattern struct {
+	kind Kind
+	re   *regexp.Regexp
+}
+
+// Ordered so the more specific patterns win: a path holding a UUID is a
+// URL, and an epoch timestamp is not a numeric ID.
+var builtinPatterns = []pattern{
+	{KindEmail, regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)},
+	{KindURL, regexp.MustCompile(`^(https?://\S+|(/[^/\s]*)*/([0-9]{3,}|[0-9a-fA-F-]{16,})(/[^/\s]*)*)$`)},
+	{KindUUID, regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)},
+	{KindTimestamp, regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2})?\S*)?|1[0-9]{9}([0-9]{3})?)$`)},
+	{KindNumericID, regexp.MustCompile(`^[0-9]{6,}$`)},
+	{KindPrefixedID, regexp.MustCompile(`^[A-Za-z]{2,10}[_-][A-Za-z0-9]*[0-9][A-Za-z0-9]{2,}$`)},
+}
+
+// Classifier decides which anti-pattern, if any, a label's values follow.
+type Classifier struct {
+	patterns        []pattern
+	allowLabels     []string
+	minUniqueValues int
+	unboundedValues int
+	matchRatio      float64
+}
+
+// NewClassifier checks the configured patterns, named after their kind,
+// ahead of the built-in ones. Patterns are validated when the config is
+// loaded.
+func NewClassifier(cfg config.DetectionConfig) *Classifier {
+	patterns := make([]pattern, 0, len(cfg.Patterns)+len(builtinPatterns))
+	for _, p := range cfg.Patterns {
+		patterns = append(patterns, pattern{kind: Kind(p.Name), re: regexp.MustCompile(p.Regex)})
+	}
+	return &Classifier{
+		patterns:        append(patterns, builtinPatterns...),
+		allowLabels:     cfg.AllowLabels,
+		minUniqueValues: cfg.MinUniqueValues,
+		unboundedValues: cfg.UnboundedValues,
+		matchRatio:      cfg.MatchRatio,
+	}
+}
+
+// Classify returns the label's anti-pattern and a few values showing it.
+// Allowed labels and labels below the unique-value threshold are never
+// flagged.
+func (c *Classifier) Classify(label models.LabelSnapshot) (Kind, []string, bool) {
+	if label.UniqueValuesCount < c.minUniqueValues || c.allowed(label.LabelName) {
+		return "", nil, false
+	}
+	if len(label.Redacted) > 0 {
+		return KindRedacted, examples(label.SampleValues), true
+	}
+
+	counts := make(map[Kind]int)
+	matched := make(map[Kind][]string)
+	for _, v := range label.SampleValues {
+		kind, ok := c.classifyValue(v)
+		if !ok {
+			continue
+		}
+		counts[kind]++
+		if len(matched[kind]) < maxExamples {
+			matched[kind] = append(matched[kind], v)
+		}
+	}
+
+	// The most common kind wins, ties going to the earlier pattern.
+	var best Kind
+	for _, k := range c.kinds() {
+		if counts[k] > counts[best] {
+			best = k
+		}
+	}
+	if best != "" && float64(counts[best]) >= c.matchRatio*float64(len(label.SampleValues)) {
+		return best, matched[best], true
+	}
+	if label.UniqueValuesCount > c.unboundedValues {
+		return KindUnbounded, examples(label.SampleValues), true
+	}
+	return "", nil, false
+}
+
+func (c *Classifier) allowed(label string) bool {
+	for _, pattern := range c.allowLabels {
+		if ok, _ := path.Match(pattern, label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Classifier) classifyValue(v string) (Kind, bool) {
+	for _, p := range c.patterns {
+		if p.re.MatchString(v) {
+			return p.kind, true
+		}
+	}
+	if len(v) >= minEntropyLength && hasLetterAndDigit(v) && entropy(v) >= minEntropyBits {
+		return KindHighEntropy, true
+	}
+	return "", false
+}
+
+func (c *Classifier) kinds() []Kind {
+	kinds := make([]Kind, 0, len(c.patterns)+1)
+	for _, p := range c.patterns {
+		kinds = append(kinds, p.kind)
+	}
+	return append(kinds, KindHighEntropy)
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	freq := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		freq[r]++
+		n++
+	}
+	var bits float64
+	for _, count := range freq {
+		p := float64(count) / float64(n)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.IndexFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' }) >= 0
+}
+
+func examples(values []string) []string {
+	if len(values) > maxExamples {
+		values = values[:maxExamples]
+	}
+	return values
+}
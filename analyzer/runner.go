@@ -3,6 +3,7 @@ package analyzer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,14 +14,7 @@ import (
 func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previous *models.Snapshot) {
 	ctx := context.Background()
 
-	defer func() {
-		a.mu.Lock()
-		a.running = false
-		a.currentSnapshotID = 0
-		a.previousSnapshotID = 0
-		a.progress = ""
-		a.mu.Unlock()
-	}()
+	defer a.finishRun(analysis.CurrentSnapshotID, analysis.PreviousSnapshotID)
 
 	a.logger.Info("starting analysis",
 		"analysis_id", analysis.ID,
@@ -33,36 +27,62 @@ func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previ
 		a.logger.Error("failed to update analysis status to running", "error", err)
 	}
 
-	prompt, err := a.buildPrompt(ctx, current, previous)
+	suppressed, err := a.loadSuppressions(ctx)
+	if err != nil {
+		a.completeAnalysisWithError(ctx, analysis, err)
+		return
+	}
+
+	if a.client == nil {
+		a.updateProgress(analysis, "Running rule-based analysis")
+		result, findings, err := a.ruleAnalysis(ctx, analysis, current, previous, suppressed)
+		if err != nil {
+			a.logger.Error("rule-based analysis failed", "error", err)
+			a.completeAnalysisWithError(ctx, analysis, err)
+			return
+		}
+		a.completeAnalysis(ctx, analysis, result, findings)
+		return
+	}
+
+	prompt, err := a.buildPrompt(ctx, current, previous, suppressed)
 	if err != nil {
 		a.logger.Error("failed to build prompt", "error", err)
 		a.completeAnalysisWithError(ctx, analysis, err)
 		return
 	}
 
-	a.updateProgress("Calling Gemini API")
+	a.updateProgress(analysis, "Calling Gemini API")
+
+	// Repository updates keep using ctx so a timed-out analysis can still
+	// be marked failed.
+	genCtx, cancel := context.WithTimeout(ctx, a.geminiConfig.Timeout)
+	defer cancel()
 
 	temp := a.geminiConfig.Chat.Temperature
 	genaiConfig := &genai.GenerateContentConfig{
 		Temperature:     &temp,
 		MaxOutputTokens: a.geminiConfig.Chat.MaxOutputTokens,
-		Tools:           []*genai.Tool{getGenaiToolDefinitions()},
+		Tools:           []*genai.Tool{getGenaiToolDefinitions(a.toolExecutor.liveQueries())},
 	}
-	chatSession, err := a.client.Chats.Create(ctx, a.model, genaiConfig, nil)
+	chatSession, err := a.client.Chats.Create(genCtx, a.model, genaiConfig, nil)
 	if err != nil {
 		a.logger.Error("failed to create chat session", "error", err)
 		a.completeAnalysisWithError(ctx, analysis, err)
 		return
 	}
 
-	resp, err := chatSession.SendMessage(ctx, genai.Part{Text: prompt})
+	resp, err := a.send(genCtx, analysis, chatSession, genai.Part{Text: prompt})
 	if err != nil {
 		a.logger.Error("failed to send initial prompt to Gemini", "error", err)
-		a.completeAnalysisWithError(ctx, analysis, err)
+		a.completeAnalysisWithError(ctx, analysis, a.timeoutError(genCtx, err))
 		return
 	}
+	addUsage(analysis, resp)
 
-	for i := 0; i < maxAgenticIterations; i++ {
+	// Recorded findings don't count against the tool call budget.
+	var findings []models.Finding
+	for i := 0; ; i++ {
 		if resp.Candidates == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
 			err = fmt.Errorf("received an empty response from Gemini")
 			a.logger.Error("empty response", "error", err)
@@ -81,11 +101,34 @@ func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previ
 		if functionCall == nil {
 			break
 		}
+		if i-len(findings) == a.geminiConfig.MaxIterations {
+			// Out of budget: answer the pending call with a request to
+			// finish instead of running it.
+			a.logger.Warn("tool call budget exhausted", "max_iterations", a.geminiConfig.MaxIterations, "tool", functionCall.Name)
+			resp, err = a.send(genCtx, analysis, chatSession, genai.Part{
+				FunctionResponse: &genai.FunctionResponse{
+					Name:     functionCall.Name,
+					Response: map[string]any{"error": "tool call budget exhausted, write the final analysis now from the data gathered so far"},
+				},
+			})
+			if err != nil {
+				a.logger.Error("failed to send budget notice to Gemini", "error", err)
+				a.completeAnalysisWithError(ctx, analysis, a.timeoutError(genCtx, err))
+				return
+			}
+			addUsage(analysis, resp)
+			break
+		}
 
 		a.logger.Info("executing tool", "iteration", i+1, "tool", functionCall.Name, "args", functionCall.Args)
-		a.updateProgress(fmt.Sprintf("Executing tool: %s (iteration %d)", functionCall.Name, i+1))
+		a.updateProgress(analysis, fmt.Sprintf("Executing tool: %s (iteration %d)", functionCall.Name, i+1))
 
-		result, err := a.toolExecutor.Execute(ctx, functionCall.Name, functionCall.Args)
+		var result any
+		if functionCall.Name == reportFindingTool {
+			result, err = a.reportFinding(genCtx, analysis, &findings, suppressed, functionCall.Args)
+		} else {
+			result, err = a.toolExecutor.Execute(genCtx, functionCall.Name, functionCall.Args)
+		}
 		if err != nil {
 			a.logger.Error("tool execution failed", "tool", functionCall.Name, "error", err)
 			result = map[string]any{"error": err.Error()}
@@ -106,7 +149,7 @@ func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previ
 			a.logger.Error("failed to convert tool result to map", "error", err)
 			responseMap = map[string]any{"error": err.Error()}
 		}
-		resp, err = chatSession.SendMessage(ctx, genai.Part{
+		resp, err = a.send(genCtx, analysis, chatSession, genai.Part{
 			FunctionResponse: &genai.FunctionResponse{
 				Name:     functionCall.Name,
 				Response: responseMap,
@@ -114,12 +157,13 @@ func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previ
 		})
 		if err != nil {
 			a.logger.Error("failed to send tool result to Gemini", "error", err)
-			a.completeAnalysisWithError(ctx, analysis, err)
+			a.completeAnalysisWithError(ctx, analysis, a.timeoutError(genCtx, err))
 			return
 		}
+		addUsage(analysis, resp)
 	}
 
-	a.updateProgress("Generating final analysis")
+	a.updateProgress(analysis, "Generating final analysis")
 
 	var finalText string
 	if resp != nil && len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
@@ -148,22 +192,56 @@ func (a *Analyzer) runAnalysis(analysis *models.SnapshotAnalysis, current, previ
 		finalText = "No analysis generated."
 	}
 
+	a.completeAnalysis(ctx, analysis, finalText, findings)
+}
+
+func (a *Analyzer) completeAnalysis(ctx context.Context, analysis *models.SnapshotAnalysis, result string, findings []models.Finding) {
 	a.logger.Info("analysis completed",
 		"analysis_id", analysis.ID,
 		"tool_calls", len(analysis.ToolCalls),
+		"findings", len(findings),
+		"prompt_tokens", analysis.PromptTokens,
+		"response_tokens", analysis.ResponseTokens,
 	)
 
 	now := time.Now()
 	analysis.Status = models.AnalysisStatusCompleted
-	analysis.Result = finalText
+	analysis.Result = result
 	analysis.CompletedAt = &now
 
+	if err := a.findings.Replace(ctx, analysis.ID, findings); err != nil {
+		a.logger.Error("failed to store findings", "error", err)
+	}
+	if err := a.findings.Track(ctx, findings); err != nil {
+		a.logger.Error("failed to track findings", "error", err)
+	}
 	if err := a.analysisRepo.Update(ctx, analysis); err != nil {
 		a.logger.Error("failed to update analysis with final result", "error", err)
 		return
 	}
 
-	a.updateProgress("Completed")
+	a.updateProgress(analysis, "Completed")
+	a.publish(models.EventAnalysisFinished, analysis)
+}
+
+// timeoutError names the configured timeout when genCtx ran out, which is
+// clearer than the bare deadline error from the Gemini client.
+func (a *Analyzer) timeoutError(genCtx context.Context, err error) error {
+	if errors.Is(genCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("analysis timed out after %s: %w", a.geminiConfig.Timeout, err)
+	}
+	return err
+}
+
+// addUsage adds a response's token counts to the analysis. Each chat turn
+// resends the history, so prompt tokens grow with every tool call.
+func addUsage(analysis *models.SnapshotAnalysis, resp *genai.GenerateContentResponse) {
+	if resp == nil || resp.UsageMetadata == nil {
+		return
+	}
+	u := resp.UsageMetadata
+	analysis.PromptTokens += int64(u.PromptTokenCount) + int64(u.ToolUsePromptTokenCount)
+	analysis.ResponseTokens += int64(u.CandidatesTokenCount) + int64(u.ThoughtsTokenCount)
 }
 
 func toMap(v any) (map[string]any, error) {
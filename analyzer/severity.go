@@ -0,0 +1,169 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+// Severity is up to impactPoints for the metric's size, on a log scale that
+// peaks at 10k series, plus up to growthPoints for growth since the
+// previous snapshot, peaking at a doubling. New metrics get full growth
+// points.
+const (
+	impactPoints = 60
+	growthPoints = 40
+)
+
+// maxFindings caps report_finding calls per analysis.
+const maxFindings = 50
+
+func severityScore(series int, previous *int) int {
+	var impact float64
+	if series > 0 {
+		impact = min(impactPoints, impactPoints/4*math.Log10(float64(series)))
+	}
+
+	var growth float64
+	switch {
+	case previous == nil || *previous == 0:
+		if series > 0 {
+			growth = growthPoints
+		}
+	case series > *previous:
+		pct := float64(series-*previous) / float64(*previous) * 100
+		growth = min(growthPoints, pct/100*growthPoints)
+	}
+	return int(math.Round(impact + growth))
+}
+
+func severityLevel(score int) models.SeverityLevel {
+	switch {
+	case score >= 80:
+		return models.SeverityCritical
+	case score >= 60:
+		return models.SeverityHigh
+	case score >= 30:
+		return models.SeverityMedium
+	}
+	return models.SeverityLow
+}
+
+// ParseSeverity reads a minimum severity given as a score or a level name;
+// a level stands for the lowest score it covers.
+func ParseSeverity(s string) (int, error) {
+	switch models.SeverityLevel(s) {
+	case models.SeverityLow:
+		return 0, nil
+	case models.SeverityMedium:
+		return 30, nil
+	case models.SeverityHigh:
+		return 60, nil
+	case models.SeverityCritical:
+		return 80, nil
+	}
+	score, err := strconv.Atoi(s)
+	if err != nil || score < 0 || score > 100 {
+		return 0, fmt.Errorf("severity must be 0-100 or low, medium, high, critical")
+	}
+	return score, nil
+}
+
+// newFinding scores an issue with the metric's series count in both
+// snapshots.
+func (a *Analyzer) newFinding(ctx context.Context, analysis *models.SnapshotAnalysis, serviceName, metricName, labelName, kind, description string) (models.Finding, error) {
+	series, ok, err := a.metricSeries(ctx, analysis.CurrentSnapshotID, serviceName, metricName)
+	if err != nil {
+		return models.Finding{}, err
+	}
+	if !ok {
+		return models.Finding{}, fmt.Errorf("metric %q not found in service %q", metricName, serviceName)
+	}
+	var previous *int
+	prev, ok, err := a.metricSeries(ctx, analysis.PreviousSnapshotID, serviceName, metricName)
+	if err != nil {
+		return models.Finding{}, err
+	}
+	if ok {
+		previous = &prev
+	}
+
+	score := severityScore(series, previous)
+	return models.Finding{
+		AnalysisID:     analysis.ID,
+		SnapshotID:     analysis.CurrentSnapshotID,
+		ServiceName:    serviceName,
+		MetricName:     metricName,
+		LabelName:      labelName,
+		Kind:           kind,
+		Description:    description,
+		SeriesCount:    series,
+		PreviousSeries: previous,
+		Severity:       score,
+		Level:          severityLevel(score),
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+func (a *Analyzer) metricSeries(ctx context.Context, snapshotID int64, serviceName, metricName string) (int, bool, error) {
+	service, err := a.services.GetByName(ctx, snapshotID, serviceName)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get service: %w", err)
+	}
+	if service == nil {
+		return 0, false, nil
+	}
+	metric, err := a.metrics.GetByName(ctx, service.ID, metricName)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get metric: %w", err)
+	}
+	if metric == nil {
+		return 0, false, nil
+	}
+	return metric.SeriesCount, true, nil
+}
+
+// reportFinding handles the model's report_finding calls, which record a
+// finding instead of returning data.
+func (a *Analyzer) reportFinding(ctx context.Context, analysis *models.SnapshotAnalysis, findings *[]models.Finding, suppressed *suppressions, args map[string]any) (any, error) {
+	if len(*findings) >= maxFindings {
+		return nil, fmt.Errorf("at most %d findings can be reported", maxFindings)
+	}
+	serviceName, err := getStringArg(args, "service_name")
+	if err != nil {
+		return nil, err
+	}
+	metricName, err := getStringArg(args, "metric_name")
+	if err != nil {
+		return nil, err
+	}
+	kind, err := getStringArg(args, "kind")
+	if err != nil {
+		return nil, err
+	}
+	description, err := getStringArg(args, "description")
+	if err != nil {
+		return nil, err
+	}
+	var labelName string
+	if _, ok := args["label_name"]; ok {
+		if labelName, err = getStringArg(args, "label_name"); err != nil {
+			return nil, err
+		}
+	}
+
+	if suppressed.covers(serviceName, metricName, labelName, kind) {
+		return map[string]any{"recorded": false, "reason": "operators accepted this issue, leave it out of the analysis"}, nil
+	}
+
+	finding, err := a.newFinding(ctx, analysis, serviceName, metricName, labelName, kind, description)
+	if err != nil {
+		return nil, err
+	}
+	*findings = append(*findings, finding)
+	return map[string]any{"recorded": true, "severity": finding.Severity, "level": finding.Level}, nil
+}
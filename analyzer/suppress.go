@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// suppressions are the issues operators don't want reported: those
+// matching an ignore rule and snoozed findings.
+type suppressions struct {
+	ignores []models.IgnoreRule
+	snoozed []models.TrackedFinding
+}
+
+func (a *Analyzer) loadSuppressions(ctx context.Context) (*suppressions, error) {
+	ignores, err := a.findings.ListIgnores(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ignore rules: %w", err)
+	}
+	tracked, err := a.findings.ListTracked(ctx, storage.TrackedFindingListOptions{IncludeSuppressed: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list findings: %w", err)
+	}
+	s := &suppressions{ignores: ignores}
+	now := time.Now()
+	for _, f := range tracked {
+		if f.Snoozed(now) {
+			s.snoozed = append(s.snoozed, f)
+		}
+	}
+	return s, nil
+}
+
+func (s *suppressions) covers(service, metric, label, kind string) bool {
+	for _, rule := range s.ignores {
+		if rule.Matches(service, metric, label) {
+			return true
+		}
+	}
+	for _, f := range s.snoozed {
+		if f.ServiceName == service && f.MetricName == metric && f.LabelName == label && f.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// promptLines describes each suppression for the model.
+func (s *suppressions) promptLines() []string {
+	lines := make([]string, 0, len(s.ignores)+len(s.snoozed))
+	for _, rule := range s.ignores {
+		line := fmt.Sprintf("service %s, metric %s", rule.Service, rule.Metric)
+		if rule.Label != "" {
+			line += ", label " + rule.Label
+		}
+		if rule.Reason != "" {
+			line += " (" + rule.Reason + ")"
+		}
+		lines = append(lines, line)
+	}
+	for _, f := range s.snoozed {
+		line := fmt.Sprintf("service %s, metric %s", f.ServiceName, f.MetricName)
+		if f.LabelName != "" {
+			line += ", label " + f.LabelName
+		}
+		lines = append(lines, fmt.Sprintf("%s, %s (snoozed until %s)", line, f.Kind, f.SnoozedUntil.Format(time.DateOnly)))
+	}
+	return lines
+}
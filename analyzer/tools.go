@@ -4,21 +4,48 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/illenko/whodidthis/config"
 	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/prometheus"
 	"github.com/illenko/whodidthis/storage"
 )
 
+// maxLabelValues caps the values get_label_values returns.
+const maxLabelValues = 100
+
+// LabelValueCounter counts series per label value live; the Prometheus
+// client implements it.
+type LabelValueCounter interface {
+	TopLabelValues(ctx context.Context, serviceLabels []string, serviceName, metricName, label string, limit int) ([]prometheus.LabelValueCount, error)
+}
+
+// LiveQuerier runs instant queries; the Prometheus client implements it.
+type LiveQuerier interface {
+	InstantQuery(ctx context.Context, expr string) ([]prometheus.QuerySample, error)
+}
+
 type ToolExecutor struct {
-	services storage.ServicesRepo
-	metrics  storage.MetricsRepo
-	labels   storage.LabelsRepo
+	services      storage.ServicesRepo
+	metrics       storage.MetricsRepo
+	labels        storage.LabelsRepo
+	cost          config.CostConfig
+	counter       LabelValueCounter
+	querier       LiveQuerier
+	serviceLabels []string
 }
 
-func NewToolExecutor(services storage.ServicesRepo, metrics storage.MetricsRepo, labels storage.LabelsRepo) *ToolExecutor {
+// NewToolExecutor takes an optional counter; without one get_label_values
+// returns only the stored sample. The query_prometheus tool is only offered
+// with a querier.
+func NewToolExecutor(services storage.ServicesRepo, metrics storage.MetricsRepo, labels storage.LabelsRepo, cost config.CostConfig, counter LabelValueCounter, querier LiveQuerier, serviceLabels []string) *ToolExecutor {
 	return &ToolExecutor{
-		services: services,
-		metrics:  metrics,
-		labels:   labels,
+		services:      services,
+		metrics:       metrics,
+		labels:        labels,
+		cost:          cost,
+		counter:       counter,
+		querier:       querier,
+		serviceLabels: serviceLabels,
 	}
 }
 
@@ -30,6 +57,14 @@ func (e *ToolExecutor) Execute(ctx context.Context, toolName string, args map[st
 		return e.getMetricLabels(ctx, args)
 	case "compare_services":
 		return e.compareServices(ctx, args)
+	case "get_label_values":
+		return e.getLabelValues(ctx, args)
+	case "search_metrics":
+		return e.searchMetrics(ctx, args)
+	case "get_top_changes":
+		return e.getTopChanges(ctx, args)
+	case "query_prometheus":
+		return e.queryPrometheus(ctx, args)
 	default:
 		return nil, fmt.Errorf("unknown tool: %s", toolName)
 	}
@@ -40,6 +75,8 @@ type ServiceMetricsResult struct {
 	SnapshotID  int64                   `json:"snapshot_id"`
 	TotalSeries int                     `json:"total_series"`
 	MetricCount int                     `json:"metric_count"`
+	MonthlyCost *float64                `json:"monthly_cost,omitempty"`
+	Currency    string                  `json:"currency,omitempty"`
 	Metrics     []models.MetricSnapshot `json:"metrics"`
 }
 
@@ -71,16 +108,28 @@ func (e *ToolExecutor) getServiceMetrics(ctx context.Context, args map[string]an
 		SnapshotID:  snapshotID,
 		TotalSeries: service.TotalSeries,
 		MetricCount: service.MetricCount,
+		MonthlyCost: e.cost.MonthlyCostPtr(int64(service.TotalSeries)),
+		Currency:    e.currency(),
 		Metrics:     metrics,
 	}, nil
 }
 
 type MetricLabelsResult struct {
-	ServiceName string                 `json:"service_name"`
-	MetricName  string                 `json:"metric_name"`
-	SnapshotID  int64                  `json:"snapshot_id"`
-	SeriesCount int                    `json:"series_count"`
-	Labels      []models.LabelSnapshot `json:"labels"`
+	ServiceName     string   `json:"service_name"`
+	MetricName      string   `json:"metric_name"`
+	SnapshotID      int64    `json:"snapshot_id"`
+	SeriesCount     int      `json:"series_count"`
+	MetricType      string   `json:"metric_type,omitempty"`
+	NativeHistogram bool     `json:"native_histogram,omitempty"`
+	ExemplarCount   int      `json:"exemplar_count,omitempty"`
+	BucketCount     int      `json:"bucket_count,omitempty"`
+	SeriesPerBucket int      `json:"series_per_bucket,omitempty"`
+	MonthlyCost     *float64 `json:"monthly_cost,omitempty"`
+	Currency        string   `json:"currency,omitempty"`
+	// DropLabelSavings estimates the monthly saving of dropping each label,
+	// assuming series collapse evenly across its values.
+	DropLabelSavings map[string]float64     `json:"drop_label_savings,omitempty"`
+	Labels           []models.LabelSnapshot `json:"labels"`
 }
 
 func (e *ToolExecutor) getMetricLabels(ctx context.Context, args map[string]any) (*MetricLabelsResult, error) {
@@ -118,13 +167,289 @@ func (e *ToolExecutor) getMetricLabels(ctx context.Context, args map[string]any)
 		return nil, fmt.Errorf("failed to list labels: %w", err)
 	}
 
-	return &MetricLabelsResult{
-		ServiceName: serviceName,
-		MetricName:  metricName,
-		SnapshotID:  snapshotID,
-		SeriesCount: metric.SeriesCount,
-		Labels:      labels,
-	}, nil
+	result := &MetricLabelsResult{
+		ServiceName:     serviceName,
+		MetricName:      metricName,
+		SnapshotID:      snapshotID,
+		SeriesCount:     metric.SeriesCount,
+		MetricType:      metric.MetricType,
+		NativeHistogram: metric.NativeHistogram,
+		ExemplarCount:   metric.ExemplarCount,
+		MonthlyCost:     e.cost.MonthlyCostPtr(int64(metric.SeriesCount)),
+		Currency:        e.currency(),
+		Labels:          labels,
+	}
+
+	if e.cost.Enabled() {
+		result.DropLabelSavings = make(map[string]float64, len(labels))
+		for _, l := range labels {
+			if l.UniqueValuesCount > 1 {
+				remaining := int64(metric.SeriesCount / l.UniqueValuesCount)
+				result.DropLabelSavings[l.LabelName] = e.cost.MonthlyCost(int64(metric.SeriesCount) - remaining)
+			}
+		}
+	}
+
+	// For classic histograms the series count is label combinations times
+	// buckets, so report both factors separately.
+	if prometheus.IsClassicHistogramBucket(metricName, metric.MetricType) {
+		for _, l := range labels {
+			if l.LabelName == "le" && l.UniqueValuesCount > 0 {
+				result.BucketCount = l.UniqueValuesCount
+				result.SeriesPerBucket = metric.SeriesCount / l.UniqueValuesCount
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+type LabelValuesResult struct {
+	ServiceName  string `json:"service_name"`
+	MetricName   string `json:"metric_name"`
+	LabelName    string `json:"label_name"`
+	SnapshotID   int64  `json:"snapshot_id"`
+	UniqueValues int    `json:"unique_values"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	// StoredValues is the sample kept by the scan.
+	StoredValues []string `json:"stored_values"`
+	Redacted     []string `json:"redacted,omitempty"`
+	// LiveValues are the most common values in Prometheus now, with their
+	// series counts; they may differ from the snapshot.
+	LiveValues []prometheus.LabelValueCount `json:"live_values,omitempty"`
+	LiveError  string                       `json:"live_error,omitempty"`
+}
+
+func (e *ToolExecutor) getLabelValues(ctx context.Context, args map[string]any) (*LabelValuesResult, error) {
+	snapshotID, err := getInt64Arg(args, "snapshot_id")
+	if err != nil {
+		return nil, err
+	}
+	serviceName, err := getStringArg(args, "service_name")
+	if err != nil {
+		return nil, err
+	}
+	metricName, err := getStringArg(args, "metric_name")
+	if err != nil {
+		return nil, err
+	}
+	labelName, err := getStringArg(args, "label_name")
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := e.services.GetByName(ctx, snapshotID, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if service == nil {
+		return nil, fmt.Errorf("service %q not found in snapshot %d", serviceName, snapshotID)
+	}
+	metric, err := e.metrics.GetByName(ctx, service.ID, metricName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metric: %w", err)
+	}
+	if metric == nil {
+		return nil, fmt.Errorf("metric %q not found in service %q", metricName, serviceName)
+	}
+	label, err := e.labels.GetByName(ctx, metric.ID, labelName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get label: %w", err)
+	}
+	if label == nil {
+		return nil, fmt.Errorf("label %q not found on metric %q", labelName, metricName)
+	}
+
+	stored := label.SampleValues
+	if len(stored) > maxLabelValues {
+		stored = stored[:maxLabelValues]
+	}
+	result := &LabelValuesResult{
+		ServiceName:  serviceName,
+		MetricName:   metricName,
+		LabelName:    labelName,
+		SnapshotID:   snapshotID,
+		UniqueValues: label.UniqueValuesCount,
+		Truncated:    label.Truncated,
+		StoredValues: stored,
+		Redacted:     label.Redacted,
+	}
+
+	// Redacted values must not be fetched back in the clear.
+	if e.counter != nil && len(label.Redacted) == 0 {
+		live, err := e.counter.TopLabelValues(ctx, e.serviceLabels, serviceName, metricName, labelName, maxLabelValues)
+		if err != nil {
+			result.LiveError = err.Error()
+		} else {
+			result.LiveValues = live
+		}
+	}
+	return result, nil
+}
+
+// maxMetricMatches caps the matches search_metrics returns.
+const maxMetricMatches = 100
+
+type SearchMetricsResult struct {
+	SnapshotID int64  `json:"snapshot_id"`
+	Pattern    string `json:"pattern"`
+	// ServiceCount and TotalSeries sum up the returned matches.
+	ServiceCount int                `json:"service_count"`
+	TotalSeries  int                `json:"total_series"`
+	Matches      []models.TopMetric `json:"matches"`
+	// Truncated is set when there were more matches than returned.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func (e *ToolExecutor) searchMetrics(ctx context.Context, args map[string]any) (*SearchMetricsResult, error) {
+	snapshotID, err := getInt64Arg(args, "snapshot_id")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := getStringArg(args, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern must not be empty")
+	}
+
+	matches, err := e.metrics.Match(ctx, snapshotID, pattern, maxMetricMatches+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search metrics: %w", err)
+	}
+
+	result := &SearchMetricsResult{
+		SnapshotID: snapshotID,
+		Pattern:    pattern,
+		Matches:    []models.TopMetric{},
+	}
+	if len(matches) > maxMetricMatches {
+		matches = matches[:maxMetricMatches]
+		result.Truncated = true
+	}
+	services := make(map[string]bool)
+	for _, m := range matches {
+		services[m.ServiceName] = true
+		result.TotalSeries += m.SeriesCount
+		result.Matches = append(result.Matches, m)
+	}
+	result.ServiceCount = len(services)
+	return result, nil
+}
+
+// Bounds of get_top_changes' limit argument.
+const (
+	defaultTopChanges = 10
+	maxTopChanges     = 50
+)
+
+type TopChangesResult struct {
+	CurrentSnapshotID  int64 `json:"current_snapshot_id"`
+	PreviousSnapshotID int64 `json:"previous_snapshot_id"`
+	// Services and Metrics are the biggest absolute series changes,
+	// unchanged entries left out.
+	Services []models.ServiceDiff `json:"services"`
+	Metrics  []models.MetricDiff  `json:"metrics"`
+}
+
+func (e *ToolExecutor) getTopChanges(ctx context.Context, args map[string]any) (*TopChangesResult, error) {
+	currentSnapshotID, err := getInt64Arg(args, "current_snapshot_id")
+	if err != nil {
+		return nil, err
+	}
+	previousSnapshotID, err := getInt64Arg(args, "previous_snapshot_id")
+	if err != nil {
+		return nil, err
+	}
+	limit := defaultTopChanges
+	if _, ok := args["limit"]; ok {
+		n, err := getInt64Arg(args, "limit")
+		if err != nil {
+			return nil, err
+		}
+		limit = int(min(max(n, 1), maxTopChanges))
+	}
+
+	diffs, err := e.services.Diff(ctx, previousSnapshotID, currentSnapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff services: %w", err)
+	}
+	metrics, err := e.metrics.Changes(ctx, previousSnapshotID, currentSnapshotID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff metrics: %w", err)
+	}
+
+	result := &TopChangesResult{
+		CurrentSnapshotID:  currentSnapshotID,
+		PreviousSnapshotID: previousSnapshotID,
+		Services:           []models.ServiceDiff{},
+		Metrics:            []models.MetricDiff{},
+	}
+	// Diffs come biggest change first.
+	for _, d := range diffs {
+		if len(result.Services) == limit {
+			break
+		}
+		if d.Status != models.DiffUnchanged {
+			result.Services = append(result.Services, d)
+		}
+	}
+	result.Metrics = append(result.Metrics, metrics...)
+	return result, nil
+}
+
+// maxQuerySamples caps the series query_prometheus returns.
+const maxQuerySamples = 50
+
+type QueryPrometheusResult struct {
+	Query string `json:"query"`
+	// Samples come largest value first.
+	Samples []prometheus.QuerySample `json:"samples"`
+	// Truncated is set when the query returned more series than listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// queryPrometheus runs a count or topk query against live data, so its
+// results may postdate both snapshots.
+func (e *ToolExecutor) queryPrometheus(ctx context.Context, args map[string]any) (*QueryPrometheusResult, error) {
+	if e.querier == nil {
+		return nil, fmt.Errorf("query_prometheus is not enabled")
+	}
+	expr, err := getStringArg(args, "expr")
+	if err != nil {
+		return nil, err
+	}
+	if err := validateLiveQuery(expr, e.serviceLabels); err != nil {
+		return nil, fmt.Errorf("query not allowed: %w", err)
+	}
+
+	samples, err := e.querier.InstantQuery(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryPrometheusResult{
+		Query:   expr,
+		Samples: samples,
+	}
+	if len(samples) > maxQuerySamples {
+		result.Samples = samples[:maxQuerySamples]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// liveQueries reports whether query_prometheus is available.
+func (e *ToolExecutor) liveQueries() bool {
+	return e != nil && e.querier != nil
+}
+
+func (e *ToolExecutor) currency() string {
+	if !e.cost.Enabled() {
+		return ""
+	}
+	return e.cost.Currency
 }
 
 type CompareServicesResult struct {
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// auditBodyLimit caps how much of a request body is kept; snapshot imports
+// can be hundreds of MB.
+const auditBodyLimit = 4 << 10
+
+// withAudit records every mutating request once the handler has finished,
+// so the entry carries the final status.
+func withAudit(next http.Handler, repo storage.AuditRepo) http.Handler {
+	if repo == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := &capturingBody{ReadCloser: r.Body}
+		r.Body = body
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		entry := &models.AuditEntry{
+			CreatedAt:  time.Now(),
+			RequestID:  RequestID(r.Context()),
+			Actor:      auditActor(r),
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Body:       body.buf.String(),
+			Status:     sw.status,
+		}
+		// The request context may already have timed out.
+		if _, err := repo.Create(context.WithoutCancel(r.Context()), entry); err != nil {
+			slog.ErrorContext(r.Context(), "failed to write audit entry", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+	})
+}
+
+// auditActor fingerprints the Authorization header, so the token itself
+// never reaches the database. Nothing checks that header, so any client can
+// send any value: the fingerprint is labelled unverified and the remote
+// address, stored next to it, is what actually identifies the caller.
+func auditActor(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(auth))
+	return "unverified-token:" + hex.EncodeToString(sum[:6])
+}
+
+// capturingBody keeps the first auditBodyLimit bytes the handler reads.
+type capturingBody struct {
+	io.ReadCloser
+	buf bytes.Buffer
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := auditBodyLimit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
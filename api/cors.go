@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+const corsMaxAge = "600"
+
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	headers   string
+}
+
+// newCORSPolicy returns nil when no origin is allowed, which turns CORS
+// headers off entirely and leaves the API same-origin only.
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil
+	}
+	p := &corsPolicy{
+		origins: make(map[string]bool),
+		methods: strings.Join(cfg.AllowedMethods, ", "),
+		headers: strings.Join(cfg.AllowedHeaders, ", "),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		p.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return p
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	return p.anyOrigin || p.origins[strings.ToLower(origin)]
+}
+
+// apply sets the CORS response headers for r. It reports whether r was a
+// preflight request, which needs no further handling.
+func (p *corsPolicy) apply(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != ""
+
+	h := w.Header()
+	if !p.anyOrigin {
+		h.Add("Vary", "Origin")
+	}
+	if origin == "" || !p.allowed(origin) {
+		return preflight
+	}
+
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	h.Set("Access-Control-Expose-Headers", requestIDHeader)
+
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", p.methods)
+		h.Set("Access-Control-Allow-Headers", p.headers)
+		h.Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	return preflight
+}
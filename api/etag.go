@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// etagPrefix selects the routes that get ETags. Snapshot data rarely
+// changes once written, but a single-service rescan can still rewrite it,
+// so clients must revalidate rather than cache blindly.
+const etagPrefix = "/api/scans"
+
+// etagged reports whether a request gets an ETag. Snapshot exports are left
+// out: they can be large, and buffering them whole to hash them would hold
+// the full download in memory.
+func etagged(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		strings.HasPrefix(r.URL.Path, etagPrefix) &&
+		!strings.HasSuffix(r.URL.Path, "/export")
+}
+
+// withETag buffers successful GET responses under etagPrefix, tags them
+// with a hash of the body and answers matching If-None-Match requests with
+// 304. The tag is weak because the same body may be sent with different
+// Content-Encodings.
+func withETag(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !etagged(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+
+		if bw.status != http.StatusOK {
+			w.WriteHeader(bw.status)
+			w.Write(bw.body.Bytes())
+			return
+		}
+
+		h := fnv.New128a()
+		h.Write(bw.body.Bytes())
+		etag := `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`
+
+		w.Header().Set("ETag", etag)
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			for _, k := range []string{"Content-Type", "Content-Length", "Content-Disposition"} {
+				w.Header().Del(k)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(bw.body.Bytes())
+	})
+}
+
+// etagMatches does the weak comparison If-None-Match calls for.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds the whole response so it can be hashed before any
+// of it is sent. Headers still go straight to the underlying writer.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
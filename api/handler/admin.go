@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/illenko/whodidthis/export"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type AdminHandler struct {
+	backup    *export.BackupJob
+	auditRepo storage.AuditRepo
+}
+
+func NewAdminHandler(backup *export.BackupJob, auditRepo storage.AuditRepo) *AdminHandler {
+	return &AdminHandler{backup: backup, auditRepo: auditRepo}
+}
+
+func (a *AdminHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	if a.backup == nil {
+		writeError(w, http.StatusServiceUnavailable, "backups not configured")
+		return
+	}
+
+	// A client giving up shouldn't abort a backup halfway through.
+	result, err := a.backup.Run(context.WithoutCancel(r.Context()))
+	if errors.Is(err, export.ErrBackupRunning) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "backup failed", "error", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.InfoContext(r.Context(), "backup completed", "location", result.Location, "size_bytes", result.SizeBytes)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	limit := parseIntParam(r, "limit", 100)
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	entries, err := a.auditRepo.List(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
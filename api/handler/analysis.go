@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/illenko/whodidthis/analyzer"
 	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/report"
 )
 
 type AnalysisHandler struct {
@@ -21,7 +25,7 @@ func NewAnalysisHandler(analyzer *analyzer.Analyzer) *AnalysisHandler {
 
 func (a *AnalysisHandler) Start(w http.ResponseWriter, r *http.Request) {
 	if a.analyzer == nil {
-		writeError(w, http.StatusServiceUnavailable, "analysis not configured (missing Gemini API key)")
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
 		return
 	}
 
@@ -49,7 +53,7 @@ func (a *AnalysisHandler) Start(w http.ResponseWriter, r *http.Request) {
 
 func (a *AnalysisHandler) Get(w http.ResponseWriter, r *http.Request) {
 	if a.analyzer == nil {
-		writeError(w, http.StatusServiceUnavailable, "analysis not configured (missing Gemini API key)")
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
 		return
 	}
 
@@ -74,12 +78,22 @@ func (a *AnalysisHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("format") == "markdown" {
+		var buf bytes.Buffer
+		if err := report.WriteAnalysisMarkdown(&buf, analysis); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeDocument(w, markdownContentType, buf.Bytes())
+		return
+	}
+
 	writeJSON(w, http.StatusOK, analysis)
 }
 
 func (a *AnalysisHandler) ListBySnapshot(w http.ResponseWriter, r *http.Request) {
 	if a.analyzer == nil {
-		writeError(w, http.StatusServiceUnavailable, "analysis not configured (missing Gemini API key)")
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
 		return
 	}
 
@@ -104,7 +118,7 @@ func (a *AnalysisHandler) ListBySnapshot(w http.ResponseWriter, r *http.Request)
 
 func (a *AnalysisHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	if a.analyzer == nil {
-		writeError(w, http.StatusServiceUnavailable, "analysis not configured (missing Gemini API key)")
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
 		return
 	}
 
@@ -127,9 +141,69 @@ func (a *AnalysisHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+type AnalysisCostResponse struct {
+	Since          time.Time              `json:"since"`
+	Months         []models.AnalysisUsage `json:"months"`
+	Analyses       int                    `json:"analyses"`
+	PromptTokens   int64                  `json:"prompt_tokens"`
+	ResponseTokens int64                  `json:"response_tokens"`
+	// Cost is in USD; nil when no Gemini pricing is configured.
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// Cost sums Gemini token usage per month over the last ?months= calendar
+// months (default 12), this one included.
+func (a *AnalysisHandler) Cost(w http.ResponseWriter, r *http.Request) {
+	if a.analyzer == nil {
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
+		return
+	}
+
+	months := 12
+	if param := r.URL.Query().Get("months"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid months parameter")
+			return
+		}
+		months = n
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, now.Location())
+
+	usage, err := a.analyzer.Usage(r.Context(), since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := AnalysisCostResponse{
+		Since:  since,
+		Months: make([]models.AnalysisUsage, 0, len(usage)),
+	}
+	var total float64
+	priced := false
+	for _, u := range usage {
+		resp.Months = append(resp.Months, u)
+		resp.Analyses += u.Analyses
+		resp.PromptTokens += u.PromptTokens
+		resp.ResponseTokens += u.ResponseTokens
+		if u.Cost != nil {
+			total += *u.Cost
+			priced = true
+		}
+	}
+	if priced {
+		total = math.Round(total*100) / 100
+		resp.Cost = &total
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (a *AnalysisHandler) GetStatus(w http.ResponseWriter, _ *http.Request) {
 	if a.analyzer == nil {
-		writeError(w, http.StatusServiceUnavailable, "analysis not configured (missing Gemini API key)")
+		writeError(w, http.StatusServiceUnavailable, "analysis not configured")
 		return
 	}
 
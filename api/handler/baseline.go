@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/illenko/whodidthis/drift"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type BaselineHandler struct {
+	snapshots   storage.SnapshotsRepo
+	regressions storage.RegressionsRepo
+	detector    *drift.Detector
+}
+
+func NewBaselineHandler(snapshots storage.SnapshotsRepo, regressions storage.RegressionsRepo, detector *drift.Detector) *BaselineHandler {
+	return &BaselineHandler{
+		snapshots:   snapshots,
+		regressions: regressions,
+		detector:    detector,
+	}
+}
+
+type BaselineResponse struct {
+	Baseline *models.Snapshot `json:"baseline"`
+	// Current is the latest snapshot, with its drift from the baseline.
+	Current     *models.Snapshot    `json:"current,omitempty"`
+	SeriesDelta int64               `json:"series_delta"`
+	Regressions []models.Regression `json:"regressions"`
+}
+
+// Set makes the scan the baseline; later scans record their regressions
+// against it.
+func (h *BaselineHandler) Set(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	ok, err := h.snapshots.SetBaseline(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+
+	h.Get(w, r)
+}
+
+func (h *BaselineHandler) Clear(w http.ResponseWriter, r *http.Request) {
+	if err := h.snapshots.ClearBaseline(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+}
+
+// Get returns the baseline and how the latest scan drifted from it,
+// worked out now with the current thresholds.
+func (h *BaselineHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	resp := BaselineResponse{Regressions: []models.Regression{}}
+
+	baseline, err := h.snapshots.GetBaseline(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if baseline == nil {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	resp.Baseline = baseline
+
+	latest, err := h.snapshots.GetLatest(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if latest != nil && latest.ID != baseline.ID {
+		regressions, err := h.detector.Detect(ctx, baseline.ID, latest.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.Current = latest
+		resp.SeriesDelta = latest.TotalSeries - baseline.TotalSeries
+		if regressions != nil {
+			resp.Regressions = regressions
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Regressions lists what the scan recorded against the baseline when it
+// ran.
+func (h *BaselineHandler) Regressions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	regressions, err := h.regressions.List(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if regressions == nil {
+		regressions = []models.Regression{}
+	}
+
+	writeJSON(w, http.StatusOK, regressions)
+}
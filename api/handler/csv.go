@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+// wantsCSV reports whether the client asked for ?format=csv.
+func wantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv"
+}
+
+func writeCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		slog.Error("failed to write csv header", "error", err)
+		return
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		slog.Error("failed to write csv rows", "error", err)
+	}
+}
+
+func servicesCSV(services []models.ServiceSnapshot) ([]string, [][]string) {
+	header := []string{"service", "environment", "team", "total_series", "metric_count"}
+	rows := make([][]string, 0, len(services))
+	for _, s := range services {
+		rows = append(rows, []string{
+			s.ServiceName,
+			s.Environment,
+			s.Team,
+			strconv.Itoa(s.TotalSeries),
+			strconv.Itoa(s.MetricCount),
+		})
+	}
+	return header, rows
+}
+
+func metricsCSV(service string, metrics []models.MetricSnapshot) ([]string, [][]string) {
+	header := []string{"service", "metric", "type", "series_count", "label_count", "unit", "help"}
+	rows := make([][]string, 0, len(metrics))
+	for _, m := range metrics {
+		rows = append(rows, []string{
+			service,
+			m.MetricName,
+			m.MetricType,
+			strconv.Itoa(m.SeriesCount),
+			strconv.Itoa(m.LabelCount),
+			m.Unit,
+			m.Help,
+		})
+	}
+	return header, rows
+}
+
+// Sample values are joined with "|" to keep one row per label.
+func labelsCSV(service, metric string, labels []models.LabelSnapshot) ([]string, [][]string) {
+	header := []string{"service", "metric", "label", "unique_values", "truncated", "sample_values"}
+	rows := make([][]string, 0, len(labels))
+	for _, l := range labels {
+		rows = append(rows, []string{
+			service,
+			metric,
+			l.LabelName,
+			strconv.Itoa(l.UniqueValuesCount),
+			strconv.FormatBool(l.Truncated),
+			strings.Join(l.SampleValues, "|"),
+		})
+	}
+	return header, rows
+}
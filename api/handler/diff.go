@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type DiffHandler struct {
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+}
+
+func NewDiffHandler(snapshots storage.SnapshotsRepo, services storage.ServicesRepo) *DiffHandler {
+	return &DiffHandler{
+		snapshots: snapshots,
+		services:  services,
+	}
+}
+
+type DiffResponse struct {
+	Current     models.Snapshot      `json:"current"`
+	Previous    models.Snapshot      `json:"previous"`
+	SeriesDelta int64                `json:"series_delta"`
+	Services    []models.ServiceDiff `json:"services"`
+}
+
+// Diff compares the snapshots nearest ?current_date= and ?previous_date=
+// (YYYY-MM-DD or RFC 3339). The current date defaults to the latest
+// snapshot and the previous one to the snapshot before it; ?team= keeps
+// one team's services.
+func (h *DiffHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	var current *models.Snapshot
+	if param := q.Get("current_date"); param != "" {
+		date, ok := parseDate(param)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid current_date, expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+		snap, err := h.snapshots.GetNearest(ctx, date)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		current = snap
+	} else {
+		snap, err := h.snapshots.GetLatest(ctx)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		current = snap
+	}
+	if current == nil {
+		writeError(w, http.StatusNotFound, "no snapshots")
+		return
+	}
+
+	var previous *models.Snapshot
+	var err error
+	if param := q.Get("previous_date"); param != "" {
+		date, ok := parseDate(param)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid previous_date, expected YYYY-MM-DD or RFC 3339")
+			return
+		}
+		previous, err = h.snapshots.GetNearest(ctx, date)
+	} else {
+		previous, err = h.snapshots.GetPrevious(ctx, current.ID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if previous == nil {
+		writeError(w, http.StatusNotFound, "no snapshot to compare with")
+		return
+	}
+
+	diffs, err := h.services.Diff(ctx, previous.ID, current.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := DiffResponse{
+		Current:     *current,
+		Previous:    *previous,
+		SeriesDelta: current.TotalSeries - previous.TotalSeries,
+		Services:    make([]models.ServiceDiff, 0, len(diffs)),
+	}
+	// A team's delta is the sum over its services rather than the totals.
+	team := q.Get("team")
+	if team != "" {
+		resp.SeriesDelta = 0
+	}
+	for _, d := range diffs {
+		if team == "" || d.Team == team {
+			resp.Services = append(resp.Services, d)
+			if team != "" {
+				resp.SeriesDelta += int64(d.SeriesDelta)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseDate reads a day (taken as midnight UTC) or a full timestamp.
+func parseDate(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
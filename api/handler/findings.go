@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/analyzer"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+	"github.com/illenko/whodidthis/ticket"
+)
+
+type FindingsHandler struct {
+	findings storage.FindingsRepo
+	drafter  *ticket.Drafter
+	// tracker opens tickets (Jira) and issues opens them in the owning
+	// team's repository; either is nil when not configured.
+	tracker ticket.Tracker
+	issues  ticket.Tracker
+}
+
+func NewFindingsHandler(findings storage.FindingsRepo, drafter *ticket.Drafter, tracker, issues ticket.Tracker) *FindingsHandler {
+	return &FindingsHandler{
+		findings: findings,
+		drafter:  drafter,
+		tracker:  tracker,
+		issues:   issues,
+	}
+}
+
+// List returns the tracked findings, open ones first, then most severe.
+// ?state= takes a comma-separated list of open, acknowledged and resolved,
+// or all, and defaults to the unresolved ones. ?service= and
+// ?min_severity= narrow it down; ?suppressed=true adds snoozed and ignored
+// findings.
+func (h *FindingsHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	opts := storage.TrackedFindingListOptions{
+		Service:           q.Get("service"),
+		IncludeSuppressed: q.Get("suppressed") == "true",
+	}
+	if param := q.Get("state"); param == "all" {
+		opts.States = []models.FindingState{models.FindingOpen, models.FindingAcknowledged, models.FindingResolved}
+	} else if param != "" {
+		for _, s := range strings.Split(param, ",") {
+			state := models.FindingState(strings.TrimSpace(s))
+			switch state {
+			case models.FindingOpen, models.FindingAcknowledged, models.FindingResolved:
+				opts.States = append(opts.States, state)
+			default:
+				writeError(w, http.StatusBadRequest, "invalid state: "+string(state))
+				return
+			}
+		}
+	}
+	score, ok := minSeverity(w, r)
+	if !ok {
+		return
+	}
+	opts.MinSeverity = score
+
+	findings, err := h.findings.ListTracked(r.Context(), opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if findings == nil {
+		findings = []models.TrackedFinding{}
+	}
+
+	writeJSON(w, http.StatusOK, findings)
+}
+
+func (h *FindingsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid finding id")
+		return
+	}
+
+	finding, err := h.findings.GetTracked(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if finding == nil {
+		writeError(w, http.StatusNotFound, "finding not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, finding)
+}
+
+// Acknowledge takes a JSON body with an optional comment and assignee.
+// Resolved findings can't be acknowledged; they reopen on their own when
+// an analysis reports them again.
+func (h *FindingsHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid finding id")
+		return
+	}
+
+	var req struct {
+		Comment  string `json:"comment"`
+		Assignee string `json:"assignee"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ok, err := h.findings.Acknowledge(r.Context(), id, strings.TrimSpace(req.Comment), strings.TrimSpace(req.Assignee), time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		finding, err := h.findings.GetTracked(r.Context(), id)
+		switch {
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		case finding == nil:
+			writeError(w, http.StatusNotFound, "finding not found")
+		default:
+			writeError(w, http.StatusConflict, "finding is resolved")
+		}
+		return
+	}
+
+	h.Get(w, r)
+}
+
+// Ticket opens a Jira ticket for a finding, pre-filled with the metric,
+// label samples, estimated impact and a suggested fix, and links it back
+// to the finding. A finding gets at most one ticket or issue.
+func (h *FindingsHandler) Ticket(w http.ResponseWriter, r *http.Request) {
+	if h.tracker == nil {
+		writeError(w, http.StatusServiceUnavailable, "no issue tracker configured")
+		return
+	}
+	h.openTicket(w, r, h.tracker)
+}
+
+// Issue is Ticket for a GitHub or GitLab issue in the repository of the
+// team owning the finding's service.
+func (h *FindingsHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	if h.issues == nil {
+		writeError(w, http.StatusServiceUnavailable, "no team repositories configured")
+		return
+	}
+	h.openTicket(w, r, h.issues)
+}
+
+func (h *FindingsHandler) openTicket(w http.ResponseWriter, r *http.Request, tracker ticket.Tracker) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid finding id")
+		return
+	}
+
+	ctx := r.Context()
+	finding, err := h.findings.GetTracked(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if finding == nil {
+		writeError(w, http.StatusNotFound, "finding not found")
+		return
+	}
+	if finding.TicketKey != "" {
+		writeError(w, http.StatusConflict, "finding already has ticket "+finding.TicketKey)
+		return
+	}
+	// Reserve the finding first: of two concurrent requests only one may
+	// open a ticket.
+	reserved, err := h.findings.ReserveTicket(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !reserved {
+		writeError(w, http.StatusConflict, "a ticket is already being opened for this finding")
+		return
+	}
+
+	t, status, err := h.createTicket(ctx, tracker, *finding)
+	if err != nil {
+		if err := h.findings.ReleaseTicket(context.WithoutCancel(ctx), id); err != nil {
+			slog.ErrorContext(ctx, "failed to release ticket reservation", "finding_id", id, "error", err)
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	if _, err := h.findings.SetTicket(ctx, id, t.Key, t.URL); err != nil {
+		writeError(w, http.StatusInternalServerError, "ticket "+t.Key+" created but not linked: "+err.Error())
+		return
+	}
+
+	h.Get(w, r)
+}
+
+// createTicket drafts and opens the ticket, returning the status to answer
+// with when it fails.
+func (h *FindingsHandler) createTicket(ctx context.Context, tracker ticket.Tracker, finding models.TrackedFinding) (*ticket.Ticket, int, error) {
+	draft, err := h.drafter.Draft(ctx, finding)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	t, err := tracker.Create(ctx, draft)
+	if errors.Is(err, ticket.ErrNoRepository) {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	return t, 0, nil
+}
+
+// Snooze hides a finding until ?until=, a date or an RFC 3339 timestamp.
+func (h *FindingsHandler) Snooze(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid finding id")
+		return
+	}
+	until, ok := parseDate(r.URL.Query().Get("until"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "until must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		return
+	}
+	if !until.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "until must be in the future")
+		return
+	}
+
+	h.snooze(w, r, id, &until)
+}
+
+// Unsnooze shows a snoozed finding again.
+func (h *FindingsHandler) Unsnooze(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid finding id")
+		return
+	}
+
+	h.snooze(w, r, id, nil)
+}
+
+func (h *FindingsHandler) snooze(w http.ResponseWriter, r *http.Request, id int64, until *time.Time) {
+	ok, err := h.findings.Snooze(r.Context(), id, until)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "finding not found")
+		return
+	}
+
+	h.Get(w, r)
+}
+
+// Ignores lists the ignore rules.
+func (h *FindingsHandler) Ignores(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.findings.ListIgnores(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if rules == nil {
+		rules = []models.IgnoreRule{}
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// CreateIgnore adds an ignore rule from a JSON body with metric and
+// optionally service, label and reason. Service defaults to every service
+// and an empty label ignores the whole metric.
+func (h *FindingsHandler) CreateIgnore(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Service string `json:"service"`
+		Metric  string `json:"metric"`
+		Label   string `json:"label"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rule := models.IgnoreRule{
+		Service:   strings.TrimSpace(req.Service),
+		Metric:    strings.TrimSpace(req.Metric),
+		Label:     strings.TrimSpace(req.Label),
+		Reason:    strings.TrimSpace(req.Reason),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if rule.Service == "" {
+		rule.Service = "*"
+	}
+	if rule.Metric == "" {
+		writeError(w, http.StatusBadRequest, "metric is required")
+		return
+	}
+	for _, pattern := range []string{rule.Service, rule.Metric, rule.Label} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid pattern: "+pattern)
+			return
+		}
+	}
+
+	id, err := h.findings.CreateIgnore(r.Context(), &rule)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rule.ID = id
+
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *FindingsHandler) DeleteIgnore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid ignore rule id")
+		return
+	}
+
+	ok, err := h.findings.DeleteIgnore(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "ignore rule not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// Analysis returns the findings of the latest completed analysis, or of
+// ?analysis_id=, most severe first.
+func (h *FindingsHandler) Analysis(w http.ResponseWriter, r *http.Request) {
+	var opts storage.FindingListOptions
+	if param := r.URL.Query().Get("analysis_id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid analysis_id")
+			return
+		}
+		opts.AnalysisID = id
+	}
+	score, ok := minSeverity(w, r)
+	if !ok {
+		return
+	}
+	opts.MinSeverity = score
+
+	findings, err := h.findings.List(r.Context(), opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if findings == nil {
+		findings = []models.Finding{}
+	}
+
+	writeJSON(w, http.StatusOK, findings)
+}
+
+// minSeverity parses ?min_severity=, a score (0-100) or a level: low,
+// medium, high, critical. It writes the error response itself.
+func minSeverity(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("min_severity")
+	if param == "" {
+		return 0, true
+	}
+	score, err := analyzer.ParseSeverity(param)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	return score, true
+}
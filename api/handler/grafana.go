@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// Grafana targets: the total, one service or one team over time, or the
+// latest per-team rollup as a table. The team "-" is the services without
+// one.
+const (
+	grafanaTotal         = "total"
+	grafanaTeams         = "teams"
+	grafanaServicePrefix = "service:"
+	grafanaTeamPrefix    = "team:"
+)
+
+// GrafanaHandler speaks the protocol of Grafana's JSON datasource plugins
+// (simpod-json-datasource and the older SimpleJSON), so dashboards can be
+// built on whodidthis data. The Infinity datasource can read the plain
+// trend endpoints instead.
+type GrafanaHandler struct {
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+}
+
+func NewGrafanaHandler(snapshots storage.SnapshotsRepo, services storage.ServicesRepo) *GrafanaHandler {
+	return &GrafanaHandler{
+		snapshots: snapshots,
+		services:  services,
+	}
+}
+
+// Test is the datasource's connection check.
+func (h *GrafanaHandler) Test(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Search lists the targets, optionally those containing {"target"}, as
+// SimpleJSON expects.
+func (h *GrafanaHandler) Search(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if !decodeGrafana(w, r, &req) {
+		return
+	}
+
+	targets, err := h.targets(r.Context(), req.Target)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// Metrics lists the targets as label/value pairs, as the JSON datasource
+// expects.
+func (h *GrafanaHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Metric string `json:"metric"`
+	}
+	if !decodeGrafana(w, r, &req) {
+		return
+	}
+
+	targets, err := h.targets(r.Context(), req.Metric)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type metric struct {
+		Label string `json:"label"`
+		Value string `json:"value"`
+	}
+	metrics := make([]metric, len(targets))
+	for i, t := range targets {
+		metrics[i] = metric{Label: t, Value: t}
+	}
+
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+type grafanaSeries struct {
+	Target string `json:"target"`
+	// Datapoints are [value, unix milliseconds] pairs.
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// Query answers every target of the request over its time range, one
+// point per scan.
+func (h *GrafanaHandler) Query(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Range struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		} `json:"range"`
+		Targets []struct {
+			Target string `json:"target"`
+			Hide   bool   `json:"hide"`
+		} `json:"targets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	from, to := req.Range.From, req.Range.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	// Grafana sends UTC; scan times are stored, and compared, as local time.
+	from = from.Local()
+
+	results := make([]any, 0, len(req.Targets))
+	for _, t := range req.Targets {
+		if t.Hide || t.Target == "" {
+			continue
+		}
+		if t.Target == grafanaTeams {
+			table, err := h.teamsTable(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			results = append(results, table)
+			continue
+		}
+
+		points, err := h.trend(r.Context(), t.Target, from)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		series := grafanaSeries{Target: t.Target, Datapoints: [][2]float64{}}
+		for _, p := range points {
+			if p.CollectedAt.After(to) {
+				break
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{float64(p.Series), float64(p.CollectedAt.UnixMilli())})
+		}
+		results = append(results, series)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (h *GrafanaHandler) trend(ctx context.Context, target string, since time.Time) ([]models.TrendPoint, error) {
+	switch {
+	case target == grafanaTotal:
+		return h.snapshots.Trend(ctx, since)
+	case strings.HasPrefix(target, grafanaServicePrefix):
+		return h.services.Trend(ctx, strings.TrimPrefix(target, grafanaServicePrefix), since)
+	case strings.HasPrefix(target, grafanaTeamPrefix):
+		team := strings.TrimPrefix(target, grafanaTeamPrefix)
+		if team == "-" {
+			team = ""
+		}
+		return h.services.TeamTrend(ctx, team, since)
+	default:
+		return nil, fmt.Errorf("unknown target %q", target)
+	}
+}
+
+func (h *GrafanaHandler) teamsTable(ctx context.Context) (*grafanaTable, error) {
+	table := &grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{Text: "Team", Type: "string"},
+			{Text: "Services", Type: "number"},
+			{Text: "Series", Type: "number"},
+			{Text: "Metrics", Type: "number"},
+		},
+		Rows: [][]any{},
+	}
+
+	latest, err := h.snapshots.GetLatest(ctx)
+	if err != nil || latest == nil {
+		return table, err
+	}
+	teams, err := h.services.ListTeams(ctx, latest.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range teams {
+		name := t.Team
+		if name == "" {
+			name = "-"
+		}
+		table.Rows = append(table.Rows, []any{name, t.ServiceCount, t.TotalSeries, t.MetricCount})
+	}
+	return table, nil
+}
+
+// targets lists the total, the teams table and every team and service in
+// the latest scan, keeping those containing filter.
+func (h *GrafanaHandler) targets(ctx context.Context, filter string) ([]string, error) {
+	targets := []string{grafanaTotal, grafanaTeams}
+
+	latest, err := h.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		teams, err := h.services.ListTeams(ctx, latest.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			name := t.Team
+			if name == "" {
+				name = "-"
+			}
+			targets = append(targets, grafanaTeamPrefix+name)
+		}
+		services, err := h.services.List(ctx, latest.ID, storage.ServiceListOptions{Sort: "name", Order: "asc"})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range services {
+			targets = append(targets, grafanaServicePrefix+s.ServiceName)
+		}
+	}
+
+	if filter == "" {
+		return targets, nil
+	}
+	matched := []string{}
+	for _, t := range targets {
+		if strings.Contains(t, filter) {
+			matched = append(matched, t)
+		}
+	}
+	return matched, nil
+}
+
+// decodeGrafana reads an optional JSON body; the plugins send none on some
+// versions.
+func decodeGrafana(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
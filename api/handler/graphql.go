@@ -0,0 +1,466 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+const maxGraphQLBody = 1 << 20
+
+// The API is unauthenticated, so queries are bounded before they run: by
+// nesting depth, and by complexity, the number of fields they may resolve
+// when every list is as long as its limit allows. Lists without a limit
+// argument count as graphQLDefaultFanout items.
+const (
+	maxGraphQLDepth      = 6
+	maxGraphQLComplexity = 50000
+	maxGraphQLScans      = 100
+	defaultGraphQLScans  = 30
+	graphQLDefaultFanout = 100
+)
+
+// GraphQLHandler serves the snapshot → service → metric → labels tree as a
+// read-only GraphQL schema, so clients can fetch it in one round trip.
+// Fields without a resolver are read straight off the models structs.
+type GraphQLHandler struct {
+	schema graphql.Schema
+}
+
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+func NewGraphQLHandler(
+	snapshotsRepo storage.SnapshotsRepo,
+	servicesRepo storage.ServicesRepo,
+	metricsRepo storage.MetricsRepo,
+	labelsRepo storage.LabelsRepo,
+) (*GraphQLHandler, error) {
+	labelType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Label",
+		Fields: graphql.Fields{
+			"name":              &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"uniqueValuesCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"sampleValues":      &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"redacted":          &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"truncated":         &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	metricType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Metric",
+		Fields: graphql.Fields{
+			"name":            &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"seriesCount":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"labelCount":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"type":            &graphql.Field{Type: graphql.String},
+			"help":            &graphql.Field{Type: graphql.String},
+			"unit":            &graphql.Field{Type: graphql.String},
+			"nativeHistogram": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"exemplarCount":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"labels": &graphql.Field{
+				Type: graphql.NewList(graphql.NewNonNull(labelType)),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					m := p.Source.(*models.MetricSnapshot)
+					labels, err := labelsRepo.List(p.Context, m.ID)
+					if err != nil {
+						return nil, err
+					}
+					return pointers(labels), nil
+				},
+			},
+		},
+	})
+
+	serviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Service",
+		Fields: graphql.Fields{
+			"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"environment": &graphql.Field{Type: graphql.String},
+			"team":        &graphql.Field{Type: graphql.String},
+			"totalSeries": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"metricCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"missing":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"metrics": &graphql.Field{
+				Type: graphql.NewList(graphql.NewNonNull(metricType)),
+				Args: graphql.FieldConfigArgument{
+					"sort":  &graphql.ArgumentConfig{Type: graphql.String},
+					"order": &graphql.ArgumentConfig{Type: graphql.String},
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := p.Source.(*models.ServiceSnapshot)
+					sort, _ := p.Args["sort"].(string)
+					order, _ := p.Args["order"].(string)
+					metrics, err := metricsRepo.List(p.Context, s.ID, storage.MetricListOptions{Sort: sort, Order: order})
+					if err != nil {
+						return nil, err
+					}
+					return pointers(limitArg(p, metrics)), nil
+				},
+			},
+			"metric": &graphql.Field{
+				Type: metricType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := p.Source.(*models.ServiceSnapshot)
+					m, err := metricsRepo.GetByName(p.Context, s.ID, p.Args["name"].(string))
+					if err != nil || m == nil {
+						return nil, err
+					}
+					return m, nil
+				},
+			},
+		},
+	})
+
+	scanType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Scan",
+		Fields: graphql.Fields{
+			"id":             &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"collectedAt":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"status":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"scanDurationMs": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"totalServices":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"totalSeries":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"skippedMetrics": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"copiedServices": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"services": &graphql.Field{
+				Type: graphql.NewList(graphql.NewNonNull(serviceType)),
+				Args: graphql.FieldConfigArgument{
+					"search":      &graphql.ArgumentConfig{Type: graphql.String},
+					"environment": &graphql.ArgumentConfig{Type: graphql.String},
+					"team":        &graphql.ArgumentConfig{Type: graphql.String},
+					"sort":        &graphql.ArgumentConfig{Type: graphql.String},
+					"order":       &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":       &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				// Resolved as a thunk so that the services of every scan in a
+				// list are loaded with one query.
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					snap := p.Source.(*models.Snapshot)
+					opts := storage.ServiceListOptions{}
+					opts.Search, _ = p.Args["search"].(string)
+					opts.Environment, _ = p.Args["environment"].(string)
+					opts.Team, _ = p.Args["team"].(string)
+					opts.Sort, _ = p.Args["sort"].(string)
+					opts.Order, _ = p.Args["order"].(string)
+					batch := loaderFrom(p.Context).batch(opts, snap.ID)
+					return func() (any, error) {
+						services, err := batch.load(p.Context, servicesRepo)
+						if err != nil {
+							return nil, err
+						}
+						return pointers(limitArg(p, services[snap.ID])), nil
+					}, nil
+				},
+			},
+			"service": &graphql.Field{
+				Type: serviceType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					snap := p.Source.(*models.Snapshot)
+					s, err := servicesRepo.GetByName(p.Context, snap.ID, p.Args["name"].(string))
+					if err != nil || s == nil {
+						return nil, err
+					}
+					return s, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"scan": &graphql.Field{
+				Type:        scanType,
+				Description: "A scan by id, or the latest one when id is omitted.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var snap *models.Snapshot
+					var err error
+					if id, ok := p.Args["id"].(int); ok {
+						snap, err = snapshotsRepo.GetByID(p.Context, int64(id))
+					} else {
+						snap, err = snapshotsRepo.GetLatest(p.Context)
+					}
+					if err != nil || snap == nil {
+						return nil, err
+					}
+					return snap, nil
+				},
+			},
+			"scans": &graphql.Field{
+				Type: graphql.NewList(graphql.NewNonNull(scanType)),
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphQLScans},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					limit := min(max(p.Args["limit"].(int), 1), maxGraphQLScans)
+					snapshots, err := snapshotsRepo.List(p.Context, limit)
+					if err != nil {
+						return nil, err
+					}
+					return pointers(snapshots), nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		return nil, fmt.Errorf("build graphql schema: %w", err)
+	}
+	return &GraphQLHandler{schema: schema}, nil
+}
+
+// Query executes a GraphQL request. POST takes the usual JSON body; GET
+// reads query, variables and operationName from the query string.
+func (h *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables")
+				return
+			}
+		}
+	} else {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+	// Syntax errors are left for graphql.Do to report in the usual shape.
+	if doc, err := parser.Parse(parser.ParseParams{Source: req.Query}); err == nil {
+		if err := checkQueryCost(doc, req.OperationName, req.Variables); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), serviceLoaderKey{}, &serviceLoader{}),
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// limitArg applies an optional "limit" argument; zero or negative means all.
+func limitArg[T any](p graphql.ResolveParams, items []T) []T {
+	if limit, ok := p.Args["limit"].(int); ok && limit > 0 && limit < len(items) {
+		return items[:limit]
+	}
+	return items
+}
+
+// pointers lets nested resolvers type-assert a single pointer type whether
+// the parent came from a list or a lookup.
+func pointers[T any](items []T) []*T {
+	out := make([]*T, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out
+}
+
+// serviceLoader batches the services lookups of one request: every scan
+// asking for services with the same arguments joins one batch, loaded by
+// the first thunk that runs.
+type serviceLoader struct {
+	mu      sync.Mutex
+	pending map[storage.ServiceListOptions]*serviceBatch
+}
+
+type serviceLoaderKey struct{}
+
+func loaderFrom(ctx context.Context) *serviceLoader {
+	if l, ok := ctx.Value(serviceLoaderKey{}).(*serviceLoader); ok {
+		return l
+	}
+	return &serviceLoader{}
+}
+
+// batch adds a snapshot to the open batch for opts, starting one if needed.
+func (l *serviceLoader) batch(opts storage.ServiceListOptions, snapshotID int64) *serviceBatch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending == nil {
+		l.pending = make(map[storage.ServiceListOptions]*serviceBatch)
+	}
+	b, ok := l.pending[opts]
+	if !ok {
+		b = &serviceBatch{loader: l, opts: opts}
+		l.pending[opts] = b
+	}
+	b.ids = append(b.ids, snapshotID)
+	return b
+}
+
+type serviceBatch struct {
+	loader *serviceLoader
+	opts   storage.ServiceListOptions
+	ids    []int64
+
+	once     sync.Once
+	services map[int64][]models.ServiceSnapshot
+	err      error
+}
+
+// load runs the batch's query once; later snapshots start a new batch.
+func (b *serviceBatch) load(ctx context.Context, repo storage.ServicesRepo) (map[int64][]models.ServiceSnapshot, error) {
+	b.once.Do(func() {
+		b.loader.mu.Lock()
+		if b.loader.pending[b.opts] == b {
+			delete(b.loader.pending, b.opts)
+		}
+		ids := b.ids
+		b.loader.mu.Unlock()
+		b.services, b.err = repo.ListBySnapshots(ctx, ids, b.opts)
+	})
+	return b.services, b.err
+}
+
+// checkQueryCost rejects an operation nested deeper than maxGraphQLDepth
+// or more complex than maxGraphQLComplexity. Introspection is free: it
+// never touches the database.
+func checkQueryCost(doc *ast.Document, operationName string, variables map[string]any) error {
+	c := &queryCost{fragments: make(map[string]*ast.FragmentDefinition), variables: variables}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || def.Name != nil && def.Name.Value == operationName {
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		return nil
+	}
+	return c.selectionSet(op.SelectionSet, 1, 1)
+}
+
+type queryCost struct {
+	fragments  map[string]*ast.FragmentDefinition
+	variables  map[string]any
+	complexity int
+}
+
+func (c *queryCost) selectionSet(set *ast.SelectionSet, depth, multiplier int) error {
+	if set == nil {
+		return nil
+	}
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("query is nested deeper than %d levels", maxGraphQLDepth)
+	}
+	for _, sel := range set.Selections {
+		var err error
+		switch sel := sel.(type) {
+		case *ast.Field:
+			err = c.field(sel, depth, multiplier)
+		case *ast.InlineFragment:
+			err = c.selectionSet(sel.SelectionSet, depth, multiplier)
+		case *ast.FragmentSpread:
+			// Fragments don't add a level; the depth check still stops
+			// fragments that spread themselves.
+			if f := c.fragments[sel.Name.Value]; f != nil {
+				err = c.selectionSet(f.SelectionSet, depth, multiplier)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *queryCost) field(f *ast.Field, depth, multiplier int) error {
+	name := f.Name.Value
+	if name == "__schema" || name == "__type" {
+		return nil
+	}
+	c.complexity += multiplier
+	if c.complexity > maxGraphQLComplexity {
+		return fmt.Errorf("query is too complex: it may resolve more than %d fields; add limit arguments", maxGraphQLComplexity)
+	}
+	return c.selectionSet(f.SelectionSet, depth+1, min(multiplier*c.fanout(f), maxGraphQLComplexity+1))
+}
+
+// fanout is how many items a field may return.
+func (c *queryCost) fanout(f *ast.Field) int {
+	switch f.Name.Value {
+	case "scans":
+		limit, ok := c.limit(f)
+		if !ok {
+			limit = defaultGraphQLScans
+		}
+		return min(max(limit, 1), maxGraphQLScans)
+	case "services", "metrics":
+		if limit, ok := c.limit(f); ok && limit > 0 {
+			return limit
+		}
+		return graphQLDefaultFanout
+	case "labels":
+		return graphQLDefaultFanout
+	default:
+		return 1
+	}
+}
+
+// limit reads the field's limit argument, literal or from a variable.
+func (c *queryCost) limit(f *ast.Field) (int, bool) {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(v.Value)
+			if err != nil {
+				return maxGraphQLComplexity + 1, true
+			}
+			return n, true
+		case *ast.Variable:
+			switch n := c.variables[v.Name.Value].(type) {
+			case float64:
+				return int(min(n, maxGraphQLComplexity+1)), true
+			case int:
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestCheckQueryCost(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		wantErr   bool
+	}{
+		{name: "latest scan", query: `{ scan { id totalSeries } }`},
+		{name: "services of a scan", query: `{ scan { services { name totalSeries } } }`},
+		{name: "metrics of every service", query: `{ scan { services { name metrics { name seriesCount } } } }`},
+		{name: "labels of one service", query: `{ scan { service(name: "api") { metrics { labels { name uniqueValuesCount } } } } }`},
+		{name: "scans with limited services", query: `{ scans(limit: 10) { services(limit: 5) { metrics(limit: 10) { name } } } }`},
+		{name: "limit from variable", query: `query($n: Int) { scans(limit: $n) { services(limit: $n) { metrics(limit: $n) { name } } } }`, variables: map[string]any{"n": float64(5)}},
+		{name: "introspection", query: `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`},
+
+		{name: "whole database", query: `{ scans(limit: 100) { services { metrics { labels { name } } } } }`, wantErr: true},
+		{name: "every label of every metric", query: `{ scan { services { metrics { labels { name sampleValues } } } } }`, wantErr: true},
+		{name: "huge limit", query: `{ scan { services(limit: 1000000) { metrics(limit: 1000000) { name } } } }`, wantErr: true},
+		{name: "huge limit variable", query: `query($n: Int) { scan { services(limit: $n) { metrics(limit: $n) { name } } } }`, variables: map[string]any{"n": float64(1e12)}, wantErr: true},
+		{name: "too deep", query: `{ scan { service(name: "a") { metric(name: "b") { labels { name { x { y } } } } } } }`, wantErr: true},
+		{name: "self-spreading fragment", query: `{ scan { ...F } } fragment F on Scan { services { ...F } }`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			err = checkQueryCost(doc, "", tt.variables)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkQueryCost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
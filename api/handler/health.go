@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/illenko/whodidthis/models"
 	"github.com/illenko/whodidthis/prometheus"
+	"github.com/illenko/whodidthis/scheduler"
 	"github.com/illenko/whodidthis/storage"
 )
 
@@ -12,18 +16,70 @@ type HealthHandler struct {
 	snapshots  storage.SnapshotsRepo
 	db         *storage.DB
 	promClient prometheus.MetricsClient
+	scheduler  *scheduler.Scheduler
 }
 
 func NewHealthHandler(snapshots storage.SnapshotsRepo,
 	db *storage.DB,
-	promClient prometheus.MetricsClient) *HealthHandler {
+	promClient prometheus.MetricsClient,
+	scheduler *scheduler.Scheduler) *HealthHandler {
 	return &HealthHandler{
 		snapshots:  snapshots,
 		db:         db,
 		promClient: promClient,
+		scheduler:  scheduler,
 	}
 }
 
+// Live answers as long as the process serves requests. It checks nothing
+// else, so a slow first scan or an unreachable Prometheus never gets the
+// pod restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// Ready answers 503 until the database is migrated, Prometheus answers and
+// the first scan has been attempted, listing each component's state.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status := models.ReadinessStatus{Ready: true}
+	report := func(name string, err error) {
+		c := models.ComponentStatus{Name: name, OK: err == nil}
+		if err != nil {
+			c.Detail = err.Error()
+			status.Ready = false
+		}
+		status.Components = append(status.Components, c)
+	}
+
+	pending, err := h.db.PendingMigrations(ctx)
+	if err == nil && len(pending) > 0 {
+		err = fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+	}
+	report("database", err)
+
+	if h.promClient != nil {
+		report("prometheus", h.promClient.HealthCheck(ctx))
+	}
+
+	if h.scheduler != nil {
+		var err error
+		if !h.scheduler.InitialScanAttempted() {
+			err = errors.New("not started")
+			if p := h.scheduler.GetStatus().Progress; p != nil {
+				err = fmt.Errorf("running: %s %d/%d", p.Phase, p.Current, p.Total)
+			}
+		}
+		report("initial_scan", err)
+	}
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -45,9 +101,21 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 				status.Status = "degraded"
 			}
 		}
+
+		circuit := h.promClient.CircuitStatus()
+		status.PrometheusCircuit = &models.CircuitStatus{
+			State:               string(circuit.State),
+			ConsecutiveFailures: circuit.ConsecutiveFailures,
+		}
+		if !circuit.OpenedAt.IsZero() {
+			status.PrometheusCircuit.OpenedAt = &circuit.OpenedAt
+		}
+		if circuit.State != prometheus.CircuitClosed && status.Status == "healthy" {
+			status.Status = "degraded"
+		}
 	}
 
-	latest, _ := h.snapshots.GetLatest(ctx)
+	latest, _ := h.snapshots.GetLatestAnyStatus(ctx)
 	if latest != nil {
 		status.LastScan = latest.CollectedAt
 	}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -60,6 +61,12 @@ func (h *LabelsHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wantsCSV(r) {
+		header, rows := labelsCSV(serviceName, metricName, labels)
+		writeCSV(w, fmt.Sprintf("labels-scan-%d.csv", scanID), header, rows)
+		return
+	}
+
 	if labels == nil {
 		labels = []models.LabelSnapshot{}
 	}
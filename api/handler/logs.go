@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type LogsHandler struct {
+	logStreamsRepo storage.LogStreamsRepo
+}
+
+func NewLogsHandler(logStreamsRepo storage.LogStreamsRepo) *LogsHandler {
+	return &LogsHandler{
+		logStreamsRepo: logStreamsRepo,
+	}
+}
+
+type LogServiceResponse struct {
+	models.LogServiceSnapshot
+	Labels []models.LogLabelSnapshot `json:"labels"`
+}
+
+func (h *LogsHandler) List(w http.ResponseWriter, r *http.Request) {
+	scanID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	services, err := h.logStreamsRepo.List(r.Context(), scanID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if services == nil {
+		services = []models.LogServiceSnapshot{}
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+func (h *LogsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scanID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	service, err := h.logStreamsRepo.GetByName(ctx, scanID, r.PathValue("service"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if service == nil {
+		writeError(w, http.StatusNotFound, "service not found")
+		return
+	}
+
+	labels, err := h.logStreamsRepo.ListLabels(ctx, service.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if labels == nil {
+		labels = []models.LogLabelSnapshot{}
+	}
+
+	writeJSON(w, http.StatusOK, LogServiceResponse{LogServiceSnapshot: *service, Labels: labels})
+}
+
+// Trend reports stream counts over time; the series field carries streams.
+func (h *LogsHandler) Trend(w http.ResponseWriter, r *http.Request) {
+	points, err := h.logStreamsRepo.Trend(r.Context(), r.PathValue("service"), parseSince(r, 30))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if points == nil {
+		points = []models.TrendPoint{}
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
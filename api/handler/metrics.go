@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -9,14 +10,16 @@ import (
 )
 
 type MetricsHandler struct {
-	servicesRepo storage.ServicesRepo
-	metricsRepo  storage.MetricsRepo
+	snapshotsRepo storage.SnapshotsRepo
+	servicesRepo  storage.ServicesRepo
+	metricsRepo   storage.MetricsRepo
 }
 
-func NewMetricsHandler(servicesRepo storage.ServicesRepo, metricsRepo storage.MetricsRepo) *MetricsHandler {
+func NewMetricsHandler(snapshotsRepo storage.SnapshotsRepo, servicesRepo storage.ServicesRepo, metricsRepo storage.MetricsRepo) *MetricsHandler {
 	return &MetricsHandler{
-		servicesRepo: servicesRepo,
-		metricsRepo:  metricsRepo,
+		snapshotsRepo: snapshotsRepo,
+		servicesRepo:  servicesRepo,
+		metricsRepo:   metricsRepo,
 	}
 }
 
@@ -52,6 +55,12 @@ func (m *MetricsHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wantsCSV(r) {
+		header, rows := metricsCSV(serviceName, metrics)
+		writeCSV(w, fmt.Sprintf("metrics-scan-%d.csv", scanID), header, rows)
+		return
+	}
+
 	if metrics == nil {
 		metrics = []models.MetricSnapshot{}
 	}
@@ -93,3 +102,93 @@ func (m *MetricsHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, metric)
 }
+
+// Trend sums the metric across services, or reports one service's copy of
+// it with ?service=.
+func (m *MetricsHandler) Trend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	points, err := m.metricsRepo.Trend(ctx, r.PathValue("metric"), r.URL.Query().Get("service"), parseSince(r, 30))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if points == nil {
+		points = []models.TrendPoint{}
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
+
+func (m *MetricsHandler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	service := r.URL.Query().Get("service")
+	metric := r.URL.Query().Get("metric")
+	if service == "" || metric == "" {
+		writeError(w, http.StatusBadRequest, "service and metric are required")
+		return
+	}
+
+	points, err := m.metricsRepo.History(ctx, service, metric, parseIntParam(r, "limit", 365))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if points == nil {
+		points = []models.MetricHistoryPoint{}
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
+
+// Top returns the worst metrics across all services in a scan, ranked
+// ?by=series (default), labels or growth since the previous scan.
+func (m *MetricsHandler) Top(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scanID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	switch by {
+	case "":
+		by = "series"
+	case "series", "labels", "growth":
+	default:
+		writeError(w, http.StatusBadRequest, "by must be one of series, labels, growth")
+		return
+	}
+
+	limit := parseIntParam(r, "limit", 20)
+	if limit <= 0 || limit > 500 {
+		limit = 20
+	}
+
+	var previousID int64
+	previous, err := m.snapshotsRepo.GetPrevious(ctx, scanID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if previous != nil {
+		previousID = previous.ID
+	}
+
+	top, err := m.metricsRepo.Top(ctx, scanID, previousID, by, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if top == nil {
+		top = []models.TopMetric{}
+	}
+
+	writeJSON(w, http.StatusOK, top)
+}
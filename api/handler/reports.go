@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/illenko/whodidthis/report"
+)
+
+type ReportsHandler struct {
+	builder *report.Builder
+}
+
+func NewReportsHandler(builder *report.Builder) *ReportsHandler {
+	return &ReportsHandler{
+		builder: builder,
+	}
+}
+
+// HTML serves a standalone report of the scan against the previous one, or
+// against the scan given as ?compare=<id>.
+func (h *ReportsHandler) HTML(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, "text/html; charset=utf-8", "html", (*report.Report).WriteHTML)
+}
+
+// Markdown serves the same report as markdown for pasting into issues.
+func (h *ReportsHandler) Markdown(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, markdownContentType, "md", (*report.Report).WriteMarkdown)
+}
+
+func (h *ReportsHandler) serve(w http.ResponseWriter, r *http.Request, contentType, ext string, render func(*report.Report, io.Writer) error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	var compareID int64
+	if param := r.URL.Query().Get("compare"); param != "" {
+		compareID, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid compare parameter")
+			return
+		}
+	}
+
+	rep, err := h.builder.Build(r.Context(), id, compareID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rep == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+
+	// Rendered up front so a template error still gets a proper status.
+	var buf bytes.Buffer
+	if err := render(rep, &buf); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"report-%d.%s\"", id, ext))
+	}
+	writeDocument(w, contentType, buf.Bytes())
+}
+
+const markdownContentType = "text/markdown; charset=utf-8"
+
+// writeDocument sends a rendered non-JSON body.
+func writeDocument(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
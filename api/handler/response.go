@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func parseIntParam(r *http.Request, name string, defaultVal int) int {
@@ -19,6 +20,15 @@ func parseIntParam(r *http.Request, name string, defaultVal int) int {
 	return n
 }
 
+// parseSince turns ?days=N into a cutoff time for trend queries.
+func parseSince(r *http.Request, defaultDays int) time.Time {
+	days := parseIntParam(r, "days", defaultDays)
+	if days <= 0 {
+		days = defaultDays
+	}
+	return time.Now().AddDate(0, 0, -days)
+}
+
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
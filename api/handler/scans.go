@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
 	"github.com/illenko/whodidthis/models"
 	"github.com/illenko/whodidthis/scheduler"
 	"github.com/illenko/whodidthis/storage"
@@ -11,13 +17,17 @@ import (
 
 type ScansHandler struct {
 	repo      storage.SnapshotsRepo
+	runs      storage.ScanRunsRepo
 	scheduler *scheduler.Scheduler
+	cost      config.CostConfig
 }
 
-func NewScansHandler(repo storage.SnapshotsRepo, scheduler *scheduler.Scheduler) *ScansHandler {
+func NewScansHandler(repo storage.SnapshotsRepo, runs storage.ScanRunsRepo, scheduler *scheduler.Scheduler, cost config.CostConfig) *ScansHandler {
 	return &ScansHandler{
 		repo:      repo,
+		runs:      runs,
 		scheduler: scheduler,
+		cost:      cost,
 	}
 }
 
@@ -36,9 +46,31 @@ func (s *ScansHandler) List(w http.ResponseWriter, r *http.Request) {
 		scans = []models.Snapshot{}
 	}
 
+	for i := range scans {
+		scans[i].MonthlyCost = s.cost.MonthlyCostPtr(scans[i].TotalSeries)
+	}
+
 	writeJSON(w, http.StatusOK, scans)
 }
 
+func (s *ScansHandler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit := parseIntParam(r, "limit", 50)
+
+	runs, err := s.runs.List(ctx, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if runs == nil {
+		runs = []models.ScanRun{}
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
 func (s *ScansHandler) GetLatest(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -53,6 +85,13 @@ func (s *ScansHandler) GetLatest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scan.TSDBStats, err = s.repo.GetTSDBStats(ctx, scan.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scan.MonthlyCost = s.cost.MonthlyCostPtr(scan.TotalSeries)
+
 	writeJSON(w, http.StatusOK, scan)
 }
 
@@ -76,18 +115,61 @@ func (s *ScansHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scan.ServiceErrors, err = s.repo.ListServiceErrors(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	scan.TSDBStats, err = s.repo.GetTSDBStats(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scan.MonthlyCost = s.cost.MonthlyCostPtr(scan.TotalSeries)
+
 	writeJSON(w, http.StatusOK, scan)
 }
 
+// Trigger starts a full scan, adjusted by the overrides in an optional JSON
+// body, or with ?dry_run=true only discovers what it would cover and
+// estimates its queries and duration.
 func (s *ScansHandler) Trigger(w http.ResponseWriter, r *http.Request) {
 	if s.scheduler == nil {
 		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
 		return
 	}
 
-	err := s.scheduler.TriggerScan()
+	var overrides *collector.Overrides
+	var body collector.Overrides
+	switch err := json.NewDecoder(r.Body).Decode(&body); {
+	case errors.Is(err, io.EOF):
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	default:
+		if err := body.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !body.IsZero() {
+			overrides = &body
+		}
+	}
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		estimate, err := s.scheduler.Estimate(r.Context(), overrides)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, estimate)
+		return
+	}
+
+	queued, err := s.scheduler.TriggerScan(overrides)
 	if err != nil {
-		if err == scheduler.ErrScanAlreadyRunning {
+		if err == scheduler.ErrScanAlreadyRunning || err == scheduler.ErrQueueFull {
 			writeError(w, http.StatusConflict, err.Error())
 			return
 		}
@@ -95,9 +177,99 @@ func (s *ScansHandler) Trigger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if queued {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "scan queued"})
+		return
+	}
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "scan started"})
 }
 
+func (s *ScansHandler) TriggerService(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
+		return
+	}
+
+	serviceName := r.PathValue("name")
+	if serviceName == "" {
+		writeError(w, http.StatusBadRequest, "service name is required")
+		return
+	}
+
+	// The service has to be discovered now; it needn't be in the latest
+	// snapshot, a new service is added to it.
+	if err := s.scheduler.FindService(r.Context(), serviceName); err != nil {
+		if errors.Is(err, collector.ErrServiceNotFound) {
+			writeError(w, http.StatusNotFound, "service not found")
+			return
+		}
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	queued, err := s.scheduler.TriggerServiceScan(serviceName)
+	if err != nil {
+		if err == scheduler.ErrScanAlreadyRunning || err == scheduler.ErrQueueFull {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if queued {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "service scan queued", "service": serviceName})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "service scan started", "service": serviceName})
+}
+
+func (s *ScansHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
+		return
+	}
+
+	if err := s.scheduler.CancelScan(); err != nil {
+		if err == scheduler.ErrNoScanRunning {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "scan cancelling"})
+}
+
+func (s *ScansHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
+		return
+	}
+
+	if err := s.scheduler.Pause(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.scheduler.GetStatus())
+}
+
+func (s *ScansHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
+		return
+	}
+
+	if err := s.scheduler.Resume(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.scheduler.GetStatus())
+}
+
 func (s *ScansHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	if s.scheduler == nil {
 		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
@@ -107,3 +279,76 @@ func (s *ScansHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	status := s.scheduler.GetStatus()
 	writeJSON(w, http.StatusOK, status)
 }
+
+// Export returns the scan with all its services, metrics and labels as a
+// bundle that Import accepts.
+func (s *ScansHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	bundle, err := s.repo.Export(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if bundle == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"scan-%d.json\"", id))
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+// maxImportBytes caps uploaded bundles; large snapshots are a few tens of MB.
+const maxImportBytes = 512 << 20
+
+func (s *ScansHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var bundle models.SnapshotBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&bundle); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bundle: "+err.Error())
+		return
+	}
+
+	if bundle.Version != models.SnapshotBundleVersion {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported bundle version %d", bundle.Version))
+		return
+	}
+	if bundle.Snapshot.CollectedAt.IsZero() {
+		writeError(w, http.StatusBadRequest, "snapshot.collected_at is required")
+		return
+	}
+	switch bundle.Snapshot.Status {
+	case models.SnapshotStatusCompleted, models.SnapshotStatusPartial:
+	case "":
+		bundle.Snapshot.Status = models.SnapshotStatusCompleted
+	default:
+		writeError(w, http.StatusBadRequest, "only completed or partial scans can be imported")
+		return
+	}
+
+	id, err := s.repo.Import(ctx, &bundle)
+	if errors.Is(err, storage.ErrSnapshotExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	scan, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, scan)
+}
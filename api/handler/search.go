@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type SearchHandler struct {
+	repo storage.SearchRepo
+}
+
+func NewSearchHandler(repo storage.SearchRepo) *SearchHandler {
+	return &SearchHandler{repo: repo}
+}
+
+// Search finds services, metrics, labels and sample values in a scan that
+// contain ?q=.
+func (s *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scanID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := parseIntParam(r, "limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	results, err := s.repo.Search(ctx, scanID, q, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
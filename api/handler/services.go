@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -29,9 +30,11 @@ func (s *ServicesHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := storage.ServiceListOptions{
-		Sort:   r.URL.Query().Get("sort"),
-		Order:  r.URL.Query().Get("order"),
-		Search: r.URL.Query().Get("search"),
+		Sort:        r.URL.Query().Get("sort"),
+		Order:       r.URL.Query().Get("order"),
+		Search:      r.URL.Query().Get("search"),
+		Environment: r.URL.Query().Get("env"),
+		Team:        r.URL.Query().Get("team"),
 	}
 
 	services, err := s.servicesRepo.List(ctx, scanID, opts)
@@ -40,6 +43,12 @@ func (s *ServicesHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wantsCSV(r) {
+		header, rows := servicesCSV(services)
+		writeCSV(w, fmt.Sprintf("services-scan-%d.csv", scanID), header, rows)
+		return
+	}
+
 	if services == nil {
 		services = []models.ServiceSnapshot{}
 	}
@@ -71,3 +80,19 @@ func (s *ServicesHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, service)
 }
+
+func (s *ServicesHandler) Trend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	points, err := s.servicesRepo.Trend(ctx, r.PathValue("service"), parseSince(r, 30))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if points == nil {
+		points = []models.TrendPoint{}
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
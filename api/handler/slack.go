@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// slackListLimit caps how many entries a slash command answer lists.
+const slackListLimit = 10
+
+// slackMaxSkew is how old a request's timestamp may be before it is taken
+// for a replay, as Slack recommends.
+const slackMaxSkew = 5 * time.Minute
+
+const slackAcknowledgeAction = "acknowledge"
+
+// SlackHandler serves a Slack app: the /whodidthis slash command and the
+// acknowledge buttons on the findings it lists.
+type SlackHandler struct {
+	signingSecret string
+	snapshots     storage.SnapshotsRepo
+	services      storage.ServicesRepo
+	metrics       storage.MetricsRepo
+	findings      storage.FindingsRepo
+	client        *http.Client
+}
+
+// NewSlackHandler answers 503 when signingSecret is empty.
+func NewSlackHandler(signingSecret string, snapshots storage.SnapshotsRepo, services storage.ServicesRepo, metrics storage.MetricsRepo, findings storage.FindingsRepo) *SlackHandler {
+	return &SlackHandler{
+		signingSecret: signingSecret,
+		snapshots:     snapshots,
+		services:      services,
+		metrics:       metrics,
+		findings:      findings,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type slackMessage struct {
+	ResponseType string       `json:"response_type,omitempty"`
+	Text         string       `json:"text"`
+	Blocks       []slackBlock `json:"blocks,omitempty"`
+}
+
+type slackBlock struct {
+	Type      string       `json:"type"`
+	Text      *slackText   `json:"text,omitempty"`
+	Accessory *slackButton `json:"accessory,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackButton struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+}
+
+const slackUsage = "Usage:\n" +
+	"`/whodidthis top [service]` the biggest metrics in the latest scan, overall or in one service\n" +
+	"`/whodidthis diff [team]` the services that changed most since the previous scan\n" +
+	"`/whodidthis findings [service]` open findings, with buttons to acknowledge them"
+
+// Command answers the slash command in the channel. Failures are answered
+// only to the caller, since Slack shows its own generic error for anything
+// but a 200.
+func (h *SlackHandler) Command(w http.ResponseWriter, r *http.Request) {
+	form, ok := h.readRequest(w, r)
+	if !ok {
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	var arg string
+	if len(args) > 1 {
+		arg = args[1]
+	}
+
+	var msg *slackMessage
+	var err error
+	switch {
+	case len(args) == 0 || args[0] == "help":
+		msg = &slackMessage{Text: slackUsage}
+	case args[0] == "top":
+		msg, err = h.top(r.Context(), arg)
+	case args[0] == "diff":
+		msg, err = h.diff(r.Context(), arg)
+	case args[0] == "findings":
+		msg, err = h.openFindings(r.Context(), arg)
+	default:
+		msg = &slackMessage{Text: fmt.Sprintf("Unknown command `%s`.\n%s", slackEscape(args[0]), slackUsage)}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "slack command failed", "text", form.Get("text"), "error", err)
+		msg = &slackMessage{Text: "Failed: " + slackEscape(err.Error())}
+	}
+	if msg.ResponseType == "" {
+		msg.ResponseType = "ephemeral"
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// Interaction handles button clicks. Slack ignores the response body for
+// block actions, so the outcome is posted to the payload's response_url.
+func (h *SlackHandler) Interaction(w http.ResponseWriter, r *http.Request) {
+	form, ok := h.readRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Type string `json:"type"`
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+			Name     string `json:"name"`
+		} `json:"user"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	user := payload.User.Username
+	if user == "" {
+		user = payload.User.Name
+	}
+	if user == "" {
+		user = payload.User.ID
+	}
+
+	for _, action := range payload.Actions {
+		if action.ActionID != slackAcknowledgeAction {
+			continue
+		}
+		text := h.acknowledge(r.Context(), action.Value, user, payload.User.ID)
+		if payload.ResponseURL == "" {
+			continue
+		}
+		reply := slackMessage{ResponseType: "in_channel", Text: text}
+		if err := h.respond(r.Context(), payload.ResponseURL, reply); err != nil {
+			slog.ErrorContext(r.Context(), "slack response failed", "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// readRequest checks the request's signature and returns its form. Slack
+// signs the raw body, so it is read before parsing.
+func (h *SlackHandler) readRequest(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if h.signingSecret == "" {
+		writeError(w, http.StatusServiceUnavailable, "slack is not configured")
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	if !validSlackSignature(h.signingSecret, r.Header, body, time.Now()) {
+		writeError(w, http.StatusUnauthorized, "invalid slack signature")
+		return nil, false
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	return form, true
+}
+
+// validSlackSignature checks X-Slack-Signature, an HMAC of the timestamp
+// and body, and rejects timestamps too far from now.
+func validSlackSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	ts := header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(sec, 0)).Abs(); skew > slackMaxSkew {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(header.Get("X-Slack-Signature")))
+}
+
+// top lists the largest metrics in the latest scan, or in one service.
+func (h *SlackHandler) top(ctx context.Context, service string) (*slackMessage, error) {
+	latest, err := h.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return &slackMessage{Text: "No scans yet."}, nil
+	}
+
+	var b strings.Builder
+	if service == "" {
+		var previousID int64
+		previous, err := h.snapshots.GetPrevious(ctx, latest.ID)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			previousID = previous.ID
+		}
+		top, err := h.metrics.Top(ctx, latest.ID, previousID, "series", slackListLimit)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "*Top metrics* in scan %d (%s), %d series in total\n", latest.ID, latest.CollectedAt.Format(time.DateOnly), latest.TotalSeries)
+		for _, m := range top {
+			fmt.Fprintf(&b, "• `%s` in %s: %d series", slackEscape(m.MetricName), slackEscape(m.ServiceName), m.SeriesCount)
+			if m.SeriesDelta != nil && *m.SeriesDelta != 0 {
+				fmt.Fprintf(&b, " (%+d)", *m.SeriesDelta)
+			}
+			b.WriteString("\n")
+		}
+		return &slackMessage{ResponseType: "in_channel", Text: b.String()}, nil
+	}
+
+	svc, err := h.services.GetByName(ctx, latest.ID, service)
+	if err != nil {
+		return nil, err
+	}
+	if svc == nil {
+		return &slackMessage{Text: fmt.Sprintf("No service `%s` in the latest scan.", slackEscape(service))}, nil
+	}
+	metrics, err := h.metrics.List(ctx, svc.ID, storage.MetricListOptions{Sort: "series", Order: "desc"})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "*Top metrics* in %s, %d series over %d metrics\n", slackEscape(svc.ServiceName), svc.TotalSeries, svc.MetricCount)
+	for _, m := range metrics[:min(len(metrics), slackListLimit)] {
+		fmt.Fprintf(&b, "• `%s`: %d series, %d labels\n", slackEscape(m.MetricName), m.SeriesCount, m.LabelCount)
+	}
+	return &slackMessage{ResponseType: "in_channel", Text: b.String()}, nil
+}
+
+// diff lists the services that changed most between the latest two scans,
+// optionally only one team's.
+func (h *SlackHandler) diff(ctx context.Context, team string) (*slackMessage, error) {
+	latest, err := h.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return &slackMessage{Text: "No scans yet."}, nil
+	}
+	previous, err := h.snapshots.GetPrevious(ctx, latest.ID)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return &slackMessage{Text: "No previous scan to compare with."}, nil
+	}
+
+	diffs, err := h.services.Diff(ctx, previous.ID, latest.ID)
+	if err != nil {
+		return nil, err
+	}
+	var changed []models.ServiceDiff
+	var delta int64
+	for _, d := range diffs {
+		if team != "" && d.Team != team {
+			continue
+		}
+		delta += int64(d.SeriesDelta)
+		if d.Status != models.DiffUnchanged {
+			changed = append(changed, d)
+		}
+	}
+	sort.SliceStable(changed, func(i, j int) bool {
+		return abs(changed[i].SeriesDelta) > abs(changed[j].SeriesDelta)
+	})
+
+	var b strings.Builder
+	b.WriteString("*Changes*")
+	if team != "" {
+		fmt.Fprintf(&b, " for %s", slackEscape(team))
+	}
+	fmt.Fprintf(&b, " from scan %d (%s) to %d (%s): %+d series\n", previous.ID, previous.CollectedAt.Format(time.DateOnly), latest.ID, latest.CollectedAt.Format(time.DateOnly), delta)
+	if len(changed) == 0 {
+		b.WriteString("No services changed.\n")
+	}
+	for _, d := range changed[:min(len(changed), slackListLimit)] {
+		fmt.Fprintf(&b, "• %s: %d → %d series (%+d), %s\n", slackEscape(d.ServiceName), d.PreviousSeries, d.CurrentSeries, d.SeriesDelta, d.Status)
+	}
+	return &slackMessage{ResponseType: "in_channel", Text: b.String()}, nil
+}
+
+// openFindings lists the most severe open findings, each with a button to
+// acknowledge it.
+func (h *SlackHandler) openFindings(ctx context.Context, service string) (*slackMessage, error) {
+	findings, err := h.findings.ListTracked(ctx, storage.TrackedFindingListOptions{
+		States:  []models.FindingState{models.FindingOpen},
+		Service: service,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	title := "*Open findings*"
+	if service != "" {
+		title += " in " + slackEscape(service)
+	}
+	if len(findings) == 0 {
+		return &slackMessage{ResponseType: "in_channel", Text: title + ": none."}, nil
+	}
+	if len(findings) > slackListLimit {
+		title += fmt.Sprintf(", the %d most severe of %d", slackListLimit, len(findings))
+		findings = findings[:slackListLimit]
+	}
+
+	msg := &slackMessage{
+		ResponseType: "in_channel",
+		Text:         title,
+		Blocks:       []slackBlock{{Type: "section", Text: &slackText{Type: "mrkdwn", Text: title}}},
+	}
+	for _, f := range findings {
+		text := fmt.Sprintf("*%s* %d · %s `%s`", f.Level, f.Severity, slackEscape(f.ServiceName), slackEscape(f.MetricName))
+		if f.LabelName != "" {
+			text += fmt.Sprintf(" label `%s`", slackEscape(f.LabelName))
+		}
+		text += "\n" + slackEscape(f.Description)
+		msg.Blocks = append(msg.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: text},
+			Accessory: &slackButton{
+				Type:     "button",
+				Text:     slackText{Type: "plain_text", Text: "Acknowledge"},
+				ActionID: slackAcknowledgeAction,
+				Value:    strconv.FormatInt(f.ID, 10),
+			},
+		})
+	}
+	return msg, nil
+}
+
+// acknowledge assigns the finding to the Slack user who clicked and
+// returns the message to post about it.
+func (h *SlackHandler) acknowledge(ctx context.Context, value, user, userID string) string {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "Invalid finding id."
+	}
+
+	ok, err := h.findings.Acknowledge(ctx, id, "acknowledged in Slack", user, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "slack acknowledge failed", "finding", id, "error", err)
+		return "Failed to acknowledge the finding: " + slackEscape(err.Error())
+	}
+	finding, err := h.findings.GetTracked(ctx, id)
+	switch {
+	case err != nil:
+		return "Failed to acknowledge the finding: " + slackEscape(err.Error())
+	case finding == nil:
+		return fmt.Sprintf("Finding %d no longer exists.", id)
+	case !ok:
+		return fmt.Sprintf("%s `%s` is already resolved.", slackEscape(finding.ServiceName), slackEscape(finding.MetricName))
+	}
+
+	who := slackEscape(user)
+	if userID != "" {
+		who = "<@" + userID + ">"
+	}
+	return fmt.Sprintf("%s acknowledged %s `%s`.", who, slackEscape(finding.ServiceName), slackEscape(finding.MetricName))
+}
+
+func (h *SlackHandler) respond(ctx context.Context, responseURL string, msg slackMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// slackEscape escapes the characters Slack treats as markup in text.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	sseKeepalive   = 15 * time.Second
+	sseMinInterval = 200 * time.Millisecond
+)
+
+// startSSE prepares a long-lived event stream. The server's write timeout
+// is lifted for this response only.
+func startSSE(w http.ResponseWriter) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return rc, rc.Flush()
+}
+
+func writeSSE(w http.ResponseWriter, rc *http.ResponseController, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// ProgressStream pushes the scan status, the same document GET
+// /api/scan/status returns, as a "status" event whenever it changes.
+// Bursts of progress updates are coalesced.
+func (s *ScansHandler) ProgressStream(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler not configured")
+		return
+	}
+
+	rc, err := startSSE(w)
+	if err != nil {
+		return
+	}
+
+	ctx := r.Context()
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	var lastSent time.Time
+	for {
+		changed := s.scheduler.StatusChanged()
+		if err := writeSSE(w, rc, "status", s.scheduler.GetStatus()); err != nil {
+			return
+		}
+		lastSent = time.Now()
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-changed:
+				break wait
+			}
+		}
+
+		if wait := sseMinInterval - time.Since(lastSent); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}
+}
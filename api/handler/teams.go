@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type TeamsHandler struct {
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	cost      config.CostConfig
+}
+
+func NewTeamsHandler(snapshots storage.SnapshotsRepo, services storage.ServicesRepo, cost config.CostConfig) *TeamsHandler {
+	return &TeamsHandler{
+		snapshots: snapshots,
+		services:  services,
+		cost:      cost,
+	}
+}
+
+// List rolls up a scan's services per team, with deltas against the
+// previous scan or the one given as ?previous=<id>.
+func (t *TeamsHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	scanID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	teams, err := t.services.ListTeams(ctx, scanID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var previousID int64
+	if param := r.URL.Query().Get("previous"); param != "" {
+		previousID, err = strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid previous parameter")
+			return
+		}
+	} else {
+		previous, err := t.snapshots.GetPrevious(ctx, scanID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if previous != nil {
+			previousID = previous.ID
+		}
+	}
+
+	if previousID != 0 {
+		previousTeams, err := t.services.ListTeams(ctx, previousID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		applyTeamDeltas(teams, previousTeams)
+	}
+
+	if t.cost.Enabled() {
+		for i := range teams {
+			teams[i].MonthlyCost = t.cost.MonthlyCostPtr(teams[i].TotalSeries)
+			if teams[i].SeriesDelta != nil {
+				teams[i].CostDelta = t.cost.MonthlyCostPtr(*teams[i].SeriesDelta)
+			}
+		}
+	}
+
+	if teams == nil {
+		teams = []models.TeamSummary{}
+	}
+
+	writeJSON(w, http.StatusOK, teams)
+}
+
+func applyTeamDeltas(current, previous []models.TeamSummary) {
+	previousSeries := make(map[string]int64, len(previous))
+	for _, p := range previous {
+		previousSeries[p.Team] = p.TotalSeries
+	}
+
+	for i := range current {
+		prev := previousSeries[current[i].Team]
+		delta := current[i].TotalSeries - prev
+		current[i].PreviousSeries = &prev
+		current[i].SeriesDelta = &delta
+		if prev > 0 {
+			pct := float64(delta) / float64(prev) * 100
+			current[i].SeriesDeltaPct = &pct
+		}
+	}
+}
+
+// Trend sums the team's services over the last ?days=; the team named
+// "-" stands for the services without one.
+func (t *TeamsHandler) Trend(w http.ResponseWriter, r *http.Request) {
+	team := r.PathValue("team")
+	if team == "-" {
+		team = ""
+	}
+
+	points, err := t.services.TeamTrend(r.Context(), team, parseSince(r, 30))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if points == nil {
+		points = []models.TrendPoint{}
+	}
+
+	writeJSON(w, http.StatusOK, points)
+}
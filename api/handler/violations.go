@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type ViolationsHandler struct {
+	violations storage.ViolationsRepo
+}
+
+func NewViolationsHandler(violations storage.ViolationsRepo) *ViolationsHandler {
+	return &ViolationsHandler{violations: violations}
+}
+
+// List returns the metrics currently over their series limit; ?all=true
+// adds the resolved violations.
+func (h *ViolationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	violations, err := h.violations.List(r.Context(), r.URL.Query().Get("all") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if violations == nil {
+		violations = []models.Violation{}
+	}
+
+	writeJSON(w, http.StatusOK, violations)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/illenko/whodidthis/models"
+)
+
+const (
+	wsSendBuffer   = 32
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+)
+
+// Hub fans events out to connected WebSocket clients. It implements
+// models.EventPublisher so the scheduler and analyzer can publish without
+// knowing about the api package.
+type Hub struct {
+	mu       sync.Mutex
+	clients  map[*hubClient]struct{}
+	upgrader websocket.Upgrader
+	logger   *slog.Logger
+}
+
+type hubClient struct {
+	send chan []byte
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[*hubClient]struct{}),
+		logger:  slog.Default().With("component", "ws_hub"),
+	}
+}
+
+// Publish sends the event to every client. A client whose buffer is full is
+// disconnected rather than allowed to hold up the publisher.
+func (h *Hub) Publish(e models.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		h.logger.Error("failed to marshal event", "type", e.Type, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- data:
+		default:
+			h.logger.Warn("dropping slow websocket client")
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+func (h *Hub) subscribe() *hubClient {
+	c := &hubClient{send: make(chan []byte, wsSendBuffer)}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	return c
+}
+
+func (h *Hub) unsubscribe(c *hubClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// ServeWS upgrades the request and streams events until the client goes
+// away. Messages from the client are read only to notice disconnects.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written the error response.
+		h.logger.Debug("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	c := h.subscribe()
+	defer h.unsubscribe(c)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case data, ok := <-c.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ping.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
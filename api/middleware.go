@@ -1,10 +1,14 @@
 package api
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -13,6 +17,7 @@ const requestTimeout = 30 * time.Second
 type statusWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (w *statusWriter) WriteHeader(status int) {
@@ -20,40 +25,118 @@ func (w *statusWriter) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
 }
 
-func withMiddleware(next http.Handler) http.Handler {
+func (w *statusWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// flushing and deadlines.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over for WebSocket upgrades.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// streamingPaths hold their connection open and are exempt from
+// requestTimeout.
+var streamingPaths = map[string]bool{
+	"/api/scan/progress/stream": true,
+	"/ws":                       true,
+}
+
+// withMiddleware wraps the mux. cors, limiter and accessLog are optional.
+func withMiddleware(next http.Handler, cors *corsPolicy, limiter *rateLimiter, accessLog *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := requestIDFrom(r.Header.Get(requestIDHeader))
+		r = r.WithContext(withRequestID(r.Context(), id))
+
 		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		sw.Header().Set(requestIDHeader, id)
+
+		defer func() {
+			logRequest(r, sw, start, accessLog)
+		}()
 
 		defer func() {
 			if err := recover(); err != nil {
-				slog.Error("panic recovered", "error", err)
+				slog.ErrorContext(r.Context(), "panic recovered", "error", err)
 				sw.Header().Set("Content-Type", "application/json")
 				sw.WriteHeader(http.StatusInternalServerError)
 				json.NewEncoder(sw).Encode(map[string]string{"error": "internal server error"})
 			}
 		}()
 
-		sw.Header().Set("Access-Control-Allow-Origin", "*")
-		sw.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		sw.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
+		if cors != nil && cors.apply(sw, r) {
+			sw.WriteHeader(http.StatusNoContent)
+			return
+		}
 		if r.Method == http.MethodOptions {
 			sw.WriteHeader(http.StatusOK)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
-		defer cancel()
+		if limiter != nil && rateLimited(r) {
+			if ok, wait := limiter.allow(rateLimitKey(r)); !ok {
+				sw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				sw.Header().Set("Content-Type", "application/json")
+				sw.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(sw).Encode(map[string]string{"error": "rate limit exceeded"})
+				return
+			}
+		}
+
+		ctx := r.Context()
+		var rw http.ResponseWriter = sw
+		if !streamingPaths[r.URL.Path] {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+			defer cancel()
 
-		next.ServeHTTP(sw, r.WithContext(ctx))
+			if enc := negotiateEncoding(r.Header.Get("Accept-Encoding")); enc != "" {
+				cw := &compressWriter{ResponseWriter: sw, encoding: enc}
+				defer func() {
+					if err := cw.close(); err != nil {
+						slog.DebugContext(ctx, "failed to finish compressed response", "path", r.URL.Path, "error", err)
+					}
+				}()
+				rw = cw
+			}
+		}
 
-		slog.Debug("request completed",
-			"method", r.Method,
-			"path", r.URL.Path,
-			"status", sw.status,
-			"duration", time.Since(start),
-		)
+		next.ServeHTTP(rw, r.WithContext(ctx))
 	})
 }
+
+func logRequest(r *http.Request, sw *statusWriter, start time.Time, accessLog *slog.Logger) {
+	duration := time.Since(start)
+
+	slog.DebugContext(r.Context(), "request completed",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", sw.status,
+		"duration", duration,
+	)
+
+	if accessLog == nil {
+		return
+	}
+	accessLog.LogAttrs(r.Context(), slog.LevelInfo, "access",
+		slog.String("request_id", RequestID(r.Context())),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("query", r.URL.RawQuery),
+		slog.Int("status", sw.status),
+		slog.Int64("bytes", sw.bytes),
+		slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("user_agent", r.UserAgent()),
+	)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitSweepInterval = time.Minute
+	// maxRateLimitBuckets bounds memory when many addresses show up between
+	// sweeps; past it the longest idle bucket is evicted.
+	maxRateLimitBuckets = 10000
+)
+
+// rateLimiter is a token bucket per client. Buckets that have refilled are
+// swept periodically so one-off clients don't accumulate.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil when rate is not positive, which disables
+// limiting.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token for key. When none is left it reports how long until
+// the next one is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.sweep(now)
+		}
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.evictIdlest()
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that would be full by now. Must be called with mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// evictIdlest drops the bucket used longest ago. Must be called with mu held.
+func (l *rateLimiter) evictIdlest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, b := range l.buckets {
+		if oldestKey == "" || b.last.Before(oldest) {
+			oldestKey, oldest = key, b.last
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// rateLimitKey identifies the client by its remote IP. The API has no
+// authentication, so headers such as Authorization or X-Forwarded-For are
+// not trusted: a client could send a new value on every request.
+func rateLimitKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimited reports whether the request should be limited at all; only
+// API routes hit the database.
+func rateLimited(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
@@ -2,16 +2,22 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/illenko/whodidthis/api/handler"
+	"github.com/illenko/whodidthis/storage"
 )
 
 type Server struct {
 	httpServer *http.Server
+	certFile   string
+	keyFile    string
 }
 
 type ServerConfig struct {
@@ -19,6 +25,21 @@ type ServerConfig struct {
 	Port         int
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// RateLimit is requests per second per client; 0 disables limiting.
+	RateLimit      float64
+	RateLimitBurst int
+	// AccessLog writes a JSON line per request to stdout.
+	AccessLog bool
+	// Audit records mutating requests; optional.
+	Audit storage.AuditRepo
+	CORS  CORSConfig
+	// TLS is served when both files are set, or with a generated
+	// certificate when TLSSelfSigned is set.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSelfSigned bool
+	// Metrics serves GET /metrics when set.
+	Metrics http.Handler
 }
 
 func NewServer(
@@ -28,7 +49,20 @@ func NewServer(
 	servicesHandler *handler.ServicesHandler,
 	metricsHandler *handler.MetricsHandler,
 	labelsHandler *handler.LabelsHandler,
-	cfg ServerConfig) *Server {
+	teamsHandler *handler.TeamsHandler,
+	searchHandler *handler.SearchHandler,
+	adminHandler *handler.AdminHandler,
+	graphqlHandler *handler.GraphQLHandler,
+	logsHandler *handler.LogsHandler,
+	reportsHandler *handler.ReportsHandler,
+	diffHandler *handler.DiffHandler,
+	baselineHandler *handler.BaselineHandler,
+	violationsHandler *handler.ViolationsHandler,
+	findingsHandler *handler.FindingsHandler,
+	slackHandler *handler.SlackHandler,
+	grafanaHandler *handler.GrafanaHandler,
+	hub *Hub,
+	cfg ServerConfig) (*Server, error) {
 	if cfg.ReadTimeout == 0 {
 		cfg.ReadTimeout = 30 * time.Second
 	}
@@ -39,14 +73,50 @@ func NewServer(
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /health", healthHandler.Health)
+	mux.HandleFunc("GET /livez", healthHandler.Live)
+	mux.HandleFunc("GET /readyz", healthHandler.Ready)
+	if cfg.Metrics != nil {
+		mux.Handle("GET /metrics", cfg.Metrics)
+	}
 
 	mux.HandleFunc("POST /api/scan", scansHandler.Trigger)
+	mux.HandleFunc("POST /api/scan/service/{name}", scansHandler.TriggerService)
+	mux.HandleFunc("POST /api/scan/cancel", scansHandler.Cancel)
+	mux.HandleFunc("POST /api/scheduler/pause", scansHandler.Pause)
+	mux.HandleFunc("POST /api/scheduler/resume", scansHandler.Resume)
 	mux.HandleFunc("GET /api/scan/status", scansHandler.GetStatus)
+	mux.HandleFunc("GET /api/scan/progress/stream", scansHandler.ProgressStream)
+	mux.HandleFunc("GET /api/scan/history", scansHandler.History)
 	mux.HandleFunc("GET /api/scans", scansHandler.List)
 	mux.HandleFunc("GET /api/scans/latest", scansHandler.GetLatest)
 	mux.HandleFunc("GET /api/scans/{id}", scansHandler.Get)
+	mux.HandleFunc("GET /api/scans/{id}/export", scansHandler.Export)
+	mux.HandleFunc("GET /api/scans/{id}/report.html", reportsHandler.HTML)
+	mux.HandleFunc("GET /api/scans/{id}/report.md", reportsHandler.Markdown)
+	mux.HandleFunc("POST /api/scans/{id}/baseline", baselineHandler.Set)
+	mux.HandleFunc("GET /api/scans/{id}/regressions", baselineHandler.Regressions)
+	mux.HandleFunc("GET /api/baseline", baselineHandler.Get)
+	mux.HandleFunc("DELETE /api/baseline", baselineHandler.Clear)
+	mux.HandleFunc("GET /api/violations", violationsHandler.List)
+	mux.HandleFunc("GET /api/findings", findingsHandler.List)
+	mux.HandleFunc("GET /api/findings/{id}", findingsHandler.Get)
+	mux.HandleFunc("POST /api/findings/{id}/acknowledge", findingsHandler.Acknowledge)
+	mux.HandleFunc("POST /api/findings/{id}/ticket", findingsHandler.Ticket)
+	mux.HandleFunc("POST /api/findings/{id}/issue", findingsHandler.Issue)
+	mux.HandleFunc("POST /api/findings/{id}/snooze", findingsHandler.Snooze)
+	mux.HandleFunc("DELETE /api/findings/{id}/snooze", findingsHandler.Unsnooze)
+	mux.HandleFunc("GET /api/ignores", findingsHandler.Ignores)
+	mux.HandleFunc("POST /api/ignores", findingsHandler.CreateIgnore)
+	mux.HandleFunc("DELETE /api/ignores/{id}", findingsHandler.DeleteIgnore)
+	mux.HandleFunc("POST /api/scans/import", scansHandler.Import)
+
+	mux.HandleFunc("POST /api/slack/commands", slackHandler.Command)
+	mux.HandleFunc("POST /api/slack/interactions", slackHandler.Interaction)
 
 	mux.HandleFunc("GET /api/scans/{id}/services", servicesHandler.List)
+	mux.HandleFunc("GET /api/scans/{id}/teams", teamsHandler.List)
+	mux.HandleFunc("GET /api/scans/{id}/top", metricsHandler.Top)
+	mux.HandleFunc("GET /api/scans/{id}/search", searchHandler.Search)
 	mux.HandleFunc("GET /api/scans/{id}/services/{service}", servicesHandler.Get)
 
 	mux.HandleFunc("GET /api/scans/{id}/services/{service}/metrics", metricsHandler.List)
@@ -54,25 +124,79 @@ func NewServer(
 
 	mux.HandleFunc("GET /api/scans/{id}/services/{service}/metrics/{metric}/labels", labelsHandler.List)
 
+	mux.HandleFunc("GET /api/scans/{id}/logs", logsHandler.List)
+	mux.HandleFunc("GET /api/scans/{id}/logs/{service}", logsHandler.Get)
+
+	mux.HandleFunc("GET /api/services/{service}/trend", servicesHandler.Trend)
+	mux.HandleFunc("GET /api/teams/{team}/trend", teamsHandler.Trend)
+	mux.HandleFunc("GET /api/logs/{service}/trend", logsHandler.Trend)
+	mux.HandleFunc("GET /api/metrics/{metric}/trend", metricsHandler.Trend)
+	mux.HandleFunc("GET /api/history/metrics", metricsHandler.History)
+	mux.HandleFunc("GET /api/diff", diffHandler.Diff)
+
 	mux.HandleFunc("POST /api/analysis", analysisHandler.Start)
 	mux.HandleFunc("GET /api/analysis", analysisHandler.Get)
 	mux.HandleFunc("DELETE /api/analysis", analysisHandler.Delete)
 	mux.HandleFunc("GET /api/analysis/status", analysisHandler.GetStatus)
+	mux.HandleFunc("GET /api/analysis/cost", analysisHandler.Cost)
+	mux.HandleFunc("GET /api/analysis/findings", findingsHandler.Analysis)
 	mux.HandleFunc("GET /api/scans/{id}/analyses", analysisHandler.ListBySnapshot)
 
+	mux.HandleFunc("POST /api/admin/backup", adminHandler.Backup)
+	mux.HandleFunc("GET /api/admin/audit", adminHandler.Audit)
+
+	mux.HandleFunc("GET /api/grafana", grafanaHandler.Test)
+	mux.HandleFunc("POST /api/grafana/search", grafanaHandler.Search)
+	mux.HandleFunc("POST /api/grafana/metrics", grafanaHandler.Metrics)
+	mux.HandleFunc("POST /api/grafana/query", grafanaHandler.Query)
+
+	mux.HandleFunc("GET /api/graphql", graphqlHandler.Query)
+	mux.HandleFunc("POST /api/graphql", graphqlHandler.Query)
+
+	mux.HandleFunc("GET /ws", hub.ServeWS)
+
 	mux.Handle("/", staticHandler())
 
-	return &Server{
+	var accessLog *slog.Logger
+	if cfg.AccessLog {
+		accessLog = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+
+	h := withAudit(withETag(mux), cfg.Audit)
+	h = withMiddleware(h, newCORSPolicy(cfg.CORS), newRateLimiter(cfg.RateLimit, cfg.RateLimitBurst), accessLog)
+
+	srv := &Server{
 		httpServer: &http.Server{
 			Addr:         cfg.Host + ":" + strconv.Itoa(cfg.Port),
-			Handler:      withMiddleware(mux),
+			Handler:      h,
 			ReadTimeout:  cfg.ReadTimeout,
 			WriteTimeout: cfg.WriteTimeout,
 		},
+		certFile: cfg.TLSCertFile,
+		keyFile:  cfg.TLSKeyFile,
 	}
+
+	if cfg.TLSSelfSigned {
+		cert, err := selfSignedCert(cfg.Host)
+		if err != nil {
+			return nil, fmt.Errorf("self-signed certificate: %w", err)
+		}
+		srv.httpServer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	} else if srv.certFile != "" {
+		srv.httpServer.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return srv, nil
 }
 
 func (s *Server) Start() error {
+	if s.httpServer.TLSConfig != nil {
+		slog.Info("starting HTTPS server", "addr", s.httpServer.Addr, "self_signed", s.certFile == "")
+		return s.httpServer.ListenAndServeTLS(s.certFile, s.keyFile)
+	}
 	slog.Info("starting HTTP server", "addr", s.httpServer.Addr)
 	return s.httpServer.ListenAndServe()
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/drift"
+	"github.com/illenko/whodidthis/export"
+	"github.com/illenko/whodidthis/findings"
+	"github.com/illenko/whodidthis/grafana"
+	"github.com/illenko/whodidthis/limits"
+	"github.com/illenko/whodidthis/loki"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/scheduler"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// app holds what both the server and the one-shot CLI commands need: the
+// database, its repositories and the scan pipeline.
+type app struct {
+	db *storage.DB
+
+	snapshots   *storage.SnapshotsRepository
+	services    *storage.ServicesRepository
+	metrics     *storage.MetricsRepository
+	labels      *storage.LabelsRepository
+	settings    *storage.SettingsRepository
+	scanRuns    *storage.ScanRunsRepository
+	search      *storage.SearchRepository
+	audit       *storage.AuditRepository
+	logStreams  *storage.LogStreamsRepository
+	regressions *storage.RegressionsRepository
+	violations  *storage.ViolationsRepository
+	findings    *storage.FindingsRepository
+}
+
+func openApp(cfg *config.Config) (*app, error) {
+	db, err := storage.New(cfg.Storage.Path)
+	if err != nil {
+		return nil, fmt.Errorf("init database: %w", err)
+	}
+	return &app{
+		db:          db,
+		snapshots:   storage.NewSnapshotsRepository(db),
+		services:    storage.NewServicesRepository(db),
+		metrics:     storage.NewMetricsRepository(db),
+		labels:      storage.NewLabelsRepository(db),
+		settings:    storage.NewSettingsRepository(db),
+		scanRuns:    storage.NewScanRunsRepository(db),
+		search:      storage.NewSearchRepository(db),
+		audit:       storage.NewAuditRepository(db),
+		logStreams:  storage.NewLogStreamsRepository(db),
+		regressions: storage.NewRegressionsRepository(db),
+		violations:  storage.NewViolationsRepository(db),
+		findings:    storage.NewFindingsRepository(db),
+	}, nil
+}
+
+// abortInterrupted marks the snapshots and scan runs a previous process
+// left running as aborted. Only the server calls it: a CLI scan may run
+// next to a live server.
+func (a *app) abortInterrupted(ctx context.Context) error {
+	snapshots, err := a.snapshots.AbortRunning(ctx)
+	if err != nil {
+		return fmt.Errorf("abort interrupted snapshots: %w", err)
+	}
+	runs, err := a.scanRuns.AbortRunning(ctx)
+	if err != nil {
+		return fmt.Errorf("abort interrupted scan runs: %w", err)
+	}
+	if snapshots > 0 || runs > 0 {
+		slog.Warn("marked scans interrupted by a restart as aborted", "snapshots", snapshots, "scan_runs", runs)
+	}
+	return nil
+}
+
+func (a *app) Close() {
+	if err := a.db.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
+}
+
+// pipeline is the scan side of the app: the metrics source, the optional
+// service source and Loki client, and the post-scan hooks.
+type pipeline struct {
+	app        *app
+	client     collector.Source
+	source     collector.ServiceSource
+	loki       *loki.Client
+	postScan   []scheduler.PostScanHook
+	logStreams storage.LogStreamsRepo
+	drift      *drift.Detector
+	limits     *limits.Checker
+	resolver   *findings.Resolver
+	// annotator is nil unless Grafana annotations are enabled.
+	annotator *grafana.Annotator
+}
+
+func (a *app) newPipeline(cfg *config.Config) (*pipeline, error) {
+	client, err := collector.NewSource(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create metrics source: %w", err)
+	}
+	p := &pipeline{app: a, client: client}
+
+	if cfg.Discovery.Kubernetes.Enabled {
+		kube, err := newKubernetesClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		p.source = collector.NewKubernetesSource(kube, cfg.Discovery.Kubernetes)
+	}
+
+	if cfg.Loki.URL != "" {
+		p.loki = newLokiClient(cfg)
+		lokiCollector := collector.NewLokiCollector(p.loki, a.logStreams, cfg)
+		p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "loki", Run: lokiCollector.AfterScan})
+		p.logStreams = a.logStreams
+		slog.Info("loki collection enabled", "url", cfg.Loki.URL, "service_label", cfg.Loki.ServiceLabel)
+	}
+	p.drift = drift.NewDetector(a.snapshots, a.services, a.regressions, cfg.Baseline)
+	p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "baseline_drift", Run: p.drift.AfterScan})
+	p.limits = limits.NewChecker(a.snapshots, a.services, a.metrics, a.violations, cfg.Limits)
+	p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "limits", Run: p.limits.AfterScan})
+	p.resolver = findings.NewResolver(a.snapshots, a.services, a.metrics, a.labels, a.findings, cfg.Detection)
+	p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "findings", Run: p.resolver.AfterScan})
+	if cfg.Grafana.Enabled() {
+		p.annotator = grafana.NewAnnotator(cfg.Grafana, cfg.Baseline, a.snapshots, a.services, a.findings)
+		p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "grafana_annotations", Run: p.annotator.AfterScan})
+		slog.Info("grafana annotations enabled", "url", cfg.Grafana.URL)
+	}
+	if cfg.Export.Parquet.Enabled() {
+		exporter, err := export.NewParquetExporter(context.Background(), cfg.Export.Parquet, a.snapshots, a.services, a.metrics, a.labels)
+		if err != nil {
+			return nil, fmt.Errorf("create parquet exporter: %w", err)
+		}
+		p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "parquet_export", Run: exporter.AfterScan})
+		slog.Info("parquet export enabled", "destination", cfg.Export.Parquet.Destination)
+	}
+	if cfg.Export.RemoteWrite.Enabled() {
+		writer := export.NewRemoteWriter(cfg.Export.RemoteWrite, a.snapshots, a.services)
+		p.postScan = append(p.postScan, scheduler.PostScanHook{Name: "remote_write", Run: writer.AfterScan})
+		slog.Info("remote write enabled", "url", cfg.Export.RemoteWrite.URL)
+	}
+	return p, nil
+}
+
+// reload applies the thresholds of the post-scan checks from cfg; the hooks
+// themselves, and which of them run, keep their startup settings.
+func (p *pipeline) reload(cfg *config.Config) {
+	p.drift.SetConfig(cfg.Baseline)
+	p.limits.SetLimits(cfg.Limits)
+	p.resolver.SetDetection(cfg.Detection)
+	if p.annotator != nil {
+		p.annotator.SetSpikeThresholds(cfg.Baseline)
+	}
+}
+
+func (p *pipeline) newCollector(cfg *config.Config) *collector.Collector {
+	return collector.NewCollector(
+		p.client,
+		p.app.snapshots,
+		p.app.services,
+		p.app.metrics,
+		p.app.labels,
+		p.source,
+		cfg,
+	)
+}
+
+// schedulerConfig builds the scheduler settings; events may be nil.
+func (p *pipeline) schedulerConfig(cfg *config.Config, events models.EventPublisher) scheduler.Config {
+	return scheduler.Config{
+		Interval:        cfg.Scan.Interval,
+		Retention:       cfg.RetentionDuration(),
+		DownsampleAfter: cfg.DownsampleDuration(),
+		QueueSize:       cfg.Scan.QueueSize,
+		DB:              p.app.db,
+		Settings:        p.app.settings,
+		Blackouts:       cfg.Scan.BlackoutWindows,
+		ScanRuns:        p.app.scanRuns,
+		PostScan:        p.postScan,
+		Events:          events,
+	}
+}
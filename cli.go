@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/notify"
+	"github.com/illenko/whodidthis/report"
+	"github.com/illenko/whodidthis/scheduler"
+	"github.com/illenko/whodidthis/tui"
+	"github.com/spf13/cobra"
+)
+
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:     "whodidthis",
+		Short:   "Track Prometheus cardinality per service over time",
+		Long:    "Without a subcommand whodidthis runs the server, like whodidthis serve.",
+		Version: fmt.Sprintf("%s (commit %s, built %s)", version, commit, buildTime),
+		Args:    cobra.NoArgs,
+		// Errors are logged by main; usage is only shown for --help.
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(*cobra.Command, []string) error {
+			return run()
+		},
+	}
+	root.PersistentFlags().StringVar(&configFlag, "config", "", "config file (default $CONFIG_PATH or config.yaml)")
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Run the scheduler and HTTP server",
+			Args:  cobra.NoArgs,
+			RunE: func(*cobra.Command, []string) error {
+				return run()
+			},
+		},
+		newScanCmd(),
+		newDiffCmd(),
+		newTopCmd(),
+		newReportCmd(),
+		newDigestCmd(),
+		newTUICmd(),
+		newValidateCmd(),
+		&cobra.Command{
+			Use:   "restore <backup-file>",
+			Short: "Replace the database with a backup; stop the server first",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(_ *cobra.Command, args []string) error {
+				return runRestore(args[0])
+			},
+		},
+	)
+	return root
+}
+
+func newValidateCmd() *cobra.Command {
+	var offline bool
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config and connectivity, and print effective settings",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return runValidate(offline)
+		},
+	}
+	cmd.Flags().BoolVar(&offline, "offline", false, "skip connectivity checks")
+	return cmd
+}
+
+// openCLI loads the config and opens the database for a one-shot command.
+// Logs go to stderr so stdout only carries the command's output.
+func openCLI() (*config.Config, *app, error) {
+	cfg, err := config.Load(configPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel()})))
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, a, nil
+}
+
+func newScanCmd() *cobra.Command {
+	var service string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Run one scan into the database and exit",
+		Long:  "Runs a full scan, or rescans one service into the latest snapshot, with the same post-scan hooks and retention cleanup as the server. Exits non-zero when the scan fails.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+
+			pipe, err := a.newPipeline(cfg)
+			if err != nil {
+				return err
+			}
+			sched := scheduler.New(pipe.newCollector(cfg), pipe.schedulerConfig(cfg, nil))
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			result, err := sched.RunOnce(ctx, scheduler.ScanRequest{Trigger: models.ScanTriggerCLI, Service: service})
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				return writeJSONTo(cmd.OutOrStdout(), map[string]any{
+					"snapshot_id":      result.SnapshotID,
+					"total_services":   result.TotalServices,
+					"total_series":     result.TotalSeries,
+					"missing_services": result.MissingServices,
+					"failed_services":  result.ServiceErrors,
+					"duration":         result.Duration.String(),
+				})
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "snapshot\t%d\n", result.SnapshotID)
+			fmt.Fprintf(w, "services\t%d\n", result.TotalServices)
+			fmt.Fprintf(w, "series\t%d\n", result.TotalSeries)
+			fmt.Fprintf(w, "failed services\t%d\n", result.ServiceErrors)
+			fmt.Fprintf(w, "duration\t%s\n", result.Duration)
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&service, "service", "", "rescan only this service into the latest snapshot")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the result as JSON")
+	return cmd
+}
+
+func newDiffCmd() *cobra.Command {
+	var all, asJSON, asMarkdown bool
+	var limit int
+	var team string
+	cmd := &cobra.Command{
+		Use:   "diff [<from-id> <to-id>]",
+		Short: "Compare services between two snapshots",
+		Long:  "Compares per-service series counts between two snapshots, biggest change first. Without IDs the latest snapshot is compared with the one before it.",
+		Args: cobra.MatchAll(cobra.RangeArgs(0, 2), func(_ *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return fmt.Errorf("diff needs both snapshot IDs or none")
+			}
+			return nil
+		}),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+			ctx := cmd.Context()
+
+			fromID, toID, err := resolveDiffIDs(ctx, a, args)
+			if err != nil {
+				return err
+			}
+
+			diffs, err := a.services.Diff(ctx, fromID, toID)
+			if err != nil {
+				return err
+			}
+			shown := make([]models.ServiceDiff, 0, len(diffs))
+			for _, d := range diffs {
+				if (all || d.Status != models.DiffUnchanged) && (team == "" || d.Team == team) {
+					shown = append(shown, d)
+				}
+			}
+			if limit > 0 && len(shown) > limit {
+				shown = shown[:limit]
+			}
+
+			if asJSON {
+				return writeJSONTo(cmd.OutOrStdout(), shown)
+			}
+			if asMarkdown {
+				return report.WriteDiffMarkdown(cmd.OutOrStdout(), fromID, toID, shown)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "snapshot %d -> %d\n", fromID, toID)
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tTEAM\tSTATUS\tBEFORE\tAFTER\tDELTA")
+			for _, d := range shown {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%+d\n", d.ServiceName, d.Team, d.Status, d.PreviousSeries, d.CurrentSeries, d.SeriesDelta)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "include unchanged services")
+	cmd.Flags().StringVar(&team, "team", "", "only this team's services")
+	cmd.Flags().IntVar(&limit, "limit", 0, "show at most this many services (0 = all)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the diff as JSON")
+	cmd.Flags().BoolVar(&asMarkdown, "markdown", false, "print the diff as a markdown table")
+	cmd.MarkFlagsMutuallyExclusive("json", "markdown")
+	return cmd
+}
+
+func resolveDiffIDs(ctx context.Context, a *app, args []string) (int64, int64, error) {
+	if len(args) == 2 {
+		fromID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid snapshot id %q", args[0])
+		}
+		toID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid snapshot id %q", args[1])
+		}
+		for _, id := range []int64{fromID, toID} {
+			snap, err := a.snapshots.GetByID(ctx, id)
+			if err != nil {
+				return 0, 0, err
+			}
+			if snap == nil {
+				return 0, 0, fmt.Errorf("snapshot %d not found", id)
+			}
+		}
+		return fromID, toID, nil
+	}
+
+	latest, err := a.snapshots.GetLatest(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if latest == nil {
+		return 0, 0, fmt.Errorf("no snapshots yet")
+	}
+	previous, err := a.snapshots.GetPrevious(ctx, latest.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if previous == nil {
+		return 0, 0, fmt.Errorf("only one snapshot, nothing to compare")
+	}
+	return previous.ID, latest.ID, nil
+}
+
+func newTopCmd() *cobra.Command {
+	var scanID int64
+	var by string
+	var limit int
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "List the biggest metrics of a snapshot",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if by != "series" && by != "labels" && by != "growth" {
+				return fmt.Errorf("--by must be series, labels or growth")
+			}
+			_, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+			ctx := cmd.Context()
+
+			var snap *models.Snapshot
+			if scanID > 0 {
+				snap, err = a.snapshots.GetByID(ctx, scanID)
+			} else {
+				snap, err = a.snapshots.GetLatest(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			if snap == nil {
+				return fmt.Errorf("snapshot not found")
+			}
+			var previousID int64
+			previous, err := a.snapshots.GetPrevious(ctx, snap.ID)
+			if err != nil {
+				return err
+			}
+			if previous != nil {
+				previousID = previous.ID
+			}
+
+			top, err := a.metrics.Top(ctx, snap.ID, previousID, by, limit)
+			if err != nil {
+				return err
+			}
+			if top == nil {
+				top = []models.TopMetric{}
+			}
+
+			if asJSON {
+				return writeJSONTo(cmd.OutOrStdout(), top)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "snapshot %d (%s)\n", snap.ID, snap.CollectedAt.Format("2006-01-02 15:04"))
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tMETRIC\tSERIES\tLABELS\tDELTA")
+			for _, m := range top {
+				delta := "-"
+				if m.SeriesDelta != nil {
+					delta = fmt.Sprintf("%+d", *m.SeriesDelta)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", m.ServiceName, m.MetricName, m.SeriesCount, m.LabelCount, delta)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Int64Var(&scanID, "scan", 0, "snapshot ID (default latest)")
+	cmd.Flags().StringVar(&by, "by", "series", "order by series, labels or growth")
+	cmd.Flags().IntVar(&limit, "limit", 20, "number of metrics")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print as JSON")
+	return cmd
+}
+
+func newReportCmd() *cobra.Command {
+	var compareID int64
+	var output, format string
+	cmd := &cobra.Command{
+		Use:   "report [<scan-id>]",
+		Short: "Write a standalone HTML or markdown report of a snapshot",
+		Long:  "Writes a single-file report of a snapshot (default latest) compared with the snapshot before it, or with --compare.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			render := (*report.Report).WriteHTML
+			switch format {
+			case "html":
+			case "markdown", "md":
+				render = (*report.Report).WriteMarkdown
+			default:
+				return fmt.Errorf("--format must be html or markdown")
+			}
+			cfg, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+			ctx := cmd.Context()
+
+			var id int64
+			if len(args) == 1 {
+				id, err = strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid snapshot id %q", args[0])
+				}
+			} else {
+				latest, err := a.snapshots.GetLatest(ctx)
+				if err != nil {
+					return err
+				}
+				if latest == nil {
+					return fmt.Errorf("no snapshots yet")
+				}
+				id = latest.ID
+			}
+
+			rep, err := report.NewBuilder(a.snapshots, a.services, a.metrics, a.findings, cfg.Cost).Build(ctx, id, compareID)
+			if err != nil {
+				return err
+			}
+			if rep == nil {
+				return fmt.Errorf("snapshot not found")
+			}
+
+			if output == "" || output == "-" {
+				return render(rep, cmd.OutOrStdout())
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := render(rep, f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+	cmd.Flags().Int64Var(&compareID, "compare", 0, "snapshot ID to compare with (default the previous one)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write to this file instead of stdout")
+	cmd.Flags().StringVar(&format, "format", "html", "html or markdown")
+	return cmd
+}
+
+func newDigestCmd() *cobra.Command {
+	var send bool
+	cmd := &cobra.Command{
+		Use:   "digest",
+		Short: "Print the digest, or send it to the notification targets",
+		Long:  "Builds the digest over digest.window from the latest snapshot and prints it as markdown. With --send it goes to notifications.webhooks instead, as on the digest schedule.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+
+			builder := report.NewBuilder(a.snapshots, a.services, a.metrics, a.findings, cfg.Cost)
+			if send {
+				if len(cfg.Notifications.Webhooks) == 0 {
+					return fmt.Errorf("no notifications.webhooks configured")
+				}
+				return report.NewDigestJob(builder, notify.NewWebhooks(cfg.Notifications), cfg.Digest).Send(cmd.Context())
+			}
+
+			d, err := builder.Digest(cmd.Context(), cfg.Digest.Window, cfg.Digest.Top)
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				return fmt.Errorf("not enough snapshots for a digest")
+			}
+			msg := d.Message()
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "## %s\n\n%s", msg.Title, msg.Text)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&send, "send", false, "deliver to the configured webhooks")
+	return cmd
+}
+
+func newTUICmd() *cobra.Command {
+	var logFile string
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Browse the latest snapshot in an interactive terminal view",
+		Long:  "Shows the services of the latest snapshot with drill-down into their metrics and labels. Scans started with s run in this process, with the same hooks as the scan command.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, a, err := openCLI()
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+
+			// Logs would draw over the screen, so they go to a file or nowhere.
+			logOut := io.Discard
+			if logFile != "" {
+				f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					return fmt.Errorf("open log file: %w", err)
+				}
+				defer f.Close()
+				logOut = f
+			}
+			slog.SetDefault(slog.New(slog.NewTextHandler(logOut, &slog.HandlerOptions{Level: cfg.LogLevel()})))
+
+			pipe, err := a.newPipeline(cfg)
+			if err != nil {
+				return err
+			}
+			sched := scheduler.New(pipe.newCollector(cfg), pipe.schedulerConfig(cfg, nil))
+
+			return tui.Run(cmd.Context(), tui.Config{
+				Snapshots: a.snapshots,
+				Services:  a.services,
+				Metrics:   a.metrics,
+				Labels:    a.labels,
+				Scanner:   sched,
+			})
+		},
+	}
+	cmd.Flags().StringVar(&logFile, "log-file", "", "append logs to this file (default discard)")
+	return cmd
+}
+
+func writeJSONTo(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,109 @@
+// Package cloudwatch audits custom CloudWatch metrics. CloudWatch bills
+// every metric name and dimension combination as a metric of its own, so
+// each listed metric is counted as a series, labelled with its dimensions
+// and its namespace.
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/prometheus/common/model"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// NamespaceLabel carries the metric's namespace, so it can serve as a
+// discovery label.
+const NamespaceLabel = "Namespace"
+
+type Config struct {
+	Region string
+	// Endpoint overrides the CloudWatch endpoint, e.g. for LocalStack.
+	Endpoint   string
+	Namespaces []string
+	// IncludeInactive also lists metrics without data in the last three
+	// hours, which CloudWatch keeps for two weeks.
+	IncludeInactive bool
+	SkipLabels      []string
+}
+
+// Client lists the metrics of the configured namespaces once per scan and
+// answers the scan from them.
+type Client struct {
+	*prometheus.SeriesClient
+
+	api        *cloudwatch.Client
+	namespaces []string
+	active     types.RecentlyActive
+}
+
+// NewClient takes credentials from the standard AWS environment variables,
+// shared config or instance role.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	c := &Client{
+		api: cloudwatch.NewFromConfig(awsCfg, func(o *cloudwatch.Options) {
+			if cfg.Endpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.Endpoint)
+			}
+		}),
+		namespaces: cfg.Namespaces,
+	}
+	if !cfg.IncludeInactive {
+		c.active = types.RecentlyActivePt3h
+	}
+	c.SeriesClient = prometheus.NewSeriesClient(c.listSeries, cfg.SkipLabels)
+	return c, nil
+}
+
+// HealthCheck lists the first page of the first namespace.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	_, err := c.api.ListMetrics(ctx, &cloudwatch.ListMetricsInput{
+		Namespace:      aws.String(c.namespaces[0]),
+		RecentlyActive: c.active,
+	})
+	if err != nil {
+		return fmt.Errorf("cloudwatch health check failed: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) listSeries(ctx context.Context) ([]model.LabelSet, error) {
+	var series []model.LabelSet
+	for _, namespace := range c.namespaces {
+		pages := cloudwatch.NewListMetricsPaginator(c.api, &cloudwatch.ListMetricsInput{
+			Namespace:      aws.String(namespace),
+			RecentlyActive: c.active,
+		})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list metrics of %s: %w", namespace, err)
+			}
+			for _, m := range page.Metrics {
+				ls := model.LabelSet{
+					model.MetricNameLabel: model.LabelValue(aws.ToString(m.MetricName)),
+					NamespaceLabel:        model.LabelValue(aws.ToString(m.Namespace)),
+				}
+				for _, d := range m.Dimensions {
+					ls[model.LabelName(aws.ToString(d.Name))] = model.LabelValue(aws.ToString(d.Value))
+				}
+				series = append(series, ls)
+			}
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// fixedScanQueries are the requests of a full scan besides its services and
+// metrics: TSDB status, discovery and metadata.
+const fixedScanQueries = 3
+
+// queryPlan is how a full scan spends scan.max_queries: the metrics of
+// every service are listed up front, then drilled into largest first while
+// the budget lasts, using the same estimate as a dry run.
+type queryPlan struct {
+	listed map[string]listedMetrics
+	// undrilled are the metrics, per service, left without label queries.
+	undrilled map[string]map[string]bool
+	dropped   int
+}
+
+type listedMetrics struct {
+	metrics []prometheus.MetricInfo
+	err     error
+}
+
+// lookup returns what the plan listed for the service; nothing without a
+// plan or when the scan was cancelled before the service was listed.
+func (p *queryPlan) lookup(service string) (listedMetrics, bool) {
+	if p == nil {
+		return listedMetrics{}, false
+	}
+	listed, ok := p.listed[service]
+	return listed, ok
+}
+
+// drill reports whether the metric's labels are to be collected; always
+// without a plan.
+func (p *queryPlan) drill(service, metric string) bool {
+	return p == nil || !p.undrilled[service][metric]
+}
+
+// planQueries lists the metrics of services and leaves the smallest ones
+// undrilled where the scan would otherwise go over c.maxQueries. Label
+// counts for the estimate come from the snapshot latestID.
+func (c *Collector) planQueries(ctx context.Context, lim *limiter, services []prometheus.ServiceInfo, metadata map[string]prometheus.MetricMetadata, latestID int64) *queryPlan {
+	plan := &queryPlan{
+		listed:    make(map[string]listedMetrics, len(services)),
+		undrilled: make(map[string]map[string]bool),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, svc := range services {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if lim.acquire(ctx) != nil {
+				return
+			}
+			defer lim.release()
+
+			svcCtx, cancel := context.WithTimeout(ctx, c.serviceTimeout(name))
+			defer cancel()
+			start := time.Now()
+			metrics, err := c.client.GetMetricsForService(svcCtx, c.serviceLabels, name)
+			if ctx.Err() == nil {
+				lim.observe(start, 1, err)
+			}
+
+			mu.Lock()
+			plan.listed[name] = listedMetrics{metrics: metrics, err: err}
+			mu.Unlock()
+		}(svc.Name)
+	}
+	wg.Wait()
+
+	type candidate struct {
+		service string
+		metric  prometheus.MetricInfo
+		cost    int
+	}
+	var candidates []candidate
+	for service, listed := range plan.listed {
+		if listed.err != nil {
+			continue
+		}
+		metrics, _ := c.filterMetrics(listed.metrics)
+		labelCounts, err := c.labelCounts(ctx, latestID, service)
+		if err != nil {
+			c.logger.Warn("failed to read label counts for the query budget", "service", service, "error", err)
+		}
+		for _, m := range metrics {
+			candidates = append(candidates, candidate{service, m, c.metricQueries(m, labelCounts, metadata)})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(
+			cmp.Compare(b.metric.SeriesCount, a.metric.SeriesCount),
+			cmp.Compare(a.service, b.service),
+			cmp.Compare(a.metric.Name, b.metric.Name),
+		)
+	})
+
+	budget := c.maxQueries - fixedScanQueries - len(services)
+	for i, cand := range candidates {
+		if cand.cost <= budget {
+			budget -= cand.cost
+			continue
+		}
+		for _, rest := range candidates[i:] {
+			if plan.undrilled[rest.service] == nil {
+				plan.undrilled[rest.service] = make(map[string]bool)
+			}
+			plan.undrilled[rest.service][rest.metric.Name] = true
+		}
+		plan.dropped = len(candidates) - i
+		break
+	}
+	return plan
+}
+
+// metricQueries estimates the requests drilling into a metric takes: its
+// label queries and, for histograms of backends with exemplars, the
+// exemplar query. Metrics missing from labelCounts are taken to have
+// defaultLabelCount labels.
+func (c *Collector) metricQueries(m prometheus.MetricInfo, labelCounts map[string]int, metadata map[string]prometheus.MetricMetadata) int {
+	labels, ok := labelCounts[m.Name]
+	if !ok {
+		labels = defaultLabelCount
+	}
+	queries := c.labelQueries(m.SeriesCount, labels)
+	if _, ok := c.client.(exemplarSource); !ok {
+		return queries
+	}
+	md, native := prometheus.LookupMetadata(m.Name, metadata)
+	if native || prometheus.IsClassicHistogramBucket(m.Name, md.Type) {
+		queries++
+	}
+	return queries
+}
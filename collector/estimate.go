@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/prometheus"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// defaultLabelCount stands in for the label count of metrics the latest
+// snapshot doesn't have.
+const defaultLabelCount = 5
+
+// queryEstimator is implemented by clients whose label collection takes a
+// varying number of requests; any other client is taken to need one per
+// metric.
+type queryEstimator interface {
+	LabelQueries(seriesCount, labelCount int) int
+}
+
+// ScanEstimate is what a full scan would take, as worked out by a dry run.
+// Queries counts every request of the scan, discovery included; the
+// duration assumes they all take QueryLatency, the average seen during the
+// dry run, and run scan.concurrency at a time.
+type ScanEstimate struct {
+	Services          int    `json:"services"`
+	ExcludedServices  int    `json:"excluded_services"`
+	MissingServices   int    `json:"missing_services"`
+	CopiedServices    int    `json:"copied_services"`
+	ServiceErrors     int    `json:"service_errors"`
+	Metrics           int    `json:"metrics"`
+	SkippedMetrics    int    `json:"skipped_metrics"`
+	Series            int64  `json:"series"`
+	DryRunQueries     int    `json:"dry_run_queries"`
+	Queries           int    `json:"queries"`
+	Concurrency       int    `json:"concurrency"`
+	QueryLatency      string `json:"query_latency"`
+	EstimatedDuration string `json:"estimated_duration"`
+}
+
+// Estimate runs service and metric discovery without storing anything and
+// estimates the requests a full scan would make on top: the label queries
+// of every metric and the exemplar query of every histogram. Label counts
+// come from the latest snapshot where it has the metric. Services an
+// incremental scan would copy cost nothing.
+func (c *Collector) Estimate(ctx context.Context) (*ScanEstimate, error) {
+	var mu sync.Mutex
+	var dryRun int
+	var spent time.Duration
+	timed := func(start time.Time) {
+		mu.Lock()
+		dryRun++
+		spent += time.Since(start)
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	serviceInfos, err := c.client.DiscoverServices(ctx, c.serviceLabels)
+	if err != nil {
+		return nil, err
+	}
+	timed(start)
+
+	serviceInfos, excluded := c.filterServices(serviceInfos)
+	var missing []prometheus.ServiceInfo
+	if c.source != nil {
+		serviceInfos, missing, err = c.expectedServices(ctx, serviceInfos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start = time.Now()
+	metadata, err := c.metadata(ctx)
+	if err != nil {
+		c.logger.Warn("failed to get metric metadata, histograms will not be counted", "error", err)
+		metadata = nil
+	}
+	timed(start)
+
+	latest, err := c.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var latestID int64
+	if latest != nil {
+		latestID = latest.ID
+	}
+	var unchanged map[string]int
+	if c.incremental.Enabled && latest != nil {
+		prev, err := c.unchangedServices(ctx, latest.ID, serviceInfos)
+		if err != nil {
+			return nil, err
+		}
+		unchanged = make(map[string]int, len(prev))
+		for name, s := range prev {
+			unchanged[name] = s.MetricCount
+		}
+	}
+
+	est := &ScanEstimate{
+		Services:         len(serviceInfos) + len(missing),
+		ExcludedServices: excluded,
+		MissingServices:  len(missing),
+		Concurrency:      max(c.concurrency, 1),
+		Queries:          fixedScanQueries,
+	}
+
+	lim := newLimiter(c.concurrency, c.adaptive)
+	var wg sync.WaitGroup
+	for _, svc := range serviceInfos {
+		est.Series += int64(svc.SeriesCount)
+		if metrics, ok := unchanged[svc.Name]; ok {
+			est.CopiedServices++
+			est.Metrics += metrics
+			continue
+		}
+
+		wg.Add(1)
+		go func(svc prometheus.ServiceInfo) {
+			defer wg.Done()
+			if lim.acquire(ctx) != nil {
+				return
+			}
+			defer lim.release()
+
+			start := time.Now()
+			metricInfos, err := c.client.GetMetricsForService(ctx, c.serviceLabels, svc.Name)
+			timed(start)
+			if ctx.Err() == nil {
+				lim.observe(start, 1, err)
+			}
+			if err != nil {
+				c.logger.Warn("dry run failed to get metrics", "service", svc.Name, "error", err)
+				mu.Lock()
+				est.ServiceErrors++
+				est.Queries++
+				mu.Unlock()
+				return
+			}
+			metricInfos, skipped := c.filterMetrics(metricInfos)
+
+			labelCounts, err := c.labelCounts(ctx, latestID, svc.Name)
+			if err != nil {
+				c.logger.Warn("dry run failed to read label counts", "service", svc.Name, "error", err)
+			}
+			queries := 1
+			for _, m := range metricInfos {
+				queries += c.metricQueries(m, labelCounts, metadata)
+			}
+
+			mu.Lock()
+			est.Metrics += len(metricInfos)
+			est.SkippedMetrics += skipped
+			est.Queries += queries
+			mu.Unlock()
+		}(svc)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	latency := spent / time.Duration(dryRun)
+	est.DryRunQueries = dryRun
+	est.QueryLatency = latency.Round(time.Millisecond).String()
+	est.EstimatedDuration = (latency * time.Duration(est.Queries) / time.Duration(est.Concurrency)).Round(time.Second).String()
+	return est, nil
+}
+
+func (c *Collector) labelQueries(seriesCount, labelCount int) int {
+	if e, ok := c.client.(queryEstimator); ok {
+		return e.LabelQueries(seriesCount, labelCount)
+	}
+	return 1
+}
+
+// labelCounts maps the service's metrics in the given snapshot to their
+// label counts; it is empty when the snapshot doesn't have the service.
+func (c *Collector) labelCounts(ctx context.Context, snapshotID int64, service string) (map[string]int, error) {
+	if snapshotID == 0 {
+		return nil, nil
+	}
+	svc, err := c.services.GetByName(ctx, snapshotID, service)
+	if err != nil || svc == nil {
+		return nil, err
+	}
+	metrics, err := c.metrics.List(ctx, svc.ID, storage.MetricListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list metrics of %s: %w", service, err)
+	}
+	counts := make(map[string]int, len(metrics))
+	for _, m := range metrics {
+		counts[m.MetricName] = m.LabelCount
+	}
+	return counts, nil
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// filterServices applies discovery include/exclude globs. An empty include
+// list keeps everything; exclude always wins over include.
+func filterServices(services []prometheus.ServiceInfo, include, exclude []string) (kept []prometheus.ServiceInfo, excluded int) {
+	for _, svc := range services {
+		if len(include) > 0 && !matchesAny(svc.Name, include) {
+			excluded++
+			continue
+		}
+		if matchesAny(svc.Name, exclude) {
+			excluded++
+			continue
+		}
+		kept = append(kept, svc)
+	}
+	return kept, excluded
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileMetricPatterns anchors each pattern so "go_.*" matches whole metric
+// names only. Patterns are validated when the config is loaded.
+func compileMetricPatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+func filterMetrics(metrics []prometheus.MetricInfo, exclude []*regexp.Regexp) (kept []prometheus.MetricInfo, skipped int) {
+	if len(exclude) == 0 {
+		return metrics, 0
+	}
+	for _, m := range metrics {
+		if matchesAnyRegexp(m.Name, exclude) {
+			skipped++
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept, skipped
+}
+
+func matchesAnyRegexp(name string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
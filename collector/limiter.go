@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+)
+
+// limiter bounds the scan's in-flight queries. A fixed limiter holds the
+// limit at scan.concurrency; an adaptive one moves it by AIMD on the
+// latency and errors reported through observe.
+type limiter struct {
+	adaptive bool
+	min, max float64
+	target   time.Duration
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	// decreased is when the limit was last halved; answers to queries sent
+	// before then don't halve it again.
+	decreased time.Time
+	changed   chan struct{} // closed and replaced when a slot may be free
+}
+
+func newLimiter(concurrency int, cfg config.AdaptiveConcurrencyConfig) *limiter {
+	l := &limiter{
+		adaptive: cfg.Enabled,
+		limit:    float64(max(concurrency, 1)),
+		changed:  make(chan struct{}),
+	}
+	if cfg.Enabled {
+		l.min = float64(max(cfg.Min, 1))
+		l.max = float64(max(cfg.Max, cfg.Min, 1))
+		l.target = cfg.TargetLatency
+		l.limit = min(max(l.limit, l.min), l.max)
+	}
+	return l
+}
+
+// acquire waits for a free slot.
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.notifyLocked()
+	l.mu.Unlock()
+}
+
+// observe reports how a call of the given number of queries, sent at
+// start, went; its latency is taken per query. Cancellations of the scan
+// itself say nothing about Prometheus and are left out by callers.
+func (l *limiter) observe(start time.Time, queries int, err error) {
+	if !l.adaptive {
+		return
+	}
+	latency := time.Since(start) / time.Duration(max(queries, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil || latency > l.target {
+		if start.Before(l.decreased) {
+			return
+		}
+		l.limit = max(l.limit/2, l.min)
+		l.decreased = time.Now()
+		return
+	}
+	before := int(l.limit)
+	l.limit = min(l.limit+1/l.limit, l.max)
+	if int(l.limit) > before {
+		l.notifyLocked()
+	}
+}
+
+// current is the limit in whole queries.
+func (l *limiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *limiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
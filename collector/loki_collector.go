@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/loki"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// LokiCollector stores per-service stream cardinality from Loki in the
+// snapshot a metrics scan just produced, so logs share its history and
+// retention.
+type LokiCollector struct {
+	client       *loki.Client
+	streams      storage.LogStreamsRepo
+	serviceLabel string
+	include      []string
+	exclude      []string
+	redaction    []redactionRule
+	sampleLimit  int
+	concurrency  int
+	logger       *slog.Logger
+}
+
+func NewLokiCollector(client *loki.Client, streams storage.LogStreamsRepo, cfg *config.Config) *LokiCollector {
+	return &LokiCollector{
+		client:       client,
+		streams:      streams,
+		serviceLabel: cfg.Loki.ServiceLabel,
+		include:      cfg.Discovery.Include,
+		exclude:      cfg.Discovery.Exclude,
+		redaction:    compileRedactionRules(cfg.Scan.Redaction, cfg.Scan.RedactionKey),
+		sampleLimit:  cfg.Scan.SampleValuesLimit,
+		concurrency:  cfg.Scan.Concurrency,
+		logger:       slog.Default(),
+	}
+}
+
+// AfterScan collects streams into the scan's snapshot. It matches
+// scheduler.PostScanHook.Run.
+func (c *LokiCollector) AfterScan(ctx context.Context, result *CollectResult) error {
+	return c.Collect(ctx, result.SnapshotID)
+}
+
+// Collect lists services from the values of the service label, then counts
+// each service's streams and per-label values with one series call.
+// Services that fail are logged and skipped.
+func (c *LokiCollector) Collect(ctx context.Context, snapshotID int64) error {
+	names, err := c.client.LabelValues(ctx, c.serviceLabel)
+	if err != nil {
+		return err
+	}
+
+	var services []string
+	for _, name := range names {
+		if len(c.include) > 0 && !matchesAny(name, c.include) || matchesAny(name, c.exclude) {
+			continue
+		}
+		services = append(services, name)
+	}
+
+	sem := make(chan struct{}, max(c.concurrency, 1))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []error
+	for _, name := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			if err := c.collectService(ctx, snapshotID, name); err != nil {
+				c.logger.Warn("failed to collect log streams", "service", name, "error", err)
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.logger.Info("log stream collection complete", "snapshot_id", snapshotID, "services", len(services), "failed", len(failed))
+	if len(services) > 0 && len(failed) == len(services) {
+		return fmt.Errorf("all %d services failed: %w", len(services), errors.Join(failed...))
+	}
+	return ctx.Err()
+}
+
+func (c *LokiCollector) collectService(ctx context.Context, snapshotID int64, name string) error {
+	series, err := c.client.Series(ctx, fmt.Sprintf("{%s=%q}", c.serviceLabel, name))
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]map[string]struct{})
+	for _, stream := range series {
+		for label, value := range stream {
+			if label == c.serviceLabel {
+				continue
+			}
+			if values[label] == nil {
+				values[label] = make(map[string]struct{})
+			}
+			values[label][value] = struct{}{}
+		}
+	}
+
+	labels := make([]*models.LogLabelSnapshot, 0, len(values))
+	for label, vals := range values {
+		samples := make([]string, 0, min(len(vals), c.sampleLimit))
+		for v := range vals {
+			if len(samples) >= c.sampleLimit {
+				break
+			}
+			samples = append(samples, v)
+		}
+		sort.Strings(samples)
+		samples, redacted := redactValues(samples, c.redaction)
+		labels = append(labels, &models.LogLabelSnapshot{
+			LabelName:         label,
+			UniqueValuesCount: len(vals),
+			SampleValues:      samples,
+			Redacted:          redacted,
+		})
+	}
+
+	_, err = c.streams.Create(ctx, &models.LogServiceSnapshot{
+		SnapshotID:  snapshotID,
+		ServiceName: name,
+		StreamCount: len(series),
+		LabelCount:  len(labels),
+	}, labels)
+	return err
+}
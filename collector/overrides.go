@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// Overrides change the settings of a single full scan; zero values keep
+// the configured ones. Services and Metrics narrow the scan on top of the
+// configured filters, and a scan narrowed by either is stored as filtered:
+// it leaves out services or metrics a full scan would have, so it never
+// becomes the latest or previous snapshot and skips the post-scan hooks.
+type Overrides struct {
+	Concurrency       int `json:"concurrency,omitempty"`
+	SampleValuesLimit int `json:"sample_values_limit,omitempty"`
+	// Services are globs, like discovery.include.
+	Services []string `json:"services,omitempty"`
+	// Metrics are regular expressions matching whole metric names, like
+	// scan.metric_exclude.
+	Metrics []string `json:"metrics,omitempty"`
+}
+
+// IsZero reports whether o changes nothing.
+func (o Overrides) IsZero() bool {
+	return o.Concurrency == 0 && o.SampleValuesLimit == 0 && len(o.Services) == 0 && len(o.Metrics) == 0
+}
+
+// Upper bounds for overrides, which come from an unauthenticated endpoint.
+const (
+	maxOverrideConcurrency       = 50
+	maxOverrideSampleValuesLimit = 1000
+)
+
+func (o Overrides) Validate() error {
+	if o.Concurrency < 0 || o.Concurrency > maxOverrideConcurrency {
+		return fmt.Errorf("concurrency must be between 0 and %d", maxOverrideConcurrency)
+	}
+	if o.SampleValuesLimit < 0 || o.SampleValuesLimit > maxOverrideSampleValuesLimit {
+		return fmt.Errorf("sample_values_limit must be between 0 and %d", maxOverrideSampleValuesLimit)
+	}
+	for _, pattern := range o.Services {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid services pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range o.Metrics {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid metrics pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// WithOverrides returns a copy of the collector with o applied, which must
+// have been validated.
+func (c *Collector) WithOverrides(o Overrides) *Collector {
+	cc := *c
+	if o.Concurrency > 0 {
+		cc.concurrency = o.Concurrency
+	}
+	if o.SampleValuesLimit > 0 {
+		cc.sampleLimit = o.SampleValuesLimit
+	}
+	cc.onlyServices = o.Services
+	cc.onlyMetrics = compileMetricPatterns(o.Metrics)
+	return &cc
+}
+
+// narrowed reports whether overrides leave services or metrics out.
+func (c *Collector) narrowed() bool {
+	return len(c.onlyServices) > 0 || len(c.onlyMetrics) > 0
+}
+
+// filterServices applies the configured include/exclude globs and those of
+// the overrides.
+func (c *Collector) filterServices(services []prometheus.ServiceInfo) (kept []prometheus.ServiceInfo, excluded int) {
+	kept, excluded = filterServices(services, c.include, c.exclude)
+	if len(c.onlyServices) == 0 {
+		return kept, excluded
+	}
+	kept, narrowed := filterServices(kept, c.onlyServices, nil)
+	return kept, excluded + narrowed
+}
+
+// filterMetrics drops the metrics matching scan.metric_exclude and, with
+// overrides, those matching none of their patterns; both count as skipped.
+func (c *Collector) filterMetrics(metrics []prometheus.MetricInfo) (kept []prometheus.MetricInfo, skipped int) {
+	kept, skipped = filterMetrics(metrics, c.metricSkip)
+	if len(c.onlyMetrics) == 0 {
+		return kept, skipped
+	}
+	var only []prometheus.MetricInfo
+	for _, m := range kept {
+		if matchesAnyRegexp(m.Name, c.onlyMetrics) {
+			only = append(only, m)
+		} else {
+			skipped++
+		}
+	}
+	return only, skipped
+}
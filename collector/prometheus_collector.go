@@ -2,8 +2,11 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"regexp"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,47 +17,91 @@ import (
 	"github.com/illenko/whodidthis/storage"
 )
 
-const perServiceTimeout = 2 * time.Minute
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrScanCancelled   = errors.New("scan cancelled")
+)
 
 type Collector struct {
-	client       prometheus.MetricsClient
-	snapshots    storage.SnapshotsRepo
-	services     storage.ServicesRepo
-	metrics      storage.MetricsRepo
-	labels       storage.LabelsRepo
-	serviceLabel string
-	sampleLimit  int
-	concurrency  int
-	logger       *slog.Logger
+	client        Source
+	source        ServiceSource
+	snapshots     storage.SnapshotsRepo
+	services      storage.ServicesRepo
+	metrics       storage.MetricsRepo
+	labels        storage.LabelsRepo
+	serviceLabels []string
+	envLabel      string
+	teams         []config.TeamConfig
+	include       []string
+	exclude       []string
+	metricSkip    []*regexp.Regexp
+	redaction     []redactionRule
+	sampleLimit   int
+	concurrency   int
+	adaptive      config.AdaptiveConcurrencyConfig
+	maxQueries    int
+	incremental   config.IncrementalConfig
+	timeouts      config.TimeoutsConfig
+	logger        *slog.Logger
+
+	// onlyServices and onlyMetrics narrow a single scan; see Overrides.
+	onlyServices []string
+	onlyMetrics  []*regexp.Regexp
 }
 
 func NewCollector(
-	client prometheus.MetricsClient,
+	client Source,
 	snapshots storage.SnapshotsRepo,
 	services storage.ServicesRepo,
 	metrics storage.MetricsRepo,
 	labels storage.LabelsRepo,
+	source ServiceSource,
 	cfg *config.Config,
 ) *Collector {
 	return &Collector{
-		client:       client,
-		snapshots:    snapshots,
-		services:     services,
-		metrics:      metrics,
-		labels:       labels,
-		serviceLabel: cfg.Discovery.ServiceLabel,
-		sampleLimit:  cfg.Scan.SampleValuesLimit,
-		concurrency:  cfg.Scan.Concurrency,
-		logger:       slog.Default(),
+		client:        client,
+		source:        source,
+		snapshots:     snapshots,
+		services:      services,
+		metrics:       metrics,
+		labels:        labels,
+		serviceLabels: cfg.Discovery.ServiceLabels(),
+		envLabel:      cfg.Discovery.EnvironmentLabel,
+		teams:         cfg.Teams,
+		include:       cfg.Discovery.Include,
+		exclude:       cfg.Discovery.Exclude,
+		metricSkip:    compileMetricPatterns(cfg.Scan.MetricExclude),
+		redaction:     compileRedactionRules(cfg.Scan.Redaction, cfg.Scan.RedactionKey),
+		sampleLimit:   cfg.Scan.SampleValuesLimit,
+		concurrency:   cfg.Scan.Concurrency,
+		adaptive:      cfg.Scan.AdaptiveConcurrency,
+		maxQueries:    cfg.Scan.MaxQueries,
+		incremental:   cfg.Scan.Incremental,
+		timeouts:      cfg.Scan.Timeouts,
+		logger:        slog.Default(),
 	}
 }
 
 type CollectResult struct {
-	SnapshotID    int64
-	TotalServices int
-	TotalSeries   int64
-	Duration      time.Duration
-	ServiceErrors int
+	SnapshotID       int64
+	TotalServices    int
+	ExcludedServices int
+	TotalSeries      int64
+	SkippedMetrics   int
+	CopiedServices   int
+	Duration         time.Duration
+	ServiceErrors    int
+	FailedServices   []models.ServiceError
+	// MissingServices are expected by the service source but had no series.
+	MissingServices int
+	// UndrilledMetrics were left without labels by the query budget.
+	UndrilledMetrics int
+	// Filtered is set when overrides narrowed the scan; post-scan hooks
+	// skip such snapshots.
+	Filtered bool
+	// Service names the one service a rescan collected into an existing
+	// snapshot; it is empty for full scans.
+	Service string
 }
 
 type ProgressCallback func(phase string, current, total int, detail string)
@@ -68,11 +115,23 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 		progress = func(string, int, int, string) {}
 	}
 
-	logger.Info("starting service discovery", "label", c.serviceLabel)
+	logger.Info("starting service discovery", "labels", c.serviceLabels)
 	progress("discovering", 0, 0, "Discovering services...")
 
+	// Incremental scans and the query budget read the latest snapshot, which
+	// has to happen before this scan's own is created.
+	var previous *models.Snapshot
+	if c.incremental.Enabled || c.maxQueries > 0 {
+		var err error
+		previous, err = c.snapshots.GetLatest(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	snapshot := &models.Snapshot{
 		CollectedAt: collectedAt,
+		Status:      models.SnapshotStatusRunning,
 	}
 	snapshotID, err := c.snapshots.Create(ctx, snapshot)
 	if err != nil {
@@ -80,17 +139,88 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 	}
 	snapshot.ID = snapshotID
 
-	serviceInfos, err := c.client.DiscoverServices(ctx, c.serviceLabel)
+	progress("tsdb_status", 0, 0, "Reading TSDB status...")
+	c.collectTSDBStatus(ctx, snapshotID)
+
+	serviceInfos, err := c.client.DiscoverServices(ctx, c.serviceLabels)
 	if err != nil {
+		c.finishSnapshot(ctx, snapshot, start, false, err)
 		return nil, err
 	}
 
-	logger.Info("discovered services", "count", len(serviceInfos))
+	serviceInfos, excluded := c.filterServices(serviceInfos)
+
+	var missing []prometheus.ServiceInfo
+	if c.source != nil {
+		serviceInfos, missing, err = c.expectedServices(ctx, serviceInfos)
+		if err != nil {
+			c.finishSnapshot(ctx, snapshot, start, false, err)
+			return nil, err
+		}
+		if err := c.storeMissing(ctx, snapshotID, missing); err != nil {
+			c.finishSnapshot(ctx, snapshot, start, false, err)
+			return nil, err
+		}
+	}
+
+	logger.Info("discovered services", "count", len(serviceInfos), "excluded", excluded, "missing", len(missing))
+
+	metadata, err := c.metadata(ctx)
+	if err != nil {
+		logger.Warn("failed to get metric metadata, metric types will be unknown", "error", err)
+		metadata = nil
+	}
+
+	var unchanged map[string]models.ServiceSnapshot
+	if previous != nil && c.incremental.Enabled {
+		unchanged, err = c.unchangedServices(ctx, previous.ID, serviceInfos)
+		if err != nil {
+			c.finishSnapshot(ctx, snapshot, start, false, err)
+			return nil, err
+		}
+		logger.Info("incremental scan", "previous_snapshot_id", previous.ID, "unchanged_services", len(unchanged))
+	}
+
+	lim := newLimiter(c.concurrency, c.adaptive)
+
+	var plan *queryPlan
+	if c.maxQueries > 0 {
+		var toScan []prometheus.ServiceInfo
+		for _, svc := range serviceInfos {
+			if _, ok := unchanged[svc.Name]; !ok {
+				toScan = append(toScan, svc)
+			}
+		}
+		var previousID int64
+		if previous != nil {
+			previousID = previous.ID
+		}
+		progress("planning", 0, len(toScan), "Listing metrics for the query budget...")
+		plan = c.planQueries(ctx, lim, toScan, metadata, previousID)
+		if plan.dropped > 0 {
+			logger.Warn("query budget too small, smallest metrics left without labels",
+				"max_queries", c.maxQueries,
+				"undrilled_metrics", plan.dropped,
+			)
+		}
+	}
 
 	var totalSeries atomic.Int64
 	var serviceErrors atomic.Int64
+	var skippedMetrics atomic.Int64
+	var copiedServices atomic.Int64
+	var failedMu sync.Mutex
+	var failedServices []models.ServiceError
+	recordFailure := func(name string, err error) {
+		serviceErrors.Add(1)
+		failedMu.Lock()
+		failedServices = append(failedServices, models.ServiceError{Service: name, Error: err.Error()})
+		failedMu.Unlock()
+		if err := c.snapshots.SetServiceError(context.WithoutCancel(ctx), snapshotID, name, err.Error()); err != nil {
+			logger.Error("failed to store service error", "name", name, "error", err)
+		}
+	}
 
-	sem := make(chan struct{}, c.concurrency)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	completed := 0
@@ -104,15 +234,34 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 		go func(svc prometheus.ServiceInfo) {
 			defer wg.Done()
 
-			// Acquire sem for the initial HTTP call only — released inside collectService
-			// before spawning metric goroutines, so they can reuse the same sem pool.
-			select {
-			case sem <- struct{}{}:
-			case <-ctx.Done():
+			if prev, ok := unchanged[svc.Name]; ok {
+				// The copied metrics leave out the same series as before.
+				total := max(svc.SeriesCount-prev.ExcludedSeries, 0)
+				err := c.services.CopyToSnapshot(ctx, prev.ID, snapshotID, total, c.teamFor(svc.Name))
+
+				mu.Lock()
+				completed++
+				progress("service_complete", completed, len(serviceInfos), svc.Name)
+				mu.Unlock()
+
+				if err != nil {
+					recordFailure(svc.Name, err)
+					logger.Error("failed to copy unchanged service", "name", svc.Name, "error", err)
+					return
+				}
+				copiedServices.Add(1)
+				totalSeries.Add(int64(total))
 				return
 			}
 
-			svcCtx, svcCancel := context.WithTimeout(ctx, perServiceTimeout)
+			// Acquire a slot for the initial HTTP call only — released inside
+			// collectService before spawning metric goroutines, so they can
+			// reuse the same pool.
+			if lim.acquire(ctx) != nil {
+				return
+			}
+
+			svcCtx, svcCancel := context.WithTimeout(ctx, c.serviceTimeout(svc.Name))
 			defer svcCancel()
 
 			logger.Debug("scanning service", "name", svc.Name)
@@ -121,7 +270,8 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 			progress("processing_service", completed, len(serviceInfos), svc.Name)
 			mu.Unlock()
 
-			serviceSnapshot, err := c.collectService(svcCtx, snapshotID, svc, sem)
+			serviceSnapshot, skipped, err := c.collectService(svcCtx, lim, snapshotID, svc, metadata, plan)
+			skippedMetrics.Add(int64(skipped))
 
 			mu.Lock()
 			completed++
@@ -129,7 +279,7 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 			mu.Unlock()
 
 			if err != nil {
-				serviceErrors.Add(1)
+				recordFailure(svc.Name, err)
 				logger.Error("failed to collect service", "name", svc.Name, "error", err)
 				return
 			}
@@ -141,57 +291,319 @@ func (c *Collector) Collect(ctx context.Context, scanID int64, progress Progress
 	wg.Wait()
 
 	finalTotalSeries := totalSeries.Load()
-	snapshot.TotalServices = len(serviceInfos)
+	finalSkippedMetrics := int(skippedMetrics.Load())
+	finalCopiedServices := int(copiedServices.Load())
+	snapshot.TotalServices = len(serviceInfos) + len(missing)
 	snapshot.TotalSeries = finalTotalSeries
-	snapshot.ScanDurationMs = int(time.Since(start).Milliseconds())
+	snapshot.SkippedMetrics = finalSkippedMetrics
+	snapshot.CopiedServices = finalCopiedServices
 
-	if err := c.snapshots.Update(ctx, snapshot); err != nil {
+	undrilled := 0
+	if plan != nil {
+		undrilled = plan.dropped
+	}
+	partial := serviceErrors.Load() > 0 || undrilled > 0
+	if err := c.finishSnapshot(ctx, snapshot, start, partial, nil); err != nil {
 		return nil, err
 	}
 
 	duration := time.Since(start)
 	svcErrors := int(serviceErrors.Load())
 
+	result := &CollectResult{
+		SnapshotID:       snapshotID,
+		TotalServices:    len(serviceInfos) + len(missing),
+		ExcludedServices: excluded,
+		TotalSeries:      finalTotalSeries,
+		SkippedMetrics:   finalSkippedMetrics,
+		CopiedServices:   finalCopiedServices,
+		Duration:         duration,
+		ServiceErrors:    svcErrors,
+		FailedServices:   failedServices,
+		MissingServices:  len(missing),
+		UndrilledMetrics: undrilled,
+		Filtered:         c.narrowed(),
+	}
+
+	if snapshot.Status == models.SnapshotStatusAborted {
+		logger.Warn("collection cancelled", "services", len(serviceInfos), "duration", duration)
+		return result, ErrScanCancelled
+	}
+
 	logger.Info("collection complete",
 		"services", len(serviceInfos),
+		"excluded_services", excluded,
 		"total_series", finalTotalSeries,
+		"skipped_metrics", finalSkippedMetrics,
+		"copied_services", finalCopiedServices,
+		"missing_services", len(missing),
+		"undrilled_metrics", undrilled,
 		"service_errors", svcErrors,
+		"concurrency", lim.current(),
 		"duration", duration,
 	)
 
+	return result, nil
+}
+
+// finishSnapshot stores the final status and duration of a snapshot. It runs
+// detached from ctx so a cancelled scan can still be marked as aborted.
+func (c *Collector) finishSnapshot(ctx context.Context, snapshot *models.Snapshot, start time.Time, partial bool, collectErr error) error {
+	switch {
+	case ctx.Err() != nil:
+		snapshot.Status = models.SnapshotStatusAborted
+	case collectErr != nil:
+		snapshot.Status = models.SnapshotStatusFailed
+	case c.narrowed():
+		snapshot.Status = models.SnapshotStatusFiltered
+	case partial:
+		snapshot.Status = models.SnapshotStatusPartial
+	default:
+		snapshot.Status = models.SnapshotStatusCompleted
+	}
+	snapshot.ScanDurationMs = int(time.Since(start).Milliseconds())
+
+	if err := c.snapshots.Update(context.WithoutCancel(ctx), snapshot); err != nil {
+		c.logger.Error("failed to update snapshot", "snapshot_id", snapshot.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// collectTSDBStatus stores head block stats on the snapshot up front, so the
+// overview has real numbers while services are still being drilled into.
+// Backends without the TSDB status API are only logged; sources that have
+// none at all are skipped.
+func (c *Collector) collectTSDBStatus(ctx context.Context, snapshotID int64) {
+	t, ok := c.client.(tsdbStatusSource)
+	if !ok {
+		return
+	}
+	status, err := t.GetTSDBStatus(ctx)
+	if err != nil {
+		c.logger.Warn("failed to get tsdb status", "error", err)
+		return
+	}
+
+	stats := &models.TSDBStats{
+		HeadSeries:     status.HeadSeries,
+		HeadLabelPairs: status.HeadLabelPairs,
+		HeadChunks:     status.HeadChunks,
+		MinTime:        status.MinTime,
+		MaxTime:        status.MaxTime,
+		TopMetrics:     toModelStats(status.TopMetrics),
+		TopLabelNames:  toModelStats(status.TopLabelNames),
+	}
+	if err := c.snapshots.SetTSDBStats(ctx, snapshotID, stats); err != nil {
+		c.logger.Warn("failed to store tsdb status", "error", err)
+	}
+}
+
+func toModelStats(stats []prometheus.TSDBStat) []models.TSDBStat {
+	out := make([]models.TSDBStat, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, models.TSDBStat{Name: s.Name, Value: s.Value})
+	}
+	return out
+}
+
+// unchangedServices returns the services from the previous snapshot whose
+// series totals moved less than the incremental change threshold. Totals are
+// compared with the last full collection rather than the previous snapshot,
+// so a run of small changes can't keep copying the same data forever.
+func (c *Collector) unchangedServices(ctx context.Context, previousID int64, current []prometheus.ServiceInfo) (map[string]models.ServiceSnapshot, error) {
+	previous, err := c.services.List(ctx, previousID, storage.ServiceListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list previous services: %w", err)
+	}
+	collected, err := c.services.CollectedSeries(ctx, previousID)
+	if err != nil {
+		return nil, fmt.Errorf("get collected series: %w", err)
+	}
+
+	byName := make(map[string]models.ServiceSnapshot, len(previous))
+	for _, s := range previous {
+		byName[s.ServiceName] = s
+	}
+
+	unchanged := make(map[string]models.ServiceSnapshot)
+	for _, svc := range current {
+		prev, ok := byName[svc.Name]
+		base := collected[svc.Name]
+		if !ok || base == 0 {
+			continue
+		}
+		change := math.Abs(float64(svc.SeriesCount-base)) / float64(base) * 100
+		if change <= c.incremental.ChangeThreshold {
+			unchanged[svc.Name] = prev
+		}
+	}
+	return unchanged, nil
+}
+
+// FindService discovers the service by name, failing with
+// ErrServiceNotFound when the source doesn't report it.
+func (c *Collector) FindService(ctx context.Context, serviceName string) (*prometheus.ServiceInfo, error) {
+	serviceInfos, err := c.client.DiscoverServices(ctx, c.serviceLabels)
+	if err != nil {
+		return nil, err
+	}
+	for i := range serviceInfos {
+		if serviceInfos[i].Name == serviceName {
+			return &serviceInfos[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, serviceName)
+}
+
+// CollectService rescans a single service into the latest snapshot, replacing
+// its previous data there. If no snapshot exists yet, a new one is created.
+func (c *Collector) CollectService(ctx context.Context, scanID int64, serviceName string, progress ProgressCallback) (*CollectResult, error) {
+	logger := c.logger.With("scan_id", scanID, "service", serviceName)
+	start := time.Now()
+
+	if progress == nil {
+		progress = func(string, int, int, string) {}
+	}
+
+	progress("discovering", 0, 1, serviceName)
+
+	svc, err := c.FindService(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := c.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		snapshot = &models.Snapshot{CollectedAt: start.Truncate(time.Second), Status: models.SnapshotStatusCompleted}
+		snapshot.ID, err = c.snapshots.Create(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Info("rescanning service", "snapshot_id", snapshot.ID)
+
+	metadata, err := c.metadata(ctx)
+	if err != nil {
+		logger.Warn("failed to get metric metadata, metric types will be unknown", "error", err)
+		metadata = nil
+	}
+
+	progress("processing_service", 0, 1, serviceName)
+
+	svcCtx, svcCancel := context.WithTimeout(ctx, c.serviceTimeout(serviceName))
+	defer svcCancel()
+
+	lim := newLimiter(c.concurrency, c.adaptive)
+	if err := lim.acquire(svcCtx); err != nil {
+		return nil, err
+	}
+	// The new rows are written next to the previous ones, which are only
+	// replaced once the collection is complete; a failed rescan keeps them.
+	collected, skipped, err := c.collectService(svcCtx, lim, snapshot.ID, *svc, metadata, nil)
+	if err == nil && svcCtx.Err() != nil {
+		err = svcCtx.Err()
+	}
+	if err == nil {
+		if err = c.services.Replace(ctx, snapshot.ID, serviceName, collected.ID); err != nil {
+			err = fmt.Errorf("replace previous service snapshot %s: %w", serviceName, err)
+		}
+	}
+	if err != nil {
+		if collected != nil {
+			if delErr := c.services.Delete(context.WithoutCancel(ctx), collected.ID); delErr != nil {
+				logger.Error("failed to delete incomplete service snapshot", "error", delErr)
+			}
+		}
+		if storeErr := c.snapshots.SetServiceError(context.WithoutCancel(ctx), snapshot.ID, serviceName, err.Error()); storeErr != nil {
+			logger.Error("failed to store service error", "error", storeErr)
+		}
+		return nil, err
+	}
+	if err := c.snapshots.ClearServiceError(ctx, snapshot.ID, serviceName); err != nil {
+		logger.Warn("failed to clear previous service error", "error", err)
+	}
+
+	progress("service_complete", 1, 1, serviceName)
+
+	services, err := c.services.List(ctx, snapshot.ID, storage.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var totalSeries int64
+	for _, s := range services {
+		totalSeries += int64(s.TotalSeries)
+	}
+	snapshot.TotalServices = len(services)
+	snapshot.TotalSeries = totalSeries
+
+	if err := c.snapshots.Update(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	duration := time.Since(start)
+	logger.Info("service rescan complete", "series", svc.SeriesCount, "duration", duration)
+
 	return &CollectResult{
-		SnapshotID:    snapshotID,
-		TotalServices: len(serviceInfos),
-		TotalSeries:   finalTotalSeries,
-		Duration:      duration,
-		ServiceErrors: svcErrors,
+		SnapshotID:     snapshot.ID,
+		TotalServices:  snapshot.TotalServices,
+		TotalSeries:    snapshot.TotalSeries,
+		SkippedMetrics: skipped,
+		Duration:       duration,
+		Service:        serviceName,
 	}, nil
 }
 
-func (c *Collector) collectService(ctx context.Context, snapshotID int64, svc prometheus.ServiceInfo, sem chan struct{}) (*models.ServiceSnapshot, error) {
-	metricInfos, err := c.client.GetMetricsForService(ctx, c.serviceLabel, svc.Name)
-	// Release the service-level sem slot so metric goroutines can use the pool.
-	<-sem
+// collectService stores the service and its metrics. With a plan, the
+// metrics it listed are used and only those it allows are drilled into.
+func (c *Collector) collectService(ctx context.Context, lim *limiter, snapshotID int64, svc prometheus.ServiceInfo, metadata map[string]prometheus.MetricMetadata, plan *queryPlan) (*models.ServiceSnapshot, int, error) {
+	var metricInfos []prometheus.MetricInfo
+	var err error
+	if listed, ok := plan.lookup(svc.Name); ok {
+		metricInfos, err = listed.metrics, listed.err
+	} else {
+		start := time.Now()
+		metricInfos, err = c.client.GetMetricsForService(ctx, c.serviceLabels, svc.Name)
+		if ctx.Err() == nil {
+			lim.observe(start, 1, err)
+		}
+	}
+	// Release the service-level slot so metric goroutines can use the pool.
+	lim.release()
 	if err != nil {
-		return nil, fmt.Errorf("get metrics for %s: %w", svc.Name, err)
+		return nil, 0, fmt.Errorf("get metrics for %s: %w", svc.Name, err)
 	}
 
+	listedSeries := sumSeries(metricInfos)
+	metricInfos, skipped := c.filterMetrics(metricInfos)
+	excludedSeries := listedSeries - sumSeries(metricInfos)
+
 	c.logger.Debug("found metrics for service",
 		"service", svc.Name,
 		"metrics", len(metricInfos),
+		"skipped_metrics", skipped,
 		"series", svc.SeriesCount,
+		"excluded_series", excludedSeries,
 	)
 
 	serviceSnapshot := &models.ServiceSnapshot{
-		SnapshotID:  snapshotID,
-		ServiceName: svc.Name,
-		TotalSeries: svc.SeriesCount,
-		MetricCount: len(metricInfos),
+		SnapshotID:     snapshotID,
+		ServiceName:    svc.Name,
+		Labels:         svc.Labels,
+		Environment:    svc.Labels[c.envLabel],
+		Team:           c.teamFor(svc.Name),
+		TotalSeries:    max(svc.SeriesCount-excludedSeries, 0),
+		MetricCount:    len(metricInfos),
+		ExcludedSeries: excludedSeries,
 	}
 
 	serviceSnapshotID, err := c.services.Create(ctx, serviceSnapshot)
 	if err != nil {
-		return nil, fmt.Errorf("create service snapshot %s: %w", svc.Name, err)
+		return nil, skipped, fmt.Errorf("create service snapshot %s: %w", svc.Name, err)
 	}
 	serviceSnapshot.ID = serviceSnapshotID
 
@@ -205,12 +617,10 @@ func (c *Collector) collectService(ctx context.Context, snapshotID int64, svc pr
 		go func(metric prometheus.MetricInfo) {
 			defer metricWg.Done()
 
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-ctx.Done():
+			if lim.acquire(ctx) != nil {
 				return
 			}
+			defer lim.release()
 
 			c.logger.Debug("collecting metric",
 				"service", svc.Name,
@@ -218,7 +628,7 @@ func (c *Collector) collectService(ctx context.Context, snapshotID int64, svc pr
 				"series", metric.SeriesCount,
 			)
 
-			if err := c.collectMetric(ctx, serviceSnapshotID, svc.Name, metric); err != nil {
+			if err := c.collectMetric(ctx, lim, serviceSnapshotID, svc.Name, metric, metadata, plan.drill(svc.Name, metric.Name)); err != nil {
 				c.logger.Debug("failed to collect metric", "service", svc.Name, "metric", metric.Name, "error", err)
 			}
 		}(metric)
@@ -226,19 +636,80 @@ func (c *Collector) collectService(ctx context.Context, snapshotID int64, svc pr
 
 	metricWg.Wait()
 
-	return serviceSnapshot, nil
+	return serviceSnapshot, skipped, nil
 }
 
-func (c *Collector) collectMetric(ctx context.Context, serviceSnapshotID int64, serviceName string, metric prometheus.MetricInfo) error {
-	labelInfos, err := c.client.GetLabelsForMetric(ctx, c.serviceLabel, serviceName, metric.Name, c.sampleLimit)
-	if err != nil {
-		c.logger.Debug("failed to get labels", "metric", metric.Name, "error", err)
-		labelInfos = nil
-	} else {
-		c.logger.Debug("collected labels",
-			"metric", metric.Name,
-			"labels", len(labelInfos),
-		)
+// sumSeries adds up the series of the metrics.
+func sumSeries(metrics []prometheus.MetricInfo) int {
+	var n int
+	for _, m := range metrics {
+		n += m.SeriesCount
+	}
+	return n
+}
+
+// teamFor returns the first team whose globs match the service, or "".
+func (c *Collector) teamFor(name string) string {
+	for _, team := range c.teams {
+		if matchesAny(name, team.Services) {
+			return team.Name
+		}
+	}
+	return ""
+}
+
+func (c *Collector) serviceTimeout(name string) time.Duration {
+	for _, o := range c.timeouts.Overrides {
+		if matchesAny(name, o.Services) {
+			return o.Service
+		}
+	}
+	return c.timeouts.Service
+}
+
+func (c *Collector) getLabels(ctx context.Context, serviceName string, metric prometheus.MetricInfo) ([]prometheus.LabelInfo, error) {
+	if c.timeouts.Query > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeouts.Query)
+		defer cancel()
+	}
+	return c.client.GetLabelsForMetric(ctx, c.serviceLabels, serviceName, metric.Name, metric.SeriesCount, c.sampleLimit)
+}
+
+// collectMetric stores the metric, with its labels and exemplars only when
+// drill is set.
+func (c *Collector) collectMetric(ctx context.Context, lim *limiter, serviceSnapshotID int64, serviceName string, metric prometheus.MetricInfo, metadata map[string]prometheus.MetricMetadata, drill bool) error {
+	var labelInfos []prometheus.LabelInfo
+	var err error
+	if drill {
+		start := time.Now()
+		labelInfos, err = c.getLabels(ctx, serviceName, metric)
+		if ctx.Err() == nil {
+			lim.observe(start, c.labelQueries(metric.SeriesCount, len(labelInfos)), err)
+		}
+		if err != nil {
+			c.logger.Debug("failed to get labels", "metric", metric.Name, "error", err)
+			labelInfos = nil
+		} else {
+			c.logger.Debug("collected labels",
+				"metric", metric.Name,
+				"labels", len(labelInfos),
+			)
+		}
+	}
+
+	md, native := prometheus.LookupMetadata(metric.Name, metadata)
+
+	var exemplarCount int
+	if e, ok := c.client.(exemplarSource); ok && drill && (native || prometheus.IsClassicHistogramBucket(metric.Name, md.Type)) {
+		start := time.Now()
+		exemplarCount, err = e.CountExemplars(ctx, c.serviceLabels, serviceName, metric.Name)
+		if ctx.Err() == nil {
+			lim.observe(start, 1, err)
+		}
+		if err != nil {
+			c.logger.Debug("failed to count exemplars", "metric", metric.Name, "error", err)
+		}
 	}
 
 	metricSnapshot := &models.MetricSnapshot{
@@ -246,6 +717,11 @@ func (c *Collector) collectMetric(ctx context.Context, serviceSnapshotID int64,
 		MetricName:        metric.Name,
 		SeriesCount:       metric.SeriesCount,
 		LabelCount:        len(labelInfos),
+		MetricType:        md.Type,
+		Help:              md.Help,
+		Unit:              md.Unit,
+		NativeHistogram:   native,
+		ExemplarCount:     exemplarCount,
 	}
 
 	metricSnapshotID, err := c.metrics.Create(ctx, metricSnapshot)
@@ -256,11 +732,14 @@ func (c *Collector) collectMetric(ctx context.Context, serviceSnapshotID int64,
 	if len(labelInfos) > 0 {
 		labelSnapshots := make([]*models.LabelSnapshot, 0, len(labelInfos))
 		for _, label := range labelInfos {
+			samples, redacted := redactValues(label.SampleValues, c.redaction)
 			labelSnapshots = append(labelSnapshots, &models.LabelSnapshot{
 				MetricSnapshotID:  metricSnapshotID,
 				LabelName:         label.Name,
 				UniqueValuesCount: label.UniqueValues,
-				SampleValues:      label.SampleValues,
+				SampleValues:      samples,
+				Redacted:          redacted,
+				Truncated:         label.Truncated,
 			})
 		}
 
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/illenko/whodidthis/config"
+)
+
+type redactionRule struct {
+	class   string
+	pattern *regexp.Regexp
+	// hashKey is the HMAC key of the hash action, nil for mask.
+	hashKey []byte
+}
+
+// compileRedactionRules compiles the rules config validation has already
+// accepted. A rule is never skipped: dropping one would store the values it
+// exists to hide, so a pattern that somehow doesn't compile panics instead.
+func compileRedactionRules(rules []config.RedactionRule, key string) []redactionRule {
+	compiled := make([]redactionRule, 0, len(rules))
+	for _, r := range rules {
+		rule := redactionRule{
+			class:   r.Name,
+			pattern: regexp.MustCompile(r.Pattern),
+		}
+		if r.Action == config.RedactionHash {
+			rule.hashKey = []byte(key)
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// redactValues replaces every match in the sample values with a placeholder
+// naming the rule, e.g. "<email>" or "<email:3fa2b1c4d5e6>". Hashing keeps
+// distinct values distinct, so the analysis can still tell one user from
+// many. The hash is a keyed HMAC-SHA256: emails, IDs and addresses are few
+// enough to guess, and a plain hash of every guess would reveal them. It
+// returns the classes that fired.
+func redactValues(values []string, rules []redactionRule) (redacted []string, classes []string) {
+	if len(rules) == 0 || len(values) == 0 {
+		return values, nil
+	}
+
+	fired := make(map[string]bool)
+	redacted = make([]string, len(values))
+	for i, v := range values {
+		for _, r := range rules {
+			v = r.pattern.ReplaceAllStringFunc(v, func(match string) string {
+				fired[r.class] = true
+				if r.hashKey == nil {
+					return "<" + r.class + ">"
+				}
+				mac := hmac.New(sha256.New, r.hashKey)
+				mac.Write([]byte(match))
+				return fmt.Sprintf("<%s:%s>", r.class, hex.EncodeToString(mac.Sum(nil)[:6]))
+			})
+		}
+		redacted[i] = v
+	}
+
+	for _, r := range rules {
+		if fired[r.class] {
+			classes = append(classes, r.class)
+			delete(fired, r.class)
+		}
+	}
+	return redacted, classes
+}
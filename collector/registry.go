@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// Source is a metrics backend a scan reads from: the services it knows,
+// the metrics of each and their labels. Backends with more to offer also
+// implement metadataSource, exemplarSource or tsdbStatusSource; a scan
+// against one that doesn't goes without histogram detection, exemplar
+// counts or TSDB status.
+type Source interface {
+	DiscoverServices(ctx context.Context, serviceLabels []string) ([]prometheus.ServiceInfo, error)
+	GetMetricsForService(ctx context.Context, serviceLabels []string, serviceName string) ([]prometheus.MetricInfo, error)
+	GetLabelsForMetric(ctx context.Context, serviceLabels []string, serviceName, metricName string, seriesCount, sampleLimit int) ([]prometheus.LabelInfo, error)
+}
+
+type metadataSource interface {
+	GetMetadata(ctx context.Context) (map[string]prometheus.MetricMetadata, error)
+}
+
+type exemplarSource interface {
+	CountExemplars(ctx context.Context, serviceLabels []string, serviceName, metricName string) (int, error)
+}
+
+type tsdbStatusSource interface {
+	GetTSDBStatus(ctx context.Context) (*prometheus.TSDBStatus, error)
+}
+
+// SourceFactory builds the backend of a scan.mode from the config.
+type SourceFactory func(cfg *config.Config) (Source, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[config.ScanMode]SourceFactory)
+)
+
+// RegisterSource makes a backend available as the given scan.mode. It
+// panics when the mode is taken, like database/sql.Register.
+func RegisterSource(mode config.ScanMode, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if factory == nil {
+		panic("collector: RegisterSource factory is nil")
+	}
+	if _, dup := sources[mode]; dup {
+		panic("collector: RegisterSource called twice for mode " + string(mode))
+	}
+	sources[mode] = factory
+}
+
+// NewSource builds the backend registered for cfg.Scan.Mode.
+func NewSource(cfg *config.Config) (Source, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[cfg.Scan.Mode]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no metrics source registered for scan.mode %q (have %s)", cfg.Scan.Mode, strings.Join(SourceModes(), ", "))
+	}
+	return factory(cfg)
+}
+
+// SourceModes lists the registered scan modes, sorted.
+func SourceModes() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	modes := make([]string, 0, len(sources))
+	for mode := range sources {
+		modes = append(modes, string(mode))
+	}
+	slices.Sort(modes)
+	return modes
+}
+
+// metadata returns the backend's metric metadata; nil when it has none.
+func (c *Collector) metadata(ctx context.Context) (map[string]prometheus.MetricMetadata, error) {
+	m, ok := c.client.(metadataSource)
+	if !ok {
+		return nil, nil
+	}
+	return m.GetMetadata(ctx)
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/kubernetes"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// ServiceSource lists the services a scan expects to find, independently of
+// what the metrics backend reports. Series counts are left at zero.
+type ServiceSource interface {
+	ListServices(ctx context.Context, serviceLabels []string) ([]prometheus.ServiceInfo, error)
+}
+
+// expectedServices narrows the discovered services to those the source
+// lists and returns the listed ones that were not discovered.
+func (c *Collector) expectedServices(ctx context.Context, discovered []prometheus.ServiceInfo) (found, missing []prometheus.ServiceInfo, err error) {
+	expected, err := c.source.ListServices(ctx, c.serviceLabels)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, _ = c.filterServices(expected)
+
+	byName := make(map[string]prometheus.ServiceInfo, len(discovered))
+	for _, svc := range discovered {
+		byName[svc.Name] = svc
+	}
+	for _, svc := range expected {
+		if d, ok := byName[svc.Name]; ok {
+			found = append(found, d)
+			delete(byName, svc.Name)
+		} else {
+			missing = append(missing, svc)
+		}
+	}
+	if len(byName) > 0 {
+		c.logger.Debug("ignoring services not listed by the service source", "count", len(byName))
+	}
+	return found, missing, nil
+}
+
+func (c *Collector) storeMissing(ctx context.Context, snapshotID int64, missing []prometheus.ServiceInfo) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	rows := make([]*models.ServiceSnapshot, len(missing))
+	for i, svc := range missing {
+		rows[i] = &models.ServiceSnapshot{
+			SnapshotID:  snapshotID,
+			ServiceName: svc.Name,
+			Labels:      svc.Labels,
+			Environment: svc.Labels[c.envLabel],
+			Team:        c.teamFor(svc.Name),
+			Missing:     true,
+		}
+	}
+	if err := c.services.CreateBatch(ctx, rows); err != nil {
+		return fmt.Errorf("store missing services: %w", err)
+	}
+	return nil
+}
+
+// KubernetesSource builds the service list from Kubernetes Services or
+// Pods. Objects the discovery labels can't be resolved for are skipped, and
+// pods of the same service collapse into one entry.
+type KubernetesSource struct {
+	client *kubernetes.Client
+	cfg    config.KubernetesDiscovery
+}
+
+func NewKubernetesSource(client *kubernetes.Client, cfg config.KubernetesDiscovery) *KubernetesSource {
+	return &KubernetesSource{client: client, cfg: cfg}
+}
+
+func (s *KubernetesSource) ListServices(ctx context.Context, serviceLabels []string) ([]prometheus.ServiceInfo, error) {
+	var objects []kubernetes.ObjectMeta
+	switch s.cfg.Kind {
+	case config.KubernetesPods:
+		pods, err := s.client.ListPods(ctx, s.cfg.Namespaces, s.cfg.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("list kubernetes pods: %w", err)
+		}
+		for _, p := range pods {
+			objects = append(objects, p.Metadata)
+		}
+	default:
+		services, err := s.client.ListServices(ctx, s.cfg.Namespaces, s.cfg.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("list kubernetes services: %w", err)
+		}
+		for _, svc := range services {
+			objects = append(objects, svc.Metadata)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var infos []prometheus.ServiceInfo
+	for _, obj := range objects {
+		values := make([]string, len(serviceLabels))
+		labels := make(map[string]string, len(serviceLabels))
+		for i, label := range serviceLabels {
+			values[i] = s.labelValue(obj, label)
+			labels[label] = values[i]
+		}
+		if slices.Contains(values, "") {
+			continue
+		}
+		name := strings.Join(values, prometheus.ServiceKeySeparator)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		infos = append(infos, prometheus.ServiceInfo{Name: name, Labels: labels})
+	}
+	return infos, nil
+}
+
+func (s *KubernetesSource) labelValue(obj kubernetes.ObjectMeta, label string) string {
+	source, ok := s.cfg.LabelMap[label]
+	if !ok {
+		source = "label:" + label
+		if label == "namespace" {
+			source = "namespace"
+		}
+	}
+	switch source {
+	case "namespace":
+		return obj.Namespace
+	case "name":
+		return obj.Name
+	}
+	return obj.Labels[strings.TrimPrefix(source, "label:")]
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlackoutWindow is a recurring time range during which scheduled scans must
+// not start. Start may be after End for windows that cross midnight.
+type BlackoutWindow struct {
+	Days     []string `mapstructure:"days"`     // mon..sun, "weekdays", "weekends"; empty means every day
+	Start    string   `mapstructure:"start"`    // HH:MM
+	End      string   `mapstructure:"end"`      // HH:MM
+	Timezone string   `mapstructure:"timezone"` // IANA name, defaults to local time
+}
+
+var weekdayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+func (w BlackoutWindow) validate() error {
+	for _, d := range w.Days {
+		if _, ok := weekdayNames[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+	}
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	return nil
+}
+
+// ClosesAt returns when the window containing t closes. ok is false if t is
+// not inside the window.
+func (w BlackoutWindow) ClosesAt(t time.Time) (closes time.Time, ok bool) {
+	loc := time.Local
+	if w.Timezone != "" {
+		if l, err := time.LoadLocation(w.Timezone); err == nil {
+			loc = l
+		}
+	}
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	sinceMidnight := t.Sub(midnight)
+
+	if start <= end {
+		if w.onDay(t.Weekday()) && sinceMidnight >= start && sinceMidnight < end {
+			return midnight.Add(end), true
+		}
+		return time.Time{}, false
+	}
+
+	// Window crosses midnight: either the evening part of today or the
+	// morning part that started yesterday.
+	if w.onDay(t.Weekday()) && sinceMidnight >= start {
+		return midnight.AddDate(0, 0, 1).Add(end), true
+	}
+	if w.onDay(t.AddDate(0, 0, -1).Weekday()) && sinceMidnight < end {
+		return midnight.Add(end), true
+	}
+	return time.Time{}, false
+}
+
+func (w BlackoutWindow) onDay(day time.Weekday) bool {
+	return matchesDay(w.Days, day)
+}
+
+// matchesDay reports whether day is among days; no days means every day.
+func matchesDay(days []string, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		for _, wd := range weekdayNames[strings.ToLower(d)] {
+			if wd == day {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
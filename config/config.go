@@ -1,8 +1,14 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,37 +23,449 @@ type Config struct {
 	Server     ServerConfig     `mapstructure:"server"`
 	Log        LogConfig        `mapstructure:"log"`
 	Gemini     GeminiConfig     `mapstructure:"gemini"`
+	Teams      []TeamConfig     `mapstructure:"teams"`
+	Cost       CostConfig       `mapstructure:"cost"`
+	Export     ExportConfig     `mapstructure:"export"`
+	Kubernetes KubernetesConfig `mapstructure:"kubernetes"`
+	Loki       LokiConfig       `mapstructure:"loki"`
+	Vault      VaultConfig      `mapstructure:"vault"`
+	// Notifications are the targets of the digest.
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	Digest        DigestConfig        `mapstructure:"digest"`
+	Baseline      BaselineConfig      `mapstructure:"baseline"`
+	Limits        []LimitConfig       `mapstructure:"limits"`
+	Detection     DetectionConfig     `mapstructure:"detection"`
+	Jira          JiraConfig          `mapstructure:"jira"`
+	GitHub        GitHubConfig        `mapstructure:"github"`
+	GitLab        GitLabConfig        `mapstructure:"gitlab"`
+	Slack         SlackConfig         `mapstructure:"slack"`
+	Grafana       GrafanaConfig       `mapstructure:"grafana"`
+
+	secretsTTL  time.Duration
+	vaultLeases *vaultLeases
+}
+
+// TeamConfig assigns services to a team by glob. Teams are matched in order
+// and the first match wins.
+type TeamConfig struct {
+	Name     string   `mapstructure:"name"`
+	Services []string `mapstructure:"services"`
+	// Repository is where issues for the team's services are opened.
+	Repository TeamRepository `mapstructure:"repository"`
 }
 
 type PrometheusConfig struct {
-	URL      string        `mapstructure:"url"`
-	Username string        `mapstructure:"username"`
-	Password string        `mapstructure:"password"`
-	Timeout  time.Duration `mapstructure:"timeout"`
+	URL             string               `mapstructure:"url"`
+	Username        string               `mapstructure:"username"`
+	Password        string               `mapstructure:"password"`
+	PasswordFile    string               `mapstructure:"password_file"`
+	BearerToken     string               `mapstructure:"bearer_token"`
+	BearerTokenFile string               `mapstructure:"bearer_token_file"`
+	Timeout         time.Duration        `mapstructure:"timeout"`
+	TLS             PrometheusTLSConfig  `mapstructure:"tls"`
+	Retry           RetryConfig          `mapstructure:"retry"`
+	CircuitBreaker  CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+type PrometheusTLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	Cooldown         time.Duration `mapstructure:"cooldown"`
 }
 
 type DiscoveryConfig struct {
 	ServiceLabel string `mapstructure:"service_label"`
+	// Labels keys services by several labels, e.g. [namespace, app]; the
+	// values are joined with "/" into the service name. Overrides
+	// ServiceLabel when set.
+	Labels []string `mapstructure:"labels"`
+	// EnvironmentLabel splits services by environment, e.g. env or
+	// namespace. It becomes the leading part of the service key, so the
+	// same app in prod and staging is tracked as two services.
+	EnvironmentLabel string              `mapstructure:"environment_label"`
+	Include          []string            `mapstructure:"include"`
+	Exclude          []string            `mapstructure:"exclude"`
+	Kubernetes       KubernetesDiscovery `mapstructure:"kubernetes"`
+}
+
+type KubernetesKind string
+
+const (
+	KubernetesServices KubernetesKind = "services"
+	KubernetesPods     KubernetesKind = "pods"
+)
+
+// KubernetesDiscovery takes the expected service list from the Kubernetes
+// API, so services that stopped reporting entirely are stored as missing
+// rather than silently vanishing. Services Prometheus reports that are not
+// listed are ignored.
+type KubernetesDiscovery struct {
+	Enabled       bool           `mapstructure:"enabled"`
+	Kind          KubernetesKind `mapstructure:"kind"`
+	Namespaces    []string       `mapstructure:"namespaces"`
+	LabelSelector string         `mapstructure:"label_selector"`
+	// LabelMap says where each discovery label's value comes from on the
+	// object: "namespace", "name" or "label:<key>". Unmapped labels read
+	// the namespace for "namespace" and the same-named object label
+	// otherwise.
+	LabelMap map[string]string `mapstructure:"label_map"`
+}
+
+// ServiceLabels returns the labels that identify a service, in key order.
+func (d DiscoveryConfig) ServiceLabels() []string {
+	labels := d.Labels
+	if len(labels) == 0 {
+		labels = []string{d.ServiceLabel}
+	}
+	if d.EnvironmentLabel == "" || slices.Contains(labels, d.EnvironmentLabel) {
+		return labels
+	}
+	return append([]string{d.EnvironmentLabel}, labels...)
 }
 
 type ScanConfig struct {
-	Interval          time.Duration `mapstructure:"interval"`
-	SampleValuesLimit int           `mapstructure:"sample_values_limit"`
-	Concurrency       int           `mapstructure:"concurrency"`
+	// Mode is how series are counted: query runs count() queries against
+	// the server, federate computes everything from /federate instead, and
+	// scrape reads application endpoints without Prometheus, otel reads
+	// an OpenTelemetry Collector, and datadog and cloudwatch audit the
+	// custom metrics of those services.
+	Mode              ScanMode          `mapstructure:"mode"`
+	Federate          FederateConfig    `mapstructure:"federate"`
+	Scrape            ScrapeConfig      `mapstructure:"scrape"`
+	OTel              OTelConfig        `mapstructure:"otel"`
+	Datadog           DatadogConfig     `mapstructure:"datadog"`
+	CloudWatch        CloudWatchConfig  `mapstructure:"cloudwatch"`
+	Interval          time.Duration     `mapstructure:"interval"`
+	SampleValuesLimit int               `mapstructure:"sample_values_limit"`
+	Concurrency       int               `mapstructure:"concurrency"`
+	MetricExclude     []string          `mapstructure:"metric_exclude"`
+	QueueSize         int               `mapstructure:"queue_size"`
+	BlackoutWindows   []BlackoutWindow  `mapstructure:"blackout_windows"`
+	Incremental       IncrementalConfig `mapstructure:"incremental"`
+	Timeouts          TimeoutsConfig    `mapstructure:"timeouts"`
+	// Lookback counts series that reported within the window rather than
+	// only those present at scan time. Zero keeps instant queries.
+	Lookback time.Duration `mapstructure:"lookback"`
+	// AdaptiveConcurrency lets the number of in-flight queries follow how
+	// Prometheus copes, starting from Concurrency.
+	AdaptiveConcurrency AdaptiveConcurrencyConfig `mapstructure:"adaptive_concurrency"`
+	// LabelValuesAPI counts label values through the label values endpoint
+	// instead of fetching every series. Disable it for backends that ignore
+	// match[] on that endpoint.
+	LabelValuesAPI bool `mapstructure:"label_values_api"`
+	// CardinalityAPI uses the Mimir/Cortex cardinality analysis endpoints
+	// for label counts when the backend turns out to have them.
+	CardinalityAPI bool `mapstructure:"cardinality_api"`
+	// SeriesChunkSize is the most series fetched per Series call; larger
+	// metrics are sharded over the values of their widest label.
+	SeriesChunkSize int `mapstructure:"series_chunk_size"`
+	// MaxSeriesPerMetric stops fetching a metric's series after this many
+	// and flags its labels as truncated. Zero means no cap.
+	MaxSeriesPerMetric int `mapstructure:"max_series_per_metric"`
+	// MaxQueries caps the queries of a full scan. Once it is spent, the
+	// smallest metrics keep their series counts but aren't drilled into
+	// for labels, and the snapshot is marked partial. Zero means no cap.
+	MaxQueries int `mapstructure:"max_queries"`
+	// SkipLabels are left out of label stats in addition to __name__ and
+	// the service labels, e.g. pod or instance.
+	SkipLabels []string `mapstructure:"skip_labels"`
+	// Redaction rewrites matching parts of sample label values before they
+	// are stored.
+	Redaction []RedactionRule `mapstructure:"redaction"`
+	// RedactionKey keys the HMAC behind the hash action, so hashed values
+	// can't be recovered by hashing guesses without it. Changing it changes
+	// every placeholder.
+	RedactionKey     string `mapstructure:"redaction_key"`
+	RedactionKeyFile string `mapstructure:"redaction_key_file"`
+}
+
+type ScanMode string
+
+const (
+	ScanModeQuery      ScanMode = "query"
+	ScanModeFederate   ScanMode = "federate"
+	ScanModeScrape     ScanMode = "scrape"
+	ScanModeOTel       ScanMode = "otel"
+	ScanModeDatadog    ScanMode = "datadog"
+	ScanModeCloudWatch ScanMode = "cloudwatch"
+)
+
+// queriesPrometheus reports whether the mode reads from prometheus.url.
+func (m ScanMode) queriesPrometheus() bool {
+	return m != ScanModeScrape && m != ScanModeOTel && m != ScanModeDatadog && m != ScanModeCloudWatch
+}
+
+type FederateConfig struct {
+	// Match are the match[] selectors sent to /federate; every series by
+	// default.
+	Match []string `mapstructure:"match"`
+}
+
+type ScrapeConfig struct {
+	// Timeout bounds a single target scrape.
+	Timeout     time.Duration   `mapstructure:"timeout"`
+	Concurrency int             `mapstructure:"concurrency"`
+	Targets     []ScrapeTarget  `mapstructure:"targets"`
+	Kubernetes  ScrapeDiscovery `mapstructure:"kubernetes"`
+	// TLS is used for every target, the OTel Collector's included.
+	TLS PrometheusTLSConfig `mapstructure:"tls"`
+}
+
+type ScrapeTarget struct {
+	URL string `mapstructure:"url"`
+	// Labels are attached to every series of the target, e.g. job, so the
+	// discovery labels can find the service.
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+// ScrapeDiscovery finds targets among pods annotated
+// prometheus.io/scrape=true, using the kubernetes section for API access.
+type ScrapeDiscovery struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Namespaces to search; all namespaces when empty.
+	Namespaces    []string `mapstructure:"namespaces"`
+	LabelSelector string   `mapstructure:"label_selector"`
+}
+
+// OTelConfig audits an OpenTelemetry Collector before its metrics reach
+// Prometheus. Timeout and concurrency come from the scrape section.
+type OTelConfig struct {
+	// ExporterURLs are the collector's prometheus exporter endpoints, where
+	// OTLP metrics appear with job set from the SDK's service.name and
+	// otel_scope_name set to the instrumentation library.
+	ExporterURLs []string `mapstructure:"exporter_urls"`
+	// TelemetryURL is the collector's own metrics endpoint. Its otelcol_*
+	// series are stored as the service TelemetryService, so receiver,
+	// processor and exporter labels show per pipeline component.
+	TelemetryURL     string `mapstructure:"telemetry_url"`
+	TelemetryService string `mapstructure:"telemetry_service"`
+}
+
+// DatadogConfig audits Datadog custom metrics. Datadog reports tags and
+// volumes per metric rather than per series, so a metric's indexed volume
+// stands in for its series count and its tags for labels; a metric
+// reported by several services counts in full for each.
+type DatadogConfig struct {
+	// Site is the Datadog site, e.g. datadoghq.eu, or a full API URL.
+	Site       string `mapstructure:"site"`
+	APIKey     string `mapstructure:"api_key"`
+	APIKeyFile string `mapstructure:"api_key_file"`
+	// AppKey needs the metrics_read scope.
+	AppKey     string        `mapstructure:"app_key"`
+	AppKeyFile string        `mapstructure:"app_key_file"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	// Lookback is the window metrics count as active and tags are read
+	// over.
+	Lookback time.Duration `mapstructure:"lookback"`
+	// TagFilter limits the audit to metrics reported with these tags, e.g.
+	// env:prod.
+	TagFilter string `mapstructure:"tag_filter"`
+	// MetricPrefixes limit the audit to metrics starting with one of them,
+	// typically the custom metric namespaces. Every active metric,
+	// integrations included, when empty.
+	MetricPrefixes []string `mapstructure:"metric_prefixes"`
+}
+
+// CloudWatchConfig audits custom CloudWatch metrics, which are billed per
+// metric name and dimension combination; each counts as a series and its
+// dimensions as labels. Credentials come from the standard AWS environment
+// variables, shared config or instance role.
+type CloudWatchConfig struct {
+	Region string `mapstructure:"region"`
+	// Endpoint overrides the CloudWatch endpoint, e.g. for LocalStack.
+	Endpoint string `mapstructure:"endpoint"`
+	// Namespaces are listed in full. Metrics also get a Namespace label,
+	// which can serve as the discovery label.
+	Namespaces []string `mapstructure:"namespaces"`
+	// IncludeInactive also counts metrics without data in the last three
+	// hours, which CloudWatch keeps listing for two weeks.
+	IncludeInactive bool `mapstructure:"include_inactive"`
+}
+
+// LokiConfig adds stream cardinality from Loki to every scan. Empty URL
+// disables it.
+type LokiConfig struct {
+	URL             string        `mapstructure:"url"`
+	Username        string        `mapstructure:"username"`
+	Password        string        `mapstructure:"password"`
+	PasswordFile    string        `mapstructure:"password_file"`
+	BearerToken     string        `mapstructure:"bearer_token"`
+	BearerTokenFile string        `mapstructure:"bearer_token_file"`
+	TenantID        string        `mapstructure:"tenant_id"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	// Lookback is the window streams are counted over.
+	Lookback time.Duration `mapstructure:"lookback"`
+	// ServiceLabel is the stream label naming the service, which often
+	// differs from the metrics one.
+	ServiceLabel string `mapstructure:"service_label"`
+}
+
+// KubernetesConfig is how the API server is reached. Everything defaults
+// to the pod's in-cluster service account.
+type KubernetesConfig struct {
+	APIServer          string `mapstructure:"api_server"`
+	TokenFile          string `mapstructure:"token_file"`
+	CAFile             string `mapstructure:"ca_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+type RedactionAction string
+
+const (
+	RedactionMask RedactionAction = "mask"
+	RedactionHash RedactionAction = "hash"
+)
+
+type RedactionRule struct {
+	// Name is the pattern class shown in place of the value, e.g. "email".
+	Name    string          `mapstructure:"name"`
+	Pattern string          `mapstructure:"pattern"`
+	Action  RedactionAction `mapstructure:"action"`
+}
+
+type TimeoutsConfig struct {
+	// Service bounds the whole collection of one service.
+	Service time.Duration `mapstructure:"service"`
+	// Query bounds a single per-metric Series call; zero leaves it to the
+	// service timeout.
+	Query     time.Duration     `mapstructure:"query"`
+	Overrides []TimeoutOverride `mapstructure:"overrides"`
+}
+
+// TimeoutOverride replaces the service timeout for services matching any of
+// the glob patterns. The first matching override wins.
+type TimeoutOverride struct {
+	Services []string      `mapstructure:"services"`
+	Service  time.Duration `mapstructure:"service"`
+}
+
+// AdaptiveConcurrencyConfig moves the scan's in-flight queries between Min
+// and Max: one more per round of answers within TargetLatency, half as many
+// after an error or a slower answer (AIMD).
+type AdaptiveConcurrencyConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Min           int           `mapstructure:"min"`
+	Max           int           `mapstructure:"max"`
+	TargetLatency time.Duration `mapstructure:"target_latency"`
+}
+
+type IncrementalConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ChangeThreshold is the relative series change (percent) above which a
+	// service is rescanned; services within it are copied forward.
+	ChangeThreshold float64 `mapstructure:"change_threshold"`
+}
+
+// BaselineConfig flags a service as regressed when it has grown past both
+// thresholds since the baseline snapshot.
+type BaselineConfig struct {
+	ThresholdPct float64 `mapstructure:"threshold_pct"`
+	// MinDelta is the smallest growth in series that counts, so small
+	// services doubling from a handful of series don't raise noise. It is
+	// the only threshold for services the baseline didn't have.
+	MinDelta int `mapstructure:"min_delta"`
+}
+
+// LimitConfig caps the series a metric may have in each service. Limits
+// are matched in order and the first match wins, so specific entries go
+// before broad ones.
+type LimitConfig struct {
+	// Metric is a glob over metric names, e.g. http_server_requests_total
+	// or http_*.
+	Metric string `mapstructure:"metric"`
+	// Services are globs over service names; empty applies to every service.
+	Services  []string `mapstructure:"services"`
+	MaxSeries int      `mapstructure:"max_series"`
 }
 
 type StorageConfig struct {
 	Path          string `mapstructure:"path"`
 	RetentionDays int    `mapstructure:"retention_days"`
+	// DownsampleAfterDays thins snapshots older than this to one per week.
+	// Zero keeps every snapshot until retention removes it.
+	DownsampleAfterDays int          `mapstructure:"downsample_after_days"`
+	Backup              BackupConfig `mapstructure:"backup"`
+}
+
+// BackupConfig is where POST /api/admin/backup writes database copies.
+type BackupConfig struct {
+	// Destination is a local directory or an s3://bucket/prefix URL. Empty
+	// disables backups.
+	Destination string   `mapstructure:"destination"`
+	S3          S3Config `mapstructure:"s3"`
 }
 
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port      int             `mapstructure:"port"`
+	Host      string          `mapstructure:"host"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+	TLS       TLSConfig       `mapstructure:"tls"`
+}
+
+// TLSConfig serves HTTPS from a certificate pair, or from a generated
+// self-signed certificate for development.
+type TLSConfig struct {
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	SelfSigned bool   `mapstructure:"self_signed"`
+}
+
+func (c TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if c.SelfSigned && c.CertFile != "" {
+		return fmt.Errorf("self_signed can't be combined with cert_file")
+	}
+	return nil
+}
+
+// CORSConfig controls which browser origins may call the API. The default
+// allows any origin.
+type CORSConfig struct {
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	AllowedMethods []string `mapstructure:"allowed_methods"`
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+}
+
+func (c CORSConfig) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("origin %q must be \"*\" or scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// RateLimitConfig is a per-client token bucket for the API. A zero rate
+// disables limiting.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	// Burst defaults to twice the rate, rounded up.
+	Burst int `mapstructure:"burst"`
 }
 
 type LogConfig struct {
 	Level string `mapstructure:"level"`
+	// Access writes one JSON line per API request to stdout.
+	Access bool `mapstructure:"access"`
 }
 
 type ChatConfig struct {
@@ -55,11 +473,63 @@ type ChatConfig struct {
 	MaxOutputTokens int32   `mapstructure:"max_output_tokens"`
 }
 
+// GeminiPricing is the price per million tokens in USD, used to cost
+// analyses. Output includes thinking tokens.
+type GeminiPricing struct {
+	InputPerMillion  float64 `mapstructure:"input_per_million"`
+	OutputPerMillion float64 `mapstructure:"output_per_million"`
+}
+
+func (p GeminiPricing) Enabled() bool {
+	return p.InputPerMillion > 0 || p.OutputPerMillion > 0
+}
+
+// Cost prices token counts, rounded to cents; nil when no price is set.
+func (p GeminiPricing) Cost(promptTokens, responseTokens int64) *float64 {
+	if !p.Enabled() {
+		return nil
+	}
+	cost := float64(promptTokens)/1e6*p.InputPerMillion + float64(responseTokens)/1e6*p.OutputPerMillion
+	cost = math.Round(cost*100) / 100
+	return &cost
+}
+
+// PromptConfig customizes the analysis prompt without forking the code.
+type PromptConfig struct {
+	// TemplateFile replaces the built-in text/template prompt.
+	TemplateFile string `mapstructure:"template_file"`
+	// DomainContext describes the environment, e.g. what the services do.
+	DomainContext string          `mapstructure:"domain_context"`
+	Sections      []PromptSection `mapstructure:"sections"`
+}
+
+// PromptSection is an extra prompt section, rendered as a heading and body.
+type PromptSection struct {
+	Title string `mapstructure:"title"`
+	Body  string `mapstructure:"body"`
+}
+
 type GeminiConfig struct {
-	APIKey  string        `mapstructure:"api_key"`
-	Model   string        `mapstructure:"model"`
+	APIKey     string `mapstructure:"api_key"`
+	APIKeyFile string `mapstructure:"api_key_file"`
+	Model      string `mapstructure:"model"`
+	// Timeout bounds a whole analysis, all Gemini calls and tool calls
+	// included.
 	Timeout time.Duration `mapstructure:"timeout"`
-	Chat    ChatConfig    `mapstructure:"chat"`
+	// MaxIterations caps the tool calls the model may make per analysis.
+	MaxIterations int `mapstructure:"max_iterations"`
+	// MaxConcurrent caps analyses running at once, rule-based ones
+	// included; each snapshot pair runs at most once at a time.
+	MaxConcurrent int        `mapstructure:"max_concurrent"`
+	Chat          ChatConfig `mapstructure:"chat"`
+	// QueryPrometheus gives the analysis a query_prometheus tool that runs
+	// count and topk queries against live data.
+	QueryPrometheus bool          `mapstructure:"query_prometheus"`
+	Pricing         GeminiPricing `mapstructure:"pricing"`
+	// Retry applies to 429 and 503 answers, waiting at least as long as
+	// the API asks.
+	Retry  RetryConfig  `mapstructure:"retry"`
+	Prompt PromptConfig `mapstructure:"prompt"`
 }
 
 func Load(path string) (*Config, error) {
@@ -79,6 +549,10 @@ func Load(path string) (*Config, error) {
 
 	bindEnvs(v)
 
+	// Defaults that the zero value can't express; the rest live in applyDefaults.
+	v.SetDefault("scan.label_values_api", true)
+	v.SetDefault("scan.cardinality_api", true)
+
 	if err := v.ReadInConfig(); err != nil {
 		slog.Warn("no config file found, using env vars and defaults", "error", err)
 	}
@@ -88,9 +562,22 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.resolveVaultSecrets(); err != nil {
+		if err := cfg.revokeAllSecrets(context.Background()); err != nil {
+			slog.Warn("failed to revoke vault leases of rejected config", "error", err)
+		}
+		return nil, fmt.Errorf("resolve vault secrets: %w", err)
+	}
+
 	cfg.applyDefaults()
 
 	if err := cfg.Validate(); err != nil {
+		if err := cfg.revokeAllSecrets(context.Background()); err != nil {
+			slog.Warn("failed to revoke vault leases of rejected config", "error", err)
+		}
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
@@ -102,21 +589,181 @@ func bindEnvs(v *viper.Viper) {
 		"prometheus.url",
 		"prometheus.username",
 		"prometheus.password",
+		"prometheus.password_file",
+		"prometheus.bearer_token",
+		"prometheus.bearer_token_file",
 		"prometheus.timeout",
+		"prometheus.tls.ca_file",
+		"prometheus.tls.cert_file",
+		"prometheus.tls.key_file",
+		"prometheus.tls.insecure_skip_verify",
+		"prometheus.retry.max_attempts",
+		"prometheus.retry.initial_backoff",
+		"prometheus.retry.max_backoff",
+		"prometheus.circuit_breaker.failure_threshold",
+		"prometheus.circuit_breaker.cooldown",
 		"discovery.service_label",
+		"discovery.labels",
+		"discovery.environment_label",
+		"discovery.include",
+		"discovery.exclude",
+		"discovery.kubernetes.enabled",
+		"discovery.kubernetes.kind",
+		"discovery.kubernetes.namespaces",
+		"discovery.kubernetes.label_selector",
+		"scan.mode",
+		"scan.federate.match",
+		"scan.scrape.timeout",
+		"scan.scrape.concurrency",
+		"scan.scrape.tls.ca_file",
+		"scan.scrape.tls.cert_file",
+		"scan.scrape.tls.key_file",
+		"scan.scrape.tls.insecure_skip_verify",
+		"scan.scrape.kubernetes.enabled",
+		"scan.scrape.kubernetes.namespaces",
+		"scan.scrape.kubernetes.label_selector",
+		"scan.otel.exporter_urls",
+		"scan.otel.telemetry_url",
+		"scan.otel.telemetry_service",
+		"scan.datadog.site",
+		"scan.datadog.api_key",
+		"scan.datadog.api_key_file",
+		"scan.datadog.app_key",
+		"scan.datadog.app_key_file",
+		"scan.datadog.timeout",
+		"scan.datadog.lookback",
+		"scan.datadog.tag_filter",
+		"scan.datadog.metric_prefixes",
+		"scan.cloudwatch.region",
+		"scan.cloudwatch.endpoint",
+		"scan.cloudwatch.namespaces",
+		"scan.cloudwatch.include_inactive",
+		"loki.url",
+		"loki.username",
+		"loki.password",
+		"loki.password_file",
+		"loki.bearer_token",
+		"loki.bearer_token_file",
+		"loki.tenant_id",
+		"loki.timeout",
+		"loki.lookback",
+		"loki.service_label",
+		"vault.address",
+		"vault.token",
+		"vault.token_file",
+		"vault.namespace",
+		"vault.ca_file",
+		"vault.kubernetes_role",
+		"vault.kubernetes_mount",
+		"vault.timeout",
+		"kubernetes.api_server",
+		"kubernetes.token_file",
+		"kubernetes.ca_file",
+		"kubernetes.insecure_skip_verify",
 		"scan.interval",
 		"scan.sample_values_limit",
 		"scan.concurrency",
+		"scan.adaptive_concurrency.enabled",
+		"scan.adaptive_concurrency.min",
+		"scan.adaptive_concurrency.max",
+		"scan.adaptive_concurrency.target_latency",
+		"scan.metric_exclude",
+		"scan.queue_size",
+		"scan.incremental.enabled",
+		"scan.incremental.change_threshold",
+		"scan.timeouts.service",
+		"scan.timeouts.query",
+		"scan.lookback",
+		"scan.label_values_api",
+		"scan.cardinality_api",
+		"scan.skip_labels",
+		"scan.series_chunk_size",
+		"scan.max_series_per_metric",
+		"scan.max_queries",
+		"scan.redaction_key",
+		"scan.redaction_key_file",
+		"cost.currency",
+		"cost.per_million_series_month",
+		"cost.per_gb_month",
+		"cost.bytes_per_series",
+		"export.parquet.destination",
+		"export.parquet.s3.region",
+		"export.parquet.s3.endpoint",
+		"export.parquet.s3.force_path_style",
+		"export.metrics.enabled",
+		"export.metrics.top_metrics",
+		"export.remote_write.url",
+		"export.remote_write.username",
+		"export.remote_write.password",
+		"export.remote_write.password_file",
+		"export.remote_write.bearer_token",
+		"export.remote_write.bearer_token_file",
+		"export.remote_write.tenant_id",
+		"export.remote_write.timeout",
 		"storage.path",
 		"storage.retention_days",
+		"storage.downsample_after_days",
+		"storage.backup.destination",
+		"storage.backup.s3.region",
+		"storage.backup.s3.endpoint",
+		"storage.backup.s3.force_path_style",
 		"server.port",
 		"server.host",
+		"server.rate_limit.requests_per_second",
+		"server.rate_limit.burst",
+		"server.cors.allowed_origins",
+		"server.cors.allowed_methods",
+		"server.cors.allowed_headers",
+		"server.tls.cert_file",
+		"server.tls.key_file",
+		"server.tls.self_signed",
 		"log.level",
+		"log.access",
 		"gemini.api_key",
+		"gemini.api_key_file",
 		"gemini.model",
+		"baseline.threshold_pct",
+		"baseline.min_delta",
+		"detection.min_unique_values",
+		"detection.unbounded_values",
+		"detection.match_ratio",
+		"digest.enabled",
+		"digest.days",
+		"digest.time",
+		"digest.timezone",
+		"digest.window",
+		"digest.top",
+		"jira.url",
+		"jira.project",
+		"jira.issue_type",
+		"jira.email",
+		"jira.token",
+		"jira.token_file",
+		"github.api_url",
+		"github.token",
+		"github.token_file",
+		"gitlab.url",
+		"gitlab.token",
+		"gitlab.token_file",
+		"slack.signing_secret",
+		"slack.signing_secret_file",
+		"grafana.url",
+		"grafana.token",
+		"grafana.token_file",
+		"grafana.dashboard_uid",
 		"gemini.timeout",
+		"gemini.max_iterations",
+		"gemini.max_concurrent",
 		"gemini.chat.temperature",
 		"gemini.chat.max_output_tokens",
+		"gemini.query_prometheus",
+		"gemini.pricing.input_per_million",
+		"gemini.pricing.output_per_million",
+		"gemini.retry.max_attempts",
+		"gemini.retry.initial_backoff",
+		"gemini.retry.max_backoff",
+		"gemini.prompt.template_file",
+		"gemini.prompt.domain_context",
 	}
 	for _, key := range keys {
 		v.BindEnv(key)
@@ -124,14 +771,138 @@ func bindEnvs(v *viper.Viper) {
 }
 
 func (c *Config) applyDefaults() {
+	if c.Discovery.Kubernetes.Kind == "" {
+		c.Discovery.Kubernetes.Kind = KubernetesServices
+	}
+	if c.Scan.Mode == "" {
+		c.Scan.Mode = ScanModeQuery
+	}
+	if c.Scan.OTel.TelemetryService == "" {
+		c.Scan.OTel.TelemetryService = "otelcol"
+	}
+	if c.Scan.Datadog.Site == "" {
+		c.Scan.Datadog.Site = "datadoghq.com"
+	}
+	if c.Scan.Datadog.Timeout <= 0 {
+		c.Scan.Datadog.Timeout = 30 * time.Second
+	}
+	if c.Scan.Datadog.Lookback <= 0 {
+		c.Scan.Datadog.Lookback = time.Hour
+	}
 	if c.Scan.Concurrency <= 0 {
 		c.Scan.Concurrency = 5
 	}
+	if c.Scan.AdaptiveConcurrency.Min <= 0 {
+		c.Scan.AdaptiveConcurrency.Min = 1
+	}
+	if c.Scan.AdaptiveConcurrency.Max <= 0 {
+		c.Scan.AdaptiveConcurrency.Max = max(50, c.Scan.Concurrency)
+	}
+	if c.Scan.AdaptiveConcurrency.TargetLatency <= 0 {
+		c.Scan.AdaptiveConcurrency.TargetLatency = 2 * time.Second
+	}
+	if c.Scan.Incremental.ChangeThreshold <= 0 {
+		c.Scan.Incremental.ChangeThreshold = 5
+	}
+	for i := range c.Scan.Redaction {
+		if c.Scan.Redaction[i].Action == "" {
+			c.Scan.Redaction[i].Action = RedactionMask
+		}
+	}
+	if c.Scan.SeriesChunkSize <= 0 {
+		c.Scan.SeriesChunkSize = 10000
+	}
+	if c.Scan.Timeouts.Service <= 0 {
+		c.Scan.Timeouts.Service = 2 * time.Minute
+	}
 	if c.Prometheus.Timeout <= 0 {
 		c.Prometheus.Timeout = 30 * time.Second
 	}
+	if c.Prometheus.Retry.MaxAttempts <= 0 {
+		c.Prometheus.Retry.MaxAttempts = 3
+	}
+	if c.Prometheus.Retry.InitialBackoff <= 0 {
+		c.Prometheus.Retry.InitialBackoff = 500 * time.Millisecond
+	}
+	if c.Prometheus.Retry.MaxBackoff <= 0 {
+		c.Prometheus.Retry.MaxBackoff = 10 * time.Second
+	}
+	if c.Prometheus.CircuitBreaker.FailureThreshold <= 0 {
+		c.Prometheus.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.Prometheus.CircuitBreaker.Cooldown <= 0 {
+		c.Prometheus.CircuitBreaker.Cooldown = 30 * time.Second
+	}
+	if c.Loki.Timeout <= 0 {
+		c.Loki.Timeout = 30 * time.Second
+	}
+	if c.Loki.Lookback <= 0 {
+		c.Loki.Lookback = time.Hour
+	}
+	if c.Loki.ServiceLabel == "" {
+		c.Loki.ServiceLabel = "service_name"
+	}
+	if c.Cost.Currency == "" {
+		c.Cost.Currency = "USD"
+	}
+	if c.Cost.BytesPerSeries <= 0 {
+		c.Cost.BytesPerSeries = 4096
+	}
+	if c.Server.RateLimit.RequestsPerSecond > 0 && c.Server.RateLimit.Burst <= 0 {
+		c.Server.RateLimit.Burst = int(math.Ceil(c.Server.RateLimit.RequestsPerSecond * 2))
+	}
+	if len(c.Server.CORS.AllowedOrigins) == 0 {
+		c.Server.CORS.AllowedOrigins = []string{"*"}
+	}
+	if len(c.Server.CORS.AllowedMethods) == 0 {
+		c.Server.CORS.AllowedMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
+	}
+	if len(c.Server.CORS.AllowedHeaders) == 0 {
+		c.Server.CORS.AllowedHeaders = []string{"Content-Type", "X-Request-ID"}
+	}
+	for i := range c.Notifications.Webhooks {
+		if c.Notifications.Webhooks[i].Format == "" {
+			c.Notifications.Webhooks[i].Format = WebhookJSON
+		}
+	}
+	c.Digest.applyDefaults()
+	if c.Export.Metrics.TopMetrics <= 0 {
+		c.Export.Metrics.TopMetrics = 100
+	}
+	if c.Export.RemoteWrite.Timeout <= 0 {
+		c.Export.RemoteWrite.Timeout = 30 * time.Second
+	}
+	c.Detection.applyDefaults()
+	c.Jira.applyDefaults()
+	if c.GitHub.APIURL == "" {
+		c.GitHub.APIURL = "https://api.github.com"
+	}
+	if c.GitLab.URL == "" {
+		c.GitLab.URL = "https://gitlab.com"
+	}
+	if c.Baseline.ThresholdPct <= 0 {
+		c.Baseline.ThresholdPct = 20
+	}
+	if c.Baseline.MinDelta <= 0 {
+		c.Baseline.MinDelta = 1000
+	}
 	if c.Gemini.Timeout <= 0 {
-		c.Gemini.Timeout = 2 * time.Minute
+		c.Gemini.Timeout = 5 * time.Minute
+	}
+	if c.Gemini.MaxIterations <= 0 {
+		c.Gemini.MaxIterations = 20
+	}
+	if c.Gemini.MaxConcurrent <= 0 {
+		c.Gemini.MaxConcurrent = 2
+	}
+	if c.Gemini.Retry.MaxAttempts <= 0 {
+		c.Gemini.Retry.MaxAttempts = 5
+	}
+	if c.Gemini.Retry.InitialBackoff <= 0 {
+		c.Gemini.Retry.InitialBackoff = 2 * time.Second
+	}
+	if c.Gemini.Retry.MaxBackoff <= 0 {
+		c.Gemini.Retry.MaxBackoff = time.Minute
 	}
 	if c.Gemini.Chat.Temperature <= 0 {
 		c.Gemini.Chat.Temperature = 0.1
@@ -142,15 +913,233 @@ func (c *Config) applyDefaults() {
 }
 
 func (c *Config) Validate() error {
-	if c.Prometheus.URL == "" {
+	if c.Prometheus.URL == "" && c.Scan.Mode.queriesPrometheus() {
 		return fmt.Errorf("prometheus.url is required")
 	}
-	if c.Discovery.ServiceLabel == "" {
-		return fmt.Errorf("discovery.service_label is required")
+	if c.Prometheus.BearerToken != "" && c.Prometheus.BearerTokenFile != "" {
+		return fmt.Errorf("prometheus.bearer_token and bearer_token_file are mutually exclusive")
+	}
+	if (c.Prometheus.BearerToken != "" || c.Prometheus.BearerTokenFile != "") && c.Prometheus.Username != "" {
+		return fmt.Errorf("prometheus bearer token can't be combined with basic auth")
+	}
+	if (c.Prometheus.TLS.CertFile == "") != (c.Prometheus.TLS.KeyFile == "") {
+		return fmt.Errorf("prometheus.tls.cert_file and key_file must be set together")
+	}
+	if (c.Scan.Scrape.TLS.CertFile == "") != (c.Scan.Scrape.TLS.KeyFile == "") {
+		return fmt.Errorf("scan.scrape.tls.cert_file and key_file must be set together")
+	}
+	if c.Prometheus.Retry.MaxBackoff < c.Prometheus.Retry.InitialBackoff {
+		return fmt.Errorf("prometheus.retry.max_backoff must not be less than initial_backoff")
+	}
+	if c.Discovery.ServiceLabel == "" && len(c.Discovery.Labels) == 0 {
+		return fmt.Errorf("discovery.service_label or discovery.labels is required")
+	}
+	for _, label := range c.Discovery.Labels {
+		if label == "" {
+			return fmt.Errorf("discovery.labels must not contain empty names")
+		}
+	}
+	if c.Loki.URL != "" && c.Loki.BearerToken != "" && c.Loki.Username != "" {
+		return fmt.Errorf("loki bearer token can't be combined with basic auth")
+	}
+	if k := c.Discovery.Kubernetes; k.Enabled {
+		if k.Kind != KubernetesServices && k.Kind != KubernetesPods {
+			return fmt.Errorf("discovery.kubernetes.kind must be services or pods")
+		}
+		for label, source := range k.LabelMap {
+			if source != "namespace" && source != "name" && !strings.HasPrefix(source, "label:") {
+				return fmt.Errorf("discovery.kubernetes.label_map.%s must be namespace, name or label:<key>", label)
+			}
+		}
+	}
+	if c.Gemini.Retry.MaxBackoff < c.Gemini.Retry.InitialBackoff {
+		return fmt.Errorf("gemini.retry.max_backoff must not be less than initial_backoff")
+	}
+	for i, section := range c.Gemini.Prompt.Sections {
+		if section.Title == "" || section.Body == "" {
+			return fmt.Errorf("gemini.prompt.sections[%d] needs a title and a body", i)
+		}
+	}
+	if c.Gemini.Pricing.InputPerMillion < 0 || c.Gemini.Pricing.OutputPerMillion < 0 {
+		return fmt.Errorf("gemini.pricing must not be negative")
+	}
+	if c.Gemini.QueryPrometheus && len(c.Scan.Redaction) > 0 {
+		return fmt.Errorf("gemini.query_prometheus can't be combined with scan.redaction, live results are not redacted")
+	}
+	if err := c.Cost.validate(); err != nil {
+		return fmt.Errorf("invalid cost: %w", err)
+	}
+	if err := c.Export.Parquet.validate(); err != nil {
+		return fmt.Errorf("invalid export.parquet: %w", err)
+	}
+	if c.Export.RemoteWrite.Enabled() && !isHTTPURL(c.Export.RemoteWrite.URL) {
+		return fmt.Errorf("export.remote_write.url must be an http(s) URL")
+	}
+	if c.Storage.DownsampleAfterDays < 0 {
+		return fmt.Errorf("storage.downsample_after_days must not be negative")
+	}
+	if c.Storage.DownsampleAfterDays > 0 && c.Storage.RetentionDays > 0 && c.Storage.DownsampleAfterDays >= c.Storage.RetentionDays {
+		return fmt.Errorf("storage.downsample_after_days must be less than retention_days")
+	}
+	if err := validateDestination(c.Storage.Backup.Destination); err != nil {
+		return fmt.Errorf("invalid storage.backup: %w", err)
+	}
+	for i, team := range c.Teams {
+		if team.Name == "" {
+			return fmt.Errorf("teams[%d].name is required", i)
+		}
+		for _, pattern := range team.Services {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid teams[%d] pattern %q: %w", i, pattern, err)
+			}
+		}
+		if err := c.validateRepository(team.Repository); err != nil {
+			return fmt.Errorf("invalid teams[%d].repository: %w", i, err)
+		}
+	}
+	for i, l := range c.Limits {
+		if l.Metric == "" {
+			return fmt.Errorf("limits[%d].metric is required", i)
+		}
+		if l.MaxSeries <= 0 {
+			return fmt.Errorf("limits[%d].max_series must be positive", i)
+		}
+		for _, pattern := range append([]string{l.Metric}, l.Services...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid limits[%d] pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	for _, pattern := range append(c.Discovery.Include, c.Discovery.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid discovery pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range c.Scan.MetricExclude {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid scan.metric_exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for i, r := range c.Scan.Redaction {
+		if r.Name == "" {
+			return fmt.Errorf("scan.redaction[%d].name is required", i)
+		}
+		if r.Pattern == "" {
+			return fmt.Errorf("scan.redaction[%d].pattern is required", i)
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid scan.redaction[%d].pattern %q: %w", i, r.Pattern, err)
+		}
+		if r.Action != RedactionMask && r.Action != RedactionHash {
+			return fmt.Errorf("scan.redaction[%d].action must be mask or hash", i)
+		}
+		if r.Action == RedactionHash && c.Scan.RedactionKey == "" {
+			return fmt.Errorf("scan.redaction[%d].action hash needs scan.redaction_key", i)
+		}
+	}
+	switch c.Scan.Mode {
+	case ScanModeQuery, ScanModeFederate:
+	case ScanModeScrape:
+		if len(c.Scan.Scrape.Targets) == 0 && !c.Scan.Scrape.Kubernetes.Enabled {
+			return fmt.Errorf("scan.mode scrape needs scan.scrape.targets or scan.scrape.kubernetes.enabled")
+		}
+		for i, t := range c.Scan.Scrape.Targets {
+			if !isHTTPURL(t.URL) {
+				return fmt.Errorf("scan.scrape.targets[%d].url must be an http(s) URL", i)
+			}
+		}
+	case ScanModeOTel:
+		if len(c.Scan.OTel.ExporterURLs) == 0 && c.Scan.OTel.TelemetryURL == "" {
+			return fmt.Errorf("scan.mode otel needs scan.otel.exporter_urls or scan.otel.telemetry_url")
+		}
+		for i, u := range c.Scan.OTel.ExporterURLs {
+			if !isHTTPURL(u) {
+				return fmt.Errorf("scan.otel.exporter_urls[%d] must be an http(s) URL", i)
+			}
+		}
+		if c.Scan.OTel.TelemetryURL != "" && !isHTTPURL(c.Scan.OTel.TelemetryURL) {
+			return fmt.Errorf("scan.otel.telemetry_url must be an http(s) URL")
+		}
+	case ScanModeDatadog:
+		if c.Scan.Datadog.APIKey == "" || c.Scan.Datadog.AppKey == "" {
+			return fmt.Errorf("scan.mode datadog needs scan.datadog.api_key and app_key")
+		}
+	case ScanModeCloudWatch:
+		if len(c.Scan.CloudWatch.Namespaces) == 0 {
+			return fmt.Errorf("scan.mode cloudwatch needs scan.cloudwatch.namespaces")
+		}
+		if c.Scan.CloudWatch.Endpoint != "" && !isHTTPURL(c.Scan.CloudWatch.Endpoint) {
+			return fmt.Errorf("scan.cloudwatch.endpoint must be an http(s) URL")
+		}
+	default:
+		return fmt.Errorf("scan.mode must be query, federate, scrape, otel, datadog or cloudwatch")
+	}
+	if c.Scan.MaxSeriesPerMetric < 0 {
+		return fmt.Errorf("scan.max_series_per_metric must not be negative")
+	}
+	if c.Scan.MaxQueries < 0 {
+		return fmt.Errorf("scan.max_queries must not be negative")
+	}
+	if a := c.Scan.AdaptiveConcurrency; a.Enabled && a.Min > a.Max {
+		return fmt.Errorf("scan.adaptive_concurrency.min must not be above max")
+	}
+	if c.Scan.Lookback < 0 {
+		return fmt.Errorf("scan.lookback must not be negative")
+	}
+	if c.Scan.Timeouts.Query < 0 {
+		return fmt.Errorf("scan.timeouts.query must not be negative")
+	}
+	for i, o := range c.Scan.Timeouts.Overrides {
+		if o.Service <= 0 {
+			return fmt.Errorf("scan.timeouts.overrides[%d].service must be positive", i)
+		}
+		for _, pattern := range o.Services {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid scan.timeouts.overrides[%d] pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	for i, w := range c.Scan.BlackoutWindows {
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("invalid scan.blackout_windows[%d]: %w", i, err)
+		}
+	}
+	if err := c.Notifications.validate(); err != nil {
+		return fmt.Errorf("invalid notifications: %w", err)
+	}
+	if err := c.Digest.validate(); err != nil {
+		return fmt.Errorf("invalid digest: %w", err)
+	}
+	if err := c.Detection.validate(); err != nil {
+		return fmt.Errorf("invalid detection: %w", err)
+	}
+	if err := c.Jira.validate(); err != nil {
+		return fmt.Errorf("invalid jira: %w", err)
+	}
+	if err := c.Grafana.validate(); err != nil {
+		return fmt.Errorf("invalid grafana: %w", err)
+	}
+	if !isHTTPURL(c.GitHub.APIURL) {
+		return fmt.Errorf("github.api_url must be an http(s) URL")
+	}
+	if !isHTTPURL(c.GitLab.URL) {
+		return fmt.Errorf("gitlab.url must be an http(s) URL")
+	}
+	if c.Digest.Enabled && len(c.Notifications.Webhooks) == 0 {
+		return fmt.Errorf("digest.enabled needs at least one notifications.webhooks target")
 	}
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		return fmt.Errorf("server.port must be between 1 and 65535")
 	}
+	if c.Server.RateLimit.RequestsPerSecond < 0 {
+		return fmt.Errorf("server.rate_limit.requests_per_second must not be negative")
+	}
+	if err := c.Server.CORS.validate(); err != nil {
+		return fmt.Errorf("invalid server.cors: %w", err)
+	}
+	if err := c.Server.TLS.validate(); err != nil {
+		return fmt.Errorf("invalid server.tls: %w", err)
+	}
 	return nil
 }
 
@@ -158,6 +1147,10 @@ func (c *Config) RetentionDuration() time.Duration {
 	return time.Duration(c.Storage.RetentionDays) * 24 * time.Hour
 }
 
+func (c *Config) DownsampleDuration() time.Duration {
+	return time.Duration(c.Storage.DownsampleAfterDays) * 24 * time.Hour
+}
+
 func (c *Config) LogLevel() slog.Level {
 	switch c.Log.Level {
 	case "debug":
@@ -170,3 +1163,8 @@ func (c *Config) LogLevel() slog.Level {
 		return slog.LevelInfo
 	}
 }
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
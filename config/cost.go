@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// CostConfig prices series so reports can speak in money. Either price may
+// be set; when both are, they add up.
+type CostConfig struct {
+	Currency string `mapstructure:"currency"`
+	// PerMillionSeriesMonth is the price of one million active series for
+	// a month.
+	PerMillionSeriesMonth float64 `mapstructure:"per_million_series_month"`
+	// PerGBMonth is the price of a GB stored for a month, applied to the
+	// estimated size of the series.
+	PerGBMonth float64 `mapstructure:"per_gb_month"`
+	// BytesPerSeries is the estimated storage footprint of one series for
+	// a month, used with PerGBMonth.
+	BytesPerSeries int64 `mapstructure:"bytes_per_series"`
+}
+
+func (c CostConfig) Enabled() bool {
+	return c.PerMillionSeriesMonth > 0 || c.PerGBMonth > 0
+}
+
+// MonthlyCost prices a number of series, rounded to cents.
+func (c CostConfig) MonthlyCost(series int64) float64 {
+	cost := float64(series) / 1e6 * c.PerMillionSeriesMonth
+	cost += float64(series*c.BytesPerSeries) / 1e9 * c.PerGBMonth
+	return math.Round(cost*100) / 100
+}
+
+// MonthlyCostPtr is MonthlyCost for optional JSON fields: nil when no price
+// is configured.
+func (c CostConfig) MonthlyCostPtr(series int64) *float64 {
+	if !c.Enabled() {
+		return nil
+	}
+	cost := c.MonthlyCost(series)
+	return &cost
+}
+
+func (c CostConfig) validate() error {
+	if c.PerMillionSeriesMonth < 0 || c.PerGBMonth < 0 {
+		return fmt.Errorf("prices must not be negative")
+	}
+	if c.BytesPerSeries < 0 {
+		return fmt.Errorf("bytes_per_series must not be negative")
+	}
+	return nil
+}
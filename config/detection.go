@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// DetectionConfig tunes how label anti-patterns are spotted, both by the
+// built-in rules and in the Gemini prompt.
+type DetectionConfig struct {
+	// MinUniqueValues is how many values a label needs before any pattern
+	// counts.
+	MinUniqueValues int `mapstructure:"min_unique_values"`
+	// UnboundedValues flags labels with more values than this even when
+	// they follow no pattern.
+	UnboundedValues int `mapstructure:"unbounded_values"`
+	// MatchRatio is the share of sample values that must follow a pattern.
+	MatchRatio float64 `mapstructure:"match_ratio"`
+	// Patterns are checked before the built-in ones.
+	Patterns []DetectionPattern `mapstructure:"patterns"`
+	// AllowLabels are globs over label names known to be bounded, which
+	// are never flagged, e.g. path when routes are templated.
+	AllowLabels []string `mapstructure:"allow_labels"`
+}
+
+type DetectionPattern struct {
+	// Name is what matching labels are reported as, e.g. order_id.
+	Name  string `mapstructure:"name"`
+	Regex string `mapstructure:"regex"`
+}
+
+func (d *DetectionConfig) applyDefaults() {
+	if d.MinUniqueValues <= 0 {
+		d.MinUniqueValues = 10
+	}
+	if d.UnboundedValues <= 0 {
+		d.UnboundedValues = 50
+	}
+	if d.MatchRatio <= 0 {
+		d.MatchRatio = 0.5
+	}
+}
+
+func (d DetectionConfig) validate() error {
+	if d.MatchRatio > 1 {
+		return fmt.Errorf("match_ratio must be between 0 and 1")
+	}
+	for i, p := range d.Patterns {
+		if p.Name == "" {
+			return fmt.Errorf("patterns[%d].name is required", i)
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("invalid patterns[%d].regex %q: %w", i, p.Regex, err)
+		}
+	}
+	for _, pattern := range d.AllowLabels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allow_labels pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
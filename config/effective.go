@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+const maskedSecret = "<redacted>"
+
+// Effective returns the config as loaded, defaults applied, keyed like the
+// config file. Secrets that are set are masked, so the result is safe to
+// print.
+func (c *Config) Effective() (map[string]any, error) {
+	var out map[string]any
+	if err := mapstructure.Decode(c, &out); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+
+	for _, s := range c.secretFiles() {
+		if *s.value != "" {
+			setPath(out, s.key, maskedSecret)
+		}
+	}
+	if c.Vault.Token != "" {
+		setPath(out, "vault.token", maskedSecret)
+	}
+	// Webhook URLs often embed their token, as Slack's do.
+	webhooks := make([]any, len(c.Notifications.Webhooks))
+	for i, w := range c.Notifications.Webhooks {
+		headers := make(map[string]any, len(w.Headers))
+		for k := range w.Headers {
+			headers[k] = maskedSecret
+		}
+		webhooks[i] = map[string]any{"url": maskedSecret, "format": string(w.Format), "headers": headers}
+	}
+	setPath(out, "notifications.webhooks", webhooks)
+	return readableDurations(out).(map[string]any), nil
+}
+
+func setPath(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]any)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+// readableDurations turns durations into strings such as "30s" instead of
+// nanosecond counts.
+func readableDurations(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = readableDurations(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = readableDurations(item)
+		}
+	case time.Duration:
+		return v.String()
+	}
+	return v
+}
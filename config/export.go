@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ExportConfig struct {
+	Parquet ParquetExportConfig `mapstructure:"parquet"`
+	Metrics MetricsExportConfig `mapstructure:"metrics"`
+	// RemoteWrite sends series totals to a long-term TSDB after every scan.
+	RemoteWrite RemoteWriteConfig `mapstructure:"remote_write"`
+}
+
+// RemoteWriteConfig is a Prometheus remote write endpoint, e.g. Mimir,
+// Thanos Receive or VictoriaMetrics. Empty URL disables it.
+type RemoteWriteConfig struct {
+	URL             string `mapstructure:"url"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	PasswordFile    string `mapstructure:"password_file"`
+	BearerToken     string `mapstructure:"bearer_token"`
+	BearerTokenFile string `mapstructure:"bearer_token_file"`
+	// TenantID is sent as X-Scope-OrgID for multi-tenant backends.
+	TenantID string        `mapstructure:"tenant_id"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+func (r RemoteWriteConfig) Enabled() bool {
+	return r.URL != ""
+}
+
+// MetricsExportConfig serves the latest snapshot on /metrics in the
+// Prometheus format, so cardinality can be alerted on in Prometheus.
+type MetricsExportConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TopMetrics is how many of the largest service metrics get a series
+	// gauge of their own.
+	TopMetrics int `mapstructure:"top_metrics"`
+}
+
+// ParquetExportConfig writes services, metrics and labels tables for every
+// snapshot after it is collected.
+type ParquetExportConfig struct {
+	// Destination is a local directory or an s3://bucket/prefix URL. Empty
+	// disables the export.
+	Destination string   `mapstructure:"destination"`
+	S3          S3Config `mapstructure:"s3"`
+}
+
+// S3Config tunes the S3 client. Credentials come from the standard AWS
+// environment variables, shared config or instance role.
+type S3Config struct {
+	Region string `mapstructure:"region"`
+	// Endpoint overrides the S3 endpoint for compatible stores such as MinIO.
+	Endpoint       string `mapstructure:"endpoint"`
+	ForcePathStyle bool   `mapstructure:"force_path_style"`
+}
+
+func (p ParquetExportConfig) Enabled() bool {
+	return p.Destination != ""
+}
+
+func (p ParquetExportConfig) validate() error {
+	return validateDestination(p.Destination)
+}
+
+func validateDestination(destination string) error {
+	if rest, ok := strings.CutPrefix(destination, "s3://"); ok {
+		if bucket, _, _ := strings.Cut(rest, "/"); bucket == "" {
+			return fmt.Errorf("destination %q has no bucket", destination)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotificationsConfig is where messages such as the digest are delivered.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `mapstructure:"webhooks"`
+}
+
+type WebhookFormat string
+
+const (
+	// WebhookJSON posts {"title", "text"} with markdown text.
+	WebhookJSON WebhookFormat = "json"
+	// WebhookSlack posts {"text"} for Slack incoming webhooks.
+	WebhookSlack WebhookFormat = "slack"
+)
+
+type WebhookConfig struct {
+	URL    string        `mapstructure:"url"`
+	Format WebhookFormat `mapstructure:"format"`
+	// Headers are added to every request, e.g. Authorization.
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// DigestConfig sends a summary of the last Window of scans on the given
+// days at Time, through every configured notification target.
+type DigestConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Days are mon..sun, "weekdays" or "weekends"; Monday by default.
+	Days     []string `mapstructure:"days"`
+	Time     string   `mapstructure:"time"`     // HH:MM, 09:00 by default
+	Timezone string   `mapstructure:"timezone"` // IANA name, defaults to local time
+	// Window is how far back the digest compares, a week by default.
+	Window time.Duration `mapstructure:"window"`
+	// Top is how many services and metrics each list shows.
+	Top int `mapstructure:"top"`
+}
+
+func (d *DigestConfig) applyDefaults() {
+	if len(d.Days) == 0 {
+		d.Days = []string{"mon"}
+	}
+	if d.Time == "" {
+		d.Time = "09:00"
+	}
+	if d.Window <= 0 {
+		d.Window = 7 * 24 * time.Hour
+	}
+	if d.Top <= 0 {
+		d.Top = 10
+	}
+}
+
+func (d DigestConfig) validate() error {
+	for _, day := range d.Days {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+	}
+	if _, err := parseClock(d.Time); err != nil {
+		return fmt.Errorf("time: %w", err)
+	}
+	if _, err := time.LoadLocation(d.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	return nil
+}
+
+// Next returns the first send time after t.
+func (d DigestConfig) Next(t time.Time) time.Time {
+	loc := time.Local
+	if d.Timezone != "" {
+		if l, err := time.LoadLocation(d.Timezone); err == nil {
+			loc = l
+		}
+	}
+	at, err := parseClock(d.Time)
+	if err != nil {
+		return time.Time{}
+	}
+
+	t = t.In(loc)
+	hour, minute := int(at/time.Hour), int(at%time.Hour/time.Minute)
+	for i := 0; i <= 7; i++ {
+		// Built from the date so the clock time holds across DST changes.
+		next := time.Date(t.Year(), t.Month(), t.Day()+i, hour, minute, 0, 0, loc)
+		if next.After(t) && matchesDay(d.Days, next.Weekday()) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (n NotificationsConfig) validate() error {
+	for i, w := range n.Webhooks {
+		if !isHTTPURL(w.URL) {
+			return fmt.Errorf("webhooks[%d].url must be an http(s) URL", i)
+		}
+		if w.Format != WebhookJSON && w.Format != WebhookSlack {
+			return fmt.Errorf("webhooks[%d].format must be json or slack", i)
+		}
+	}
+	return nil
+}
+
+// SlackConfig enables the Slack app endpoints for slash commands and
+// interactive buttons. SigningSecret is the app's signing secret, used to
+// verify that requests come from Slack; empty disables the endpoints.
+type SlackConfig struct {
+	SigningSecret     string `mapstructure:"signing_secret"`
+	SigningSecretFile string `mapstructure:"signing_secret_file"`
+}
+
+func (s SlackConfig) Enabled() bool {
+	return s.SigningSecret != ""
+}
+
+// GrafanaConfig posts annotations to Grafana for finished scans, services
+// whose series jumped since the previous scan and new findings. Empty URL
+// disables it.
+type GrafanaConfig struct {
+	URL string `mapstructure:"url"`
+	// Token is a service account token with the annotations:write
+	// permission.
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"token_file"`
+	// DashboardUID limits the annotations to one dashboard; without it they
+	// are organization-wide and shown wherever a dashboard queries them.
+	DashboardUID string `mapstructure:"dashboard_uid"`
+	// Tags are added to every annotation, next to "whodidthis".
+	Tags []string `mapstructure:"tags"`
+}
+
+func (g GrafanaConfig) Enabled() bool {
+	return g.URL != ""
+}
+
+func (g GrafanaConfig) validate() error {
+	if !g.Enabled() {
+		return nil
+	}
+	if !isHTTPURL(g.URL) {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if g.Token == "" {
+		return fmt.Errorf("token (or token_file) is required")
+	}
+	return nil
+}
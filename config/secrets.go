@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secretFile pairs an inline secret with the _file key that may supply it
+// instead, e.g. a mounted Kubernetes Secret. Every listed value may also be
+// a vault: reference.
+type secretFile struct {
+	key   string
+	value *string
+	path  string
+}
+
+func (c *Config) secretFiles() []secretFile {
+	return []secretFile{
+		{"prometheus.username", &c.Prometheus.Username, ""},
+		{"prometheus.password", &c.Prometheus.Password, c.Prometheus.PasswordFile},
+		{"prometheus.bearer_token", &c.Prometheus.BearerToken, ""},
+		{"scan.datadog.api_key", &c.Scan.Datadog.APIKey, c.Scan.Datadog.APIKeyFile},
+		{"scan.datadog.app_key", &c.Scan.Datadog.AppKey, c.Scan.Datadog.AppKeyFile},
+		{"scan.redaction_key", &c.Scan.RedactionKey, c.Scan.RedactionKeyFile},
+		{"loki.username", &c.Loki.Username, ""},
+		{"loki.password", &c.Loki.Password, c.Loki.PasswordFile},
+		{"loki.bearer_token", &c.Loki.BearerToken, c.Loki.BearerTokenFile},
+		{"export.remote_write.username", &c.Export.RemoteWrite.Username, ""},
+		{"export.remote_write.password", &c.Export.RemoteWrite.Password, c.Export.RemoteWrite.PasswordFile},
+		{"export.remote_write.bearer_token", &c.Export.RemoteWrite.BearerToken, c.Export.RemoteWrite.BearerTokenFile},
+		{"gemini.api_key", &c.Gemini.APIKey, c.Gemini.APIKeyFile},
+		{"jira.token", &c.Jira.Token, c.Jira.TokenFile},
+		{"github.token", &c.GitHub.Token, c.GitHub.TokenFile},
+		{"gitlab.token", &c.GitLab.Token, c.GitLab.TokenFile},
+		{"slack.signing_secret", &c.Slack.SigningSecret, c.Slack.SigningSecretFile},
+		{"grafana.token", &c.Grafana.Token, c.Grafana.TokenFile},
+	}
+}
+
+// readSecretFiles fills secrets from their _file keys (or WDT_*_FILE
+// variables). Surrounding whitespace is trimmed, since mounted files
+// usually end in a newline. The files are read on every load, so a
+// reload picks up rotated secrets.
+func (c *Config) readSecretFiles() error {
+	for _, s := range c.secretFiles() {
+		if s.path == "" {
+			continue
+		}
+		if *s.value != "" {
+			return fmt.Errorf("%s and %s_file are mutually exclusive", s.key, s.key)
+		}
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("read %s_file: %w", s.key, err)
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// JiraConfig lets findings be turned into Jira issues. Empty URL disables
+// it. With Email set the token is a Jira Cloud API token used with basic
+// auth; without, a personal access token sent as a bearer token.
+type JiraConfig struct {
+	URL       string `mapstructure:"url"`
+	Project   string `mapstructure:"project"`
+	IssueType string `mapstructure:"issue_type"`
+	Email     string `mapstructure:"email"`
+	Token     string `mapstructure:"token"`
+	TokenFile string `mapstructure:"token_file"`
+	// Labels are added to every issue.
+	Labels []string `mapstructure:"labels"`
+}
+
+func (j JiraConfig) Enabled() bool {
+	return j.URL != ""
+}
+
+func (j *JiraConfig) applyDefaults() {
+	if j.IssueType == "" {
+		j.IssueType = "Task"
+	}
+}
+
+func (j JiraConfig) validate() error {
+	if !j.Enabled() {
+		return nil
+	}
+	if !isHTTPURL(j.URL) {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if j.Project == "" {
+		return fmt.Errorf("project is required")
+	}
+	if j.Token == "" {
+		return fmt.Errorf("token (or token_file) is required")
+	}
+	return nil
+}
+
+type RepositoryProvider string
+
+const (
+	ProviderGitHub RepositoryProvider = "github"
+	ProviderGitLab RepositoryProvider = "gitlab"
+)
+
+// TeamRepository names a team's repository, owner/repo on GitHub or the
+// full project path on GitLab. An empty one means the team gets no issues.
+type TeamRepository struct {
+	Provider RepositoryProvider `mapstructure:"provider"`
+	Name     string             `mapstructure:"name"`
+}
+
+// GitHubConfig authenticates issue creation in teams' GitHub repositories.
+// APIURL points at the API of GitHub Enterprise Server instead of
+// github.com, e.g. https://github.example.com/api/v3.
+type GitHubConfig struct {
+	APIURL    string   `mapstructure:"api_url"`
+	Token     string   `mapstructure:"token"`
+	TokenFile string   `mapstructure:"token_file"`
+	Labels    []string `mapstructure:"labels"`
+}
+
+// GitLabConfig authenticates issue creation in teams' GitLab projects.
+type GitLabConfig struct {
+	URL       string   `mapstructure:"url"`
+	Token     string   `mapstructure:"token"`
+	TokenFile string   `mapstructure:"token_file"`
+	Labels    []string `mapstructure:"labels"`
+}
+
+func (c *Config) validateRepository(r TeamRepository) error {
+	if r.Provider == "" && r.Name == "" {
+		return nil
+	}
+	if !strings.Contains(strings.Trim(r.Name, "/"), "/") {
+		return fmt.Errorf("name must be owner/repo or a group/project path")
+	}
+	switch r.Provider {
+	case ProviderGitHub:
+		if c.GitHub.Token == "" {
+			return fmt.Errorf("github.token (or token_file) is required for GitHub repositories")
+		}
+	case ProviderGitLab:
+		if c.GitLab.Token == "" {
+			return fmt.Errorf("gitlab.token (or token_file) is required for GitLab projects")
+		}
+	default:
+		return fmt.Errorf("provider must be github or gitlab")
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// vaultPrefix marks a secret value as a Vault reference:
+// vault:<path>#<field>, where path is the API path without /v1/, e.g.
+// vault:secret/data/whodidthis#gemini_api_key (KV v2) or
+// vault:database/creds/prometheus#password (dynamic).
+const vaultPrefix = "vault:"
+
+const defaultServiceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig is how vault: references are resolved. Address and token
+// default to VAULT_ADDR and VAULT_TOKEN; with KubernetesRole set the pod's
+// service account logs in instead of a token. CAFile verifies the server
+// instead of the system roots.
+type VaultConfig struct {
+	Address        string `mapstructure:"address"`
+	Token          string `mapstructure:"token"`
+	TokenFile      string `mapstructure:"token_file"`
+	Namespace      string `mapstructure:"namespace"`
+	CAFile         string `mapstructure:"ca_file"`
+	KubernetesRole string `mapstructure:"kubernetes_role"`
+	// KubernetesMount is the auth method's mount path, "kubernetes" by
+	// default.
+	KubernetesMount string        `mapstructure:"kubernetes_mount"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+}
+
+// SecretsTTL is the shortest lease among the secrets read from Vault, zero
+// when none is leased. The config must be loaded again before it runs out
+// to get fresh credentials.
+func (c *Config) SecretsTTL() time.Duration {
+	return c.secretsTTL
+}
+
+// RevokeSecrets revokes the Vault leases behind the given keys, e.g.
+// "prometheus.password", once a reloaded config's secrets have replaced
+// them in the running clients; otherwise every reload leaves another set of
+// live credentials behind. A lease that also backs a key not listed is
+// kept, since some client still uses it.
+func (c *Config) RevokeSecrets(ctx context.Context, keys ...string) error {
+	return c.revokeSecrets(ctx, func(key string) bool { return slices.Contains(keys, key) })
+}
+
+// revokeAllSecrets revokes every lease, for a config that is never used.
+func (c *Config) revokeAllSecrets(ctx context.Context) error {
+	return c.revokeSecrets(ctx, func(string) bool { return true })
+}
+
+func (c *Config) revokeSecrets(ctx context.Context, replaced func(key string) bool) error {
+	if c.vaultLeases == nil {
+		return nil
+	}
+	var errs []error
+	for id, keys := range c.vaultLeases.keys {
+		if !slices.ContainsFunc(keys, func(k string) bool { return !replaced(k) }) {
+			if err := c.vaultLeases.client.revoke(ctx, id); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			delete(c.vaultLeases.keys, id)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type vaultSecret struct {
+	data    map[string]any
+	leaseID string
+	lease   time.Duration
+}
+
+// vaultLeases are the leased secrets a config holds, by lease ID with the
+// keys read from each, and the client that can revoke them.
+type vaultLeases struct {
+	client *vaultClient
+	keys   map[string][]string
+}
+
+// vaultClient is a logged-in connection to Vault.
+type vaultClient struct {
+	cfg   VaultConfig
+	http  *http.Client
+	token string
+}
+
+// resolveVaultSecrets replaces vault: references with the secrets they
+// point to. Each path is read once, so a username and password from the
+// same dynamic secret belong to the same lease.
+func (c *Config) resolveVaultSecrets() error {
+	var refs []secretFile
+	for _, s := range c.secretFiles() {
+		if strings.HasPrefix(*s.value, vaultPrefix) {
+			refs = append(refs, s)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	v := c.Vault
+	if v.Address == "" {
+		v.Address = os.Getenv("VAULT_ADDR")
+	}
+	if v.Address == "" {
+		return fmt.Errorf("%s is a vault: reference but vault.address (or VAULT_ADDR) is not set", refs[0].key)
+	}
+	if v.Timeout <= 0 {
+		v.Timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+
+	client, err := v.newClient()
+	if err != nil {
+		return err
+	}
+	if client.token, err = client.login(ctx); err != nil {
+		return fmt.Errorf("vault auth: %w", err)
+	}
+	leases := &vaultLeases{client: client, keys: make(map[string][]string)}
+	c.vaultLeases = leases
+
+	read := make(map[string]*vaultSecret)
+	for _, s := range refs {
+		path, field, ok := strings.Cut(strings.TrimPrefix(*s.value, vaultPrefix), "#")
+		if !ok || path == "" || field == "" {
+			return fmt.Errorf("%s: vault reference must look like vault:<path>#<field>", s.key)
+		}
+		secret, ok := read[path]
+		if !ok {
+			secret, err = client.read(ctx, path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", s.key, err)
+			}
+			read[path] = secret
+			if secret.lease > 0 && (c.secretsTTL == 0 || secret.lease < c.secretsTTL) {
+				c.secretsTTL = secret.lease
+			}
+		}
+		if secret.leaseID != "" {
+			leases.keys[secret.leaseID] = append(leases.keys[secret.leaseID], s.key)
+		}
+		value, ok := secret.data[field].(string)
+		if !ok {
+			return fmt.Errorf("%s: vault secret %s has no string field %q", s.key, path, field)
+		}
+		*s.value = value
+	}
+	return nil
+}
+
+// newClient builds an HTTP client of its own for Vault, bounded by the
+// configured timeout and trusting CAFile when set.
+func (v VaultConfig) newClient() (*vaultClient, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if v.CAFile != "" {
+		pem, err := os.ReadFile(v.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vault ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", v.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &vaultClient{
+		cfg:  v,
+		http: &http.Client{Transport: transport, Timeout: v.Timeout},
+	}, nil
+}
+
+func (c *vaultClient) login(ctx context.Context) (string, error) {
+	v := c.cfg
+	switch {
+	case v.KubernetesRole != "":
+		return c.kubernetesLogin(ctx)
+	case v.Token != "":
+		return v.Token, nil
+	case v.TokenFile != "":
+		data, err := os.ReadFile(v.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case os.Getenv("VAULT_TOKEN") != "":
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+	return "", fmt.Errorf("no vault token: set vault.token, vault.token_file, vault.kubernetes_role or VAULT_TOKEN")
+}
+
+func (c *vaultClient) kubernetesLogin(ctx context.Context) (string, error) {
+	v := c.cfg
+	jwt, err := os.ReadFile(defaultServiceAccountToken)
+	if err != nil {
+		return "", fmt.Errorf("read service account token: %w", err)
+	}
+	mount := v.KubernetesMount
+	if mount == "" {
+		mount = "kubernetes"
+	}
+	body, err := json.Marshal(map[string]string{"role": v.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/"+mount+"/login", body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("kubernetes login returned no token")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+func (c *vaultClient) read(ctx context.Context, path string) (*vaultSecret, error) {
+	var resp struct {
+		Data          map[string]any `json:"data"`
+		LeaseID       string         `json:"lease_id"`
+		LeaseDuration int            `json:"lease_duration"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	// KV v2 nests the fields next to the version metadata.
+	if nested, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = nested
+	}
+	return &vaultSecret{
+		data:    data,
+		leaseID: resp.LeaseID,
+		lease:   time.Duration(resp.LeaseDuration) * time.Second,
+	}, nil
+}
+
+func (c *vaultClient) revoke(ctx context.Context, leaseID string) error {
+	body, err := json.Marshal(map[string]string{"lease_id": leaseID})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, "sys/leases/revoke", body, nil)
+}
+
+func (c *vaultClient) do(ctx context.Context, method, path string, body []byte, out any) error {
+	v := c.cfg
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.Address, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent && out == nil {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vault %s returned HTTP %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("vault %s: decode response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+// Package datadog audits custom metrics through the Datadog API: the
+// active metrics, their tags and their indexed volumes, shaped like the
+// services, metrics and labels of a Prometheus scan.
+package datadog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// indexReuse is how long a loaded index answers calls that would otherwise
+// reload it, like the Prometheus scrape index.
+const indexReuse = 30 * time.Second
+
+// maxRateLimitWait caps how long a rate-limited request waits for the
+// limit to reset before it is retried.
+const maxRateLimitWait = time.Minute
+
+type Config struct {
+	// Site is the Datadog site, e.g. datadoghq.eu, or a full API URL.
+	Site     string
+	APIKey   string
+	AppKey   string
+	Timeout  time.Duration
+	Lookback time.Duration
+	// TagFilter is passed to the active metrics list, e.g. env:prod.
+	TagFilter      string
+	MetricPrefixes []string
+	// Concurrency bounds the per-metric requests while loading the index.
+	Concurrency int
+	// SkipLabels are tag keys left out of label stats, on top of the
+	// service labels.
+	SkipLabels []string
+}
+
+// Client reads the whole account into an index on service discovery and
+// answers the per-service calls of the scan from it. It makes up to three
+// requests per metric: tags, volumes and metadata.
+type Client struct {
+	http    *http.Client
+	baseURL string
+	cfg     Config
+	skip    map[string]bool
+
+	mu       sync.Mutex
+	index    *index
+	loadedAt time.Time
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Lookback <= 0 {
+		cfg.Lookback = time.Hour
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 5
+	}
+	baseURL := strings.TrimSuffix(cfg.Site, "/")
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://api." + baseURL
+	}
+	skip := make(map[string]bool, len(cfg.SkipLabels))
+	for _, name := range cfg.SkipLabels {
+		skip[name] = true
+	}
+	return &Client{
+		http:    &http.Client{Timeout: cfg.Timeout},
+		baseURL: baseURL,
+		cfg:     cfg,
+		skip:    skip,
+	}
+}
+
+// HealthCheck validates the API key.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	var body struct {
+		Valid bool `json:"valid"`
+	}
+	if err := c.get(ctx, "/api/v1/validate", nil, &body); err != nil {
+		return fmt.Errorf("datadog health check failed: %w", err)
+	}
+	if !body.Valid {
+		return fmt.Errorf("datadog health check failed: api key is not valid")
+	}
+	return nil
+}
+
+func (c *Client) DiscoverServices(ctx context.Context, serviceLabels []string) ([]prometheus.ServiceInfo, error) {
+	idx, err := c.current(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return idx.services(serviceLabels), nil
+}
+
+func (c *Client) GetMetricsForService(ctx context.Context, serviceLabels []string, serviceName string) ([]prometheus.MetricInfo, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.metrics(serviceLabels, serviceName), nil
+}
+
+func (c *Client) GetLabelsForMetric(ctx context.Context, serviceLabels []string, serviceName, metricName string, _, sampleLimit int) ([]prometheus.LabelInfo, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.labels(serviceLabels, metricName, c.skip, sampleLimit), nil
+}
+
+// GetMetadata maps Datadog metric types onto Prometheus ones: count and
+// rate are counters and distributions, whose percentiles Datadog computes,
+// summaries.
+func (c *Client) GetMetadata(ctx context.Context) (map[string]prometheus.MetricMetadata, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]prometheus.MetricMetadata, len(idx.byName))
+	for name, m := range idx.byName {
+		if m.metadata != (prometheus.MetricMetadata{}) {
+			metadata[name] = m.metadata
+		}
+	}
+	return metadata, nil
+}
+
+func (c *Client) current(ctx context.Context, refresh bool) (*index, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil && (!refresh || time.Since(c.loadedAt) < indexReuse) {
+		return c.index, nil
+	}
+
+	idx, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.index, c.loadedAt = idx, time.Now()
+	return idx, nil
+}
+
+// load lists the active metrics and reads the tags, volume and metadata of
+// each. Missing metadata only leaves the type unknown; a metric whose tags
+// or volume can't be read is logged and left out, so one deleted or
+// forbidden metric doesn't fail the whole discovery.
+func (c *Client) load(ctx context.Context) (*index, error) {
+	names, err := c.activeMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*metric, len(names))
+	sem := make(chan struct{}, c.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			m, err := c.loadMetric(ctx, name)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("skipping datadog metric", "metric", name, "error", err)
+				}
+				return
+			}
+			metrics[i] = m
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return newIndex(metrics), nil
+}
+
+func (c *Client) activeMetrics(ctx context.Context) ([]string, error) {
+	query := url.Values{"from": {strconv.FormatInt(time.Now().Add(-c.cfg.Lookback).Unix(), 10)}}
+	if c.cfg.TagFilter != "" {
+		query.Set("tag_filter", c.cfg.TagFilter)
+	}
+	var body struct {
+		Metrics []string `json:"metrics"`
+	}
+	if err := c.get(ctx, "/api/v1/metrics", query, &body); err != nil {
+		return nil, fmt.Errorf("failed to list active metrics: %w", err)
+	}
+	if len(c.cfg.MetricPrefixes) == 0 {
+		return body.Metrics, nil
+	}
+	var names []string
+	for _, name := range body.Metrics {
+		for _, prefix := range c.cfg.MetricPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+func (c *Client) loadMetric(ctx context.Context, name string) (*metric, error) {
+	path := "/api/v2/metrics/" + url.PathEscape(name)
+
+	var tags struct {
+		Data struct {
+			Attributes struct {
+				Tags []string `json:"tags"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	window := url.Values{"window[seconds]": {strconv.Itoa(int(c.cfg.Lookback.Seconds()))}}
+	if err := c.get(ctx, path+"/all-tags", window, &tags); err != nil {
+		return nil, fmt.Errorf("failed to get tags of %s: %w", name, err)
+	}
+
+	// Distribution metrics answer with distinct_volume instead.
+	var volumes struct {
+		Data struct {
+			Attributes struct {
+				IndexedVolume  int `json:"indexed_volume"`
+				DistinctVolume int `json:"distinct_volume"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := c.get(ctx, path+"/volumes", nil, &volumes); err != nil {
+		return nil, fmt.Errorf("failed to get volumes of %s: %w", name, err)
+	}
+
+	m := &metric{
+		name:   name,
+		volume: max(volumes.Data.Attributes.IndexedVolume, volumes.Data.Attributes.DistinctVolume),
+		tags:   parseTags(tags.Data.Attributes.Tags),
+	}
+
+	var metadata struct {
+		Type        string `json:"type"`
+		Description string `json:"description"`
+		Unit        string `json:"unit"`
+	}
+	if err := c.get(ctx, "/api/v1/metrics/"+url.PathEscape(name), nil, &metadata); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	} else {
+		m.metadata = prometheus.MetricMetadata{
+			Type: metricType(metadata.Type),
+			Help: metadata.Description,
+			Unit: metadata.Unit,
+		}
+	}
+	return m, nil
+}
+
+func metricType(datadogType string) string {
+	switch datadogType {
+	case "count", "rate":
+		return "counter"
+	case "distribution":
+		return "summary"
+	default:
+		return datadogType
+	}
+}
+
+// errRateLimited is returned when the rate limit didn't reset in time.
+var errRateLimited = errors.New("rate limited")
+
+// get decodes a JSON response into out. Rate-limited requests are retried
+// once the limit resets, per X-RateLimit-Reset, up to maxRateLimitWait.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("DD-API-KEY", c.cfg.APIKey)
+		req.Header.Set("DD-APPLICATION-KEY", c.cfg.AppKey)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			reset, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+			wait := time.Duration(max(reset, 1)) * time.Second
+			if wait > maxRateLimitWait {
+				return errRateLimited
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("datadog returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package datadog
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+type metric struct {
+	name string
+	// volume is the metric's indexed custom metrics, what Datadog bills.
+	volume int
+	// tags are the values seen per tag key, sorted.
+	tags     map[string][]string
+	metadata prometheus.MetricMetadata
+}
+
+// parseTags groups key:value tags by key. Tags without a value count as
+// one empty value of their key.
+func parseTags(tags []string) map[string][]string {
+	grouped := make(map[string][]string)
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		grouped[key] = append(grouped[key], value)
+	}
+	for key, values := range grouped {
+		slices.Sort(values)
+		grouped[key] = slices.Compact(values)
+	}
+	return grouped
+}
+
+// share is the part of a metric's volume attributed to one service.
+type share struct {
+	metric *metric
+	volume int
+}
+
+// index is one load of the account's metrics.
+type index struct {
+	byName map[string]*metric
+
+	mu        sync.Mutex
+	byService map[string]map[string][]share // label set -> service -> metrics
+	labelsOf  map[string]map[string]map[string]string
+}
+
+// newIndex skips nil entries, which stand for metrics that failed to load.
+func newIndex(metrics []*metric) *index {
+	byName := make(map[string]*metric, len(metrics))
+	for _, m := range metrics {
+		if m != nil {
+			byName[m.name] = m
+		}
+	}
+	return &index{
+		byName:    byName,
+		byService: make(map[string]map[string][]share),
+		labelsOf:  make(map[string]map[string]map[string]string),
+	}
+}
+
+// grouped returns the metrics of every service for one set of discovery
+// labels, building it on first use. Tags are per metric, not per series,
+// so a metric tagged with several values of the labels belongs to every
+// combination of them; metrics missing any of the labels belong to none.
+// Datadog doesn't say how the volume splits between the combinations, so
+// it is spread evenly and the services still add up to the metric's volume.
+func (idx *index) grouped(serviceLabels []string) (map[string][]share, map[string]map[string]string) {
+	key := strings.Join(serviceLabels, ",")
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if g, ok := idx.byService[key]; ok {
+		return g, idx.labelsOf[key]
+	}
+
+	g := make(map[string][]share)
+	labelsOf := make(map[string]map[string]string)
+	for _, m := range idx.byName {
+		combos := combinations(m.tags, serviceLabels)
+		for i, values := range combos {
+			name := strings.Join(values, prometheus.ServiceKeySeparator)
+			g[name] = append(g[name], share{metric: m, volume: splitVolume(m.volume, len(combos), i)})
+			if _, ok := labelsOf[name]; !ok {
+				labels := make(map[string]string, len(serviceLabels))
+				for i, label := range serviceLabels {
+					labels[label] = values[i]
+				}
+				labelsOf[name] = labels
+			}
+		}
+	}
+	idx.byService[key] = g
+	idx.labelsOf[key] = labelsOf
+	return g, labelsOf
+}
+
+// splitVolume returns the i-th of n near-equal parts of volume; the first
+// volume%n parts get one more so the parts sum to volume.
+func splitVolume(volume, n, i int) int {
+	part := volume / n
+	if i < volume%n {
+		part++
+	}
+	return part
+}
+
+// combinations lists every combination of the metric's values of the
+// labels, in label order.
+func combinations(tags map[string][]string, labels []string) [][]string {
+	combos := [][]string{nil}
+	for _, label := range labels {
+		values := slices.DeleteFunc(slices.Clone(tags[label]), func(v string) bool { return v == "" })
+		if len(values) == 0 {
+			return nil
+		}
+		var next [][]string
+		for _, combo := range combos {
+			for _, v := range values {
+				next = append(next, append(slices.Clone(combo), v))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+func (idx *index) services(serviceLabels []string) []prometheus.ServiceInfo {
+	grouped, labelsOf := idx.grouped(serviceLabels)
+	services := make([]prometheus.ServiceInfo, 0, len(grouped))
+	for name, metrics := range grouped {
+		count := 0
+		for _, m := range metrics {
+			count += m.volume
+		}
+		services = append(services, prometheus.ServiceInfo{
+			Name:        name,
+			Labels:      labelsOf[name],
+			SeriesCount: count,
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].SeriesCount > services[j].SeriesCount
+	})
+	return services
+}
+
+func (idx *index) metrics(serviceLabels []string, serviceName string) []prometheus.MetricInfo {
+	grouped, _ := idx.grouped(serviceLabels)
+	var metrics []prometheus.MetricInfo
+	for _, m := range grouped[serviceName] {
+		metrics = append(metrics, prometheus.MetricInfo{Name: m.metric.name, SeriesCount: m.volume})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].SeriesCount > metrics[j].SeriesCount
+	})
+	return metrics
+}
+
+// labels reports the metric's tag keys other than the service labels. The
+// values are those of the whole metric, whichever service reported them.
+func (idx *index) labels(serviceLabels []string, metricName string, skip map[string]bool, sampleLimit int) []prometheus.LabelInfo {
+	m := idx.byName[metricName]
+	if m == nil {
+		return nil
+	}
+	var labels []prometheus.LabelInfo
+	for key, values := range m.tags {
+		if skip[key] || slices.Contains(serviceLabels, key) {
+			continue
+		}
+		labels = append(labels, prometheus.LabelInfo{
+			Name:         key,
+			UniqueValues: len(values),
+			SampleValues: values[:min(len(values), sampleLimit)],
+		})
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].UniqueValues > labels[j].UniqueValues
+	})
+	return labels
+}
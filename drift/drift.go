@@ -0,0 +1,104 @@
+// Package drift compares every scan with the baseline snapshot and records
+// the services that regressed.
+package drift
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type Detector struct {
+	snapshots   storage.SnapshotsRepo
+	services    storage.ServicesRepo
+	regressions storage.RegressionsRepo
+
+	mu  sync.RWMutex
+	cfg config.BaselineConfig
+}
+
+func NewDetector(snapshots storage.SnapshotsRepo, services storage.ServicesRepo, regressions storage.RegressionsRepo, cfg config.BaselineConfig) *Detector {
+	return &Detector{
+		snapshots:   snapshots,
+		services:    services,
+		regressions: regressions,
+		cfg:         cfg,
+	}
+}
+
+// SetConfig replaces the thresholds, e.g. after a config reload.
+func (d *Detector) SetConfig(cfg config.BaselineConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cfg = cfg
+}
+
+func (d *Detector) config() config.BaselineConfig {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.cfg
+}
+
+// AfterScan is a scheduler post-scan hook. It does nothing until a baseline
+// is set.
+func (d *Detector) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	baseline, err := d.snapshots.GetBaseline(ctx)
+	if err != nil {
+		return fmt.Errorf("get baseline: %w", err)
+	}
+	if baseline == nil || baseline.ID == result.SnapshotID {
+		return nil
+	}
+
+	found, err := d.Detect(ctx, baseline.ID, result.SnapshotID)
+	if err != nil {
+		return err
+	}
+	if err := d.regressions.Replace(ctx, result.SnapshotID, found); err != nil {
+		return fmt.Errorf("store regressions: %w", err)
+	}
+	if len(found) > 0 {
+		slog.Warn("services regressed since baseline", "snapshot_id", result.SnapshotID, "baseline_id", baseline.ID, "count", len(found))
+	}
+	return nil
+}
+
+// Detect compares a snapshot with the baseline and returns the services
+// above the thresholds, biggest growth first.
+func (d *Detector) Detect(ctx context.Context, baselineID, snapshotID int64) ([]models.Regression, error) {
+	diffs, err := d.services.Diff(ctx, baselineID, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("diff services: %w", err)
+	}
+
+	cfg := d.config()
+	var found []models.Regression
+	for _, s := range diffs {
+		if s.SeriesDelta < cfg.MinDelta {
+			continue
+		}
+		r := models.Regression{
+			SnapshotID:     snapshotID,
+			BaselineID:     baselineID,
+			ServiceName:    s.ServiceName,
+			BaselineSeries: s.PreviousSeries,
+			CurrentSeries:  s.CurrentSeries,
+			SeriesDelta:    s.SeriesDelta,
+		}
+		if s.PreviousSeries > 0 {
+			pct := float64(s.SeriesDelta) * 100 / float64(s.PreviousSeries)
+			if pct < cfg.ThresholdPct {
+				continue
+			}
+			r.SeriesDeltaPct = &pct
+		}
+		found = append(found, r)
+	}
+	return found, nil
+}
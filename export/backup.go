@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/storage"
+)
+
+var ErrBackupRunning = errors.New("backup already running")
+
+type BackupResult struct {
+	Location  string    `json:"location"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Duration  string    `json:"duration"`
+}
+
+// BackupJob copies the live database to the configured destination.
+type BackupJob struct {
+	db   *storage.DB
+	sink sink
+	mu   sync.Mutex
+}
+
+func NewBackupJob(ctx context.Context, cfg config.BackupConfig, db *storage.DB) (*BackupJob, error) {
+	s, err := newSink(ctx, cfg.Destination, cfg.S3)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupJob{db: db, sink: s}, nil
+}
+
+// Run takes one backup. The copy is staged in a temp file first so a
+// failed upload never leaves a truncated backup at the destination.
+func (j *BackupJob) Run(ctx context.Context) (*BackupResult, error) {
+	if !j.mu.TryLock() {
+		return nil, ErrBackupRunning
+	}
+	defer j.mu.Unlock()
+
+	start := time.Now()
+
+	tmp, err := os.CreateTemp("", "whodidthis-backup-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := j.db.Backup(ctx, tmpPath); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("open backup: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat backup: %w", err)
+	}
+
+	name := fmt.Sprintf("whodidthis-%s.db", start.UTC().Format("20060102T150405Z"))
+	if err := j.sink.put(ctx, name, f); err != nil {
+		return nil, err
+	}
+
+	return &BackupResult{
+		Location:  j.sink.location(name),
+		SizeBytes: info.Size(),
+		CreatedAt: start,
+		Duration:  time.Since(start).String(),
+	}, nil
+}
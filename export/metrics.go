@@ -0,0 +1,154 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/limits"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// MetricsExporter serves the latest finished snapshot as Prometheus gauges.
+// The families are built once per snapshot and rebuilt after the next scan
+// finishes, since a service rescan updates a snapshot in place.
+type MetricsExporter struct {
+	cfg       config.MetricsExportConfig
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	metrics   storage.MetricsRepo
+	limits    *limits.Checker
+
+	mu         sync.Mutex
+	snapshotID int64
+	families   []*dto.MetricFamily
+}
+
+func NewMetricsExporter(cfg config.MetricsExportConfig, snapshots storage.SnapshotsRepo, services storage.ServicesRepo, metrics storage.MetricsRepo, checker *limits.Checker) *MetricsExporter {
+	return &MetricsExporter{
+		cfg:       cfg,
+		snapshots: snapshots,
+		services:  services,
+		metrics:   metrics,
+		limits:    checker,
+	}
+}
+
+// ServeHTTP writes the families in the format the scraper asks for. Before
+// the first snapshot the body is empty.
+func (e *MetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families, err := e.collect(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to export metrics", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(w, format)
+	for _, f := range families {
+		if err := enc.Encode(f); err != nil {
+			slog.ErrorContext(r.Context(), "failed to encode metrics", "family", f.GetName(), "error", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.ErrorContext(r.Context(), "failed to encode metrics", "error", err)
+		}
+	}
+}
+
+// Publish drops the cached families when a scan finishes. It matches
+// models.EventPublisher.
+func (e *MetricsExporter) Publish(event models.Event) {
+	if event.Type != models.EventScanFinished {
+		return
+	}
+	e.mu.Lock()
+	e.snapshotID = 0
+	e.families = nil
+	e.mu.Unlock()
+}
+
+func (e *MetricsExporter) collect(ctx context.Context) ([]*dto.MetricFamily, error) {
+	latest, err := e.snapshots.GetLatest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get latest snapshot: %w", err)
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if latest.ID == e.snapshotID {
+		return e.families, nil
+	}
+
+	snapshot := gaugeFamily("whodidthis_snapshot_series", "Active series in the latest snapshot.")
+	addGauge(snapshot, float64(latest.TotalSeries))
+	timestamp := gaugeFamily("whodidthis_snapshot_timestamp_seconds", "When the latest snapshot was collected.")
+	addGauge(timestamp, float64(latest.CollectedAt.Unix()))
+
+	services, err := e.services.List(ctx, latest.ID, storage.ServiceListOptions{Sort: "name", Order: "asc"})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	serviceSeries := gaugeFamily("whodidthis_service_series", "Active series per service in the latest snapshot.")
+	serviceMetrics := gaugeFamily("whodidthis_service_metrics", "Metric names per service in the latest snapshot.")
+	for _, s := range services {
+		addGauge(serviceSeries, float64(s.TotalSeries), "service", s.ServiceName, "team", s.Team)
+		addGauge(serviceMetrics, float64(s.MetricCount), "service", s.ServiceName, "team", s.Team)
+	}
+
+	top, err := e.metrics.Top(ctx, latest.ID, 0, "series", e.cfg.TopMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("list top metrics: %w", err)
+	}
+	metricSeries := gaugeFamily("whodidthis_metric_series", fmt.Sprintf("Active series of the %d largest service metrics in the latest snapshot.", e.cfg.TopMetrics))
+	for _, m := range top {
+		addGauge(metricSeries, float64(m.SeriesCount), "service", m.ServiceName, "metric", m.MetricName)
+	}
+
+	usage, err := e.limits.Usage(ctx, latest.ID)
+	if err != nil {
+		return nil, fmt.Errorf("limit usage: %w", err)
+	}
+	limit := gaugeFamily("whodidthis_metric_series_limit", "Configured series limit of service metrics that have one.")
+	utilization := gaugeFamily("whodidthis_metric_limit_utilization", "Series of a limited service metric as a ratio of its limit; above 1 is a violation.")
+	for _, u := range usage {
+		addGauge(limit, float64(u.MaxSeries), "service", u.Service, "metric", u.Metric)
+		addGauge(utilization, float64(u.Series)/float64(u.MaxSeries), "service", u.Service, "metric", u.Metric)
+	}
+
+	e.snapshotID = latest.ID
+	e.families = []*dto.MetricFamily{snapshot, timestamp, serviceSeries, serviceMetrics, metricSeries, limit, utilization}
+	return e.families, nil
+}
+
+func gaugeFamily(name, help string) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String(name),
+		Help: proto.String(help),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+}
+
+// addGauge appends a sample; labels are name, value pairs.
+func addGauge(f *dto.MetricFamily, value float64, labels ...string) {
+	m := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(value)}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(labels[i]), Value: proto.String(labels[i+1])})
+	}
+	f.Metric = append(f.Metric, m)
+}
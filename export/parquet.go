@@ -0,0 +1,191 @@
+// Package export writes snapshots out of SQLite for analysis elsewhere.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type serviceRow struct {
+	SnapshotID  int64     `parquet:"snapshot_id"`
+	CollectedAt time.Time `parquet:"collected_at,timestamp(millisecond)"`
+	Service     string    `parquet:"service"`
+	Environment string    `parquet:"environment"`
+	Team        string    `parquet:"team"`
+	TotalSeries int64     `parquet:"total_series"`
+	MetricCount int64     `parquet:"metric_count"`
+}
+
+type metricRow struct {
+	SnapshotID      int64     `parquet:"snapshot_id"`
+	CollectedAt     time.Time `parquet:"collected_at,timestamp(millisecond)"`
+	Service         string    `parquet:"service"`
+	Metric          string    `parquet:"metric"`
+	Type            string    `parquet:"type"`
+	SeriesCount     int64     `parquet:"series_count"`
+	LabelCount      int64     `parquet:"label_count"`
+	Unit            string    `parquet:"unit"`
+	Help            string    `parquet:"help"`
+	NativeHistogram bool      `parquet:"native_histogram"`
+	ExemplarCount   int64     `parquet:"exemplar_count"`
+}
+
+type labelRow struct {
+	SnapshotID   int64     `parquet:"snapshot_id"`
+	CollectedAt  time.Time `parquet:"collected_at,timestamp(millisecond)"`
+	Service      string    `parquet:"service"`
+	Metric       string    `parquet:"metric"`
+	Label        string    `parquet:"label"`
+	UniqueValues int64     `parquet:"unique_values"`
+	Truncated    bool      `parquet:"truncated"`
+	SampleValues []string  `parquet:"sample_values,list"`
+}
+
+// ParquetExporter writes services, metrics and labels tables per snapshot
+// under snapshot_id=<id>/, so warehouses can read the destination as a
+// partitioned dataset.
+type ParquetExporter struct {
+	sink      sink
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	metrics   storage.MetricsRepo
+	labels    storage.LabelsRepo
+	logger    *slog.Logger
+}
+
+func NewParquetExporter(
+	ctx context.Context,
+	cfg config.ParquetExportConfig,
+	snapshots storage.SnapshotsRepo,
+	services storage.ServicesRepo,
+	metrics storage.MetricsRepo,
+	labels storage.LabelsRepo,
+) (*ParquetExporter, error) {
+	s, err := newSink(ctx, cfg.Destination, cfg.S3)
+	if err != nil {
+		return nil, err
+	}
+	return &ParquetExporter{
+		sink:      s,
+		snapshots: snapshots,
+		services:  services,
+		metrics:   metrics,
+		labels:    labels,
+		logger:    slog.Default(),
+	}, nil
+}
+
+// AfterScan exports the snapshot a scan produced. It matches
+// scheduler.PostScanHook.Run.
+func (e *ParquetExporter) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	return e.Export(ctx, result.SnapshotID)
+}
+
+func (e *ParquetExporter) Export(ctx context.Context, snapshotID int64) error {
+	snapshot, err := e.snapshots.GetByID(ctx, snapshotID)
+	if err != nil {
+		return fmt.Errorf("get snapshot: %w", err)
+	}
+	if snapshot == nil {
+		return fmt.Errorf("snapshot %d not found", snapshotID)
+	}
+
+	services, err := e.services.List(ctx, snapshotID, storage.ServiceListOptions{Sort: "name", Order: "asc"})
+	if err != nil {
+		return fmt.Errorf("list services: %w", err)
+	}
+
+	var serviceRows []serviceRow
+	var metricRows []metricRow
+	var labelRows []labelRow
+
+	for _, svc := range services {
+		serviceRows = append(serviceRows, serviceRow{
+			SnapshotID:  snapshotID,
+			CollectedAt: snapshot.CollectedAt,
+			Service:     svc.ServiceName,
+			Environment: svc.Environment,
+			Team:        svc.Team,
+			TotalSeries: int64(svc.TotalSeries),
+			MetricCount: int64(svc.MetricCount),
+		})
+
+		metrics, err := e.metrics.List(ctx, svc.ID, storage.MetricListOptions{Sort: "name", Order: "asc"})
+		if err != nil {
+			return fmt.Errorf("list metrics for %s: %w", svc.ServiceName, err)
+		}
+
+		for _, m := range metrics {
+			metricRows = append(metricRows, toMetricRow(snapshot, svc.ServiceName, m))
+
+			labels, err := e.labels.List(ctx, m.ID)
+			if err != nil {
+				return fmt.Errorf("list labels for %s/%s: %w", svc.ServiceName, m.MetricName, err)
+			}
+			for _, l := range labels {
+				labelRows = append(labelRows, labelRow{
+					SnapshotID:   snapshotID,
+					CollectedAt:  snapshot.CollectedAt,
+					Service:      svc.ServiceName,
+					Metric:       m.MetricName,
+					Label:        l.LabelName,
+					UniqueValues: int64(l.UniqueValuesCount),
+					Truncated:    l.Truncated,
+					SampleValues: l.SampleValues,
+				})
+			}
+		}
+	}
+
+	dir := fmt.Sprintf("snapshot_id=%d/", snapshotID)
+	if err := writeTable(ctx, e.sink, dir+"services.parquet", serviceRows); err != nil {
+		return err
+	}
+	if err := writeTable(ctx, e.sink, dir+"metrics.parquet", metricRows); err != nil {
+		return err
+	}
+	if err := writeTable(ctx, e.sink, dir+"labels.parquet", labelRows); err != nil {
+		return err
+	}
+
+	e.logger.Info("parquet export complete",
+		"snapshot_id", snapshotID,
+		"services", len(serviceRows),
+		"metrics", len(metricRows),
+		"labels", len(labelRows))
+	return nil
+}
+
+func toMetricRow(snapshot *models.Snapshot, service string, m models.MetricSnapshot) metricRow {
+	return metricRow{
+		SnapshotID:      snapshot.ID,
+		CollectedAt:     snapshot.CollectedAt,
+		Service:         service,
+		Metric:          m.MetricName,
+		Type:            m.MetricType,
+		SeriesCount:     int64(m.SeriesCount),
+		LabelCount:      int64(m.LabelCount),
+		Unit:            m.Unit,
+		Help:            m.Help,
+		NativeHistogram: m.NativeHistogram,
+		ExemplarCount:   int64(m.ExemplarCount),
+	}
+}
+
+func writeTable[T any](ctx context.Context, s sink, name string, rows []T) error {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows, parquet.Compression(&parquet.Zstd)); err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+	return s.put(ctx, name, bytes.NewReader(buf.Bytes()))
+}
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// remoteWriteAttempts is how often a batch is sent before giving up on a
+// retryable error.
+const remoteWriteAttempts = 3
+
+// RemoteWriter pushes each snapshot's totals to a Prometheus remote write
+// endpoint, one sample per series at the collection time, so trends outlive
+// the local retention. The series are named like the /metrics gauges:
+// whodidthis_snapshot_series, whodidthis_service_series{service,team} and
+// whodidthis_team_series{team}.
+type RemoteWriter struct {
+	cfg       config.RemoteWriteConfig
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	client    *http.Client
+}
+
+func NewRemoteWriter(cfg config.RemoteWriteConfig, snapshots storage.SnapshotsRepo, services storage.ServicesRepo) *RemoteWriter {
+	return &RemoteWriter{
+		cfg:       cfg,
+		snapshots: snapshots,
+		services:  services,
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// remoteSeries is one sample with its labels, __name__ included.
+type remoteSeries struct {
+	labels [][2]string
+	value  float64
+}
+
+// AfterScan is a scheduler post-scan hook. Samples are stamped with the
+// snapshot's collection time, except after a service rescan: the snapshot's
+// samples were sent then already, and the receiver rejects new values at
+// the same timestamp, so the rescanned values go out at the current time.
+func (w *RemoteWriter) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	snap, err := w.snapshots.GetByID(ctx, result.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("get snapshot: %w", err)
+	}
+	if snap == nil {
+		return nil
+	}
+	teams, err := w.services.ListTeams(ctx, snap.ID)
+	if err != nil {
+		return fmt.Errorf("list teams: %w", err)
+	}
+	services, err := w.services.List(ctx, snap.ID, storage.ServiceListOptions{Sort: "name", Order: "asc"})
+	if err != nil {
+		return fmt.Errorf("list services: %w", err)
+	}
+
+	series := []remoteSeries{{
+		labels: [][2]string{{"__name__", "whodidthis_snapshot_series"}},
+		value:  float64(snap.TotalSeries),
+	}}
+	for _, t := range teams {
+		series = append(series, remoteSeries{
+			labels: labelPairs("__name__", "whodidthis_team_series", "team", t.Team),
+			value:  float64(t.TotalSeries),
+		})
+	}
+	for _, s := range services {
+		series = append(series, remoteSeries{
+			labels: labelPairs("__name__", "whodidthis_service_series", "service", s.ServiceName, "team", s.Team),
+			value:  float64(s.TotalSeries),
+		})
+	}
+
+	at := snap.CollectedAt
+	if result.Service != "" {
+		at = time.Now()
+	}
+	body := snappy.Encode(nil, encodeWriteRequest(series, at))
+	for attempt := 1; ; attempt++ {
+		retry, err := w.send(ctx, body)
+		if err == nil || !retry || attempt == remoteWriteAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+// send posts one batch; it reports whether a failure is worth retrying,
+// which per the remote write spec is a network error, 429 or 5xx.
+func (w *RemoteWriter) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", w.cfg.TenantID)
+	}
+	if w.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.cfg.BearerToken)
+	} else if w.cfg.Username != "" {
+		req.SetBasicAuth(w.cfg.Username, w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("remote write: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("remote write: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
+
+// labelPairs builds sorted labels from name, value pairs, leaving out
+// empty values as Prometheus does.
+func labelPairs(kv ...string) [][2]string {
+	var labels [][2]string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			labels = append(labels, [2]string{kv[i], kv[i+1]})
+		}
+	}
+	slices.SortFunc(labels, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+	return labels
+}
+
+// encodeWriteRequest marshals a prometheus.WriteRequest by hand, which
+// saves depending on the Prometheus module for three small messages:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries, at time.Time) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(at.UnixMilli()))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/illenko/whodidthis/config"
+)
+
+// sink stores exported files under a destination. The body is seekable so
+// S3 uploads can be signed and retried.
+type sink interface {
+	put(ctx context.Context, name string, body io.ReadSeeker) error
+	location(name string) string
+}
+
+// newSink picks a sink for a local directory or an s3://bucket/prefix URL.
+func newSink(ctx context.Context, destination string, s3cfg config.S3Config) (sink, error) {
+	rest, ok := strings.CutPrefix(destination, "s3://")
+	if !ok {
+		return dirSink{dir: destination}, nil
+	}
+
+	bucket, prefix, _ := strings.Cut(rest, "/")
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if s3cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(s3cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if s3cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s3cfg.Endpoint)
+		}
+		o.UsePathStyle = s3cfg.ForcePathStyle
+	})
+
+	return s3Sink{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+type dirSink struct {
+	dir string
+}
+
+// put writes via a temp file so readers never see a partial file.
+func (d dirSink) put(_ context.Context, name string, body io.ReadSeeker) error {
+	target := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("create export dir: %w", err)
+	}
+
+	tmp := target + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("rename %s: %w", name, err)
+	}
+	return nil
+}
+
+func (d dirSink) location(name string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(name))
+}
+
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s s3Sink) put(ctx context.Context, name string, body io.ReadSeeker) error {
+	key := path.Join(s.prefix, name)
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("upload s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return nil
+}
+
+func (s s3Sink) location(name string) string {
+	return "s3://" + s.bucket + "/" + path.Join(s.prefix, name)
+}
@@ -0,0 +1,131 @@
+// Package findings resolves tracked findings once a scan shows their
+// cardinality fixed.
+package findings
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type Resolver struct {
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	metrics   storage.MetricsRepo
+	labels    storage.LabelsRepo
+	findings  storage.FindingsRepo
+
+	mu        sync.RWMutex
+	detection config.DetectionConfig
+}
+
+func NewResolver(snapshots storage.SnapshotsRepo, services storage.ServicesRepo, metrics storage.MetricsRepo, labels storage.LabelsRepo, findings storage.FindingsRepo, detection config.DetectionConfig) *Resolver {
+	return &Resolver{
+		snapshots: snapshots,
+		services:  services,
+		metrics:   metrics,
+		labels:    labels,
+		findings:  findings,
+		detection: detection,
+	}
+}
+
+// SetDetection replaces the detection settings, e.g. after a config
+// reload.
+func (r *Resolver) SetDetection(detection config.DetectionConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detection = detection
+}
+
+func (r *Resolver) minUniqueValues() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.detection.MinUniqueValues
+}
+
+// AfterScan is a scheduler post-scan hook that resolves the unresolved
+// findings the new snapshot shows fixed.
+func (r *Resolver) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	snap, err := r.snapshots.GetByID(ctx, result.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("get snapshot: %w", err)
+	}
+	if snap == nil {
+		return nil
+	}
+
+	// Snoozed and ignored findings still get resolved when fixed.
+	open, err := r.findings.ListTracked(ctx, storage.TrackedFindingListOptions{IncludeSuppressed: true})
+	if err != nil {
+		return fmt.Errorf("list findings: %w", err)
+	}
+	// A service that failed to scan says nothing about its findings.
+	serviceErrors, err := r.snapshots.ListServiceErrors(ctx, snap.ID)
+	if err != nil {
+		return fmt.Errorf("list service errors: %w", err)
+	}
+	failed := make(map[string]bool, len(serviceErrors))
+	for _, e := range serviceErrors {
+		failed[e.Service] = true
+	}
+
+	var resolved []int64
+	for _, f := range open {
+		// A finding reported against this snapshot is current by definition.
+		if f.LastSnapshotID >= snap.ID || failed[f.ServiceName] {
+			continue
+		}
+		ok, err := r.fixed(ctx, snap.ID, f)
+		if err != nil {
+			return err
+		}
+		if ok {
+			resolved = append(resolved, f.ID)
+		}
+	}
+	if err := r.findings.Resolve(ctx, resolved, snap.ID, snap.CollectedAt); err != nil {
+		return fmt.Errorf("resolve findings: %w", err)
+	}
+	if len(resolved) > 0 {
+		slog.Info("findings resolved", "snapshot_id", snap.ID, "count", len(resolved))
+	}
+	return nil
+}
+
+// fixed reports whether a snapshot shows a finding fixed: the metric is
+// gone, or its label is gone or down to fewer values than detection
+// looks at. Findings without a label are fixed once the metric is back to
+// its size before the issue; ones about a new metric only by removing it.
+func (r *Resolver) fixed(ctx context.Context, snapshotID int64, f models.TrackedFinding) (bool, error) {
+	service, err := r.services.GetByName(ctx, snapshotID, f.ServiceName)
+	if err != nil {
+		return false, fmt.Errorf("get service: %w", err)
+	}
+	// Discovery still lists a missing service, which may just be down.
+	if service == nil || service.Missing {
+		return service == nil, nil
+	}
+	metric, err := r.metrics.GetByName(ctx, service.ID, f.MetricName)
+	if err != nil {
+		return false, fmt.Errorf("get metric: %w", err)
+	}
+	if metric == nil {
+		return true, nil
+	}
+
+	if f.LabelName == "" {
+		return f.BaselineSeries != nil && metric.SeriesCount <= *f.BaselineSeries, nil
+	}
+	label, err := r.labels.GetByName(ctx, metric.ID, f.LabelName)
+	if err != nil {
+		return false, fmt.Errorf("get label: %w", err)
+	}
+	return label == nil || label.UniqueValuesCount < r.minUniqueValues(), nil
+}
@@ -0,0 +1,227 @@
+// Package grafana writes scan and finding events as Grafana annotations,
+// so cardinality spikes line up with the services' own dashboards.
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// Annotator posts an annotation for every finished scan, every service
+// whose series grew past the spike thresholds since the previous scan and
+// every finding an analysis opens. Annotations are tagged "service:<name>",
+// and spikes "team:<name>" too, so dashboards can pick their own.
+type Annotator struct {
+	cfg       config.GrafanaConfig
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	findings  storage.FindingsRepo
+	client    *http.Client
+
+	mu    sync.RWMutex
+	spike config.BaselineConfig
+}
+
+// NewAnnotator takes the spike thresholds from the baseline settings: a
+// service spikes when it grew by both ThresholdPct and MinDelta.
+func NewAnnotator(cfg config.GrafanaConfig, spike config.BaselineConfig, snapshots storage.SnapshotsRepo, services storage.ServicesRepo, findings storage.FindingsRepo) *Annotator {
+	return &Annotator{
+		cfg:       cfg,
+		spike:     spike,
+		snapshots: snapshots,
+		services:  services,
+		findings:  findings,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	Time         int64    `json:"time"` // unix milliseconds
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// AfterScan is a scheduler post-scan hook. Annotations are placed at the
+// scan's collection time. A service rescan only annotates that service, at
+// the time of the rescan.
+func (a *Annotator) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	if result.Service != "" {
+		return a.annotateRescan(ctx, result)
+	}
+	snap, err := a.snapshots.GetByID(ctx, result.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("get snapshot: %w", err)
+	}
+	if snap == nil {
+		return nil
+	}
+	previous, err := a.snapshots.GetPrevious(ctx, snap.ID)
+	if err != nil {
+		return fmt.Errorf("get previous snapshot: %w", err)
+	}
+
+	text := fmt.Sprintf("Scan %d completed: %d services, %d series", snap.ID, snap.TotalServices, snap.TotalSeries)
+	if previous != nil {
+		text += fmt.Sprintf(" (%+d)", snap.TotalSeries-previous.TotalSeries)
+	}
+	if err := a.post(ctx, snap.CollectedAt, text, "scan"); err != nil {
+		return err
+	}
+	if previous == nil {
+		return nil
+	}
+
+	diffs, err := a.services.Diff(ctx, previous.ID, snap.ID)
+	if err != nil {
+		return fmt.Errorf("diff services: %w", err)
+	}
+	var errs []error
+	for _, d := range diffs {
+		if !a.spiked(d) {
+			continue
+		}
+		pct := float64(d.SeriesDelta) * 100 / float64(d.PreviousSeries)
+		text := fmt.Sprintf("Cardinality spike on %s: %d → %d series (%+.0f%%)", d.ServiceName, d.PreviousSeries, d.CurrentSeries, pct)
+		tags := []string{"spike", "service:" + d.ServiceName}
+		if d.Team != "" {
+			tags = append(tags, "team:"+d.Team)
+		}
+		if err := a.post(ctx, snap.CollectedAt, text, tags...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Annotator) annotateRescan(ctx context.Context, result *collector.CollectResult) error {
+	svc, err := a.services.GetByName(ctx, result.SnapshotID, result.Service)
+	if err != nil {
+		return fmt.Errorf("get service: %w", err)
+	}
+	if svc == nil {
+		return nil
+	}
+	text := fmt.Sprintf("Rescan of %s completed: %d series", svc.ServiceName, svc.TotalSeries)
+	tags := []string{"rescan", "service:" + svc.ServiceName}
+	if svc.Team != "" {
+		tags = append(tags, "team:"+svc.Team)
+	}
+	return a.post(ctx, time.Now(), text, tags...)
+}
+
+// SetSpikeThresholds replaces the spike thresholds, e.g. after a config
+// reload.
+func (a *Annotator) SetSpikeThresholds(spike config.BaselineConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.spike = spike
+}
+
+// spiked reports whether a service that was in both scans grew past the
+// thresholds; new services have nothing to spike from.
+func (a *Annotator) spiked(d models.ServiceDiff) bool {
+	a.mu.RLock()
+	spike := a.spike
+	a.mu.RUnlock()
+	if d.Status != models.DiffChanged || d.PreviousSeries == 0 || d.SeriesDelta < spike.MinDelta {
+		return false
+	}
+	return float64(d.SeriesDelta)*100/float64(d.PreviousSeries) >= spike.ThresholdPct
+}
+
+// Publish picks finished analyses out of the event stream and annotates
+// the findings they opened, in the background since Publish must not
+// block.
+func (a *Annotator) Publish(e models.Event) {
+	if e.Type != models.EventAnalysisFinished {
+		return
+	}
+	analysis, ok := e.Data.(*models.SnapshotAnalysis)
+	if !ok || analysis.Status != models.AnalysisStatusCompleted {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := a.annotateFindings(ctx, analysis); err != nil {
+			slog.Error("failed to annotate findings", "analysis_id", analysis.ID, "error", err)
+		}
+	}()
+}
+
+// annotateFindings annotates the open findings the analysis reported for
+// the first time, or reopened, at its current snapshot's time.
+func (a *Annotator) annotateFindings(ctx context.Context, analysis *models.SnapshotAnalysis) error {
+	snap, err := a.snapshots.GetByID(ctx, analysis.CurrentSnapshotID)
+	if err != nil || snap == nil {
+		return err
+	}
+	findings, err := a.findings.ListTracked(ctx, storage.TrackedFindingListOptions{
+		States: []models.FindingState{models.FindingOpen},
+	})
+	if err != nil {
+		return fmt.Errorf("list findings: %w", err)
+	}
+
+	var errs []error
+	for _, f := range findings {
+		if f.LastAnalysisID != analysis.ID || !f.FirstSeen.Equal(f.LastSeen) {
+			continue
+		}
+		subject := f.MetricName
+		if f.LabelName != "" {
+			subject += " label " + f.LabelName
+		}
+		text := fmt.Sprintf("New %s finding on %s: %s (%s)", f.Level, f.ServiceName, subject, f.Description)
+		if err := a.post(ctx, snap.CollectedAt, text, "finding", "service:"+f.ServiceName, "severity:"+string(f.Level)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Annotator) post(ctx context.Context, at time.Time, text string, tags ...string) error {
+	body, err := json.Marshal(annotation{
+		DashboardUID: a.cfg.DashboardUID,
+		Time:         at.UnixMilli(),
+		Tags:         append(append([]string{"whodidthis"}, a.cfg.Tags...), tags...),
+		Text:         text,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(a.cfg.URL, "/") + "/api/annotations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("grafana: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("grafana: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package kubernetes is a minimal read-only client for the Kubernetes API,
+// covering only the list calls discovery needs.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultTimeout    = 30 * time.Second
+)
+
+type Config struct {
+	// APIServer defaults to the in-cluster address. Point it at
+	// `kubectl proxy` (http://localhost:8001) to run outside the cluster.
+	APIServer string
+	// TokenFile and CAFile default to the pod's service account when
+	// running in-cluster.
+	TokenFile          string
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+type Client struct {
+	http      *http.Client
+	apiServer string
+	tokenFile string
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	inCluster := cfg.APIServer == ""
+	if inCluster {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster; set kubernetes.api_server")
+		}
+		cfg.APIServer = "https://" + net.JoinHostPort(host, port)
+		if cfg.TokenFile == "" {
+			cfg.TokenFile = serviceAccountDir + "/token"
+		}
+		if cfg.CAFile == "" {
+			cfg.CAFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kubernetes ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		http:      &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		apiServer: strings.TrimSuffix(cfg.APIServer, "/"),
+		tokenFile: cfg.TokenFile,
+	}, nil
+}
+
+// list GETs a collection and decodes it into out. An empty namespace lists
+// across all namespaces.
+func (c *Client) list(ctx context.Context, namespace, resource, labelSelector string, out any) error {
+	path := "/api/v1/" + resource
+	if namespace != "" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/" + resource
+	}
+	u := c.apiServer + path
+	if labelSelector != "" {
+		u += "?" + url.Values{"labelSelector": {labelSelector}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	// The service account token is rotated on disk, so it is read per call.
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("read kubernetes token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list %s: kubernetes api returned HTTP %d", resource, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", resource, err)
+	}
+	return nil
+}
+
+// listNamespaces runs list once per namespace, or once cluster-wide when
+// none are given.
+func listNamespaces[T any](ctx context.Context, c *Client, namespaces []string, resource, labelSelector string) ([]T, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	var items []T
+	for _, ns := range namespaces {
+		var list struct {
+			Items []T `json:"items"`
+		}
+		if err := c.list(ctx, ns, resource, labelSelector, &list); err != nil {
+			return nil, err
+		}
+		items = append(items, list.Items...)
+	}
+	return items, nil
+}
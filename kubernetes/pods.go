@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type ObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Containers []struct {
+			Name  string `json:"name"`
+			Ports []struct {
+				Name          string `json:"name"`
+				ContainerPort int    `json:"containerPort"`
+			} `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+// ListPods lists pods in the given namespaces (all when empty) matching the
+// label selector.
+func (c *Client) ListPods(ctx context.Context, namespaces []string, labelSelector string) ([]Pod, error) {
+	return listNamespaces[Pod](ctx, c, namespaces, "pods", labelSelector)
+}
+
+// Pod annotations understood by MetricsEndpoint, the same ones the example
+// Prometheus Kubernetes scrape config relabels on.
+const (
+	annotationScrape = "prometheus.io/scrape"
+	annotationPort   = "prometheus.io/port"
+	annotationPath   = "prometheus.io/path"
+	annotationScheme = "prometheus.io/scheme"
+)
+
+// MetricsEndpoint returns the URL of a running pod's metrics endpoint. Only
+// pods annotated prometheus.io/scrape=true qualify; the port comes from
+// prometheus.io/port, else from a container port named "metrics" or
+// "http-metrics".
+func (p Pod) MetricsEndpoint() (string, bool) {
+	ann := p.Metadata.Annotations
+	if ann[annotationScrape] != "true" || p.Status.Phase != "Running" || p.Status.PodIP == "" {
+		return "", false
+	}
+
+	port := ann[annotationPort]
+	if port == "" {
+		for _, c := range p.Spec.Containers {
+			for _, cp := range c.Ports {
+				if cp.Name == "metrics" || cp.Name == "http-metrics" {
+					port = strconv.Itoa(cp.ContainerPort)
+				}
+			}
+		}
+	}
+	if port == "" {
+		return "", false
+	}
+
+	scheme := ann[annotationScheme]
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := ann[annotationPath]
+	if path == "" {
+		path = "/metrics"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme + "://" + net.JoinHostPort(p.Status.PodIP, port) + path, true
+}
+
+// TargetLabels are the labels a scrape of the pod attaches to its series:
+// namespace, pod and every pod label, with names sanitized the way
+// Prometheus' labelmap does, e.g. app.kubernetes.io/name becomes
+// app_kubernetes_io_name.
+func (p Pod) TargetLabels() map[string]string {
+	labels := make(map[string]string, len(p.Metadata.Labels)+2)
+	for name, value := range p.Metadata.Labels {
+		labels[SanitizeLabelName(name)] = value
+	}
+	labels["namespace"] = p.Metadata.Namespace
+	labels["pod"] = p.Metadata.Name
+	return labels
+}
+
+// SanitizeLabelName replaces every character not allowed in a classic
+// Prometheus label name with an underscore.
+func SanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
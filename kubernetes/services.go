@@ -0,0 +1,13 @@
+package kubernetes
+
+import "context"
+
+type Service struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// ListServices lists Services in the given namespaces (all when empty)
+// matching the label selector.
+func (c *Client) ListServices(ctx context.Context, namespaces []string, labelSelector string) ([]Service, error) {
+	return listNamespaces[Service](ctx, c, namespaces, "services", labelSelector)
+}
@@ -0,0 +1,204 @@
+// Package limits checks every scan against the configured per-metric
+// series limits and tracks the violations across scans.
+package limits
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+type Checker struct {
+	snapshots  storage.SnapshotsRepo
+	services   storage.ServicesRepo
+	metrics    storage.MetricsRepo
+	violations storage.ViolationsRepo
+
+	mu     sync.RWMutex
+	limits []config.LimitConfig
+}
+
+func NewChecker(snapshots storage.SnapshotsRepo, services storage.ServicesRepo, metrics storage.MetricsRepo, violations storage.ViolationsRepo, limits []config.LimitConfig) *Checker {
+	return &Checker{
+		snapshots:  snapshots,
+		services:   services,
+		metrics:    metrics,
+		violations: violations,
+		limits:     limits,
+	}
+}
+
+// SetLimits replaces the limits, e.g. after a config reload.
+func (c *Checker) SetLimits(limits []config.LimitConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = limits
+}
+
+func (c *Checker) currentLimits() []config.LimitConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.limits
+}
+
+// AfterScan is a scheduler post-scan hook. It runs even without limits so
+// that violations left over from removed limits get resolved.
+func (c *Checker) AfterScan(ctx context.Context, result *collector.CollectResult) error {
+	snap, err := c.snapshots.GetByID(ctx, result.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("get snapshot: %w", err)
+	}
+	if snap == nil {
+		return nil
+	}
+
+	evaluated, err := c.evaluatedServices(ctx, snap)
+	if err != nil {
+		return err
+	}
+	found, err := c.Check(ctx, snap.ID)
+	if err != nil {
+		return err
+	}
+	if err := c.violations.Record(ctx, snap.ID, snap.CollectedAt, found, evaluated); err != nil {
+		return fmt.Errorf("record violations: %w", err)
+	}
+	if len(found) > 0 {
+		slog.Warn("metrics over their series limit", "snapshot_id", snap.ID, "count", len(found))
+	}
+	return nil
+}
+
+// evaluatedServices returns the services whose violations a snapshot can
+// resolve. Services that failed to scan or had no series say nothing about
+// their violations, which stay as they were. A service absent from a
+// completed scan is gone, but one absent from a partial scan may only have
+// been skipped.
+func (c *Checker) evaluatedServices(ctx context.Context, snap *models.Snapshot) ([]string, error) {
+	serviceErrors, err := c.snapshots.ListServiceErrors(ctx, snap.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list service errors: %w", err)
+	}
+	failed := make(map[string]bool, len(serviceErrors))
+	for _, e := range serviceErrors {
+		failed[e.Service] = true
+	}
+
+	services, err := c.services.List(ctx, snap.ID, storage.ServiceListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	present := make(map[string]bool, len(services))
+	var evaluated []string
+	for _, s := range services {
+		present[s.ServiceName] = true
+		if !s.Missing && !failed[s.ServiceName] {
+			evaluated = append(evaluated, s.ServiceName)
+		}
+	}
+
+	if snap.Status != models.SnapshotStatusCompleted {
+		return evaluated, nil
+	}
+	active, err := c.violations.List(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("list violations: %w", err)
+	}
+	gone := make(map[string]bool)
+	for _, v := range active {
+		if !present[v.ServiceName] && !failed[v.ServiceName] && !gone[v.ServiceName] {
+			gone[v.ServiceName] = true
+			evaluated = append(evaluated, v.ServiceName)
+		}
+	}
+	return evaluated, nil
+}
+
+// Check returns the service metrics in a snapshot over their limit.
+func (c *Checker) Check(ctx context.Context, snapshotID int64) ([]models.Violation, error) {
+	limits := c.currentLimits()
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	// Nothing at or below the smallest limit can violate any of them.
+	floor := limits[0].MaxSeries
+	for _, l := range limits[1:] {
+		floor = min(floor, l.MaxSeries)
+	}
+	metrics, err := c.metrics.Above(ctx, snapshotID, floor)
+	if err != nil {
+		return nil, fmt.Errorf("list metrics: %w", err)
+	}
+
+	var found []models.Violation
+	for _, m := range metrics {
+		limit, ok := limitFor(limits, m.ServiceName, m.MetricName)
+		if !ok || m.SeriesCount <= limit.MaxSeries {
+			continue
+		}
+		found = append(found, models.Violation{
+			ServiceName: m.ServiceName,
+			MetricName:  m.MetricName,
+			MaxSeries:   limit.MaxSeries,
+			SeriesCount: m.SeriesCount,
+		})
+	}
+	return found, nil
+}
+
+// Usage is a service metric's series against its limit.
+type Usage struct {
+	Service   string
+	Metric    string
+	Series    int
+	MaxSeries int
+}
+
+// Usage returns every service metric in a snapshot that has a limit,
+// largest first.
+func (c *Checker) Usage(ctx context.Context, snapshotID int64) ([]Usage, error) {
+	limits := c.currentLimits()
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	metrics, err := c.metrics.Above(ctx, snapshotID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("list metrics: %w", err)
+	}
+
+	var usage []Usage
+	for _, m := range metrics {
+		if limit, ok := limitFor(limits, m.ServiceName, m.MetricName); ok {
+			usage = append(usage, Usage{Service: m.ServiceName, Metric: m.MetricName, Series: m.SeriesCount, MaxSeries: limit.MaxSeries})
+		}
+	}
+	return usage, nil
+}
+
+func limitFor(limits []config.LimitConfig, service, metric string) (config.LimitConfig, bool) {
+	for _, l := range limits {
+		if ok, _ := path.Match(l.Metric, metric); !ok {
+			continue
+		}
+		if len(l.Services) == 0 || matchesAny(service, l.Services) {
+			return l, true
+		}
+	}
+	return config.LimitConfig{}, false
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
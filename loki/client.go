@@ -0,0 +1,155 @@
+// Package loki reads stream labels from Loki's series and label values
+// APIs.
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	URL      string
+	Username string
+	Password string
+	// BearerToken authenticates instead of basic auth.
+	BearerToken string
+	// TenantID is sent as X-Scope-OrgID on multi-tenant Loki.
+	TenantID string
+	Timeout  time.Duration
+	// Lookback is the window streams are counted over; Loki has no instant
+	// view of its index.
+	Lookback time.Duration
+}
+
+type Client struct {
+	http     *http.Client
+	baseURL  string
+	lookback time.Duration
+
+	mu  sync.RWMutex // guards the credentials in cfg
+	cfg Config
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	lookback := cfg.Lookback
+	if lookback <= 0 {
+		lookback = time.Hour
+	}
+	return &Client{
+		http:     &http.Client{Timeout: cfg.Timeout},
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		cfg:      cfg,
+		lookback: lookback,
+	}
+}
+
+// SetCredentials replaces the auth settings for the next request.
+func (c *Client) SetCredentials(username, password, bearerToken string) {
+	c.mu.Lock()
+	c.cfg.Username, c.cfg.Password, c.cfg.BearerToken = username, password, bearerToken
+	c.mu.Unlock()
+}
+
+func (c *Client) HealthCheck(ctx context.Context) error {
+	resp, err := c.get(ctx, "/ready", nil)
+	if err != nil {
+		return fmt.Errorf("loki health check failed: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// LabelValues lists the values of a label across all streams in the
+// lookback window.
+func (c *Client) LabelValues(ctx context.Context, name string) ([]string, error) {
+	var values []string
+	if err := c.getData(ctx, "/loki/api/v1/label/"+url.PathEscape(name)+"/values", c.window(), &values); err != nil {
+		return nil, fmt.Errorf("failed to get values of %s: %w", name, err)
+	}
+	return values, nil
+}
+
+// Series returns the label set of every stream matching the LogQL stream
+// selector in the lookback window.
+func (c *Client) Series(ctx context.Context, selector string) ([]map[string]string, error) {
+	query := c.window()
+	query.Set("match[]", selector)
+
+	var series []map[string]string
+	if err := c.getData(ctx, "/loki/api/v1/series", query, &series); err != nil {
+		return nil, fmt.Errorf("failed to get series for %s: %w", selector, err)
+	}
+	return series, nil
+}
+
+func (c *Client) window() url.Values {
+	end := time.Now()
+	return url.Values{
+		"start": {strconv.FormatInt(end.Add(-c.lookback).UnixNano(), 10)},
+		"end":   {strconv.FormatInt(end.UnixNano(), 10)},
+	}
+}
+
+func (c *Client) getData(ctx context.Context, path string, query url.Values, out any) error {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if body.Status != "success" {
+		return fmt.Errorf("loki returned status %q", body.Status)
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+	c.mu.RUnlock()
+	if c.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.cfg.TenantID)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned HTTP %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
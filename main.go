@@ -4,19 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/illenko/whodidthis/analyzer"
+	"github.com/illenko/whodidthis/analyzer/rules"
 	"github.com/illenko/whodidthis/api"
 	"github.com/illenko/whodidthis/api/handler"
 	"github.com/illenko/whodidthis/collector"
 	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/export"
+	"github.com/illenko/whodidthis/kubernetes"
+	"github.com/illenko/whodidthis/loki"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/notify"
 	"github.com/illenko/whodidthis/prometheus"
+	"github.com/illenko/whodidthis/report"
 	"github.com/illenko/whodidthis/scheduler"
 	"github.com/illenko/whodidthis/storage"
+	"github.com/illenko/whodidthis/ticket"
+	"go.yaml.in/yaml/v3"
 )
 
 var (
@@ -26,109 +36,357 @@ var (
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := newRootCmd().Execute(); err != nil {
 		slog.Error("fatal error", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath == "" {
-		configPath = "config.yaml"
+// configFlag is set by --config and takes precedence over CONFIG_PATH.
+var configFlag string
+
+func configPath() string {
+	if configFlag != "" {
+		return configFlag
+	}
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
 	}
+	return "config.yaml"
+}
 
-	cfg, err := config.Load(configPath)
+// runRestore replaces the configured database with a backup. The server
+// must be stopped first.
+func runRestore(backup string) error {
+	cfg, err := config.Load(configPath())
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel()})))
-	slog.Info("starting whodidthis", "version", version, "commit", commit, "built", buildTime)
+	slog.Info("restoring database", "backup", backup, "path", cfg.Storage.Path)
+	if err := storage.Restore(context.Background(), cfg.Storage.Path, backup); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	slog.Info("restore complete")
+	return nil
+}
 
-	db, err := storage.New(cfg.Storage.Path)
+// runValidate loads the config, prints it with defaults applied and secrets
+// masked, then checks that Prometheus, Loki and Gemini are reachable with
+// it unless offline.
+func runValidate(offline bool) error {
+	cfg, err := config.Load(configPath())
 	if err != nil {
-		return fmt.Errorf("init database: %w", err)
+		return fmt.Errorf("load config: %w", err)
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			slog.Error("failed to close database", "error", err)
-		}
-	}()
-
-	snapshotsRepo := storage.NewSnapshotsRepository(db)
-	servicesRepo := storage.NewServicesRepository(db)
-	metricsRepo := storage.NewMetricsRepository(db)
-	labelsRepo := storage.NewLabelsRepository(db)
 
-	promClient, err := prometheus.NewClient(prometheus.Config{
-		URL:      cfg.Prometheus.URL,
-		Username: cfg.Prometheus.Username,
-		Password: cfg.Prometheus.Password,
-		Timeout:  cfg.Prometheus.Timeout,
-	})
+	effective, err := cfg.Effective()
 	if err != nil {
-		return fmt.Errorf("create prometheus client: %w", err)
-	}
-
-	coll := collector.NewCollector(
-		promClient,
-		snapshotsRepo,
-		servicesRepo,
-		metricsRepo,
-		labelsRepo,
-		cfg,
-	)
-
-	sched := scheduler.New(coll, scheduler.Config{
-		Interval:  cfg.Scan.Interval,
-		Retention: cfg.RetentionDuration(),
-		DB:        db,
-	})
+		return err
+	}
+	out, err := yaml.Marshal(effective)
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	fmt.Printf("# effective config from %s\n%s\n", configPath(), out)
 
-	analysisRepo := storage.NewAnalysisRepository(db)
+	if offline {
+		fmt.Println("config ok (connectivity not checked)")
+		return nil
+	}
 
-	var snapshotAnalyzer *analyzer.Analyzer
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	failed := 0
+	check := func(name string, fn func() error) {
+		if err := fn(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			return
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+
+	check(fmt.Sprintf("metrics source (%s mode)", cfg.Scan.Mode), func() error {
+		client, err := collector.NewSource(cfg)
+		if err != nil {
+			return err
+		}
+		if h, ok := client.(interface{ HealthCheck(context.Context) error }); ok {
+			return h.HealthCheck(ctx)
+		}
+		return nil
+	})
+	if cfg.Loki.URL != "" {
+		check("loki", func() error {
+			return newLokiClient(cfg).HealthCheck(ctx)
+		})
+	}
 	if cfg.Gemini.APIKey != "" {
-		toolExecutor := analyzer.NewToolExecutor(servicesRepo, metricsRepo, labelsRepo)
-		snapshotAnalyzer, err = analyzer.New(context.Background(), analyzer.Config{
-			Gemini:       cfg.Gemini,
-			ToolExecutor: toolExecutor,
-			AnalysisRepo: analysisRepo,
-			Snapshots:    snapshotsRepo,
-			Services:     servicesRepo,
+		check("gemini", func() error {
+			return analyzer.CheckGemini(ctx, cfg.Gemini)
 		})
-		if err != nil {
-			return fmt.Errorf("create analyzer: %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d connectivity checks failed", failed)
+	}
+	fmt.Println("config ok")
+	return nil
+}
+
+func run() error {
+	cfg, err := config.Load(configPath())
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	// The level is a LevelVar so a config reload can change it.
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel())
+	slog.SetDefault(slog.New(api.NewLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))))
+	slog.Info("starting whodidthis", "version", version, "commit", commit, "built", buildTime)
+
+	a, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	if err := a.abortInterrupted(context.Background()); err != nil {
+		return err
+	}
+
+	pipe, err := a.newPipeline(cfg)
+	if err != nil {
+		return err
+	}
+	// Sources other than Prometheus have no health or live queries.
+	promClient, _ := pipe.client.(prometheus.MetricsClient)
+
+	hub := api.NewHub()
+	// The exporter watches scan events to drop its cached families, since
+	// a service rescan changes a snapshot without changing its ID.
+	var scanEvents models.EventPublisher = hub
+	var metricsExporter http.Handler
+	if cfg.Export.Metrics.Enabled {
+		exporter := export.NewMetricsExporter(cfg.Export.Metrics, a.snapshots, a.services, a.metrics, pipe.limits)
+		scanEvents = models.Publishers{hub, exporter}
+		metricsExporter = exporter
+		slog.Info("metrics exporter enabled", "path", "/metrics", "top_metrics", cfg.Export.Metrics.TopMetrics)
+	}
+	sched := scheduler.New(pipe.newCollector(cfg), pipe.schedulerConfig(cfg, scanEvents))
+
+	analysisRepo := storage.NewAnalysisRepository(a.db)
+
+	// Only the Prometheus client counts label values live, and live values
+	// would bypass redaction, so not when redaction rules are set.
+	var counter analyzer.LabelValueCounter
+	if c, ok := promClient.(analyzer.LabelValueCounter); ok && len(cfg.Scan.Redaction) == 0 {
+		counter = c
+	}
+	var querier analyzer.LiveQuerier
+	if cfg.Gemini.QueryPrometheus {
+		if q, ok := promClient.(analyzer.LiveQuerier); ok {
+			querier = q
+		} else {
+			slog.Warn("gemini.query_prometheus needs a Prometheus data source, tool disabled")
 		}
+	}
+	var analysisEvents models.EventPublisher = hub
+	if pipe.annotator != nil {
+		analysisEvents = models.Publishers{hub, pipe.annotator}
+	}
+	toolExecutor := analyzer.NewToolExecutor(a.services, a.metrics, a.labels, cfg.Cost, counter, querier, cfg.Discovery.ServiceLabels())
+	snapshotAnalyzer, err := analyzer.New(context.Background(), analyzer.Config{
+		Gemini:       cfg.Gemini,
+		Detection:    cfg.Detection,
+		ToolExecutor: toolExecutor,
+		AnalysisRepo: analysisRepo,
+		Snapshots:    a.snapshots,
+		Services:     a.services,
+		Metrics:      a.metrics,
+		Findings:     a.findings,
+		LogStreams:   pipe.logStreams,
+		Rules:        rules.NewEngine(a.services, a.metrics, a.labels, rules.NewClassifier(cfg.Detection)),
+		Events:       analysisEvents,
+	})
+	if err != nil {
+		return fmt.Errorf("create analyzer: %w", err)
+	}
+	if cfg.Gemini.APIKey != "" {
 		slog.Info("AI analysis enabled", "model", cfg.Gemini.Model)
 	} else {
-		slog.Warn("AI analysis disabled: WDT_GEMINI_API_KEY not set")
+		slog.Warn("AI analysis disabled, using rule-based analysis: WDT_GEMINI_API_KEY (or WDT_GEMINI_API_KEY_FILE) not set")
+	}
+
+	reportBuilder := report.NewBuilder(a.snapshots, a.services, a.metrics, a.findings, cfg.Cost)
+	notifier := notify.NewWebhooks(cfg.Notifications)
+
+	var digestJob *report.DigestJob
+	if cfg.Digest.Enabled {
+		digestJob = report.NewDigestJob(reportBuilder, notifier, cfg.Digest)
+		slog.Info("digest enabled", "days", cfg.Digest.Days, "time", cfg.Digest.Time, "window", cfg.Digest.Window)
 	}
 
-	healthHandler := handler.NewHealthHandler(snapshotsRepo, db, promClient)
-	scansHandler := handler.NewScansHandler(snapshotsRepo, sched)
+	var backupJob *export.BackupJob
+	if cfg.Storage.Backup.Destination != "" {
+		backupJob, err = export.NewBackupJob(context.Background(), cfg.Storage.Backup, a.db)
+		if err != nil {
+			return fmt.Errorf("create backup job: %w", err)
+		}
+	}
+
+	healthHandler := handler.NewHealthHandler(a.snapshots, a.db, promClient, sched)
+	scansHandler := handler.NewScansHandler(a.snapshots, a.scanRuns, sched, cfg.Cost)
 	analysisHandler := handler.NewAnalysisHandler(snapshotAnalyzer)
-	servicesHandler := handler.NewServicesHandler(servicesRepo)
-	metricsHandler := handler.NewMetricsHandler(servicesRepo, metricsRepo)
-	labelsHandler := handler.NewLabelsHandler(servicesRepo, metricsRepo, labelsRepo)
+	servicesHandler := handler.NewServicesHandler(a.services)
+	metricsHandler := handler.NewMetricsHandler(a.snapshots, a.services, a.metrics)
+	labelsHandler := handler.NewLabelsHandler(a.services, a.metrics, a.labels)
+	teamsHandler := handler.NewTeamsHandler(a.snapshots, a.services, cfg.Cost)
+	searchHandler := handler.NewSearchHandler(a.search)
+	adminHandler := handler.NewAdminHandler(backupJob, a.audit)
+	logsHandler := handler.NewLogsHandler(a.logStreams)
+	reportsHandler := handler.NewReportsHandler(reportBuilder)
+	diffHandler := handler.NewDiffHandler(a.snapshots, a.services)
+	baselineHandler := handler.NewBaselineHandler(a.snapshots, a.regressions, pipe.drift)
+	violationsHandler := handler.NewViolationsHandler(a.violations)
+	var tracker ticket.Tracker
+	if cfg.Jira.Enabled() {
+		tracker = ticket.NewJira(cfg.Jira)
+		slog.Info("jira tickets enabled", "url", cfg.Jira.URL, "project", cfg.Jira.Project)
+	}
+	var issues ticket.Tracker
+	if repos := ticket.NewTeamRepositories(cfg.Teams, a.services, cfg.GitHub, cfg.GitLab); repos.Enabled() {
+		issues = repos
+	}
+	drafter := ticket.NewDrafter(a.services, a.metrics, a.labels, cfg.Cost)
+	findingsHandler := handler.NewFindingsHandler(a.findings, drafter, tracker, issues)
+	if cfg.Slack.Enabled() {
+		slog.Info("slack app enabled")
+	}
+	slackHandler := handler.NewSlackHandler(cfg.Slack.SigningSecret, a.snapshots, a.services, a.metrics, a.findings)
+	grafanaHandler := handler.NewGrafanaHandler(a.snapshots, a.services)
+	graphqlHandler, err := handler.NewGraphQLHandler(a.snapshots, a.services, a.metrics, a.labels)
+	if err != nil {
+		return fmt.Errorf("create graphql handler: %w", err)
+	}
 
-	server := api.NewServer(
+	server, err := api.NewServer(
 		healthHandler,
 		scansHandler,
 		analysisHandler,
 		servicesHandler,
 		metricsHandler,
 		labelsHandler,
+		teamsHandler,
+		searchHandler,
+		adminHandler,
+		graphqlHandler,
+		logsHandler,
+		reportsHandler,
+		diffHandler,
+		baselineHandler,
+		violationsHandler,
+		findingsHandler,
+		slackHandler,
+		grafanaHandler,
+		hub,
 		api.ServerConfig{
-			Host: cfg.Server.Host,
-			Port: cfg.Server.Port,
+			Host:           cfg.Server.Host,
+			Port:           cfg.Server.Port,
+			RateLimit:      cfg.Server.RateLimit.RequestsPerSecond,
+			RateLimitBurst: cfg.Server.RateLimit.Burst,
+			AccessLog:      cfg.Log.Access,
+			Audit:          a.audit,
+			CORS: api.CORSConfig{
+				AllowedOrigins: cfg.Server.CORS.AllowedOrigins,
+				AllowedMethods: cfg.Server.CORS.AllowedMethods,
+				AllowedHeaders: cfg.Server.CORS.AllowedHeaders,
+			},
+			TLSCertFile:   cfg.Server.TLS.CertFile,
+			TLSKeyFile:    cfg.Server.TLS.KeyFile,
+			TLSSelfSigned: cfg.Server.TLS.SelfSigned,
+			Metrics:       metricsExporter,
 		})
+	if err != nil {
+		return fmt.Errorf("create server: %w", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go sched.Start(ctx)
+	if digestJob != nil {
+		go digestJob.Start(ctx)
+	}
+
+	// SIGHUP re-reads the config file and applies what can change without
+	// a restart: scan interval and tuning, discovery filters, teams,
+	// retention, blackout windows, the log level, notification targets,
+	// the digest schedule, the baseline, limit and detection thresholds of
+	// the post-scan checks and the Prometheus and Loki credentials.
+	// Storage, the server, turning the digest on or off and the other
+	// client settings keep their startup values. Leased Vault secrets
+	// trigger the same reload once two thirds of the lease has passed.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		current := cfg
+		refresh := secretsRefresh(cfg.SecretsTTL())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupCh:
+			case <-refresh:
+			}
+
+			reloaded, err := config.Load(configPath())
+			if err != nil {
+				slog.Error("config reload failed, keeping current config", "error", err)
+				if refresh != nil {
+					refresh = time.After(time.Minute)
+				}
+				continue
+			}
+			refresh = secretsRefresh(reloaded.SecretsTTL())
+
+			logLevel.Set(reloaded.LogLevel())
+			// Only these clients take new credentials; the rest keep the
+			// ones they started with, so only these leases may be revoked.
+			var replaced []string
+			if c, ok := promClient.(interface {
+				SetCredentials(prometheus.Credentials) error
+			}); ok {
+				err := c.SetCredentials(prometheus.Credentials{
+					Username:    reloaded.Prometheus.Username,
+					Password:    reloaded.Prometheus.Password,
+					BearerToken: reloaded.Prometheus.BearerToken,
+				})
+				if err != nil {
+					slog.Error("failed to update prometheus credentials", "error", err)
+				} else {
+					replaced = append(replaced, "prometheus.username", "prometheus.password", "prometheus.bearer_token")
+				}
+			}
+			if pipe.loki != nil {
+				pipe.loki.SetCredentials(reloaded.Loki.Username, reloaded.Loki.Password, reloaded.Loki.BearerToken)
+				replaced = append(replaced, "loki.username", "loki.password", "loki.bearer_token")
+			}
+			pipe.reload(reloaded)
+			sched.Reload(pipe.newCollector(reloaded), pipe.schedulerConfig(reloaded, scanEvents))
+			notifier.SetTargets(reloaded.Notifications)
+			if digestJob != nil {
+				digestJob.Reload(reloaded.Digest)
+			}
+			if err := current.RevokeSecrets(ctx, replaced...); err != nil {
+				slog.Warn("failed to revoke previous vault leases", "error", err)
+			}
+			current = reloaded
+			slog.Info("config reloaded", "path", configPath())
+		}
+	}()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -148,3 +406,37 @@ func run() error {
 
 	return server.Start()
 }
+
+func newLokiClient(cfg *config.Config) *loki.Client {
+	return loki.NewClient(loki.Config{
+		URL:         cfg.Loki.URL,
+		Username:    cfg.Loki.Username,
+		Password:    cfg.Loki.Password,
+		BearerToken: cfg.Loki.BearerToken,
+		TenantID:    cfg.Loki.TenantID,
+		Timeout:     cfg.Loki.Timeout,
+		Lookback:    cfg.Loki.Lookback,
+	})
+}
+
+// secretsRefresh fires when leased secrets should be read again; never
+// when nothing is leased.
+func secretsRefresh(ttl time.Duration) <-chan time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	return time.After(ttl * 2 / 3)
+}
+
+func newKubernetesClient(cfg *config.Config) (*kubernetes.Client, error) {
+	kube, err := kubernetes.NewClient(kubernetes.Config{
+		APIServer:          cfg.Kubernetes.APIServer,
+		TokenFile:          cfg.Kubernetes.TokenFile,
+		CAFile:             cfg.Kubernetes.CAFile,
+		InsecureSkipVerify: cfg.Kubernetes.InsecureSkipVerify,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create kubernetes client: %w", err)
+	}
+	return kube, nil
+}
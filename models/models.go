@@ -1,21 +1,54 @@
 package models
 
-import "time"
+import (
+	"path"
+	"time"
+)
+
+type SnapshotStatus string
+
+const (
+	SnapshotStatusRunning   SnapshotStatus = "running"
+	SnapshotStatusCompleted SnapshotStatus = "completed"
+	SnapshotStatusPartial   SnapshotStatus = "partial"
+	SnapshotStatusAborted   SnapshotStatus = "aborted"
+	SnapshotStatusFailed    SnapshotStatus = "failed"
+	// SnapshotStatusFiltered marks a scan narrowed by per-trigger overrides.
+	// It is kept for inspection but never used as latest or previous.
+	SnapshotStatusFiltered SnapshotStatus = "filtered"
+)
 
 type Snapshot struct {
-	ID             int64     `json:"id"`
-	CollectedAt    time.Time `json:"collected_at"`
-	ScanDurationMs int       `json:"duration_ms,omitempty"`
-	TotalServices  int       `json:"total_services"`
-	TotalSeries    int64     `json:"total_series"`
+	ID             int64          `json:"id"`
+	CollectedAt    time.Time      `json:"collected_at"`
+	Status         SnapshotStatus `json:"status"`
+	ScanDurationMs int            `json:"duration_ms,omitempty"`
+	TotalServices  int            `json:"total_services"`
+	TotalSeries    int64          `json:"total_series"`
+	SkippedMetrics int            `json:"skipped_metrics,omitempty"`
+	CopiedServices int            `json:"copied_services,omitempty"`
+	ServiceErrors  []ServiceError `json:"service_errors,omitempty"`
+	TSDBStats      *TSDBStats     `json:"tsdb_stats,omitempty"`
+	MonthlyCost    *float64       `json:"monthly_cost,omitempty"`
 }
 
 type ServiceSnapshot struct {
 	ID          int64  `json:"id"`
 	SnapshotID  int64  `json:"snapshot_id"`
 	ServiceName string `json:"name"`
-	TotalSeries int    `json:"total_series"`
-	MetricCount int    `json:"metric_count"`
+	// Labels holds the discovery label values the name was built from.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Team        string            `json:"team,omitempty"`
+	TotalSeries int               `json:"total_series"`
+	MetricCount int               `json:"metric_count"`
+	// Missing marks a service the discovery backend lists but that had no
+	// series at scan time.
+	Missing bool `json:"missing,omitempty"`
+	// ExcludedSeries belong to metrics the scan left out, e.g. by
+	// scan.metric_exclude. TotalSeries doesn't count them, so it matches
+	// the sum of the service's metrics.
+	ExcludedSeries int `json:"excluded_series,omitempty"`
 }
 
 type MetricSnapshot struct {
@@ -24,6 +57,240 @@ type MetricSnapshot struct {
 	MetricName        string `json:"name"`
 	SeriesCount       int    `json:"series_count"`
 	LabelCount        int    `json:"label_count"`
+	MetricType        string `json:"type,omitempty"`
+	Help              string `json:"help,omitempty"`
+	Unit              string `json:"unit,omitempty"`
+	NativeHistogram   bool   `json:"native_histogram,omitempty"`
+	ExemplarCount     int    `json:"exemplar_count,omitempty"`
+}
+
+type DiffStatus string
+
+const (
+	DiffAdded     DiffStatus = "added"
+	DiffRemoved   DiffStatus = "removed"
+	DiffChanged   DiffStatus = "changed"
+	DiffUnchanged DiffStatus = "unchanged"
+)
+
+// ServiceDiff compares a service between two snapshots. Counts are zero on
+// the side where the service doesn't exist.
+type ServiceDiff struct {
+	ServiceName     string     `json:"name"`
+	Team            string     `json:"team,omitempty"`
+	Status          DiffStatus `json:"status"`
+	PreviousSeries  int        `json:"previous_series"`
+	CurrentSeries   int        `json:"current_series"`
+	SeriesDelta     int        `json:"series_delta"`
+	PreviousMetrics int        `json:"previous_metrics"`
+	CurrentMetrics  int        `json:"current_metrics"`
+}
+
+// MetricDiff is one service metric compared between two snapshots.
+type MetricDiff struct {
+	ServiceName    string     `json:"service"`
+	MetricName     string     `json:"metric"`
+	Status         DiffStatus `json:"status"`
+	PreviousSeries int        `json:"previous_series"`
+	CurrentSeries  int        `json:"current_series"`
+	SeriesDelta    int        `json:"series_delta"`
+}
+
+// Regression is a service that grew past the regression thresholds since
+// the baseline snapshot.
+type Regression struct {
+	ID             int64  `json:"id"`
+	SnapshotID     int64  `json:"snapshot_id"`
+	BaselineID     int64  `json:"baseline_id"`
+	ServiceName    string `json:"service"`
+	BaselineSeries int    `json:"baseline_series"`
+	CurrentSeries  int    `json:"current_series"`
+	SeriesDelta    int    `json:"series_delta"`
+	// SeriesDeltaPct is nil for services the baseline didn't have.
+	SeriesDeltaPct *float64 `json:"series_delta_pct,omitempty"`
+}
+
+// Violation is a service metric over its configured series limit.
+type Violation struct {
+	ID          int64     `json:"id"`
+	ServiceName string    `json:"service"`
+	MetricName  string    `json:"metric"`
+	MaxSeries   int       `json:"max_series"`
+	SeriesCount int       `json:"series_count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	// LastSnapshotID is the latest scan that found the violation; it is
+	// no longer active once a later scan doesn't.
+	LastSnapshotID int64 `json:"last_snapshot_id"`
+	Active         bool  `json:"active"`
+}
+
+type SeverityLevel string
+
+const (
+	SeverityLow      SeverityLevel = "low"
+	SeverityMedium   SeverityLevel = "medium"
+	SeverityHigh     SeverityLevel = "high"
+	SeverityCritical SeverityLevel = "critical"
+)
+
+// Finding is one issue an analysis reported for a service metric. Severity
+// runs from 0 to 100 and is scored from the metric's series count and
+// growth, whichever engine found the issue.
+type Finding struct {
+	ID          int64  `json:"id"`
+	AnalysisID  int64  `json:"analysis_id"`
+	SnapshotID  int64  `json:"snapshot_id"`
+	ServiceName string `json:"service"`
+	MetricName  string `json:"metric"`
+	// LabelName is empty for issues that aren't about one label.
+	LabelName   string `json:"label,omitempty"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	SeriesCount int    `json:"series_count"`
+	// PreviousSeries is nil when the previous snapshot lacks the metric.
+	PreviousSeries *int          `json:"previous_series,omitempty"`
+	Severity       int           `json:"severity"`
+	Level          SeverityLevel `json:"level"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+type FindingState string
+
+const (
+	FindingOpen         FindingState = "open"
+	FindingAcknowledged FindingState = "acknowledged"
+	FindingResolved     FindingState = "resolved"
+)
+
+// TrackedFinding follows one issue, a service metric, label and kind,
+// across analyses. Description, series count and severity come from the
+// latest analysis that reported it.
+type TrackedFinding struct {
+	ID          int64        `json:"id"`
+	ServiceName string       `json:"service"`
+	MetricName  string       `json:"metric"`
+	LabelName   string       `json:"label,omitempty"`
+	Kind        string       `json:"kind"`
+	State       FindingState `json:"state"`
+	Description string       `json:"description"`
+	SeriesCount int          `json:"series_count"`
+	// BaselineSeries is the metric's size before the issue, nil when it
+	// was new; growth findings resolve once the metric is back to it.
+	BaselineSeries *int          `json:"baseline_series,omitempty"`
+	Severity       int           `json:"severity"`
+	Level          SeverityLevel `json:"level"`
+	FirstSeen      time.Time     `json:"first_seen"`
+	LastSeen       time.Time     `json:"last_seen"`
+	LastSnapshotID int64         `json:"last_snapshot_id"`
+	LastAnalysisID int64         `json:"last_analysis_id"`
+	Assignee       string        `json:"assignee,omitempty"`
+	Comment        string        `json:"comment,omitempty"`
+	AcknowledgedAt *time.Time    `json:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time    `json:"resolved_at,omitempty"`
+	// ResolvedSnapshotID is the scan that showed the issue fixed.
+	ResolvedSnapshotID *int64 `json:"resolved_snapshot_id,omitempty"`
+	// SnoozedUntil hides the finding until then.
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	// TicketKey and TicketURL name the issue opened for the finding.
+	TicketKey string `json:"ticket_key,omitempty"`
+	TicketURL string `json:"ticket_url,omitempty"`
+}
+
+// Snoozed reports whether the finding is hidden at t.
+func (f TrackedFinding) Snoozed(t time.Time) bool {
+	return f.SnoozedUntil != nil && f.SnoozedUntil.After(t)
+}
+
+// IgnoreRule accepts some cardinality for good, so issues it matches are
+// no longer reported. Service, metric and label are globs; an empty label
+// covers the whole metric.
+type IgnoreRule struct {
+	ID        int64     `json:"id"`
+	Service   string    `json:"service"`
+	Metric    string    `json:"metric"`
+	Label     string    `json:"label,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether an issue with the service metric and label,
+// which may be empty, falls under the rule. A rule naming a label doesn't
+// cover issues about the metric as a whole.
+func (r IgnoreRule) Matches(service, metric, label string) bool {
+	if ok, _ := path.Match(r.Service, service); !ok {
+		return false
+	}
+	if ok, _ := path.Match(r.Metric, metric); !ok {
+		return false
+	}
+	if r.Label == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Label, label)
+	return ok && label != ""
+}
+
+// TeamSummary rolls up a snapshot's services per team. Services without a
+// team are grouped under an empty name.
+type TeamSummary struct {
+	Team         string `json:"team"`
+	ServiceCount int    `json:"service_count"`
+	TotalSeries  int64  `json:"total_series"`
+	MetricCount  int    `json:"metric_count"`
+	// Deltas against the previous snapshot; nil when there is none.
+	PreviousSeries *int64   `json:"previous_series,omitempty"`
+	SeriesDelta    *int64   `json:"series_delta,omitempty"`
+	SeriesDeltaPct *float64 `json:"series_delta_pct,omitempty"`
+	MonthlyCost    *float64 `json:"monthly_cost,omitempty"`
+	CostDelta      *float64 `json:"cost_delta,omitempty"`
+}
+
+// TrendPoint is one snapshot's series count in a trend.
+type TrendPoint struct {
+	SnapshotID  int64     `json:"snapshot_id"`
+	CollectedAt time.Time `json:"collected_at"`
+	Series      int64     `json:"series"`
+}
+
+// MetricHistoryPoint is one snapshot's view of a single service metric.
+type MetricHistoryPoint struct {
+	SnapshotID  int64     `json:"snapshot_id"`
+	CollectedAt time.Time `json:"collected_at"`
+	SeriesCount int       `json:"series_count"`
+	LabelCount  int       `json:"label_count"`
+	// SeriesDelta is the change since the previous point; zero for the first.
+	SeriesDelta int `json:"series_delta"`
+}
+
+// TopMetric is one service metric ranked in a snapshot's top offenders.
+type TopMetric struct {
+	ServiceName string `json:"service"`
+	MetricName  string `json:"metric"`
+	SeriesCount int    `json:"series_count"`
+	LabelCount  int    `json:"label_count"`
+	// Deltas against the previous snapshot; nil when there is none.
+	PreviousSeries *int `json:"previous_series,omitempty"`
+	SeriesDelta    *int `json:"series_delta,omitempty"`
+}
+
+type SearchResultType string
+
+const (
+	SearchResultService SearchResultType = "service"
+	SearchResultMetric  SearchResultType = "metric"
+	SearchResultLabel   SearchResultType = "label"
+	SearchResultValue   SearchResultType = "value"
+)
+
+// SearchResult is one match in a snapshot search. Fields below the matched
+// level are left empty, e.g. a metric match has no Label or Value.
+type SearchResult struct {
+	Type    SearchResultType `json:"type"`
+	Service string           `json:"service"`
+	Metric  string           `json:"metric,omitempty"`
+	Label   string           `json:"label,omitempty"`
+	Value   string           `json:"value,omitempty"`
 }
 
 type LabelSnapshot struct {
@@ -32,6 +299,29 @@ type LabelSnapshot struct {
 	LabelName         string   `json:"name"`
 	UniqueValuesCount int      `json:"unique_values"`
 	SampleValues      []string `json:"sample_values,omitempty"`
+	// Redacted lists the redaction classes (e.g. "email") whose placeholders
+	// appear in SampleValues.
+	Redacted  []string `json:"redacted,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// LogServiceSnapshot is a service's Loki streams in one snapshot, the log
+// counterpart of ServiceSnapshot.
+type LogServiceSnapshot struct {
+	ID          int64  `json:"id"`
+	SnapshotID  int64  `json:"snapshot_id"`
+	ServiceName string `json:"name"`
+	StreamCount int    `json:"stream_count"`
+	LabelCount  int    `json:"label_count"`
+}
+
+type LogLabelSnapshot struct {
+	ID                   int64    `json:"id"`
+	LogServiceSnapshotID int64    `json:"log_service_snapshot_id"`
+	LabelName            string   `json:"name"`
+	UniqueValuesCount    int      `json:"unique_values"`
+	SampleValues         []string `json:"sample_values,omitempty"`
+	Redacted             []string `json:"redacted,omitempty"`
 }
 
 type Overview struct {
@@ -47,11 +337,162 @@ type ScanStatus struct {
 	LastDuration string    `json:"last_duration,omitempty"`
 }
 
+type EventType string
+
+const (
+	EventScanStarted      EventType = "scan.started"
+	EventScanFinished     EventType = "scan.finished"
+	EventAnalysisProgress EventType = "analysis.progress"
+	EventAnalysisFinished EventType = "analysis.finished"
+)
+
+// Event is a notification pushed to live UI clients. Data is the payload
+// for the type, e.g. the ScanRun for scan events.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data,omitempty"`
+}
+
+// EventPublisher receives events from the scheduler and analyzer. Publish
+// must not block.
+type EventPublisher interface {
+	Publish(Event)
+}
+
+// Publishers hands every event to each publisher in turn.
+type Publishers []EventPublisher
+
+func (p Publishers) Publish(e Event) {
+	for _, pub := range p {
+		pub.Publish(e)
+	}
+}
+
+// AnalysisProgress is the payload of analysis progress events.
+type AnalysisProgress struct {
+	CurrentSnapshotID  int64  `json:"current_snapshot_id"`
+	PreviousSnapshotID int64  `json:"previous_snapshot_id"`
+	Progress           string `json:"progress"`
+}
+
+type ScanTrigger string
+
+const (
+	ScanTriggerScheduled ScanTrigger = "scheduled"
+	ScanTriggerManual    ScanTrigger = "manual"
+	ScanTriggerCLI       ScanTrigger = "cli"
+)
+
+type ScanRunStatus string
+
+const (
+	ScanRunStatusRunning   ScanRunStatus = "running"
+	ScanRunStatusCompleted ScanRunStatus = "completed"
+	ScanRunStatusFailed    ScanRunStatus = "failed"
+	ScanRunStatusAborted   ScanRunStatus = "aborted"
+)
+
+type ScanRun struct {
+	ID            int64          `json:"id"`
+	Trigger       ScanTrigger    `json:"trigger"`
+	Service       string         `json:"service,omitempty"`
+	SnapshotID    int64          `json:"snapshot_id,omitempty"`
+	Status        ScanRunStatus  `json:"status"`
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+	TotalServices int            `json:"total_services"`
+	TotalSeries   int64          `json:"total_series"`
+	ServiceErrors []ServiceError `json:"service_errors,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// AuditEntry records one mutating API call. Body holds at most the first
+// few KB of the request body. Actor is only a fingerprint of an
+// Authorization header nothing verifies; RemoteAddr is the reliable part.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Actor      string    `json:"actor"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Body       string    `json:"body,omitempty"`
+	Status     int       `json:"status"`
+}
+
+// TSDBStats is the Prometheus head block as reported by the TSDB status API.
+type TSDBStats struct {
+	HeadSeries     int        `json:"head_series"`
+	HeadLabelPairs int        `json:"head_label_pairs"`
+	HeadChunks     int        `json:"head_chunks"`
+	MinTime        time.Time  `json:"min_time"`
+	MaxTime        time.Time  `json:"max_time"`
+	TopMetrics     []TSDBStat `json:"top_metrics"`
+	TopLabelNames  []TSDBStat `json:"top_label_names"`
+}
+
+type TSDBStat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// SnapshotBundleVersion is bumped whenever the bundle layout changes in a
+// way older importers can't read.
+const SnapshotBundleVersion = 1
+
+// SnapshotBundle is a self-contained copy of one snapshot, used to move
+// snapshots between installations. IDs inside are informational only and
+// are reassigned on import.
+type SnapshotBundle struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Snapshot   Snapshot        `json:"snapshot"`
+	Services   []ServiceBundle `json:"services"`
+}
+
+type ServiceBundle struct {
+	ServiceSnapshot
+	Metrics []MetricBundle `json:"metrics"`
+}
+
+type MetricBundle struct {
+	MetricSnapshot
+	Labels []LabelSnapshot `json:"labels"`
+}
+
+type ServiceError struct {
+	Service string `json:"service"`
+	Error   string `json:"error"`
+}
+
 type HealthStatus struct {
-	Status              string    `json:"status"`
-	PrometheusConnected bool      `json:"prometheus_connected"`
-	DatabaseOK          bool      `json:"database_ok"`
-	LastScan            time.Time `json:"last_scan,omitempty"`
+	Status              string         `json:"status"`
+	PrometheusConnected bool           `json:"prometheus_connected"`
+	PrometheusCircuit   *CircuitStatus `json:"prometheus_circuit,omitempty"`
+	DatabaseOK          bool           `json:"database_ok"`
+	LastScan            time.Time      `json:"last_scan,omitempty"`
+}
+
+// ReadinessStatus is the /readyz answer: Ready only when every component
+// is OK.
+type ReadinessStatus struct {
+	Ready      bool              `json:"ready"`
+	Components []ComponentStatus `json:"components"`
+}
+
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type CircuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
 }
 
 type AnalysisStatus string
@@ -73,6 +514,20 @@ type SnapshotAnalysis struct {
 	Error              string         `json:"error,omitempty"`
 	CreatedAt          time.Time      `json:"created_at"`
 	CompletedAt        *time.Time     `json:"completed_at,omitempty"`
+	// Gemini token usage summed over all calls; ResponseTokens includes
+	// thinking tokens, which are billed as output.
+	PromptTokens   int64 `json:"prompt_tokens,omitempty"`
+	ResponseTokens int64 `json:"response_tokens,omitempty"`
+}
+
+// AnalysisUsage sums the token usage of the analyses created in one month.
+type AnalysisUsage struct {
+	Month          string `json:"month"` // YYYY-MM
+	Analyses       int    `json:"analyses"`
+	PromptTokens   int64  `json:"prompt_tokens"`
+	ResponseTokens int64  `json:"response_tokens"`
+	// Cost is nil when no Gemini pricing is configured.
+	Cost *float64 `json:"cost,omitempty"`
 }
 
 type ToolCall struct {
@@ -81,9 +536,14 @@ type ToolCall struct {
 	Result any            `json:"result,omitempty"`
 }
 
+// AnalysisGlobalStatus lists the analyses in flight. The snapshot IDs and
+// progress repeat the most recently started one.
 type AnalysisGlobalStatus struct {
 	Running            bool   `json:"running"`
 	CurrentSnapshotID  int64  `json:"current_snapshot_id,omitempty"`
 	PreviousSnapshotID int64  `json:"previous_snapshot_id,omitempty"`
 	Progress           string `json:"progress,omitempty"`
+	// Full is set when no further analysis can start until one finishes.
+	Full     bool               `json:"full"`
+	Analyses []AnalysisProgress `json:"analyses"`
 }
@@ -0,0 +1,106 @@
+// Package notify delivers messages such as the digest to chat and incident
+// tools through webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+)
+
+// Message is a notification; Text is markdown.
+type Message struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Webhooks posts every message to each configured webhook.
+type Webhooks struct {
+	mu      sync.RWMutex
+	targets []config.WebhookConfig
+	client  *http.Client
+}
+
+func NewWebhooks(cfg config.NotificationsConfig) *Webhooks {
+	return &Webhooks{
+		targets: cfg.Webhooks,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetTargets replaces the webhooks, e.g. after a config reload.
+func (w *Webhooks) SetTargets(cfg config.NotificationsConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.targets = cfg.Webhooks
+}
+
+// Notify tries every target and returns the failures joined, so one broken
+// webhook doesn't silence the others.
+func (w *Webhooks) Notify(ctx context.Context, msg Message) error {
+	w.mu.RLock()
+	targets := w.targets
+	w.mu.RUnlock()
+
+	var errs []error
+	for i, t := range targets {
+		if err := w.post(ctx, t, msg); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Webhooks) post(ctx context.Context, t config.WebhookConfig, msg Message) error {
+	var payload any = msg
+	if t.Format == config.WebhookSlack {
+		payload = map[string]string{"text": slackText(msg)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// slackText converts the bits of markdown messages use to Slack's mrkdwn,
+// which bolds with single asterisks and has no headings.
+func slackText(msg Message) string {
+	text := strings.ReplaceAll(msg.Text, "**", "*")
+	if msg.Title == "" {
+		return text
+	}
+	return "*" + msg.Title + "*\n" + text
+}
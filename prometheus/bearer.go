@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bearerAuthTransport sends a bearer token from either a static string or
+// a file. The file is re-read whenever its modification time or size
+// changes, which covers rotated Kubernetes service-account tokens.
+type bearerAuthTransport struct {
+	transport http.RoundTripper
+	token     string
+	file      string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+func newBearerAuthTransport(transport http.RoundTripper, token, file string) (*bearerAuthTransport, error) {
+	t := &bearerAuthTransport{transport: transport, token: token, file: file}
+	if file != "" {
+		if _, err := t.currentToken(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *bearerAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.transport.RoundTrip(req)
+}
+
+func (t *bearerAuthTransport) CloseIdleConnections() {
+	closeIdleConnections(t.transport)
+}
+
+func (t *bearerAuthTransport) currentToken() (string, error) {
+	if t.file == "" {
+		return t.token, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.file)
+	if err != nil {
+		if t.token != "" {
+			// Keep the last good token; the file may be mid-rotation.
+			slog.Warn("failed to stat bearer token file, using previous token", "file", t.file, "error", err)
+			return t.token, nil
+		}
+		return "", fmt.Errorf("stat bearer token file: %w", err)
+	}
+	if t.token != "" && info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return t.token, nil
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return "", fmt.Errorf("read bearer token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("bearer token file %s is empty", t.file)
+	}
+
+	t.token = token
+	t.modTime = info.ModTime()
+	t.size = info.Size()
+	return token, nil
+}
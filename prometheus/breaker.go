@@ -0,0 +1,161 @@
+package prometheus
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive server-side failures
+	// that trips the breaker.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before a probe request is
+	// let through.
+	Cooldown time.Duration
+}
+
+func (b BreakerConfig) withDefaults() BreakerConfig {
+	if b.FailureThreshold <= 0 {
+		b.FailureThreshold = 5
+	}
+	if b.Cooldown <= 0 {
+		b.Cooldown = 30 * time.Second
+	}
+	return b
+}
+
+type CircuitStatus struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	OpenedAt            time.Time
+}
+
+// breaker blocks callers while Prometheus is failing instead of failing them,
+// so a scan pauses through an outage and carries on once a probe succeeds.
+type breaker struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	changed  chan struct{}
+}
+
+func newBreaker(cfg BreakerConfig) *breaker {
+	return &breaker{
+		cfg:     cfg.withDefaults(),
+		state:   CircuitClosed,
+		changed: make(chan struct{}),
+	}
+}
+
+// wait returns once a request may be sent, or with ctx's error if the caller
+// gives up first.
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		state, changed := b.state, b.changed
+
+		var delay time.Duration
+		switch state {
+		case CircuitClosed:
+			b.mu.Unlock()
+			return nil
+		case CircuitOpen:
+			delay = time.Until(b.openedAt.Add(b.cfg.Cooldown))
+			if delay <= 0 {
+				// This caller becomes the probe; everyone else waits for it.
+				b.setState(CircuitHalfOpen)
+				b.mu.Unlock()
+				return nil
+			}
+		}
+		b.mu.Unlock()
+
+		// A half-open breaker has no delay: wait for the probe to finish.
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if delay > 0 {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			err := ctx.Err()
+			if timer != nil {
+				timer.Stop()
+			}
+			return err
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// record updates the breaker with the outcome of a request. Only failures that
+// point at Prometheus itself count; a bad query means the server is answering.
+func (b *breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The caller gave up mid-request, which says nothing about the
+		// server. Hand the probe slot to the next waiter.
+		if b.state == CircuitHalfOpen {
+			b.setState(CircuitOpen)
+		}
+	case err != nil && isRetryable(ctx, err):
+		b.failures++
+		if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.cfg.FailureThreshold) {
+			b.openedAt = time.Now()
+			b.setState(CircuitOpen)
+			slog.Warn("prometheus circuit breaker opened",
+				"consecutive_failures", b.failures,
+				"cooldown", b.cfg.Cooldown,
+				"error", err)
+		}
+	default:
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.setState(CircuitClosed)
+			slog.Info("prometheus circuit breaker closed")
+		}
+	}
+}
+
+func (b *breaker) status() CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != CircuitClosed {
+		status.OpenedAt = b.openedAt
+	}
+	return status
+}
+
+// setState must be called with mu held.
+func (b *breaker) setState(state CircuitState) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
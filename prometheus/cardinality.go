@@ -0,0 +1,144 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// cardinalityMaxLimit is the largest limit the Mimir cardinality endpoints
+// accept for label names and for values per label.
+const cardinalityMaxLimit = 500
+
+// Availability of the cardinality API, probed on first use.
+const (
+	cardinalityUnknown int32 = iota
+	cardinalityAvailable
+	cardinalityUnavailable
+)
+
+type cardinalityLabelNames struct {
+	Cardinality []struct {
+		LabelName string `json:"label_name"`
+	} `json:"cardinality"`
+}
+
+type cardinalityLabelValues struct {
+	Labels []struct {
+		LabelName        string `json:"label_name"`
+		LabelValuesCount int    `json:"label_values_count"`
+		Cardinality      []struct {
+			LabelValue string `json:"label_value"`
+		} `json:"cardinality"`
+	} `json:"labels"`
+}
+
+// labelsFromCardinalityAPI answers GetLabelsForMetric with Mimir's (and
+// Cortex's) cardinality analysis endpoints, which return exact value counts
+// plus the most common values without shipping any series. It reports
+// ok=false when the backend doesn't offer them; the first such answer turns
+// the API off for good.
+func (c *Client) labelsFromCardinalityAPI(ctx context.Context, selector string, serviceLabels []string, sampleLimit int) (labels []LabelInfo, ok bool, err error) {
+	if c.cardinality.Load() == cardinalityUnavailable {
+		return nil, false, nil
+	}
+
+	labels, err = c.cardinalityLabels(ctx, selector, serviceLabels, sampleLimit)
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && !isRetryable(ctx, err) {
+		if c.cardinality.CompareAndSwap(cardinalityUnknown, cardinalityUnavailable) {
+			slog.Info("cardinality API not available, counting labels without it", "error", err)
+		}
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.cardinality.CompareAndSwap(cardinalityUnknown, cardinalityAvailable) {
+		slog.Info("using the cardinality API for label counts")
+	}
+	return labels, true, nil
+}
+
+func (c *Client) cardinalityLabels(ctx context.Context, selector string, serviceLabels []string, sampleLimit int) ([]LabelInfo, error) {
+	var names cardinalityLabelNames
+	err := c.cardinalityGet(ctx, "/api/v1/cardinality/label_names", url.Values{
+		"selector": {selector},
+		"limit":    {fmt.Sprint(cardinalityMaxLimit)},
+	}, &names)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"selector": {selector},
+		"limit":    {fmt.Sprint(min(max(sampleLimit, 1), cardinalityMaxLimit))},
+	}
+	for _, n := range names.Cardinality {
+		if !c.skipLabel(n.LabelName, serviceLabels) {
+			query.Add("label_names[]", n.LabelName)
+		}
+	}
+	if len(query["label_names[]"]) == 0 {
+		return nil, nil
+	}
+
+	var values cardinalityLabelValues
+	if err := c.cardinalityGet(ctx, "/api/v1/cardinality/label_values", query, &values); err != nil {
+		return nil, err
+	}
+
+	labels := make([]LabelInfo, 0, len(values.Labels))
+	for _, l := range values.Labels {
+		samples := make([]string, 0, len(l.Cardinality))
+		for _, v := range l.Cardinality {
+			samples = append(samples, v.LabelValue)
+		}
+		sort.Strings(samples)
+		labels = append(labels, LabelInfo{
+			Name:         l.LabelName,
+			UniqueValues: l.LabelValuesCount,
+			SampleValues: samples,
+		})
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].UniqueValues > labels[j].UniqueValues
+	})
+	return labels, nil
+}
+
+func (c *Client) cardinalityGet(ctx context.Context, endpoint string, query url.Values, out any) error {
+	u := c.raw.URL(endpoint, nil)
+	u.RawQuery = query.Encode()
+
+	body, err := withRetry(ctx, c.retry, c.breaker, func() ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, body, err := c.raw.Do(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &httpStatusError{url: endpoint, code: resp.StatusCode}
+		}
+		return body, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode %s: %w", endpoint, err)
+	}
+	return nil
+}
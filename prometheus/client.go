@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/api"
@@ -15,20 +19,67 @@ import (
 
 type MetricsClient interface {
 	HealthCheck(ctx context.Context) error
-	DiscoverServices(ctx context.Context, serviceLabel string) ([]ServiceInfo, error)
-	GetMetricsForService(ctx context.Context, serviceLabel, serviceName string) ([]MetricInfo, error)
-	GetLabelsForMetric(ctx context.Context, serviceLabel, serviceName, metricName string, sampleLimit int) ([]LabelInfo, error)
+	DiscoverServices(ctx context.Context, serviceLabels []string) ([]ServiceInfo, error)
+	GetMetricsForService(ctx context.Context, serviceLabels []string, serviceName string) ([]MetricInfo, error)
+	GetLabelsForMetric(ctx context.Context, serviceLabels []string, serviceName, metricName string, seriesCount, sampleLimit int) ([]LabelInfo, error)
+	GetMetadata(ctx context.Context) (map[string]MetricMetadata, error)
+	CountExemplars(ctx context.Context, serviceLabels []string, serviceName, metricName string) (int, error)
+	GetTSDBStatus(ctx context.Context) (*TSDBStatus, error)
+	CircuitStatus() CircuitStatus
 }
 
 type Client struct {
-	api v1.API
+	api      v1.API
+	raw      api.Client
+	auth     *authTransport
+	retry    RetryConfig
+	breaker  *breaker
+	lookback time.Duration
+
+	labelValuesAPI  bool
+	seriesChunkSize int
+	maxSeries       int
+	skipLabels      map[string]struct{}
+	cardinalityAPI  bool
+	cardinality     atomic.Int32
+
+	// services holds the label values of every service the last discovery
+	// found, so matchers never have to split a service name.
+	servicesMu sync.RWMutex
+	services   map[string]map[string]string
 }
 
 type Config struct {
 	URL      string
 	Username string
 	Password string
-	Timeout  time.Duration
+	// BearerToken or BearerTokenFile authenticate instead of basic auth.
+	// The file is re-read when it changes.
+	BearerToken     string
+	BearerTokenFile string
+	Timeout         time.Duration
+	TLS             TLSConfig
+	Retry           RetryConfig
+	Breaker         BreakerConfig
+	// Lookback widens cardinality queries to series seen within the window
+	// instead of only those present at query time. Zero means instant.
+	Lookback time.Duration
+	// LabelValuesAPI counts label values with /api/v1/label/<name>/values
+	// instead of fetching every series of a metric.
+	LabelValuesAPI bool
+	// SeriesChunkSize is the most series a single Series call is expected
+	// to return; bigger metrics are sharded across several calls.
+	SeriesChunkSize int
+	// MaxSeries caps how many series are fetched per metric when sharding.
+	// Zero means no cap.
+	MaxSeries int
+	// SkipLabels are left out of per-metric label stats, on top of
+	// __name__ and the service labels.
+	SkipLabels []string
+	// CardinalityAPI counts labels with the Mimir/Cortex cardinality
+	// analysis endpoints when the backend has them. Anything else is
+	// detected on the first call and falls back to the other methods.
+	CardinalityAPI bool
 }
 
 func NewClient(cfg Config) (*Client, error) {
@@ -37,10 +88,55 @@ func NewClient(cfg Config) (*Client, error) {
 		timeout = 30 * time.Second
 	}
 
+	seriesChunkSize := cfg.SeriesChunkSize
+	if seriesChunkSize <= 0 {
+		seriesChunkSize = 10000
+	}
+
+	auth, err := newAuthTransport(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	apiCfg := api.Config{
+		Address:      cfg.URL,
+		RoundTripper: auth,
+	}
+
+	client, err := api.NewClient(apiCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prometheus client: %w", err)
+	}
+
+	return &Client{
+		api:      v1.NewAPI(client),
+		raw:      client,
+		auth:     auth,
+		retry:    cfg.Retry.withDefaults(),
+		breaker:  newBreaker(cfg.Breaker),
+		lookback: cfg.Lookback,
+
+		labelValuesAPI:  cfg.LabelValuesAPI,
+		seriesChunkSize: seriesChunkSize,
+		maxSeries:       cfg.MaxSeries,
+		skipLabels:      skipSet(cfg.SkipLabels),
+		cardinalityAPI:  cfg.CardinalityAPI,
+	}, nil
+}
+
+// newRoundTripper builds the transport shared by every request to the
+// server: TLS settings plus bearer or basic auth.
+func newRoundTripper(cfg Config, timeout time.Duration) (http.RoundTripper, error) {
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("prometheus tls: %w", err)
+	}
+
 	transport := &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout: 5 * time.Second,
 		}).DialContext,
+		TLSClientConfig:       tlsConfig,
 		TLSHandshakeTimeout:   5 * time.Second,
 		ResponseHeaderTimeout: timeout,
 		MaxIdleConns:          10,
@@ -48,27 +144,62 @@ func NewClient(cfg Config) (*Client, error) {
 	}
 
 	var rt http.RoundTripper = transport
-	if cfg.Username != "" && cfg.Password != "" {
+	switch {
+	case cfg.BearerToken != "" || cfg.BearerTokenFile != "":
+		rt, err = newBearerAuthTransport(transport, cfg.BearerToken, cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus bearer auth: %w", err)
+		}
+	case cfg.Username != "" && cfg.Password != "":
 		rt = &basicAuthTransport{
 			transport: transport,
 			username:  cfg.Username,
 			password:  cfg.Password,
 		}
 	}
+	return rt, nil
+}
 
-	apiCfg := api.Config{
-		Address:      cfg.URL,
-		RoundTripper: rt,
-	}
+func (c *Client) SetCredentials(creds Credentials) error {
+	return c.auth.SetCredentials(creds)
+}
 
-	client, err := api.NewClient(apiCfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create prometheus client: %w", err)
+func (c *Client) CircuitStatus() CircuitStatus {
+	return c.breaker.status()
+}
+
+func (c *Client) query(ctx context.Context, query string, ts time.Time) (model.Value, error) {
+	return withRetry(ctx, c.retry, c.breaker, func() (model.Value, error) {
+		result, _, err := c.api.Query(ctx, query, ts)
+		return result, err
+	})
+}
+
+func (c *Client) series(ctx context.Context, matches []string, start, end time.Time) ([]model.LabelSet, error) {
+	return withRetry(ctx, c.retry, c.breaker, func() ([]model.LabelSet, error) {
+		series, _, err := c.api.Series(ctx, matches, start, end)
+		return series, err
+	})
+}
+
+// selector wraps a series selector so it matches every series that reported
+// within the lookback window. last_over_time keeps the metric name, so the
+// result can still be grouped by __name__.
+func (c *Client) selector(sel string) string {
+	if c.lookback <= 0 {
+		return sel
 	}
+	return fmt.Sprintf("last_over_time(%s[%s])", sel, model.Duration(c.lookback))
+}
 
-	return &Client{
-		api: v1.NewAPI(client),
-	}, nil
+// seriesRange returns the bounds for Series calls; zero times let Prometheus
+// apply its own default.
+func (c *Client) seriesRange() (start, end time.Time) {
+	if c.lookback <= 0 {
+		return time.Time{}, time.Time{}
+	}
+	end = time.Now()
+	return end.Add(-c.lookback), end
 }
 
 func (c *Client) HealthCheck(ctx context.Context) error {
@@ -80,14 +211,26 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 }
 
 type ServiceInfo struct {
+	// Name is the service key: the discovery label values joined with
+	// ServiceKeySeparator.
 	Name        string
+	Labels      map[string]string
 	SeriesCount int
 }
 
-func (c *Client) DiscoverServices(ctx context.Context, serviceLabel string) ([]ServiceInfo, error) {
-	query := fmt.Sprintf(`count({%s!=""}) by (%s)`, serviceLabel, serviceLabel)
+// DiscoverServices counts series per distinct combination of the discovery
+// labels. Series missing any of the labels are not attributed to a service.
+func (c *Client) DiscoverServices(ctx context.Context, serviceLabels []string) ([]ServiceInfo, error) {
+	present := make([]string, len(serviceLabels))
+	for i, label := range serviceLabels {
+		present[i] = fmt.Sprintf(`%s!=""`, label)
+	}
+	query := fmt.Sprintf(`count(%s) by (%s)`,
+		c.selector("{"+strings.Join(present, ",")+"}"),
+		strings.Join(serviceLabels, ","),
+	)
 
-	result, _, err := c.api.Query(ctx, query, time.Now())
+	result, err := c.query(ctx, query, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to discover services: %w", err)
 	}
@@ -99,12 +242,18 @@ func (c *Client) DiscoverServices(ctx context.Context, serviceLabel string) ([]S
 
 	var services []ServiceInfo
 	for _, sample := range vector {
-		serviceName := string(sample.Metric[model.LabelName(serviceLabel)])
-		if serviceName == "" {
+		values := make([]string, len(serviceLabels))
+		labels := make(map[string]string, len(serviceLabels))
+		for i, label := range serviceLabels {
+			values[i] = string(sample.Metric[model.LabelName(label)])
+			labels[label] = values[i]
+		}
+		if slices.Contains(values, "") {
 			continue
 		}
 		services = append(services, ServiceInfo{
-			Name:        serviceName,
+			Name:        serviceKey(values),
+			Labels:      labels,
 			SeriesCount: int(sample.Value),
 		})
 	}
@@ -113,6 +262,14 @@ func (c *Client) DiscoverServices(ctx context.Context, serviceLabel string) ([]S
 		return services[i].SeriesCount > services[j].SeriesCount
 	})
 
+	known := make(map[string]map[string]string, len(services))
+	for _, svc := range services {
+		known[svc.Name] = svc.Labels
+	}
+	c.servicesMu.Lock()
+	c.services = known
+	c.servicesMu.Unlock()
+
 	return services, nil
 }
 
@@ -121,10 +278,10 @@ type MetricInfo struct {
 	SeriesCount int
 }
 
-func (c *Client) GetMetricsForService(ctx context.Context, serviceLabel, serviceName string) ([]MetricInfo, error) {
-	query := fmt.Sprintf(`count({%s="%s"}) by (__name__)`, serviceLabel, serviceName)
+func (c *Client) GetMetricsForService(ctx context.Context, serviceLabels []string, serviceName string) ([]MetricInfo, error) {
+	query := fmt.Sprintf(`count(%s) by (__name__)`, c.selector("{"+c.serviceMatchers(serviceLabels, serviceName)+"}"))
 
-	result, _, err := c.api.Query(ctx, query, time.Now())
+	result, err := c.query(ctx, query, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metrics for service %s: %w", serviceName, err)
 	}
@@ -153,64 +310,153 @@ func (c *Client) GetMetricsForService(ctx context.Context, serviceLabel, service
 	return metrics, nil
 }
 
+type LabelValueCount struct {
+	Value  string `json:"value"`
+	Series int    `json:"series"`
+}
+
+// TopLabelValues counts a metric's series per value of one label right
+// now, most common values first.
+func (c *Client) TopLabelValues(ctx context.Context, serviceLabels []string, serviceName, metricName, label string, limit int) ([]LabelValueCount, error) {
+	if !model.IsValidLegacyMetricName(metricName) {
+		return nil, fmt.Errorf("invalid metric name %q", metricName)
+	}
+	if !model.LabelName(label).IsValidLegacy() {
+		return nil, fmt.Errorf("invalid label name %q", label)
+	}
+	query := fmt.Sprintf(`topk(%d, count by (%s) (%s))`, limit, label, c.selector(c.seriesSelector(metricName, serviceLabels, serviceName, "")))
+
+	result, err := c.query(ctx, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count values of %s on %s: %w", label, metricName, err)
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	values := make([]LabelValueCount, 0, len(vector))
+	for _, sample := range vector {
+		values = append(values, LabelValueCount{
+			Value:  string(sample.Metric[model.LabelName(label)]),
+			Series: int(sample.Value),
+		})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Series > values[j].Series
+	})
+	return values, nil
+}
+
+// QuerySample is one series of an instant query result.
+type QuerySample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// InstantQuery runs expr as is at the current time. Callers are expected to
+// vet expr first; it must return an instant vector.
+func (c *Client) InstantQuery(ctx context.Context, expr string) ([]QuerySample, error) {
+	result, err := c.query(ctx, expr, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	samples := make([]QuerySample, 0, len(vector))
+	for _, sample := range vector {
+		labels := make(map[string]string, len(sample.Metric))
+		for name, value := range sample.Metric {
+			labels[string(name)] = string(value)
+		}
+		samples = append(samples, QuerySample{Labels: labels, Value: float64(sample.Value)})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Value > samples[j].Value
+	})
+	return samples, nil
+}
+
 type LabelInfo struct {
 	Name         string
 	UniqueValues int
 	SampleValues []string
+	// Truncated is set when the metric had more series than the max-series
+	// cap, so the counts only cover the series that were fetched.
+	Truncated bool
 }
 
-func (c *Client) GetLabelsForMetric(ctx context.Context, serviceLabel, serviceName, metricName string, sampleLimit int) ([]LabelInfo, error) {
-	selector := fmt.Sprintf(`%s{%s="%s"}`, metricName, serviceLabel, serviceName)
-
-	series, _, err := c.api.Series(ctx, []string{selector}, time.Time{}, time.Time{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get labels for %s: %w", metricName, err)
+// GetLabelsForMetric counts unique values per label across the metric's
+// series. On Mimir or Cortex the cardinality API reports exact counts
+// directly. Otherwise, when enabled, the label values API answers this
+// without fetching any series; failing that, or when the backend rejects
+// it, series are fetched and counted here. seriesCount is the metric's known
+// size; above the chunk size series are fetched in shards instead of one
+// call.
+func (c *Client) GetLabelsForMetric(ctx context.Context, serviceLabels []string, serviceName, metricName string, seriesCount, sampleLimit int) ([]LabelInfo, error) {
+	if c.cardinalityAPI {
+		labels, ok, err := c.labelsFromCardinalityAPI(ctx, c.seriesSelector(metricName, serviceLabels, serviceName, ""), serviceLabels, sampleLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get labels for %s: %w", metricName, err)
+		}
+		if ok {
+			return labels, nil
+		}
 	}
 
-	labelValues := make(map[string]map[string]struct{})
-	for _, s := range series {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
+	values := make(labelValueSet)
 
-		for label, value := range s {
-			labelName := string(label)
-			if labelName == "__name__" || labelName == serviceLabel {
-				continue
-			}
-			if _, ok := labelValues[labelName]; !ok {
-				labelValues[labelName] = make(map[string]struct{})
-			}
-			labelValues[labelName][string(value)] = struct{}{}
+	useSeries := !c.labelValuesAPI
+	if c.labelValuesAPI {
+		err := c.labelsFromValuesAPI(ctx, c.seriesSelector(metricName, serviceLabels, serviceName, ""), serviceLabels, values)
+		switch {
+		case err == nil:
+		case isRetryable(ctx, err) || ctx.Err() != nil:
+			return nil, fmt.Errorf("failed to get labels for %s: %w", metricName, err)
+		default:
+			// The backend answered but refused the request, most likely
+			// because it doesn't support match[] on label values.
+			values = make(labelValueSet)
+			useSeries = true
 		}
 	}
 
-	var labels []LabelInfo
-	for name, values := range labelValues {
-		var samples []string
-		for v := range values {
-			samples = append(samples, v)
-			if len(samples) >= sampleLimit {
-				break
-			}
+	var truncated bool
+	if useSeries {
+		var err error
+		truncated, err = c.labelsFromSeries(ctx, metricName, serviceLabels, serviceName, seriesCount, values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get labels for %s: %w", metricName, err)
 		}
+	}
 
-		sort.Strings(samples)
+	return values.labelInfos(sampleLimit, truncated), nil
+}
 
-		labels = append(labels, LabelInfo{
-			Name:         name,
-			UniqueValues: len(values),
-			SampleValues: samples,
-		})
+// LabelQueries estimates how many requests GetLabelsForMetric makes for a
+// metric with seriesCount series and labelCount labels, ignoring retries
+// and fallbacks.
+func (c *Client) LabelQueries(seriesCount, labelCount int) int {
+	switch {
+	case c.cardinalityAPI && c.cardinality.Load() != cardinalityUnavailable:
+		return 2
+	case c.labelValuesAPI:
+		return 1 + labelCount
+	case seriesCount <= c.seriesChunkSize:
+		return 1
 	}
 
-	sort.Slice(labels, func(i, j int) bool {
-		return labels[i].UniqueValues > labels[j].UniqueValues
-	})
-
-	return labels, nil
+	// Finding the shard label reads every label's values, then one call
+	// per chunk and one for series without the label.
+	fetched := seriesCount
+	if c.maxSeries > 0 {
+		fetched = min(fetched, c.maxSeries)
+	}
+	chunks := (fetched + c.seriesChunkSize - 1) / c.seriesChunkSize
+	return 1 + labelCount + chunks + 1
 }
 
 type basicAuthTransport struct {
@@ -224,3 +470,7 @@ func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error
 	req.SetBasicAuth(t.username, t.password)
 	return t.transport.RoundTrip(req)
 }
+
+func (t *basicAuthTransport) CloseIdleConnections() {
+	closeIdleConnections(t.transport)
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Credentials are the auth settings a running client can swap, e.g. when a
+// leased secret was read again.
+type Credentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// authTransport forwards to the transport built by newRoundTripper and
+// rebuilds it when the credentials change.
+type authTransport struct {
+	mu      sync.RWMutex
+	cfg     Config
+	timeout time.Duration
+	rt      http.RoundTripper
+}
+
+func newAuthTransport(cfg Config, timeout time.Duration) (*authTransport, error) {
+	rt, err := newRoundTripper(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &authTransport{cfg: cfg, timeout: timeout, rt: rt}, nil
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	rt := t.rt
+	t.mu.RUnlock()
+	return rt.RoundTrip(req)
+}
+
+// SetCredentials takes effect for the next request; requests in flight
+// finish with the old ones, and the old transport's idle connections are
+// closed. Unchanged credentials are a no-op.
+func (t *authTransport) SetCredentials(creds Credentials) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cfg.Username == creds.Username && t.cfg.Password == creds.Password && t.cfg.BearerToken == creds.BearerToken {
+		return nil
+	}
+	cfg := t.cfg
+	cfg.Username, cfg.Password, cfg.BearerToken = creds.Username, creds.Password, creds.BearerToken
+	rt, err := newRoundTripper(cfg, t.timeout)
+	if err != nil {
+		return err
+	}
+	old := t.rt
+	t.cfg, t.rt = cfg, rt
+	closeIdleConnections(old)
+	return nil
+}
+
+// closeIdleConnections closes rt's idle connections if it keeps any.
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// expositionAccept asks for delimited protobuf first, which is cheaper to
+// parse, and falls back to the text format.
+const expositionAccept = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// decodeExposition reads every series from a /metrics or /federate body.
+// Histograms and summaries are expanded into their _bucket, _sum, _count
+// and quantile series, the way Prometheus stores them. extra labels are
+// added to every series without overriding exposed ones, like a scrape's
+// target labels with honor_labels.
+func decodeExposition(r io.Reader, format expfmt.Format, extra model.LabelSet) ([]model.LabelSet, map[string]MetricMetadata, error) {
+	dec := expfmt.NewDecoder(r, format)
+
+	var series []model.LabelSet
+	metadata := make(map[string]MetricMetadata)
+	opts := &expfmt.DecodeOptions{Timestamp: model.Now()}
+
+	for {
+		var fam dto.MetricFamily
+		if err := dec.Decode(&fam); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, fmt.Errorf("decode exposition: %w", err)
+		}
+
+		if md, ok := familyMetadata(&fam); ok {
+			metadata[fam.GetName()] = md
+		}
+
+		samples, err := expfmt.ExtractSamples(opts, &fam)
+		if err != nil {
+			return nil, nil, fmt.Errorf("extract samples of %s: %w", fam.GetName(), err)
+		}
+		for _, s := range samples {
+			ls := model.LabelSet(s.Metric)
+			for name, value := range extra {
+				if _, ok := ls[name]; !ok {
+					ls[name] = value
+				}
+			}
+			series = append(series, ls)
+		}
+	}
+
+	return series, metadata, nil
+}
+
+// familyMetadata skips untyped families without help, which is all
+// /federate reports for most series.
+func familyMetadata(fam *dto.MetricFamily) (MetricMetadata, bool) {
+	typ := strings.ToLower(fam.GetType().String())
+	if typ == "untyped" {
+		typ = ""
+	}
+	if typ == "" && fam.GetHelp() == "" {
+		return MetricMetadata{}, false
+	}
+	return MetricMetadata{Type: typ, Help: fam.GetHelp(), Unit: fam.GetUnit()}, true
+}
@@ -0,0 +1,113 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultFederateMatch selects every series on the server.
+const DefaultFederateMatch = `{__name__=~".+"}`
+
+// FederationClient computes cardinality from the /federate endpoint instead
+// of running count() queries, for servers where heavy queries are not
+// allowed. /federate returns the latest sample of every matching series, so
+// the Lookback and label values settings do not apply.
+type FederationClient struct {
+	indexClient
+
+	http    *http.Client
+	auth    *authTransport
+	baseURL string
+	match   []string
+	retry   RetryConfig
+	breaker *breaker
+}
+
+func NewFederationClient(cfg Config, match []string) (*FederationClient, error) {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	if len(match) == 0 {
+		match = []string{DefaultFederateMatch}
+	}
+
+	auth, err := newAuthTransport(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FederationClient{
+		http:    &http.Client{Transport: auth, Timeout: timeout},
+		auth:    auth,
+		baseURL: strings.TrimSuffix(cfg.URL, "/"),
+		match:   match,
+		retry:   cfg.Retry.withDefaults(),
+		breaker: newBreaker(cfg.Breaker),
+	}
+	c.indexClient = indexClient{load: c.federate, skipLabels: skipSet(cfg.SkipLabels)}
+	return c, nil
+}
+
+func (c *FederationClient) SetCredentials(creds Credentials) error {
+	return c.auth.SetCredentials(creds)
+}
+
+func (c *FederationClient) CircuitStatus() CircuitStatus {
+	return c.breaker.status()
+}
+
+func (c *FederationClient) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/-/healthy", nil)
+	if err != nil {
+		return fmt.Errorf("prometheus health check failed: %w", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("prometheus health check failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("prometheus health check failed: %w", &httpStatusError{url: req.URL.String(), code: resp.StatusCode})
+	}
+	return nil
+}
+
+func (c *FederationClient) federate(ctx context.Context) (*seriesIndex, error) {
+	query := url.Values{"match[]": c.match}
+	target := c.baseURL + "/federate?" + query.Encode()
+
+	idx, err := withRetry(ctx, c.retry, c.breaker, func() (*seriesIndex, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", expositionAccept)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, &httpStatusError{url: c.baseURL + "/federate", code: resp.StatusCode}
+		}
+
+		series, metadata, err := decodeExposition(resp.Body, expfmt.ResponseFormat(resp.Header), nil)
+		if err != nil {
+			return nil, err
+		}
+		return newSeriesIndex(series, metadata), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to federate: %w", err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,266 @@
+package prometheus
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// indexReuse is how long a loaded index answers calls that would otherwise
+// reload it. A scan reads the TSDB status and then discovers services right
+// away; both should see the same scrape.
+const indexReuse = 30 * time.Second
+
+// seriesIndex holds every series of one scrape, so cardinality is computed
+// in memory instead of with queries.
+type seriesIndex struct {
+	series   []model.LabelSet
+	metadata map[string]MetricMetadata
+
+	mu        sync.Mutex
+	byService map[string]map[string]map[string][]model.LabelSet // label set -> service -> metric
+}
+
+func newSeriesIndex(series []model.LabelSet, metadata map[string]MetricMetadata) *seriesIndex {
+	return &seriesIndex{
+		series:    series,
+		metadata:  metadata,
+		byService: make(map[string]map[string]map[string][]model.LabelSet),
+	}
+}
+
+// grouped returns the series bucketed by service and metric for one set of
+// discovery labels, building it on first use. Series missing any of the
+// labels are not attributed to a service.
+func (idx *seriesIndex) grouped(serviceLabels []string) map[string]map[string][]model.LabelSet {
+	key := serviceKey(serviceLabels)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if g, ok := idx.byService[key]; ok {
+		return g
+	}
+
+	g := make(map[string]map[string][]model.LabelSet)
+	values := make([]string, len(serviceLabels))
+	for _, ls := range idx.series {
+		for i, label := range serviceLabels {
+			values[i] = string(ls[model.LabelName(label)])
+		}
+		if slices.Contains(values, "") {
+			continue
+		}
+		name := serviceKey(values)
+		if g[name] == nil {
+			g[name] = make(map[string][]model.LabelSet)
+		}
+		metric := string(ls[model.MetricNameLabel])
+		g[name][metric] = append(g[name][metric], ls)
+	}
+	idx.byService[key] = g
+	return g
+}
+
+func (idx *seriesIndex) services(serviceLabels []string) []ServiceInfo {
+	var services []ServiceInfo
+	for name, metrics := range idx.grouped(serviceLabels) {
+		count := 0
+		var sample model.LabelSet
+		for _, series := range metrics {
+			count += len(series)
+			sample = series[0]
+		}
+		labels := make(map[string]string, len(serviceLabels))
+		for _, label := range serviceLabels {
+			labels[label] = string(sample[model.LabelName(label)])
+		}
+		services = append(services, ServiceInfo{
+			Name:        name,
+			Labels:      labels,
+			SeriesCount: count,
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].SeriesCount > services[j].SeriesCount
+	})
+	return services
+}
+
+func (idx *seriesIndex) metrics(serviceLabels []string, serviceName string) []MetricInfo {
+	var metrics []MetricInfo
+	for name, series := range idx.grouped(serviceLabels)[serviceName] {
+		if name == "" {
+			continue
+		}
+		metrics = append(metrics, MetricInfo{Name: name, SeriesCount: len(series)})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].SeriesCount > metrics[j].SeriesCount
+	})
+	return metrics
+}
+
+func (idx *seriesIndex) labels(ctx context.Context, serviceLabels []string, serviceName, metricName string, skipLabels map[string]struct{}, sampleLimit int) ([]LabelInfo, error) {
+	values := make(labelValueSet)
+	series := idx.grouped(serviceLabels)[serviceName][metricName]
+	err := values.add(ctx, series, func(name string) bool {
+		return skipLabel(name, serviceLabels, skipLabels)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values.labelInfos(sampleLimit, false), nil
+}
+
+// tsdbStatus reports the same head stats Prometheus would, computed over
+// the scraped series. There are no chunks or time range to report.
+func (idx *seriesIndex) tsdbStatus() *TSDBStatus {
+	perMetric := make(map[string]uint64)
+	perLabel := make(map[string]map[string]struct{})
+	pairs := 0
+	for _, ls := range idx.series {
+		perMetric[string(ls[model.MetricNameLabel])]++
+		for name, value := range ls {
+			if perLabel[string(name)] == nil {
+				perLabel[string(name)] = make(map[string]struct{})
+			}
+			if _, ok := perLabel[string(name)][string(value)]; !ok {
+				perLabel[string(name)][string(value)] = struct{}{}
+				pairs++
+			}
+		}
+	}
+
+	perLabelCount := make(map[string]uint64, len(perLabel))
+	for name, vals := range perLabel {
+		perLabelCount[name] = uint64(len(vals))
+	}
+
+	return &TSDBStatus{
+		HeadSeries:     len(idx.series),
+		HeadLabelPairs: pairs,
+		TopMetrics:     topStats(perMetric),
+		TopLabelNames:  topStats(perLabelCount),
+	}
+}
+
+func topStats(counts map[string]uint64) []TSDBStat {
+	stats := make([]TSDBStat, 0, len(counts))
+	for name, value := range counts {
+		stats = append(stats, TSDBStat{Name: name, Value: value})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Value != stats[j].Value {
+			return stats[i].Value > stats[j].Value
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	if len(stats) > tsdbStatusLimit {
+		stats = stats[:tsdbStatusLimit]
+	}
+	return stats
+}
+
+// indexClient implements the cardinality half of MetricsClient over a
+// scraped seriesIndex. Service discovery and the TSDB status, the first
+// calls of a scan, load a fresh index; the per-service calls that follow
+// reuse it so the whole scan sees one scrape.
+type indexClient struct {
+	load       func(ctx context.Context) (*seriesIndex, error)
+	skipLabels map[string]struct{}
+
+	mu       sync.Mutex
+	index    *seriesIndex
+	loadedAt time.Time
+}
+
+func (c *indexClient) current(ctx context.Context, refresh bool) (*seriesIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil && (!refresh || time.Since(c.loadedAt) < indexReuse) {
+		return c.index, nil
+	}
+
+	idx, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.index, c.loadedAt = idx, time.Now()
+	return idx, nil
+}
+
+func (c *indexClient) DiscoverServices(ctx context.Context, serviceLabels []string) ([]ServiceInfo, error) {
+	idx, err := c.current(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return idx.services(serviceLabels), nil
+}
+
+func (c *indexClient) GetMetricsForService(ctx context.Context, serviceLabels []string, serviceName string) ([]MetricInfo, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.metrics(serviceLabels, serviceName), nil
+}
+
+func (c *indexClient) GetLabelsForMetric(ctx context.Context, serviceLabels []string, serviceName, metricName string, _, sampleLimit int) ([]LabelInfo, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.labels(ctx, serviceLabels, serviceName, metricName, c.skipLabels, sampleLimit)
+}
+
+func (c *indexClient) GetMetadata(ctx context.Context) (map[string]MetricMetadata, error) {
+	idx, err := c.current(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.metadata, nil
+}
+
+// CountExemplars always reports none: exemplars are only exposed in the
+// OpenMetrics format, which neither /federate nor the decoder here speak.
+func (c *indexClient) CountExemplars(context.Context, []string, string, string) (int, error) {
+	return 0, nil
+}
+
+func (c *indexClient) GetTSDBStatus(ctx context.Context) (*TSDBStatus, error) {
+	idx, err := c.current(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return idx.tsdbStatus(), nil
+}
+
+// SeriesClient answers a scan from series listed by some other backend,
+// for those that can enumerate their series but not count them by query.
+// There is no metadata; the TSDB status is computed over the series.
+type SeriesClient struct {
+	indexClient
+}
+
+// NewSeriesClient wraps load, which returns every series with __name__
+// set. It is called once per scan.
+func NewSeriesClient(load func(ctx context.Context) ([]model.LabelSet, error), skipLabels []string) *SeriesClient {
+	return &SeriesClient{indexClient{
+		load: func(ctx context.Context) (*seriesIndex, error) {
+			series, err := load(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return newSeriesIndex(series, nil), nil
+		},
+		skipLabels: skipSet(skipLabels),
+	}}
+}
@@ -0,0 +1,95 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+const exemplarLookback = time.Hour
+
+type MetricMetadata struct {
+	Type string
+	Help string
+	Unit string
+}
+
+func (c *Client) GetMetadata(ctx context.Context) (map[string]MetricMetadata, error) {
+	result, err := withRetry(ctx, c.retry, c.breaker, func() (map[string][]v1.Metadata, error) {
+		return c.api.Metadata(ctx, "", "")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metric metadata: %w", err)
+	}
+
+	metadata := make(map[string]MetricMetadata, len(result))
+	for name, entries := range result {
+		if len(entries) == 0 {
+			continue
+		}
+		metadata[name] = MetricMetadata{
+			Type: string(entries[0].Type),
+			Help: entries[0].Help,
+			Unit: entries[0].Unit,
+		}
+	}
+
+	return metadata, nil
+}
+
+func (c *Client) CountExemplars(ctx context.Context, serviceLabels []string, serviceName, metricName string) (int, error) {
+	selector := c.seriesSelector(metricName, serviceLabels, serviceName, "")
+
+	end := time.Now()
+	results, err := withRetry(ctx, c.retry, c.breaker, func() ([]v1.ExemplarQueryResult, error) {
+		return c.api.QueryExemplars(ctx, selector, end.Add(-exemplarLookback), end)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query exemplars for %s: %w", metricName, err)
+	}
+
+	count := 0
+	for _, r := range results {
+		count += len(r.Exemplars)
+	}
+	return count, nil
+}
+
+// classicHistogramSuffixes are the series suffixes a classic histogram or
+// summary family is exposed under; metadata is keyed by the family name.
+var classicHistogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// LookupMetadata finds the metadata for a series name. Native histograms are
+// stored under the bare family name, so a histogram-typed family matched
+// without stripping a suffix is reported as native.
+func LookupMetadata(metricName string, metadata map[string]MetricMetadata) (md MetricMetadata, native bool) {
+	if md, ok := metadata[metricName]; ok {
+		return md, md.Type == "histogram"
+	}
+
+	for _, suffix := range classicHistogramSuffixes {
+		if base, ok := strings.CutSuffix(metricName, suffix); ok {
+			if md, ok := metadata[base]; ok {
+				return md, false
+			}
+		}
+	}
+
+	if base, ok := strings.CutSuffix(metricName, "_total"); ok {
+		if md, ok := metadata[base]; ok {
+			return md, false
+		}
+	}
+
+	return MetricMetadata{}, false
+}
+
+// IsClassicHistogramBucket reports whether the series is the _bucket part of
+// a classic histogram, where every label combination is multiplied by the
+// number of le buckets.
+func IsClassicHistogramBucket(metricName, metricType string) bool {
+	return metricType == "histogram" && strings.HasSuffix(metricName, "_bucket")
+}
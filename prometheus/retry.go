@@ -0,0 +1,126 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 3
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = 500 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 10 * time.Second
+	}
+	return r
+}
+
+// withRetry runs fn until it succeeds, returns a non-retryable error, or the
+// attempt budget is used up. Backoff is exponential with full jitter. Every
+// attempt goes through the circuit breaker, which may hold it back while
+// Prometheus is failing.
+func withRetry[T any](ctx context.Context, cfg RetryConfig, b *breaker, fn func() (T, error)) (T, error) {
+	var result T
+	var err error
+
+	for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
+		if err := b.wait(ctx); err != nil {
+			return result, err
+		}
+		result, err = fn()
+		b.record(ctx, err)
+		if err == nil || !isRetryable(ctx, err) || attempt == cfg.MaxAttempts-1 {
+			return result, err
+		}
+
+		backoff := time.Duration(rand.Int64N(int64(backoffCeiling(cfg, attempt)) + 1))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+
+	return result, err
+}
+
+// backoffCeiling is the upper bound of the jittered wait after the given
+// attempt: InitialBackoff doubled per attempt, stopping at MaxBackoff so a
+// large attempt count can't overflow the shift.
+func backoffCeiling(cfg RetryConfig, attempt int) time.Duration {
+	backoff := cfg.InitialBackoff
+	for i := 0; i < attempt && backoff < cfg.MaxBackoff; i++ {
+		if backoff > cfg.MaxBackoff/2 {
+			return cfg.MaxBackoff
+		}
+		backoff *= 2
+	}
+	return min(backoff, cfg.MaxBackoff)
+}
+
+// httpStatusError is a non-2xx answer from an endpoint read without the
+// Prometheus API client, such as /federate or a target's /metrics.
+type httpStatusError struct {
+	url  string
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %d", e.url, e.code)
+}
+
+func isRetryable(ctx context.Context, err error) bool {
+	// The caller gave up; retrying cannot help.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *v1.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Type {
+		case v1.ErrServer, v1.ErrTimeout, v1.ErrBadResponse:
+			return true
+		case v1.ErrClient:
+			return strings.Contains(apiErr.Msg, "429")
+		default:
+			return false
+		}
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,37 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffCeiling(t *testing.T) {
+	cfg := RetryConfig{InitialBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		name    string
+		cfg     RetryConfig
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first retry", cfg: cfg, attempt: 0, want: 500 * time.Millisecond},
+		{name: "doubles", cfg: cfg, attempt: 1, want: time.Second},
+		{name: "doubles again", cfg: cfg, attempt: 3, want: 4 * time.Second},
+		{name: "reaches max", cfg: cfg, attempt: 5, want: 10 * time.Second},
+		{name: "stays at max", cfg: cfg, attempt: 40, want: 10 * time.Second},
+		{name: "attempt past shift width", cfg: cfg, attempt: 1000, want: 10 * time.Second},
+		{name: "initial above max", cfg: RetryConfig{InitialBackoff: time.Minute, MaxBackoff: time.Second}, attempt: 0, want: time.Second},
+		{
+			name:    "huge max",
+			cfg:     RetryConfig{InitialBackoff: time.Second, MaxBackoff: time.Duration(1<<63 - 1)},
+			attempt: 200,
+			want:    time.Duration(1<<63 - 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoffCeiling(tt.cfg, tt.attempt); got != tt.want {
+				t.Errorf("backoffCeiling(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// ScrapeTarget is one /metrics endpoint and the labels its series are
+// attributed with, such as job or namespace.
+type ScrapeTarget struct {
+	URL    string
+	Labels map[string]string
+}
+
+// TargetSource lists the endpoints to scrape; it is called once per scan.
+type TargetSource func(ctx context.Context) ([]ScrapeTarget, error)
+
+// StaticTargets is a TargetSource for a fixed list.
+func StaticTargets(targets []ScrapeTarget) TargetSource {
+	return func(context.Context) ([]ScrapeTarget, error) {
+		return targets, nil
+	}
+}
+
+type ScrapeConfig struct {
+	// Sources are combined; a source that fails fails the scan.
+	Sources []TargetSource
+	// Timeout bounds a single target scrape.
+	Timeout time.Duration
+	// Concurrency is how many targets are scraped at once.
+	Concurrency int
+	TLS         TLSConfig
+	SkipLabels  []string
+}
+
+// ScrapeClient computes cardinality by scraping application endpoints
+// directly, so it works before the metrics ever reach Prometheus. Each
+// series gets its target's labels plus instance, as a scrape would. A
+// target that cannot be scraped is logged and left out; the scan only fails
+// when none can.
+type ScrapeClient struct {
+	indexClient
+
+	http        *http.Client
+	sources     []TargetSource
+	concurrency int
+}
+
+func NewScrapeClient(cfg ScrapeConfig) (*ScrapeClient, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 10
+	}
+
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("scrape tls: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	c := &ScrapeClient{
+		http:        &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		sources:     cfg.Sources,
+		concurrency: cfg.Concurrency,
+	}
+	c.indexClient = indexClient{load: c.scrapeAll, skipLabels: skipSet(cfg.SkipLabels)}
+	return c, nil
+}
+
+// CircuitStatus is always closed: a failing target only drops that target.
+func (c *ScrapeClient) CircuitStatus() CircuitStatus {
+	return CircuitStatus{State: CircuitClosed}
+}
+
+// HealthCheck passes when at least one target is configured or discovered.
+func (c *ScrapeClient) HealthCheck(ctx context.Context) error {
+	targets, err := c.targets(ctx)
+	if err != nil {
+		return fmt.Errorf("scrape health check failed: %w", err)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("scrape health check failed: no targets")
+	}
+	return nil
+}
+
+func (c *ScrapeClient) targets(ctx context.Context) ([]ScrapeTarget, error) {
+	var targets []ScrapeTarget
+	for _, source := range c.sources {
+		found, err := source(ctx)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, found...)
+	}
+	return targets, nil
+}
+
+func (c *ScrapeClient) scrapeAll(ctx context.Context) (*seriesIndex, error) {
+	targets, err := c.targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scrape targets: %w", err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no scrape targets")
+	}
+
+	var (
+		mu       sync.Mutex
+		series   []model.LabelSet
+		metadata = make(map[string]MetricMetadata)
+		failed   []error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, c.concurrency)
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			got, md, err := c.scrape(ctx, target)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				slog.Warn("failed to scrape target", "url", target.URL, "error", err)
+				failed = append(failed, err)
+				return
+			}
+			series = append(series, got...)
+			for name, m := range md {
+				metadata[name] = m
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) == len(targets) {
+		return nil, fmt.Errorf("all %d scrape targets failed: %w", len(targets), errors.Join(failed...))
+	}
+	return newSeriesIndex(series, metadata), nil
+}
+
+func (c *ScrapeClient) scrape(ctx context.Context, target ScrapeTarget) ([]model.LabelSet, map[string]MetricMetadata, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid target url: %w", err)
+	}
+
+	extra := model.LabelSet{model.InstanceLabel: model.LabelValue(u.Host)}
+	for name, value := range target.Labels {
+		extra[model.LabelName(name)] = model.LabelValue(value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", expositionAccept)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &httpStatusError{url: target.URL, code: resp.StatusCode}
+	}
+	return decodeExposition(resp.Body, expfmt.ResponseFormat(resp.Header), extra)
+}
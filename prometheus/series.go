@@ -0,0 +1,256 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// labelValueSet collects the distinct values seen per label name.
+type labelValueSet map[string]map[string]struct{}
+
+func (s labelValueSet) add(ctx context.Context, series []model.LabelSet, skip func(string) bool) error {
+	for _, ls := range series {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for label, value := range ls {
+			labelName := string(label)
+			if skip(labelName) {
+				continue
+			}
+			if _, ok := s[labelName]; !ok {
+				s[labelName] = make(map[string]struct{})
+			}
+			s[labelName][string(value)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// labelInfos turns the collected values into per-label stats, highest
+// cardinality first, keeping up to sampleLimit sorted sample values each.
+func (s labelValueSet) labelInfos(sampleLimit int, truncated bool) []LabelInfo {
+	var labels []LabelInfo
+	for name, vals := range s {
+		var samples []string
+		for v := range vals {
+			samples = append(samples, v)
+			if len(samples) >= sampleLimit {
+				break
+			}
+		}
+
+		sort.Strings(samples)
+
+		labels = append(labels, LabelInfo{
+			Name:         name,
+			UniqueValues: len(vals),
+			SampleValues: samples,
+			Truncated:    truncated,
+		})
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].UniqueValues > labels[j].UniqueValues
+	})
+
+	return labels
+}
+
+func skipSet(names []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+// skipLabel reports whether a label is left out of the cardinality stats:
+// the metric name and service labels always are, plus the configured list.
+func skipLabel(name string, serviceLabels []string, extra map[string]struct{}) bool {
+	if name == "__name__" || isServiceLabel(name, serviceLabels) {
+		return true
+	}
+	_, ok := extra[name]
+	return ok
+}
+
+func (c *Client) skipLabel(name string, serviceLabels []string) bool {
+	return skipLabel(name, serviceLabels, c.skipLabels)
+}
+
+// labelsFromValuesAPI fills values from the label names and label values
+// endpoints, which return only the distinct values rather than every series.
+func (c *Client) labelsFromValuesAPI(ctx context.Context, selector string, serviceLabels []string, values labelValueSet) error {
+	start, end := c.seriesRange()
+
+	names, err := c.labelNames(ctx, selector, start, end)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if c.skipLabel(name, serviceLabels) {
+			continue
+		}
+
+		vals, err := c.labelValues(ctx, name, selector, start, end)
+		if err != nil {
+			return err
+		}
+		set := make(map[string]struct{}, len(vals))
+		for _, v := range vals {
+			set[v] = struct{}{}
+		}
+		values[name] = set
+	}
+	return nil
+}
+
+// labelsFromSeries fills values by fetching the metric's series, in shards
+// when it is bigger than the chunk size. Either way at most the max-series
+// cap is used, and truncated reports whether any were left out.
+func (c *Client) labelsFromSeries(ctx context.Context, metricName string, serviceLabels []string, serviceName string, seriesCount int, values labelValueSet) (truncated bool, err error) {
+	if seriesCount > c.seriesChunkSize {
+		return c.seriesChunked(ctx, metricName, serviceLabels, serviceName, seriesCount, values)
+	}
+
+	start, end := c.seriesRange()
+	series, err := c.series(ctx, []string{c.seriesSelector(metricName, serviceLabels, serviceName, "")}, start, end)
+	if err != nil {
+		return false, err
+	}
+	series, truncated = capSeries(series, 0, c.maxSeries)
+	return truncated, values.add(ctx, series, func(name string) bool { return c.skipLabel(name, serviceLabels) })
+}
+
+// capSeries cuts series so that, on top of the already fetched ones, no
+// more than maxSeries are used; 0 means no cap. It reports whether any
+// were cut.
+func capSeries(series []model.LabelSet, fetched, maxSeries int) ([]model.LabelSet, bool) {
+	if maxSeries <= 0 || fetched+len(series) <= maxSeries {
+		return series, false
+	}
+	return series[:max(0, maxSeries-fetched)], true
+}
+
+// seriesChunked fetches a metric's series in shards over the values of its
+// highest-cardinality label, so no single call has to return more than
+// roughly the chunk size. It stops once the max-series cap is reached and
+// reports whether anything was left out.
+func (c *Client) seriesChunked(ctx context.Context, metricName string, serviceLabels []string, serviceName string, seriesCount int, values labelValueSet) (truncated bool, err error) {
+	selector := c.seriesSelector(metricName, serviceLabels, serviceName, "")
+	start, end := c.seriesRange()
+
+	shardLabel, shardValues, err := c.shardLabel(ctx, selector, serviceLabels, start, end)
+	if err != nil {
+		return false, err
+	}
+	if len(shardValues) < 2 {
+		// Nothing to shard on; the only option left is one big call.
+		series, err := c.series(ctx, []string{selector}, start, end)
+		if err != nil {
+			return false, err
+		}
+		series, truncated = capSeries(series, 0, c.maxSeries)
+		return truncated, values.add(ctx, series, func(name string) bool { return c.skipLabel(name, serviceLabels) })
+	}
+
+	perChunk := max(1, len(shardValues)*c.seriesChunkSize/seriesCount)
+
+	var matchers []string
+	for i := 0; i < len(shardValues); i += perChunk {
+		chunk := shardValues[i:min(i+perChunk, len(shardValues))]
+		quoted := make([]string, len(chunk))
+		for j, v := range chunk {
+			quoted[j] = regexp.QuoteMeta(v)
+		}
+		matchers = append(matchers, fmt.Sprintf(`%s=~%q`, shardLabel, strings.Join(quoted, "|")))
+	}
+	// Series without the shard label are not covered by any value matcher.
+	matchers = append(matchers, fmt.Sprintf(`%s=""`, shardLabel))
+
+	fetched := 0
+	for _, m := range matchers {
+		if c.maxSeries > 0 && fetched >= c.maxSeries {
+			return true, nil
+		}
+
+		series, err := c.series(ctx, []string{c.seriesSelector(metricName, serviceLabels, serviceName, m)}, start, end)
+		if err != nil {
+			return false, err
+		}
+		series, cut := capSeries(series, fetched, c.maxSeries)
+		fetched += len(series)
+		if err := values.add(ctx, series, func(name string) bool { return c.skipLabel(name, serviceLabels) }); err != nil {
+			return false, err
+		}
+		if cut {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// shardLabel picks the label with the most values for the selector, which
+// splits the metric into the most evenly sized shards. Labels on the skip
+// list are fair game here: they are often the best shard keys.
+func (c *Client) shardLabel(ctx context.Context, selector string, serviceLabels []string, start, end time.Time) (string, []string, error) {
+	names, err := c.labelNames(ctx, selector, start, end)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var best string
+	var bestValues []string
+	for _, name := range names {
+		if name == "__name__" || isServiceLabel(name, serviceLabels) {
+			continue
+		}
+
+		vals, err := c.labelValues(ctx, name, selector, start, end)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(vals) > len(bestValues) {
+			best, bestValues = name, vals
+		}
+	}
+
+	return best, bestValues, nil
+}
+
+func (c *Client) labelNames(ctx context.Context, selector string, start, end time.Time) ([]string, error) {
+	names, err := withRetry(ctx, c.retry, c.breaker, func() ([]string, error) {
+		names, _, err := c.api.LabelNames(ctx, []string{selector}, start, end)
+		return names, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list label names: %w", err)
+	}
+	return names, nil
+}
+
+func (c *Client) labelValues(ctx context.Context, name, selector string, start, end time.Time) ([]string, error) {
+	vals, err := withRetry(ctx, c.retry, c.breaker, func() (model.LabelValues, error) {
+		vals, _, err := c.api.LabelValues(ctx, name, []string{selector}, start, end)
+		return vals, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list values of %s: %w", name, err)
+	}
+
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		out[i] = string(v)
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestCapSeries(t *testing.T) {
+	series := make([]model.LabelSet, 5)
+	tests := []struct {
+		name          string
+		fetched       int
+		maxSeries     int
+		wantLen       int
+		wantTruncated bool
+	}{
+		{name: "no cap", maxSeries: 0, wantLen: 5},
+		{name: "under cap", maxSeries: 10, wantLen: 5},
+		{name: "exactly at cap", maxSeries: 5, wantLen: 5},
+		{name: "over cap", maxSeries: 3, wantLen: 3, wantTruncated: true},
+		{name: "partly fetched", fetched: 4, maxSeries: 6, wantLen: 2, wantTruncated: true},
+		{name: "fits after fetched", fetched: 1, maxSeries: 6, wantLen: 5},
+		{name: "cap already reached", fetched: 6, maxSeries: 6, wantLen: 0, wantTruncated: true},
+		{name: "cap already exceeded", fetched: 9, maxSeries: 6, wantLen: 0, wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := capSeries(series, tt.fetched, tt.maxSeries)
+			if len(got) != tt.wantLen || truncated != tt.wantTruncated {
+				t.Errorf("capSeries(5 series, %d, %d) = %d series, %v; want %d, %v",
+					tt.fetched, tt.maxSeries, len(got), truncated, tt.wantLen, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestCapSeriesEmpty(t *testing.T) {
+	got, truncated := capSeries(nil, 3, 3)
+	if len(got) != 0 || truncated {
+		t.Errorf("capSeries(nil, 3, 3) = %d series, %v; want 0, false", len(got), truncated)
+	}
+}
@@ -0,0 +1,74 @@
+package prometheus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ServiceKeySeparator joins the values of a multi-label service key, e.g.
+// "payments/api" for namespace=payments, app=api.
+const ServiceKeySeparator = "/"
+
+// serviceKey builds the service name from the discovery label values in
+// configured order.
+func serviceKey(values []string) string {
+	return strings.Join(values, ServiceKeySeparator)
+}
+
+// serviceMatchers renders the equality matchers selecting one service from
+// its discovery label values.
+func serviceMatchers(serviceLabels []string, labels map[string]string) string {
+	matchers := make([]string, len(serviceLabels))
+	for i, label := range serviceLabels {
+		matchers[i] = fmt.Sprintf("%s=%q", label, labels[label])
+	}
+	return strings.Join(matchers, ",")
+}
+
+// splitServiceKey recovers the label values from a service name, for names
+// the client hasn't discovered itself. A value containing the separator
+// makes this ambiguous; the last label takes whatever is left, so at least
+// a single-label setup keeps such names intact.
+func splitServiceKey(serviceLabels []string, serviceName string) map[string]string {
+	values := strings.SplitN(serviceName, ServiceKeySeparator, len(serviceLabels))
+	labels := make(map[string]string, len(serviceLabels))
+	for i, label := range serviceLabels {
+		if i < len(values) {
+			labels[label] = values[i]
+		} else {
+			labels[label] = ""
+		}
+	}
+	return labels
+}
+
+// serviceLabelValues returns the label values of a service: those stored
+// by the last discovery, which are exact, or else split from its name.
+func (c *Client) serviceLabelValues(serviceLabels []string, serviceName string) map[string]string {
+	c.servicesMu.RLock()
+	labels, ok := c.services[serviceName]
+	c.servicesMu.RUnlock()
+	if ok && len(labels) == len(serviceLabels) && !slices.ContainsFunc(serviceLabels, func(l string) bool {
+		_, found := labels[l]
+		return !found
+	}) {
+		return labels
+	}
+	return splitServiceKey(serviceLabels, serviceName)
+}
+
+func (c *Client) serviceMatchers(serviceLabels []string, serviceName string) string {
+	return serviceMatchers(serviceLabels, c.serviceLabelValues(serviceLabels, serviceName))
+}
+
+func (c *Client) seriesSelector(metricName string, serviceLabels []string, serviceName, extra string) string {
+	if extra == "" {
+		return fmt.Sprintf(`%s{%s}`, metricName, c.serviceMatchers(serviceLabels, serviceName))
+	}
+	return fmt.Sprintf(`%s{%s,%s}`, metricName, c.serviceMatchers(serviceLabels, serviceName), extra)
+}
+
+func isServiceLabel(name string, serviceLabels []string) bool {
+	return slices.Contains(serviceLabels, name)
+}
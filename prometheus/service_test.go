@@ -0,0 +1,88 @@
+package prometheus
+
+import "testing"
+
+func TestServiceMatchers(t *testing.T) {
+	tests := []struct {
+		name          string
+		serviceLabels []string
+		labels        map[string]string
+		want          string
+	}{
+		{name: "single label", serviceLabels: []string{"job"}, labels: map[string]string{"job": "api"}, want: `job="api"`},
+		{
+			name:          "labels in configured order",
+			serviceLabels: []string{"namespace", "app"},
+			labels:        map[string]string{"app": "api", "namespace": "payments"},
+			want:          `namespace="payments",app="api"`,
+		},
+		{
+			name:          "separator inside a value",
+			serviceLabels: []string{"namespace", "app"},
+			labels:        map[string]string{"namespace": "team/payments", "app": "api"},
+			want:          `namespace="team/payments",app="api"`,
+		},
+		{name: "quotes are escaped", serviceLabels: []string{"job"}, labels: map[string]string{"job": `a"b`}, want: `job="a\"b"`},
+		{name: "missing value", serviceLabels: []string{"job", "env"}, labels: map[string]string{"job": "api"}, want: `job="api",env=""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceMatchers(tt.serviceLabels, tt.labels); got != tt.want {
+				t.Errorf("serviceMatchers() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitServiceKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		serviceLabels []string
+		serviceName   string
+		want          map[string]string
+	}{
+		{name: "single label keeps separator", serviceLabels: []string{"job"}, serviceName: "team/api", want: map[string]string{"job": "team/api"}},
+		{name: "two labels", serviceLabels: []string{"namespace", "app"}, serviceName: "payments/api", want: map[string]string{"namespace": "payments", "app": "api"}},
+		{name: "last label takes the rest", serviceLabels: []string{"namespace", "app"}, serviceName: "payments/api/v2", want: map[string]string{"namespace": "payments", "app": "api/v2"}},
+		{name: "too few parts", serviceLabels: []string{"namespace", "app"}, serviceName: "payments", want: map[string]string{"namespace": "payments", "app": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitServiceKey(tt.serviceLabels, tt.serviceName)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitServiceKey() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("splitServiceKey()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestClientServiceMatchersUseDiscoveredLabels(t *testing.T) {
+	serviceLabels := []string{"namespace", "app"}
+	c := &Client{services: map[string]map[string]string{
+		"team/payments/api": {"namespace": "team/payments", "app": "api"},
+	}}
+	tests := []struct {
+		name        string
+		serviceName string
+		want        string
+	}{
+		{name: "discovered", serviceName: "team/payments/api", want: `namespace="team/payments",app="api"`},
+		{name: "unknown falls back to split", serviceName: "shop/web", want: `namespace="shop",app="web"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.serviceMatchers(serviceLabels, tt.serviceName); got != tt.want {
+				t.Errorf("serviceMatchers(%q) = %s, want %s", tt.serviceName, got, tt.want)
+			}
+		})
+	}
+	// Labels stored for another label set don't apply.
+	if got := c.serviceMatchers([]string{"job"}, "team/payments/api"); got != `job="team/payments/api"` {
+		t.Errorf("serviceMatchers with other labels = %s", got)
+	}
+}
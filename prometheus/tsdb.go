@@ -0,0 +1,57 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// tsdbStatusLimit is how many entries the top-N lists of the TSDB status
+// endpoint return.
+const tsdbStatusLimit = 10
+
+type TSDBStatus struct {
+	HeadSeries     int
+	HeadLabelPairs int
+	HeadChunks     int
+	MinTime        time.Time
+	MaxTime        time.Time
+	TopMetrics     []TSDBStat
+	TopLabelNames  []TSDBStat
+}
+
+type TSDBStat struct {
+	Name  string
+	Value uint64
+}
+
+// GetTSDBStatus reads /api/v1/status/tsdb, which reports head block
+// cardinality directly from the TSDB without running any queries.
+func (c *Client) GetTSDBStatus(ctx context.Context) (*TSDBStatus, error) {
+	result, err := withRetry(ctx, c.retry, c.breaker, func() (v1.TSDBResult, error) {
+		return c.api.TSDB(ctx, v1.WithLimit(tsdbStatusLimit))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tsdb status: %w", err)
+	}
+
+	return &TSDBStatus{
+		HeadSeries:     result.HeadStats.NumSeries,
+		HeadLabelPairs: result.HeadStats.NumLabelPairs,
+		HeadChunks:     result.HeadStats.ChunkCount,
+		MinTime:        time.UnixMilli(int64(result.HeadStats.MinTime)),
+		MaxTime:        time.UnixMilli(int64(result.HeadStats.MaxTime)),
+		TopMetrics:     toTSDBStats(result.SeriesCountByMetricName),
+		TopLabelNames:  toTSDBStats(result.LabelValueCountByLabelName),
+	}, nil
+}
+
+func toTSDBStats(stats []v1.Stat) []TSDBStat {
+	out := make([]TSDBStat, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, TSDBStat{Name: s.Name, Value: s.Value})
+	}
+	return out
+}
@@ -0,0 +1,249 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/notify"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// Digest summarizes how cardinality moved over a window, from the snapshot
+// nearest its start to the latest one.
+type Digest struct {
+	From *models.Snapshot
+	To   *models.Snapshot
+	// SeriesDeltaPct is nil when From had no series.
+	SeriesDelta    int64
+	SeriesDeltaPct *float64
+	// Growing and Shrinking are the services that changed most in each
+	// direction, Added and Removed the ones that came and went.
+	Growing    []models.ServiceDiff
+	Shrinking  []models.ServiceDiff
+	Added      []models.ServiceDiff
+	Removed    []models.ServiceDiff
+	TopMetrics []models.TopMetric
+	// NewFindings are the unresolved findings first seen since From, most
+	// severe first; ResolvedFindings the ones fixed since.
+	NewFindings      []models.TrackedFinding
+	ResolvedFindings []models.TrackedFinding
+}
+
+// Digest compares the latest snapshot with the one nearest window ago,
+// listing top entries of each kind. It returns nil until there are two
+// snapshots to compare.
+func (b *Builder) Digest(ctx context.Context, window time.Duration, top int) (*Digest, error) {
+	to, err := b.snapshots.GetLatest(ctx)
+	if err != nil || to == nil {
+		return nil, err
+	}
+	from, err := b.snapshots.GetNearest(ctx, to.CollectedAt.Add(-window))
+	if err != nil || from == nil || from.ID == to.ID {
+		return nil, err
+	}
+
+	d := &Digest{From: from, To: to, SeriesDelta: to.TotalSeries - from.TotalSeries}
+	if from.TotalSeries > 0 {
+		pct := float64(d.SeriesDelta) * 100 / float64(from.TotalSeries)
+		d.SeriesDeltaPct = &pct
+	}
+
+	diffs, err := b.services.Diff(ctx, from.ID, to.ID)
+	if err != nil {
+		return nil, fmt.Errorf("diff services: %w", err)
+	}
+	// Diffs come biggest change first, so each list keeps the top ones.
+	for _, s := range diffs {
+		switch {
+		case s.Status == models.DiffAdded:
+			d.Added = append(d.Added, s)
+		case s.Status == models.DiffRemoved:
+			d.Removed = append(d.Removed, s)
+		case s.SeriesDelta > 0 && len(d.Growing) < top:
+			d.Growing = append(d.Growing, s)
+		case s.SeriesDelta < 0 && len(d.Shrinking) < top:
+			d.Shrinking = append(d.Shrinking, s)
+		}
+	}
+
+	metrics, err := b.metrics.Top(ctx, to.ID, from.ID, "growth", top)
+	if err != nil {
+		return nil, fmt.Errorf("top metrics: %w", err)
+	}
+	for _, m := range metrics {
+		if m.SeriesDelta != nil && *m.SeriesDelta > 0 {
+			d.TopMetrics = append(d.TopMetrics, m)
+		}
+	}
+
+	findings, err := b.findings.ListTracked(ctx, storage.TrackedFindingListOptions{
+		States: []models.FindingState{models.FindingOpen, models.FindingAcknowledged, models.FindingResolved},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list findings: %w", err)
+	}
+	for _, f := range findings {
+		switch {
+		case f.ResolvedAt != nil:
+			if f.ResolvedAt.After(from.CollectedAt) && len(d.ResolvedFindings) < top {
+				d.ResolvedFindings = append(d.ResolvedFindings, f)
+			}
+		case f.FirstSeen.After(from.CollectedAt) && len(d.NewFindings) < top:
+			d.NewFindings = append(d.NewFindings, f)
+		}
+	}
+	return d, nil
+}
+
+// Message renders the digest as a notification. It sticks to lists and
+// bold text, which chat tools render, rather than tables.
+func (d *Digest) Message() notify.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Snapshot %d (%s) → %d (%s)\n\n", d.From.ID, d.From.CollectedAt.Format("2006-01-02"), d.To.ID, d.To.CollectedAt.Format("2006-01-02"))
+
+	fmt.Fprintf(&b, "**Active series:** %s (%s", formatNumber(d.To.TotalSeries), formatDelta(d.SeriesDelta))
+	if d.SeriesDeltaPct != nil {
+		fmt.Fprintf(&b, ", %+.1f%%", *d.SeriesDeltaPct)
+	}
+	b.WriteString(")\n")
+	fmt.Fprintf(&b, "**Services:** %s (%d new, %d gone)\n", formatNumber(d.To.TotalServices), len(d.Added), len(d.Removed))
+
+	if len(d.Growing) > 0 {
+		b.WriteString("\n**Top growth**\n")
+		for _, s := range d.Growing {
+			fmt.Fprintf(&b, "- %s: %s (%s → %s)\n", s.ServiceName, formatDelta(s.SeriesDelta), formatNumber(s.PreviousSeries), formatNumber(s.CurrentSeries))
+		}
+	}
+	if len(d.TopMetrics) > 0 {
+		b.WriteString("\n**Fastest growing metrics**\n")
+		for _, m := range d.TopMetrics {
+			fmt.Fprintf(&b, "- %s `%s`: %s\n", m.ServiceName, m.MetricName, formatDelta(m.SeriesDelta))
+		}
+	}
+	if len(d.Shrinking) > 0 {
+		b.WriteString("\n**Biggest drops**\n")
+		for _, s := range d.Shrinking {
+			fmt.Fprintf(&b, "- %s: %s\n", s.ServiceName, formatDelta(s.SeriesDelta))
+		}
+	}
+	if len(d.NewFindings) > 0 {
+		b.WriteString("\n**New findings**\n")
+		for _, f := range d.NewFindings {
+			fmt.Fprintf(&b, "- [%s] %s\n", f.Level, findingName(f))
+		}
+	}
+	if len(d.ResolvedFindings) > 0 {
+		b.WriteString("\n**Resolved findings**\n")
+		for _, f := range d.ResolvedFindings {
+			fmt.Fprintf(&b, "- %s\n", findingName(f))
+		}
+	}
+	if len(d.Added) > 0 {
+		fmt.Fprintf(&b, "\n**New services:** %s\n", serviceNames(d.Added))
+	}
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(&b, "\n**Removed services:** %s\n", serviceNames(d.Removed))
+	}
+
+	return notify.Message{Title: "Cardinality digest", Text: b.String()}
+}
+
+func findingName(f models.TrackedFinding) string {
+	name := fmt.Sprintf("%s `%s`", f.ServiceName, f.MetricName)
+	if f.LabelName != "" {
+		name += fmt.Sprintf(" label `%s`", f.LabelName)
+	}
+	return name + " (" + f.Kind + ")"
+}
+
+func serviceNames(diffs []models.ServiceDiff) string {
+	names := make([]string, len(diffs))
+	for i, d := range diffs {
+		names[i] = d.ServiceName
+	}
+	return strings.Join(names, ", ")
+}
+
+// DigestJob sends the digest on the configured schedule.
+type DigestJob struct {
+	builder  *Builder
+	notifier notify.Notifier
+
+	mu       sync.Mutex
+	cfg      config.DigestConfig
+	reloaded chan struct{}
+}
+
+func NewDigestJob(builder *Builder, notifier notify.Notifier, cfg config.DigestConfig) *DigestJob {
+	return &DigestJob{
+		builder:  builder,
+		notifier: notifier,
+		cfg:      cfg,
+		reloaded: make(chan struct{}, 1),
+	}
+}
+
+// Reload swaps the schedule; the next send time is worked out again.
+func (j *DigestJob) Reload(cfg config.DigestConfig) {
+	j.mu.Lock()
+	j.cfg = cfg
+	j.mu.Unlock()
+	select {
+	case j.reloaded <- struct{}{}:
+	default:
+	}
+}
+
+func (j *DigestJob) config() config.DigestConfig {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cfg
+}
+
+// Start sends digests until ctx is done.
+func (j *DigestJob) Start(ctx context.Context) {
+	for {
+		next := j.config().Next(time.Now())
+		slog.Info("next digest scheduled", "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-j.reloaded:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		if err := j.Send(ctx); err != nil {
+			slog.Error("digest failed", "error", err)
+		}
+	}
+}
+
+// Send builds the digest now and delivers it. Without two snapshots to
+// compare there is nothing to say and nothing is sent.
+func (j *DigestJob) Send(ctx context.Context) error {
+	cfg := j.config()
+	d, err := j.builder.Digest(ctx, cfg.Window, cfg.Top)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		slog.Info("digest skipped, not enough snapshots")
+		return nil
+	}
+	if err := j.notifier.Notify(ctx, d.Message()); err != nil {
+		return err
+	}
+	slog.Info("digest sent", "from_snapshot", d.From.ID, "to_snapshot", d.To.ID)
+	return nil
+}
@@ -0,0 +1,152 @@
+package report
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//go:embed report.html
+var htmlSource string
+
+// chartBars is how many services the bar charts show.
+const chartBars = 15
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"num":      formatNumber,
+	"delta":    formatDelta,
+	"money":    formatMoney,
+	"bars":     bars,
+	"deltaBar": deltaBars,
+	"team":     team,
+	"deltaClass": func(v any) string {
+		delta, _ := toInt64(v)
+		switch {
+		case delta > 0:
+			return "up"
+		case delta < 0:
+			return "down"
+		}
+		return ""
+	},
+}).Parse(htmlSource))
+
+// WriteHTML renders the report as a single HTML page with its styles and
+// charts inline, so it can be mailed or attached as one file.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// bar is one row of a CSS bar chart; Percent is relative to the largest.
+type bar struct {
+	Label   string
+	Value   int64
+	Percent float64
+}
+
+func bars(r *Report) []bar {
+	services := r.Services[:min(len(r.Services), chartBars)]
+	var peak int64
+	for _, s := range services {
+		peak = max(peak, int64(s.TotalSeries))
+	}
+	out := make([]bar, len(services))
+	for i, s := range services {
+		out[i] = bar{Label: s.ServiceName, Value: int64(s.TotalSeries), Percent: percent(int64(s.TotalSeries), peak)}
+	}
+	return out
+}
+
+// deltaBars charts the biggest changes; Percent is of the largest absolute
+// change and the sign goes by Value.
+func deltaBars(r *Report) []bar {
+	changes := r.Changes[:min(len(r.Changes), chartBars)]
+	var peak int64
+	for _, c := range changes {
+		peak = max(peak, abs(int64(c.SeriesDelta)))
+	}
+	out := make([]bar, len(changes))
+	for i, c := range changes {
+		out[i] = bar{Label: c.ServiceName, Value: int64(c.SeriesDelta), Percent: percent(abs(int64(c.SeriesDelta)), peak)}
+	}
+	return out
+}
+
+func percent(v, peak int64) float64 {
+	if peak == 0 {
+		return 0
+	}
+	return float64(v) * 100 / float64(peak)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// toInt64 takes the template's counts, which are ints, int64s or pointers
+// to them for optional deltas; ok is false for nil.
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case *int:
+		if n != nil {
+			return int64(*n), true
+		}
+	case *int64:
+		if n != nil {
+			return *n, true
+		}
+	}
+	return 0, false
+}
+
+// formatNumber groups thousands: 1234567 -> 1,234,567. Nil prints a dash.
+func formatNumber(v any) string {
+	n, ok := toInt64(v)
+	if !ok {
+		return "–"
+	}
+	s := strconv.FormatInt(n, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	if neg {
+		return "-" + b.String()
+	}
+	return b.String()
+}
+
+func formatDelta(v any) string {
+	s := formatNumber(v)
+	if n, _ := toInt64(v); n > 0 {
+		return "+" + s
+	}
+	return s
+}
+
+// formatMoney prints a cost with the configured currency, or nothing when
+// there is no cost.
+func formatMoney(cost *float64, currency string) string {
+	if cost == nil {
+		return ""
+	}
+	s := strconv.FormatFloat(*cost, 'f', 2, 64)
+	if currency == "" {
+		return s
+	}
+	return s + " " + currency
+}
@@ -0,0 +1,182 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+// markdownRows caps the tables of the markdown report, which is meant to be
+// pasted into issues and wiki pages rather than read in full.
+const markdownRows = 20
+
+// WriteMarkdown renders the report as GitHub-flavored markdown; the
+// tables paste into Confluence as well.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "## Cardinality report: snapshot %d\n\n", r.Snapshot.ID)
+	fmt.Fprintf(b, "Collected %s", r.Snapshot.CollectedAt.UTC().Format("2006-01-02 15:04 UTC"))
+	if r.Baseline != nil {
+		fmt.Fprintf(b, ", compared with snapshot %d from %s", r.Baseline.ID, r.Baseline.CollectedAt.UTC().Format("2006-01-02 15:04 UTC"))
+	}
+	b.WriteString(".\n\n")
+
+	fmt.Fprintf(b, "- **Active series:** %s", formatNumber(r.Snapshot.TotalSeries))
+	if r.Baseline != nil {
+		fmt.Fprintf(b, " (%s)", formatDelta(r.SeriesDelta))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(b, "- **Services:** %s", formatNumber(r.Snapshot.TotalServices))
+	if r.Baseline != nil {
+		fmt.Fprintf(b, " (%d changed)", len(r.Changes))
+	}
+	b.WriteString("\n")
+	if r.MonthlyCost != nil {
+		fmt.Fprintf(b, "- **Monthly cost:** %s", formatMoney(r.MonthlyCost, r.Currency))
+		if r.CostDelta != nil {
+			sign := ""
+			if *r.CostDelta > 0 {
+				sign = "+"
+			}
+			fmt.Fprintf(b, " (%s%s)", sign, formatMoney(r.CostDelta, r.Currency))
+		}
+		b.WriteString("\n")
+	}
+
+	if r.Baseline != nil {
+		fmt.Fprintf(b, "\n### Changes since snapshot %d\n\n", r.Baseline.ID)
+		if len(r.Changes) == 0 {
+			b.WriteString("No service changed size.\n")
+		} else {
+			writeDiffTable(b, r.Changes, markdownRows)
+		}
+	}
+
+	b.WriteString("\n### Teams\n\n")
+	header := []string{"Team", "Services", "Series"}
+	if r.Baseline != nil {
+		header = append(header, "Change")
+	}
+	var rows [][]string
+	for _, t := range r.Teams {
+		row := []string{team(t.Team), fmt.Sprint(t.Services), formatNumber(t.CurrentSeries)}
+		if r.Baseline != nil {
+			row = append(row, formatDelta(t.SeriesDelta))
+		}
+		rows = append(rows, row)
+	}
+	writeTable(b, header, rows, len(rows))
+
+	b.WriteString("\n### Biggest metrics\n\n")
+	header = []string{"Service", "Metric", "Series", "Labels"}
+	if r.Baseline != nil {
+		header = append(header, "Change")
+	}
+	rows = nil
+	for _, m := range r.TopMetrics {
+		row := []string{m.ServiceName, "`" + m.MetricName + "`", formatNumber(m.SeriesCount), fmt.Sprint(m.LabelCount)}
+		if r.Baseline != nil {
+			row = append(row, formatDelta(m.SeriesDelta))
+		}
+		rows = append(rows, row)
+	}
+	writeTable(b, header, rows, len(rows))
+
+	return b.Flush()
+}
+
+// WriteDiffMarkdown renders a comparison of two snapshots as a markdown
+// table of all the diffs given, in their order.
+func WriteDiffMarkdown(w io.Writer, fromID, toID int64, diffs []models.ServiceDiff) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "### Snapshot %d → %d\n\n", fromID, toID)
+	if len(diffs) == 0 {
+		b.WriteString("No service changed size.\n")
+	} else {
+		writeDiffTable(b, diffs, len(diffs))
+	}
+	return b.Flush()
+}
+
+func writeDiffTable(b *bufio.Writer, diffs []models.ServiceDiff, limit int) {
+	rows := make([][]string, len(diffs))
+	for i, d := range diffs {
+		rows[i] = []string{d.ServiceName, team(d.Team), string(d.Status), formatNumber(d.PreviousSeries), formatNumber(d.CurrentSeries), formatDelta(d.SeriesDelta)}
+	}
+	writeTable(b, []string{"Service", "Team", "Status", "Before", "After", "Change"}, rows, limit)
+}
+
+// WriteAnalysisMarkdown renders an analysis with its result, which the
+// model already writes in markdown, under a short header.
+func WriteAnalysisMarkdown(w io.Writer, a *models.SnapshotAnalysis) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "## Cardinality analysis: snapshot %d vs %d\n\n", a.CurrentSnapshotID, a.PreviousSnapshotID)
+	if a.CompletedAt != nil {
+		fmt.Fprintf(b, "_Status: %s at %s_\n\n", a.Status, a.CompletedAt.UTC().Format("2006-01-02 15:04 UTC"))
+	} else {
+		fmt.Fprintf(b, "_Status: %s_\n\n", a.Status)
+	}
+
+	switch {
+	case a.Result != "":
+		b.WriteString(strings.TrimSpace(a.Result))
+		b.WriteString("\n")
+	case a.Error != "":
+		fmt.Fprintf(b, "Analysis failed: %s\n", a.Error)
+	default:
+		b.WriteString("No result yet.\n")
+	}
+
+	if len(a.ToolCalls) > 0 {
+		b.WriteString("\n<details>\n<summary>Data looked up</summary>\n\n")
+		for _, c := range a.ToolCalls {
+			fmt.Fprintf(b, "- `%s`", c.Name)
+			if len(c.Args) > 0 {
+				var args []string
+				for k, v := range c.Args {
+					args = append(args, fmt.Sprintf("%s=%v", k, v))
+				}
+				slices.Sort(args)
+				fmt.Fprintf(b, " (%s)", strings.Join(args, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n</details>\n")
+	}
+	return b.Flush()
+}
+
+// writeTable writes a markdown table of at most limit rows and notes how
+// many were left out.
+func writeTable(b *bufio.Writer, header []string, rows [][]string, limit int) {
+	b.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for _, row := range rows[:min(len(rows), limit)] {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			cells[i] = escapeCell(c)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	if len(rows) > limit {
+		fmt.Fprintf(b, "\n_%d more not shown._\n", len(rows)-limit)
+	}
+}
+
+// escapeCell keeps a value on one line and from closing its table cell.
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func team(name string) string {
+	if name == "" {
+		return "(no team)"
+	}
+	return name
+}
@@ -0,0 +1,167 @@
+// Package report renders snapshots and the changes between them as
+// standalone documents for people who won't open the UI.
+package report
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// topMetricsLimit is how many metrics the biggest-metrics section lists.
+const topMetricsLimit = 25
+
+// Report is a snapshot compared with a baseline, usually the snapshot
+// before it.
+type Report struct {
+	GeneratedAt time.Time
+	Snapshot    *models.Snapshot
+	// Baseline is nil when there is nothing to compare with; the delta
+	// fields are then zero.
+	Baseline *models.Snapshot
+	Currency string
+	// MonthlyCost and CostDelta are nil without cost settings.
+	MonthlyCost *float64
+	CostDelta   *float64
+	SeriesDelta int64
+	Services    []models.ServiceSnapshot
+	// Changes are the services that were added, removed or changed size,
+	// biggest change first.
+	Changes    []models.ServiceDiff
+	Teams      []TeamChange
+	TopMetrics []models.TopMetric
+}
+
+// TeamChange is a team's series in the snapshot and the baseline.
+type TeamChange struct {
+	Team           string
+	Services       int
+	PreviousSeries int64
+	CurrentSeries  int64
+	SeriesDelta    int64
+}
+
+type Builder struct {
+	snapshots storage.SnapshotsRepo
+	services  storage.ServicesRepo
+	metrics   storage.MetricsRepo
+	findings  storage.FindingsRepo
+	cost      config.CostConfig
+}
+
+func NewBuilder(snapshots storage.SnapshotsRepo, services storage.ServicesRepo, metrics storage.MetricsRepo, findings storage.FindingsRepo, cost config.CostConfig) *Builder {
+	return &Builder{
+		snapshots: snapshots,
+		services:  services,
+		metrics:   metrics,
+		findings:  findings,
+		cost:      cost,
+	}
+}
+
+// Build reports on snapshot id against baselineID, or against the
+// previous snapshot when baselineID is 0. It returns nil when either
+// snapshot doesn't exist.
+func (b *Builder) Build(ctx context.Context, id, baselineID int64) (*Report, error) {
+	snap, err := b.snapshots.GetByID(ctx, id)
+	if err != nil || snap == nil {
+		return nil, err
+	}
+
+	var baseline *models.Snapshot
+	if baselineID != 0 {
+		baseline, err = b.snapshots.GetByID(ctx, baselineID)
+		if err != nil || baseline == nil {
+			return nil, err
+		}
+	} else {
+		baseline, err = b.snapshots.GetPrevious(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Report{
+		GeneratedAt: time.Now(),
+		Snapshot:    snap,
+		Baseline:    baseline,
+		Currency:    b.cost.Currency,
+		MonthlyCost: b.cost.MonthlyCostPtr(snap.TotalSeries),
+	}
+
+	r.Services, err = b.services.List(ctx, id, storage.ServiceListOptions{Sort: "series", Order: "desc"})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	var previousID int64
+	if baseline != nil {
+		previousID = baseline.ID
+		r.SeriesDelta = snap.TotalSeries - baseline.TotalSeries
+		r.CostDelta = b.cost.MonthlyCostPtr(r.SeriesDelta)
+
+		diffs, err := b.services.Diff(ctx, baseline.ID, id)
+		if err != nil {
+			return nil, fmt.Errorf("diff services: %w", err)
+		}
+		for _, d := range diffs {
+			if d.Status != models.DiffUnchanged {
+				r.Changes = append(r.Changes, d)
+			}
+		}
+		r.Teams = teamChanges(diffs)
+	} else {
+		r.Teams = teamChanges(currentOnly(r.Services))
+	}
+
+	r.TopMetrics, err = b.metrics.Top(ctx, id, previousID, "series", topMetricsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("top metrics: %w", err)
+	}
+
+	return r, nil
+}
+
+// currentOnly turns a snapshot's services into diffs against nothing, for
+// rolling up teams without a baseline.
+func currentOnly(services []models.ServiceSnapshot) []models.ServiceDiff {
+	diffs := make([]models.ServiceDiff, len(services))
+	for i, s := range services {
+		diffs[i] = models.ServiceDiff{ServiceName: s.ServiceName, Team: s.Team, Status: models.DiffAdded, CurrentSeries: s.TotalSeries}
+	}
+	return diffs
+}
+
+// teamChanges rolls service diffs up per team, biggest team first.
+// Services without a team are grouped under an empty name.
+func teamChanges(diffs []models.ServiceDiff) []TeamChange {
+	byTeam := make(map[string]*TeamChange)
+	for _, d := range diffs {
+		t, ok := byTeam[d.Team]
+		if !ok {
+			t = &TeamChange{Team: d.Team}
+			byTeam[d.Team] = t
+		}
+		if d.Status != models.DiffRemoved {
+			t.Services++
+		}
+		t.PreviousSeries += int64(d.PreviousSeries)
+		t.CurrentSeries += int64(d.CurrentSeries)
+		t.SeriesDelta += int64(d.SeriesDelta)
+	}
+
+	teams := make([]TeamChange, 0, len(byTeam))
+	for _, t := range byTeam {
+		teams = append(teams, *t)
+	}
+	slices.SortFunc(teams, func(a, b TeamChange) int {
+		return cmp.Or(cmp.Compare(b.CurrentSeries, a.CurrentSeries), cmp.Compare(a.Team, b.Team))
+	})
+	return teams
+}
@@ -2,28 +2,48 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
 	"github.com/illenko/whodidthis/storage"
 )
 
 type Scheduler struct {
-	collector *collector.Collector
-	db        *storage.DB
-	interval  time.Duration
-	retention time.Duration
-	stopCh    chan struct{}
-	stopOnce  sync.Once
-	status    *ScanStatus
-	mu        sync.RWMutex
-	scanIDSeq atomic.Int64
-	logger    *slog.Logger
-	parentCtx context.Context // set by Start, used for triggered scans
-	scanWg    sync.WaitGroup  // tracks async triggered scans
+	collector  *collector.Collector
+	db         *storage.DB
+	settings   storage.SettingsRepo
+	scanRuns   storage.ScanRunsRepo
+	interval   time.Duration
+	retention  time.Duration
+	downsample time.Duration
+	queueSize  int
+	blackouts  []config.BlackoutWindow
+	postScan   []PostScanHook
+	events     models.EventPublisher
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	status     *ScanStatus
+	mu         sync.RWMutex
+	scanIDSeq  atomic.Int64
+	logger     *slog.Logger
+	parentCtx  context.Context // set by Start, used for triggered scans
+	scanWg     sync.WaitGroup  // tracks async triggered scans
+
+	cancelScan context.CancelFunc // cancels the running scan, guarded by mu
+	changed    chan struct{}      // closed and replaced on every status change, guarded by mu
+	reloaded   chan struct{}      // signals Start to pick up a new interval
+
+	// initialScan is set once Start's first scheduled scan has run, failed,
+	// been skipped while paused or been deferred by a blackout window.
+	initialScan atomic.Bool
 }
 
 type ScanProgress struct {
@@ -42,12 +62,42 @@ type ScanStatus struct {
 	NextScanAt    time.Time     `json:"next_scan_at,omitempty"`
 	TotalServices int           `json:"total_services,omitempty"`
 	TotalSeries   int64         `json:"total_series,omitempty"`
+	Excluded      int           `json:"excluded_services,omitempty"`
+	Queue         []ScanRequest `json:"queue,omitempty"`
+	Paused        bool          `json:"paused"`
+	PausedAt      time.Time     `json:"paused_at,omitempty"`
+	DeferredUntil time.Time     `json:"deferred_until,omitempty"`
+}
+
+// ScanRequest is a manually triggered scan waiting in the queue. An empty
+// Service means a full scan, which Overrides may adjust.
+type ScanRequest struct {
+	Trigger   models.ScanTrigger   `json:"trigger"`
+	Service   string               `json:"service,omitempty"`
+	Overrides *collector.Overrides `json:"overrides,omitempty"`
+	QueuedAt  time.Time            `json:"queued_at"`
+}
+
+// PostScanHook runs after every successful scan, before retention cleanup.
+// A failing hook is logged and doesn't affect the scan or later hooks.
+type PostScanHook struct {
+	Name string
+	Run  func(ctx context.Context, result *collector.CollectResult) error
 }
 
 type Config struct {
 	Interval  time.Duration
 	Retention time.Duration
-	DB        *storage.DB
+	// DownsampleAfter thins snapshots older than this to one per week.
+	DownsampleAfter time.Duration
+	QueueSize       int
+	DB              *storage.DB
+	Settings        storage.SettingsRepo
+	Blackouts       []config.BlackoutWindow
+	ScanRuns        storage.ScanRunsRepo
+	PostScan        []PostScanHook
+	// Events receives scan started/finished notifications; optional.
+	Events models.EventPublisher
 }
 
 func New(collector *collector.Collector, cfg Config) *Scheduler {
@@ -59,29 +109,85 @@ func New(collector *collector.Collector, cfg Config) *Scheduler {
 	}
 
 	return &Scheduler{
-		collector: collector,
-		db:        cfg.DB,
-		interval:  cfg.Interval,
-		retention: cfg.Retention,
-		stopCh:    make(chan struct{}),
-		status:    &ScanStatus{},
-		logger:    slog.Default(),
+		collector:  collector,
+		db:         cfg.DB,
+		settings:   cfg.Settings,
+		scanRuns:   cfg.ScanRuns,
+		interval:   cfg.Interval,
+		retention:  cfg.Retention,
+		downsample: cfg.DownsampleAfter,
+		queueSize:  cfg.QueueSize,
+		blackouts:  cfg.Blackouts,
+		postScan:   cfg.PostScan,
+		events:     cfg.Events,
+		stopCh:     make(chan struct{}),
+		status:     &ScanStatus{},
+		logger:     slog.Default(),
+		changed:    make(chan struct{}),
+		reloaded:   make(chan struct{}, 1),
+	}
+}
+
+// Reload swaps in the collector and the interval, retention, downsampling
+// and blackout settings from cfg; its other fields are ignored. A scan
+// already running finishes with the collector it started with, and a new
+// interval takes effect from now.
+func (s *Scheduler) Reload(c *collector.Collector, cfg Config) {
+	if cfg.Interval == 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = 90 * 24 * time.Hour
+	}
+
+	s.mu.Lock()
+	s.collector = c
+	s.interval = cfg.Interval
+	s.retention = cfg.Retention
+	s.downsample = cfg.DownsampleAfter
+	s.blackouts = cfg.Blackouts
+	s.mu.Unlock()
+
+	select {
+	case s.reloaded <- struct{}{}:
+	default:
 	}
+	s.logger.Info("scheduler settings reloaded", "interval", cfg.Interval)
 }
 
 func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
 	s.parentCtx = ctx
-	s.logger.Info("starting scheduler", "interval", s.interval)
+	interval := s.interval
+	s.mu.Unlock()
+	s.loadPaused(ctx)
+	s.logger.Info("starting scheduler", "interval", interval, "paused", s.isPaused())
+
+	// A scheduled scan that falls into a blackout window is deferred until
+	// the window closes rather than dropped.
+	deferred := time.NewTimer(0)
+	if !deferred.Stop() {
+		<-deferred.C
+	}
+	defer deferred.Stop()
+
+	runScheduled := func() {
+		if until, ok := s.executeScheduledScan(ctx); !ok {
+			deferred.Reset(time.Until(until))
+		}
+	}
 
 	// Run initial scan
-	s.executeScan(ctx)
+	runScheduled()
+	s.initialScan.Store(true)
 
-	ticker := time.NewTicker(s.interval)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		s.mu.Lock()
 		s.status.NextScanAt = time.Now().Add(s.interval)
+		s.statusChangedLocked()
 		s.mu.Unlock()
 
 		select {
@@ -94,75 +200,365 @@ func (s *Scheduler) Start(ctx context.Context) {
 			s.logger.Info("scheduler stopped")
 			return
 		case <-ticker.C:
-			s.executeScan(ctx)
+			runScheduled()
+		case <-deferred.C:
+			runScheduled()
+		case <-s.reloaded:
+			s.mu.RLock()
+			ticker.Reset(s.interval)
+			s.mu.RUnlock()
 		}
 	}
 }
 
+// Pause stops scheduled scans until Resume is called. Manual triggers keep
+// working. The state is persisted so it survives restarts.
+func (s *Scheduler) Pause(ctx context.Context) error {
+	now := time.Now()
+	if err := s.persistPaused(ctx, now.Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.status.Paused = true
+	s.status.PausedAt = now
+	s.statusChangedLocked()
+	s.mu.Unlock()
+
+	s.logger.Info("scheduler paused")
+	return nil
+}
+
+func (s *Scheduler) Resume(ctx context.Context) error {
+	if err := s.persistPaused(ctx, ""); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.status.Paused = false
+	s.status.PausedAt = time.Time{}
+	s.statusChangedLocked()
+	s.mu.Unlock()
+
+	s.logger.Info("scheduler resumed")
+	return nil
+}
+
+func (s *Scheduler) isPaused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status.Paused
+}
+
+func (s *Scheduler) persistPaused(ctx context.Context, pausedAt string) error {
+	if s.settings == nil {
+		return nil
+	}
+	if err := s.settings.Set(ctx, pausedSettingKey, pausedAt); err != nil {
+		return fmt.Errorf("persist scheduler state: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) loadPaused(ctx context.Context) {
+	if s.settings == nil {
+		return
+	}
+	value, ok, err := s.settings.Get(ctx, pausedSettingKey)
+	if err != nil {
+		s.logger.Error("failed to load scheduler state", "error", err)
+		return
+	}
+	if !ok || value == "" {
+		return
+	}
+	pausedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		s.logger.Warn("invalid persisted pause time", "value", value, "error", err)
+	}
+
+	s.mu.Lock()
+	s.status.Paused = true
+	s.status.PausedAt = pausedAt
+	s.statusChangedLocked()
+	s.mu.Unlock()
+}
+
+// executeScheduledScan runs a scheduled scan unless the scheduler is paused.
+// If a blackout window is active it returns false and when the window closes.
+func (s *Scheduler) executeScheduledScan(ctx context.Context) (time.Time, bool) {
+	if s.isPaused() {
+		s.logger.Info("skipping scheduled scan: scheduler paused")
+		return time.Time{}, true
+	}
+
+	s.mu.RLock()
+	blackouts := s.blackouts
+	s.mu.RUnlock()
+
+	now := time.Now()
+	for _, w := range blackouts {
+		if closes, ok := w.ClosesAt(now); ok {
+			s.logger.Info("deferring scheduled scan: blackout window active", "until", closes)
+			s.mu.Lock()
+			s.status.DeferredUntil = closes
+			s.statusChangedLocked()
+			s.mu.Unlock()
+			return closes, false
+		}
+	}
+
+	s.mu.Lock()
+	s.status.DeferredUntil = time.Time{}
+	s.statusChangedLocked()
+	s.mu.Unlock()
+
+	s.executeScan(ctx)
+	return time.Time{}, true
+}
+
 func (s *Scheduler) Stop() {
 	s.stopOnce.Do(func() {
 		close(s.stopCh)
 	})
 }
 
-func (s *Scheduler) TriggerScan() error {
-	s.mu.Lock()
-	if s.status.Running {
-		s.mu.Unlock()
-		return ErrScanAlreadyRunning
-	}
-	s.status.Running = true
-	s.status.LastError = ""
-	s.status.Progress = &ScanProgress{Phase: "starting"}
-	ctx := s.parentCtx
-	s.mu.Unlock()
+// TriggerScan starts a full scan, with overrides if not nil. If a scan is
+// already running and the queue is enabled, the request is queued instead
+// and queued is true.
+func (s *Scheduler) TriggerScan(overrides *collector.Overrides) (queued bool, err error) {
+	return s.trigger(ScanRequest{Trigger: models.ScanTriggerManual, Overrides: overrides})
+}
 
-	if ctx == nil {
-		ctx = context.Background()
+// TriggerServiceScan rescans a single service into the latest snapshot.
+func (s *Scheduler) TriggerServiceScan(serviceName string) (queued bool, err error) {
+	return s.trigger(ScanRequest{Trigger: models.ScanTriggerManual, Service: serviceName})
+}
+
+// FindService checks with the current collector that the service is
+// discovered, so a rescan of an unknown one can be refused up front.
+func (s *Scheduler) FindService(ctx context.Context, serviceName string) error {
+	s.mu.RLock()
+	c := s.collector
+	s.mu.RUnlock()
+	_, err := c.FindService(ctx, serviceName)
+	return err
+}
+
+func (s *Scheduler) trigger(req ScanRequest) (bool, error) {
+	ctx, err := s.beginScan(s.triggerContext(), req.Service)
+	if errors.Is(err, ErrScanAlreadyRunning) && s.queueSize > 0 {
+		if err := s.enqueue(req); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
 	}
 
+	s.startAsync(ctx, req)
+	return false, nil
+}
+
+func (s *Scheduler) startAsync(ctx context.Context, req ScanRequest) {
 	s.scanWg.Add(1)
 	go func() {
 		defer s.scanWg.Done()
-		s.doScan(ctx)
+		s.doScan(ctx, req)
+		s.startNextQueued()
 	}()
+}
+
+// Estimate dry-runs a full scan with the current collector and overrides,
+// if not nil; it doesn't wait for or block a running scan.
+func (s *Scheduler) Estimate(ctx context.Context, overrides *collector.Overrides) (*collector.ScanEstimate, error) {
+	s.mu.RLock()
+	c := s.collector
+	s.mu.RUnlock()
+	if overrides != nil {
+		c = c.WithOverrides(*overrides)
+	}
+	return c.Estimate(ctx)
+}
+
+func (s *Scheduler) collectFuncFor(req ScanRequest) collectFunc {
+	s.mu.RLock()
+	c := s.collector
+	s.mu.RUnlock()
+
+	if req.Service == "" {
+		if o := req.Overrides; o != nil {
+			s.logger.Info("scan overrides", "concurrency", o.Concurrency, "sample_values_limit", o.SampleValuesLimit, "services", o.Services, "metrics", o.Metrics)
+			c = c.WithOverrides(*o)
+		}
+		return c.Collect
+	}
+	return func(ctx context.Context, scanID int64, progress collector.ProgressCallback) (*collector.CollectResult, error) {
+		return c.CollectService(ctx, scanID, req.Service, progress)
+	}
+}
+
+func (s *Scheduler) enqueue(req ScanRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, q := range s.status.Queue {
+		if q.Service == req.Service && reflect.DeepEqual(q.Overrides, req.Overrides) {
+			return nil
+		}
+	}
+	if len(s.status.Queue) >= s.queueSize {
+		return ErrQueueFull
+	}
+
+	req.QueuedAt = time.Now()
+	s.status.Queue = append(s.status.Queue, req)
+	s.statusChangedLocked()
+	s.logger.Info("scan queued", "service", req.Service, "queue_length", len(s.status.Queue))
 	return nil
 }
 
-func (s *Scheduler) GetStatus() ScanStatus {
+// startNextQueued starts the oldest queued request, if any. Called after a
+// scan has released the running flag.
+func (s *Scheduler) startNextQueued() {
+	s.mu.Lock()
+	if len(s.status.Queue) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	req := s.status.Queue[0]
+	s.status.Queue = s.status.Queue[1:]
+	s.statusChangedLocked()
+	s.mu.Unlock()
+
+	ctx, err := s.beginScan(s.triggerContext(), req.Service)
+	if err != nil {
+		// Another scan won the race; put the request back at the front.
+		s.mu.Lock()
+		s.status.Queue = append([]ScanRequest{req}, s.status.Queue...)
+		s.statusChangedLocked()
+		s.mu.Unlock()
+		return
+	}
+
+	s.startAsync(ctx, req)
+}
+
+// CancelScan cancels the context of the running scan. The scan goroutine
+// marks its snapshot as aborted and releases the running flag itself.
+func (s *Scheduler) CancelScan() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.status.Running || s.cancelScan == nil {
+		return ErrNoScanRunning
+	}
+	s.cancelScan()
+	s.status.Progress = &ScanProgress{Phase: "cancelling"}
+	s.statusChangedLocked()
+	return nil
+}
+
+func (s *Scheduler) triggerContext() context.Context {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return *s.status
+	if s.parentCtx == nil {
+		return context.Background()
+	}
+	return s.parentCtx
 }
 
-// executeScan acquires the running lock and runs a scan synchronously.
-func (s *Scheduler) executeScan(ctx context.Context) {
+// beginScan marks a scan as running and returns its cancellable context.
+func (s *Scheduler) beginScan(parent context.Context, detail string) (context.Context, error) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.status.Running {
-		s.mu.Unlock()
-		return
+		return nil, ErrScanAlreadyRunning
 	}
+
+	ctx, cancel := context.WithCancel(parent)
+	s.cancelScan = cancel
 	s.status.Running = true
 	s.status.LastError = ""
-	s.status.Progress = &ScanProgress{Phase: "starting"}
-	s.mu.Unlock()
+	s.status.Progress = &ScanProgress{Phase: "starting", Detail: detail}
+	s.statusChangedLocked()
+	return ctx, nil
+}
+
+// StatusChanged returns a channel that is closed on the next status change.
+// Callers re-read GetStatus and call StatusChanged again to keep watching.
+func (s *Scheduler) StatusChanged() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+// statusChangedLocked wakes StatusChanged watchers. Must be called with mu held.
+func (s *Scheduler) statusChangedLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// InitialScanAttempted reports whether the scan Start runs first is over,
+// whatever its outcome.
+func (s *Scheduler) InitialScanAttempted() bool {
+	return s.initialScan.Load()
+}
+
+func (s *Scheduler) GetStatus() ScanStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := *s.status
+	status.Queue = append([]ScanRequest(nil), s.status.Queue...)
+	return status
+}
 
-	s.doScan(ctx)
+// executeScan acquires the running lock and runs a scan synchronously.
+func (s *Scheduler) executeScan(ctx context.Context) {
+	scanCtx, err := s.beginScan(ctx, "")
+	if err != nil {
+		return
+	}
+
+	s.doScan(scanCtx, ScanRequest{Trigger: models.ScanTriggerScheduled})
+	s.startNextQueued()
 }
 
-// doScan runs the actual scan. Caller must have already set status.Running = true.
-func (s *Scheduler) doScan(ctx context.Context) {
-	scanID := s.scanIDSeq.Add(1)
+type collectFunc func(ctx context.Context, scanID int64, progress collector.ProgressCallback) (*collector.CollectResult, error)
+
+// RunOnce runs a scan in the foreground, including post-scan hooks and
+// cleanup, for callers without the Start loop such as the CLI.
+func (s *Scheduler) RunOnce(ctx context.Context, req ScanRequest) (*collector.CollectResult, error) {
+	scanCtx, err := s.beginScan(ctx, req.Service)
+	if err != nil {
+		return nil, err
+	}
+	return s.doScan(scanCtx, req)
+}
+
+// doScan runs the actual scan. Caller must have already called beginScan.
+func (s *Scheduler) doScan(ctx context.Context, req ScanRequest) (result *collector.CollectResult, scanErr error) {
 	start := time.Now()
+	run := s.startRun(ctx, req, start)
+	scanID := run.ID
 
 	logger := s.logger.With("scan_id", scanID)
-	logger.Info("starting scan")
+	logger.Info("starting scan", "trigger", req.Trigger, "service", req.Service)
+	s.publish(models.EventScanStarted, run)
 
-	var result *collector.CollectResult
-	var scanErr error
+	defer func() {
+		s.finishRun(ctx, run, result, scanErr)
+		s.publish(models.EventScanFinished, run)
+	}()
 
 	defer func() {
 		s.mu.Lock()
+		if s.cancelScan != nil {
+			s.cancelScan()
+			s.cancelScan = nil
+		}
 		s.status.Running = false
 		s.status.Progress = nil
 		s.status.LastScanAt = start
@@ -172,7 +568,9 @@ func (s *Scheduler) doScan(ctx context.Context) {
 		} else if result != nil {
 			s.status.TotalServices = result.TotalServices
 			s.status.TotalSeries = result.TotalSeries
+			s.status.Excluded = result.ExcludedServices
 		}
+		s.statusChangedLocked()
 		s.mu.Unlock()
 	}()
 
@@ -185,12 +583,15 @@ func (s *Scheduler) doScan(ctx context.Context) {
 			Total:   total,
 			Detail:  detail,
 		}
+		s.statusChangedLocked()
 	}
 
-	result, scanErr = s.collector.Collect(ctx, scanID, progress)
+	result, scanErr = s.collectFuncFor(req)(ctx, scanID, progress)
 	if scanErr != nil {
+		// A cancelled scan still returns what it stored, which its run
+		// records.
 		logger.Error("collection failed", "error", scanErr)
-		return
+		return result, scanErr
 	}
 
 	logger.Info("scan complete",
@@ -199,15 +600,111 @@ func (s *Scheduler) doScan(ctx context.Context) {
 		"duration", time.Since(start),
 	)
 
+	s.runPostScan(ctx, result)
 	s.runCleanup(ctx, scanID)
+	return result, nil
+}
+
+func (s *Scheduler) runPostScan(ctx context.Context, result *collector.CollectResult) {
+	if result.Filtered {
+		// A narrowed scan lacks the services and metrics it left out; hooks
+		// would read that as everything else disappearing.
+		s.logger.Info("skipping post-scan hooks for filtered scan", "snapshot_id", result.SnapshotID)
+		return
+	}
+	for _, hook := range s.postScan {
+		start := time.Now()
+		if err := hook.Run(ctx, result); err != nil {
+			s.logger.Error("post-scan hook failed", "hook", hook.Name, "snapshot_id", result.SnapshotID, "error", err)
+			continue
+		}
+		s.logger.Debug("post-scan hook completed", "hook", hook.Name, "snapshot_id", result.SnapshotID, "duration", time.Since(start))
+	}
+}
+
+// startRun records the scan in scan_runs. Without a repository, runs are
+// numbered in memory only.
+func (s *Scheduler) startRun(ctx context.Context, req ScanRequest, start time.Time) *models.ScanRun {
+	run := &models.ScanRun{
+		Trigger:   req.Trigger,
+		Service:   req.Service,
+		Status:    models.ScanRunStatusRunning,
+		StartedAt: start,
+	}
+
+	if s.scanRuns != nil {
+		id, err := s.scanRuns.Create(ctx, run)
+		if err == nil {
+			run.ID = id
+			return run
+		}
+		s.logger.Error("failed to record scan run", "error", err)
+	}
+
+	run.ID = s.scanIDSeq.Add(1)
+	return run
+}
+
+func (s *Scheduler) finishRun(ctx context.Context, run *models.ScanRun, result *collector.CollectResult, scanErr error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	switch {
+	case errors.Is(scanErr, collector.ErrScanCancelled) || (scanErr != nil && errors.Is(ctx.Err(), context.Canceled)):
+		// Like its snapshot, however far the scan got before the cancel.
+		run.Status = models.ScanRunStatusAborted
+	case scanErr != nil:
+		run.Status = models.ScanRunStatusFailed
+	default:
+		run.Status = models.ScanRunStatusCompleted
+	}
+	if scanErr != nil {
+		run.Error = scanErr.Error()
+	}
+	if result != nil {
+		run.SnapshotID = result.SnapshotID
+		run.TotalServices = result.TotalServices
+		run.TotalSeries = result.TotalSeries
+		run.ServiceErrors = result.FailedServices
+	}
+
+	if s.scanRuns == nil {
+		return
+	}
+	if err := s.scanRuns.Update(context.WithoutCancel(ctx), run); err != nil {
+		s.logger.Error("failed to update scan run", "scan_id", run.ID, "error", err)
+	}
+}
+
+func (s *Scheduler) publish(typ models.EventType, data any) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(models.Event{Type: typ, Time: time.Now(), Data: data})
 }
 
 func (s *Scheduler) runCleanup(ctx context.Context, scanID int64) {
-	if s.db == nil || s.retention == 0 {
+	if s.db == nil {
+		return
+	}
+
+	s.mu.RLock()
+	retention, downsample := s.retention, s.downsample
+	s.mu.RUnlock()
+
+	if downsample > 0 {
+		thinned, err := s.db.Downsample(ctx, downsample)
+		if err != nil {
+			s.logger.Error("downsampling failed", "scan_id", scanID, "error", err)
+		} else if thinned > 0 {
+			s.logger.Info("downsampling completed", "scan_id", scanID, "deleted_snapshots", thinned)
+		}
+	}
+
+	if retention == 0 {
 		return
 	}
 
-	deleted, err := s.db.Cleanup(ctx, s.retention)
+	deleted, err := s.db.Cleanup(ctx, retention)
 	if err != nil {
 		s.logger.Error("cleanup failed", "scan_id", scanID, "error", err)
 		return
@@ -218,8 +715,14 @@ func (s *Scheduler) runCleanup(ctx context.Context, scanID int64) {
 	}
 }
 
+const pausedSettingKey = "scheduler.paused_at"
+
 type scanError string
 
 func (e scanError) Error() string { return string(e) }
 
-const ErrScanAlreadyRunning = scanError("scan already running")
+const (
+	ErrScanAlreadyRunning = scanError("scan already running")
+	ErrNoScanRunning      = scanError("no scan running")
+	ErrQueueFull          = scanError("scan queue full")
+)
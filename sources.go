@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+
+	"github.com/illenko/whodidthis/cloudwatch"
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/datadog"
+	"github.com/illenko/whodidthis/prometheus"
+)
+
+// The built-in metrics sources, one per scan.mode. Another backend only
+// needs a registration here and its mode in config validation.
+func init() {
+	collector.RegisterSource(config.ScanModeQuery, func(cfg *config.Config) (collector.Source, error) {
+		return prometheus.NewClient(prometheusConfig(cfg))
+	})
+	collector.RegisterSource(config.ScanModeFederate, func(cfg *config.Config) (collector.Source, error) {
+		return prometheus.NewFederationClient(prometheusConfig(cfg), cfg.Scan.Federate.Match)
+	})
+	collector.RegisterSource(config.ScanModeScrape, func(cfg *config.Config) (collector.Source, error) {
+		return newScrapeClient(cfg)
+	})
+	collector.RegisterSource(config.ScanModeOTel, func(cfg *config.Config) (collector.Source, error) {
+		return newOTelClient(cfg)
+	})
+	collector.RegisterSource(config.ScanModeDatadog, func(cfg *config.Config) (collector.Source, error) {
+		return newDatadogClient(cfg), nil
+	})
+	collector.RegisterSource(config.ScanModeCloudWatch, func(cfg *config.Config) (collector.Source, error) {
+		return cloudwatch.NewClient(context.Background(), cloudwatch.Config{
+			Region:          cfg.Scan.CloudWatch.Region,
+			Endpoint:        cfg.Scan.CloudWatch.Endpoint,
+			Namespaces:      cfg.Scan.CloudWatch.Namespaces,
+			IncludeInactive: cfg.Scan.CloudWatch.IncludeInactive,
+			SkipLabels:      cfg.Scan.SkipLabels,
+		})
+	})
+}
+
+// prometheusConfig is the client config of the modes that query a
+// Prometheus-compatible server.
+func prometheusConfig(cfg *config.Config) prometheus.Config {
+	return prometheus.Config{
+		URL:             cfg.Prometheus.URL,
+		Username:        cfg.Prometheus.Username,
+		Password:        cfg.Prometheus.Password,
+		BearerToken:     cfg.Prometheus.BearerToken,
+		BearerTokenFile: cfg.Prometheus.BearerTokenFile,
+		Timeout:         cfg.Prometheus.Timeout,
+		TLS:             tlsConfig(cfg.Prometheus.TLS),
+		Retry: prometheus.RetryConfig{
+			MaxAttempts:    cfg.Prometheus.Retry.MaxAttempts,
+			InitialBackoff: cfg.Prometheus.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Prometheus.Retry.MaxBackoff,
+		},
+		Breaker: prometheus.BreakerConfig{
+			FailureThreshold: cfg.Prometheus.CircuitBreaker.FailureThreshold,
+			Cooldown:         cfg.Prometheus.CircuitBreaker.Cooldown,
+		},
+		Lookback:        cfg.Scan.Lookback,
+		LabelValuesAPI:  cfg.Scan.LabelValuesAPI,
+		CardinalityAPI:  cfg.Scan.CardinalityAPI,
+		SeriesChunkSize: cfg.Scan.SeriesChunkSize,
+		MaxSeries:       cfg.Scan.MaxSeriesPerMetric,
+		SkipLabels:      cfg.Scan.SkipLabels,
+	}
+}
+
+func tlsConfig(t config.PrometheusTLSConfig) prometheus.TLSConfig {
+	return prometheus.TLSConfig{
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+}
+
+// newScrapeClient scrapes the configured targets plus, when enabled, every
+// annotated pod found through the Kubernetes API.
+func newScrapeClient(cfg *config.Config) (*prometheus.ScrapeClient, error) {
+	static := make([]prometheus.ScrapeTarget, len(cfg.Scan.Scrape.Targets))
+	for i, t := range cfg.Scan.Scrape.Targets {
+		static[i] = prometheus.ScrapeTarget{URL: t.URL, Labels: t.Labels}
+	}
+	sources := []prometheus.TargetSource{prometheus.StaticTargets(static)}
+
+	if disc := cfg.Scan.Scrape.Kubernetes; disc.Enabled {
+		kube, err := newKubernetesClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, func(ctx context.Context) ([]prometheus.ScrapeTarget, error) {
+			pods, err := kube.ListPods(ctx, disc.Namespaces, disc.LabelSelector)
+			if err != nil {
+				return nil, err
+			}
+			var targets []prometheus.ScrapeTarget
+			for _, pod := range pods {
+				if u, ok := pod.MetricsEndpoint(); ok {
+					targets = append(targets, prometheus.ScrapeTarget{URL: u, Labels: pod.TargetLabels()})
+				}
+			}
+			return targets, nil
+		})
+	}
+
+	return prometheus.NewScrapeClient(prometheus.ScrapeConfig{
+		Sources:     sources,
+		Timeout:     cfg.Scan.Scrape.Timeout,
+		Concurrency: cfg.Scan.Scrape.Concurrency,
+		TLS:         tlsConfig(cfg.Scan.Scrape.TLS),
+		SkipLabels:  cfg.Scan.SkipLabels,
+	})
+}
+
+// newOTelClient scrapes an OpenTelemetry Collector: its prometheus exporter
+// already labels series with the SDK's service, and its own telemetry is
+// attributed to a service of its own.
+func newOTelClient(cfg *config.Config) (*prometheus.ScrapeClient, error) {
+	var targets []prometheus.ScrapeTarget
+	for _, u := range cfg.Scan.OTel.ExporterURLs {
+		targets = append(targets, prometheus.ScrapeTarget{URL: u})
+	}
+	if cfg.Scan.OTel.TelemetryURL != "" {
+		labels := make(map[string]string)
+		for _, name := range cfg.Discovery.ServiceLabels() {
+			labels[name] = cfg.Scan.OTel.TelemetryService
+		}
+		targets = append(targets, prometheus.ScrapeTarget{URL: cfg.Scan.OTel.TelemetryURL, Labels: labels})
+	}
+
+	return prometheus.NewScrapeClient(prometheus.ScrapeConfig{
+		Sources:     []prometheus.TargetSource{prometheus.StaticTargets(targets)},
+		Timeout:     cfg.Scan.Scrape.Timeout,
+		Concurrency: cfg.Scan.Scrape.Concurrency,
+		TLS:         tlsConfig(cfg.Scan.Scrape.TLS),
+		SkipLabels:  cfg.Scan.SkipLabels,
+	})
+}
+
+func newDatadogClient(cfg *config.Config) *datadog.Client {
+	dd := cfg.Scan.Datadog
+	return datadog.NewClient(datadog.Config{
+		Site:           dd.Site,
+		APIKey:         dd.APIKey,
+		AppKey:         dd.AppKey,
+		Timeout:        dd.Timeout,
+		Lookback:       dd.Lookback,
+		TagFilter:      dd.TagFilter,
+		MetricPrefixes: dd.MetricPrefixes,
+		Concurrency:    cfg.Scan.Concurrency,
+		SkipLabels:     cfg.Scan.SkipLabels,
+	})
+}
@@ -50,7 +50,7 @@ func (r *AnalysisRepository) Create(ctx context.Context, currentID, previousID i
 
 func (r *AnalysisRepository) GetByPair(ctx context.Context, currentID, previousID int64) (*models.SnapshotAnalysis, error) {
 	query := `
-		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at
+		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at, prompt_tokens, response_tokens
 		FROM snapshot_analyses
 		WHERE current_snapshot_id = ? AND previous_snapshot_id = ?
 	`
@@ -59,7 +59,7 @@ func (r *AnalysisRepository) GetByPair(ctx context.Context, currentID, previousI
 
 func (r *AnalysisRepository) GetByID(ctx context.Context, id int64) (*models.SnapshotAnalysis, error) {
 	query := `
-		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at
+		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at, prompt_tokens, response_tokens
 		FROM snapshot_analyses
 		WHERE id = ?
 	`
@@ -68,7 +68,7 @@ func (r *AnalysisRepository) GetByID(ctx context.Context, id int64) (*models.Sna
 
 func (r *AnalysisRepository) ListBySnapshot(ctx context.Context, snapshotID int64) ([]models.SnapshotAnalysis, error) {
 	query := `
-		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at
+		SELECT id, current_snapshot_id, previous_snapshot_id, status, result, tool_calls, error, created_at, completed_at, prompt_tokens, response_tokens
 		FROM snapshot_analyses
 		WHERE current_snapshot_id = ? OR previous_snapshot_id = ?
 		ORDER BY created_at DESC
@@ -104,7 +104,7 @@ func (r *AnalysisRepository) Update(ctx context.Context, analysis *models.Snapsh
 
 	query := `
 		UPDATE snapshot_analyses
-		SET status = ?, result = ?, tool_calls = ?, error = ?, completed_at = ?
+		SET status = ?, result = ?, tool_calls = ?, error = ?, completed_at = ?, prompt_tokens = ?, response_tokens = ?
 		WHERE id = ?
 	`
 	_, err = r.db.conn.ExecContext(ctx, query,
@@ -113,11 +113,40 @@ func (r *AnalysisRepository) Update(ctx context.Context, analysis *models.Snapsh
 		string(toolCallsJSON),
 		analysis.Error,
 		completedAt,
+		analysis.PromptTokens,
+		analysis.ResponseTokens,
 		analysis.ID,
 	)
 	return err
 }
 
+// Usage sums token usage per calendar month of analyses created since the
+// given time, oldest month first. Deleted analyses no longer count.
+func (r *AnalysisRepository) Usage(ctx context.Context, since time.Time) ([]models.AnalysisUsage, error) {
+	query := `
+		SELECT substr(created_at, 1, 7) AS month, COUNT(*), SUM(prompt_tokens), SUM(response_tokens)
+		FROM snapshot_analyses
+		WHERE created_at >= ?
+		GROUP BY month
+		ORDER BY month
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []models.AnalysisUsage
+	for rows.Next() {
+		var u models.AnalysisUsage
+		if err := rows.Scan(&u.Month, &u.Analyses, &u.PromptTokens, &u.ResponseTokens); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
 func (r *AnalysisRepository) Delete(ctx context.Context, currentID, previousID int64) error {
 	query := `DELETE FROM snapshot_analyses WHERE current_snapshot_id = ? AND previous_snapshot_id = ?`
 	_, err := r.db.conn.ExecContext(ctx, query, currentID, previousID)
@@ -142,6 +171,8 @@ func (r *AnalysisRepository) scanOne(row *sql.Row) (*models.SnapshotAnalysis, er
 		&errStr,
 		&createdAt,
 		&completedAt,
+		&a.PromptTokens,
+		&a.ResponseTokens,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -198,6 +229,8 @@ func (r *AnalysisRepository) scanFromRows(rows *sql.Rows) (*models.SnapshotAnaly
 		&errStr,
 		&createdAt,
 		&completedAt,
+		&a.PromptTokens,
+		&a.ResponseTokens,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type AuditRepository struct {
+	db *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, e *models.AuditEntry) (int64, error) {
+	query := `
+		INSERT INTO audit_log (created_at, request_id, actor, remote_addr, method, path, query, body, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := r.db.conn.ExecContext(ctx, query,
+		e.CreatedAt.Format(time.RFC3339),
+		e.RequestID,
+		e.Actor,
+		e.RemoteAddr,
+		e.Method,
+		e.Path,
+		e.Query,
+		e.Body,
+		e.Status,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// List returns the most recent entries first.
+func (r *AuditRepository) List(ctx context.Context, limit int) ([]models.AuditEntry, error) {
+	query := `
+		SELECT id, created_at, request_id, actor, remote_addr, method, path, query, body, status
+		FROM audit_log
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &createdAt, &e.RequestID, &e.Actor, &e.RemoteAddr, &e.Method, &e.Path, &e.Query, &e.Body, &e.Status); err != nil {
+			return nil, err
+		}
+		e.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
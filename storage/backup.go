@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+// backupStepPages is how many pages are copied between context checks.
+const backupStepPages = 1024
+
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+}
+
+type restorer interface {
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// Backup writes a consistent copy of the database to path using SQLite's
+// online backup API. The database stays readable throughout, but writers
+// wait until the copy finishes since the pool holds a single connection.
+func (db *DB) Backup(ctx context.Context, path string) error {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		b, ok := driverConn.(backuper)
+		if !ok {
+			return fmt.Errorf("sqlite driver does not support backups")
+		}
+		backup, err := b.NewBackup(path)
+		if err != nil {
+			return fmt.Errorf("start backup: %w", err)
+		}
+		return runBackup(ctx, backup)
+	})
+}
+
+// Restore overwrites the database at dbPath with the backup at backupPath.
+// The server must not be running against dbPath while this happens.
+func Restore(ctx context.Context, dbPath, backupPath string) error {
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+
+	conn, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer conn.Close()
+
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer c.Close()
+
+	if err := c.Raw(func(driverConn any) error {
+		r, ok := driverConn.(restorer)
+		if !ok {
+			return fmt.Errorf("sqlite driver does not support restores")
+		}
+		backup, err := r.NewRestore(backupPath)
+		if err != nil {
+			return fmt.Errorf("start restore: %w", err)
+		}
+		return runBackup(ctx, backup)
+	}); err != nil {
+		return err
+	}
+
+	var result string
+	if err := c.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+func runBackup(ctx context.Context, backup *sqlite.Backup) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			backup.Finish()
+			return err
+		}
+		more, err := backup.Step(backupStepPages)
+		if err != nil {
+			backup.Finish()
+			return fmt.Errorf("backup step: %w", err)
+		}
+		if !more {
+			break
+		}
+	}
+	if err := backup.Finish(); err != nil {
+		return fmt.Errorf("finish backup: %w", err)
+	}
+	return nil
+}
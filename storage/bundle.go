@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+// ErrSnapshotExists is returned when importing a snapshot whose collection
+// time is already taken.
+var ErrSnapshotExists = errors.New("snapshot with the same collected_at already exists")
+
+// Export reads a snapshot with all its services, metrics and labels. It
+// returns nil when the snapshot doesn't exist.
+func (r *SnapshotsRepository) Export(ctx context.Context, id int64) (*models.SnapshotBundle, error) {
+	snapshot, err := r.GetByID(ctx, id)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+
+	servicesRepo := &ServicesRepository{db: r.db}
+	metricsRepo := &MetricsRepository{db: r.db}
+	labelsRepo := &LabelsRepository{db: r.db}
+
+	services, err := servicesRepo.List(ctx, id, ServiceListOptions{Sort: "name", Order: "asc"})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	bundle := &models.SnapshotBundle{
+		Version:    models.SnapshotBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Snapshot:   *snapshot,
+		Services:   make([]models.ServiceBundle, 0, len(services)),
+	}
+
+	for _, svc := range services {
+		metrics, err := metricsRepo.List(ctx, svc.ID, MetricListOptions{Sort: "name", Order: "asc"})
+		if err != nil {
+			return nil, fmt.Errorf("list metrics for %s: %w", svc.ServiceName, err)
+		}
+
+		sb := models.ServiceBundle{ServiceSnapshot: svc, Metrics: make([]models.MetricBundle, 0, len(metrics))}
+		for _, m := range metrics {
+			labels, err := labelsRepo.List(ctx, m.ID)
+			if err != nil {
+				return nil, fmt.Errorf("list labels for %s/%s: %w", svc.ServiceName, m.MetricName, err)
+			}
+			if labels == nil {
+				labels = []models.LabelSnapshot{}
+			}
+			sb.Metrics = append(sb.Metrics, models.MetricBundle{MetricSnapshot: m, Labels: labels})
+		}
+		bundle.Services = append(bundle.Services, sb)
+	}
+
+	return bundle, nil
+}
+
+// Import stores a bundle as a new snapshot in one transaction and returns
+// its ID.
+func (r *SnapshotsRepository) Import(ctx context.Context, b *models.SnapshotBundle) (int64, error) {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback snapshot import", "error", err)
+		}
+	}()
+
+	s := b.Snapshot
+	collectedAt := s.CollectedAt.Format(time.RFC3339)
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM snapshots WHERE collected_at = ?", collectedAt).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, ErrSnapshotExists
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO snapshots (collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, collectedAt, s.Status, s.ScanDurationMs, s.TotalServices, s.TotalSeries, s.SkippedMetrics, s.CopiedServices)
+	if err != nil {
+		return 0, fmt.Errorf("insert snapshot: %w", err)
+	}
+	snapshotID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	serviceStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO service_snapshots (snapshot_id, service_name, labels, environment, team, total_series, metric_count, missing, excluded_series)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer serviceStmt.Close()
+
+	metricStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer metricStmt.Close()
+
+	labelStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, values_id, truncated)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer labelStmt.Close()
+
+	for _, svc := range b.Services {
+		labels, err := marshalServiceLabels(svc.Labels)
+		if err != nil {
+			return 0, err
+		}
+		result, err := serviceStmt.ExecContext(ctx, snapshotID, svc.ServiceName, labels, svc.Environment, svc.Team, svc.TotalSeries, svc.MetricCount, svc.Missing, svc.ExcludedSeries)
+		if err != nil {
+			return 0, fmt.Errorf("insert service %s: %w", svc.ServiceName, err)
+		}
+		serviceID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, m := range svc.Metrics {
+			result, err := metricStmt.ExecContext(ctx, serviceID, m.MetricName, m.SeriesCount, m.LabelCount, m.MetricType, m.Help, m.Unit, m.NativeHistogram, m.ExemplarCount)
+			if err != nil {
+				return 0, fmt.Errorf("insert metric %s/%s: %w", svc.ServiceName, m.MetricName, err)
+			}
+			metricID, err := result.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+
+			for _, l := range m.Labels {
+				valuesID, err := putLabelValues(ctx, tx, l.LabelName, l.UniqueValuesCount, l.SampleValues, l.Redacted)
+				if err != nil {
+					return 0, fmt.Errorf("label %s: %w", l.LabelName, err)
+				}
+				if _, err := labelStmt.ExecContext(ctx, metricID, l.LabelName, l.UniqueValuesCount, valuesID, l.Truncated); err != nil {
+					return 0, fmt.Errorf("insert label %s: %w", l.LabelName, err)
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit import: %w", err)
+	}
+	return snapshotID, nil
+}
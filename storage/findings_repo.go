@@ -0,0 +1,500 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type FindingsRepository struct {
+	db *DB
+}
+
+func NewFindingsRepository(db *DB) *FindingsRepository {
+	return &FindingsRepository{db: db}
+}
+
+// Replace stores an analysis' findings, dropping any it had before, so a
+// regenerated analysis doesn't keep stale ones.
+func (r *FindingsRepository) Replace(ctx context.Context, analysisID int64, findings []models.Finding) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback findings update", "error", err)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM analysis_findings WHERE analysis_id = ?`, analysisID); err != nil {
+		return fmt.Errorf("delete findings: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO analysis_findings (analysis_id, snapshot_id, service_name, metric_name, label_name, kind, description, series_count, previous_series, severity, level, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, f := range findings {
+		if _, err := stmt.ExecContext(ctx,
+			analysisID,
+			f.SnapshotID,
+			f.ServiceName,
+			f.MetricName,
+			f.LabelName,
+			f.Kind,
+			f.Description,
+			f.SeriesCount,
+			f.PreviousSeries,
+			f.Severity,
+			f.Level,
+			f.CreatedAt.Format(time.RFC3339),
+		); err != nil {
+			return fmt.Errorf("insert finding %s/%s: %w", f.ServiceName, f.MetricName, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+type FindingListOptions struct {
+	// AnalysisID selects one analysis; zero means the latest completed one.
+	AnalysisID  int64
+	MinSeverity int
+}
+
+// List returns an analysis' findings, most severe first.
+func (r *FindingsRepository) List(ctx context.Context, opts FindingListOptions) ([]models.Finding, error) {
+	analysis := `?`
+	args := []any{opts.AnalysisID}
+	if opts.AnalysisID == 0 {
+		analysis = `(
+			SELECT id FROM snapshot_analyses
+			WHERE status = ?
+			ORDER BY current_snapshot_id DESC, completed_at DESC
+			LIMIT 1
+		)`
+		args = []any{models.AnalysisStatusCompleted}
+	}
+	query := `
+		SELECT id, analysis_id, snapshot_id, service_name, metric_name, label_name, kind, description, series_count, previous_series, severity, level, created_at
+		FROM analysis_findings
+		WHERE analysis_id = ` + analysis + ` AND severity >= ?
+		ORDER BY severity DESC, series_count DESC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, append(args, opts.MinSeverity)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []models.Finding
+	for rows.Next() {
+		var f models.Finding
+		var previous sql.NullInt64
+		var createdAt string
+		if err := rows.Scan(
+			&f.ID,
+			&f.AnalysisID,
+			&f.SnapshotID,
+			&f.ServiceName,
+			&f.MetricName,
+			&f.LabelName,
+			&f.Kind,
+			&f.Description,
+			&f.SeriesCount,
+			&previous,
+			&f.Severity,
+			&f.Level,
+			&createdAt,
+		); err != nil {
+			return nil, err
+		}
+		if previous.Valid {
+			n := int(previous.Int64)
+			f.PreviousSeries = &n
+		}
+		if f.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// Track records an analysis' findings in the tracked findings: new issues
+// open, known ones pick up the latest description and score, and resolved
+// ones reopen. Findings from a snapshot older than the one a tracked
+// finding was last seen or resolved in are ignored, so re-running an old
+// analysis doesn't reopen fixed issues.
+func (r *FindingsRepository) Track(ctx context.Context, findings []models.Finding) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback tracked findings update", "error", err)
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO tracked_findings (service_name, metric_name, label_name, kind, state, description, series_count, baseline_series, severity, level, first_seen, last_seen, last_snapshot_id, last_analysis_id)
+		VALUES (?, ?, ?, ?, 'open', ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(service_name, metric_name, label_name, kind) DO UPDATE SET
+			state = CASE WHEN tracked_findings.state = 'resolved' THEN 'open' ELSE tracked_findings.state END,
+			description = excluded.description,
+			series_count = excluded.series_count,
+			baseline_series = CASE WHEN tracked_findings.state = 'resolved' THEN excluded.baseline_series ELSE tracked_findings.baseline_series END,
+			severity = excluded.severity,
+			level = excluded.level,
+			first_seen = CASE WHEN tracked_findings.state = 'resolved' THEN excluded.first_seen ELSE tracked_findings.first_seen END,
+			last_seen = excluded.last_seen,
+			last_snapshot_id = excluded.last_snapshot_id,
+			last_analysis_id = excluded.last_analysis_id,
+			comment = CASE WHEN tracked_findings.state = 'resolved' THEN '' ELSE tracked_findings.comment END,
+			acknowledged_at = CASE WHEN tracked_findings.state = 'resolved' THEN NULL ELSE tracked_findings.acknowledged_at END,
+			resolved_at = NULL,
+			resolved_snapshot_id = NULL
+		WHERE excluded.last_snapshot_id >= COALESCE(tracked_findings.resolved_snapshot_id, tracked_findings.last_snapshot_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, f := range findings {
+		seen := f.CreatedAt.UTC().Format(time.RFC3339)
+		if _, err := stmt.ExecContext(ctx,
+			f.ServiceName,
+			f.MetricName,
+			f.LabelName,
+			f.Kind,
+			f.Description,
+			f.SeriesCount,
+			f.PreviousSeries,
+			f.Severity,
+			f.Level,
+			seen,
+			seen,
+			f.SnapshotID,
+			f.AnalysisID,
+		); err != nil {
+			return fmt.Errorf("upsert finding %s/%s: %w", f.ServiceName, f.MetricName, err)
+		}
+	}
+	return tx.Commit()
+}
+
+type TrackedFindingListOptions struct {
+	// States defaults to open and acknowledged.
+	States      []models.FindingState
+	Service     string
+	MinSeverity int
+	// IncludeSuppressed keeps snoozed findings and ones matching an ignore
+	// rule, which are left out by default.
+	IncludeSuppressed bool
+}
+
+// ListTracked returns tracked findings, open ones first, then most severe.
+func (r *FindingsRepository) ListTracked(ctx context.Context, opts TrackedFindingListOptions) ([]models.TrackedFinding, error) {
+	states := opts.States
+	if len(states) == 0 {
+		states = []models.FindingState{models.FindingOpen, models.FindingAcknowledged}
+	}
+	query := trackedFindingColumns + ` WHERE state IN (?` + strings.Repeat(", ?", len(states)-1) + `) AND severity >= ?`
+	args := make([]any, 0, len(states)+2)
+	for _, s := range states {
+		args = append(args, s)
+	}
+	args = append(args, opts.MinSeverity)
+	if opts.Service != "" {
+		query += " AND service_name = ?"
+		args = append(args, opts.Service)
+	}
+	var ignores []models.IgnoreRule
+	if !opts.IncludeSuppressed {
+		query += " AND (snoozed_until IS NULL OR snoozed_until <= ?)"
+		args = append(args, time.Now().UTC().Format(time.RFC3339))
+		var err error
+		if ignores, err = r.ListIgnores(ctx); err != nil {
+			return nil, fmt.Errorf("list ignore rules: %w", err)
+		}
+	}
+	query += `
+		ORDER BY CASE state WHEN 'open' THEN 0 WHEN 'acknowledged' THEN 1 ELSE 2 END,
+			severity DESC, last_seen DESC, service_name, metric_name
+	`
+
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []models.TrackedFinding
+	for rows.Next() {
+		f, err := scanTrackedFinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		if ignored(ignores, f.ServiceName, f.MetricName, f.LabelName) {
+			continue
+		}
+		findings = append(findings, *f)
+	}
+	return findings, rows.Err()
+}
+
+func (r *FindingsRepository) GetTracked(ctx context.Context, id int64) (*models.TrackedFinding, error) {
+	f, err := scanTrackedFinding(r.db.conn.QueryRowContext(ctx, trackedFindingColumns+" WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return f, err
+}
+
+// Acknowledge marks an unresolved finding as acknowledged, replacing any
+// earlier comment and assignee. It reports whether the finding was
+// updated.
+func (r *FindingsRepository) Acknowledge(ctx context.Context, id int64, comment, assignee string, at time.Time) (bool, error) {
+	res, err := r.db.conn.ExecContext(ctx, `
+		UPDATE tracked_findings
+		SET state = 'acknowledged', comment = ?, assignee = ?, acknowledged_at = ?
+		WHERE id = ? AND state <> 'resolved'
+	`, comment, assignee, at.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Snooze hides a finding until the given time, or shows it again when
+// until is nil. It reports whether the finding exists.
+func (r *FindingsRepository) Snooze(ctx context.Context, id int64, until *time.Time) (bool, error) {
+	var value any
+	if until != nil {
+		value = until.UTC().Format(time.RFC3339)
+	}
+	res, err := r.db.conn.ExecContext(ctx, `UPDATE tracked_findings SET snoozed_until = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ticketPending holds a finding's ticket key while its ticket is opened.
+const ticketPending = "pending"
+
+// ReserveTicket claims a finding without a ticket for the caller about to
+// open one, so concurrent requests can't open duplicates. It reports false
+// when the finding doesn't exist or already has, or is getting, a ticket.
+func (r *FindingsRepository) ReserveTicket(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.conn.ExecContext(ctx,
+		`UPDATE tracked_findings SET ticket_key = ? WHERE id = ? AND ticket_key = ''`,
+		ticketPending, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseTicket undoes ReserveTicket when opening the ticket failed.
+func (r *FindingsRepository) ReleaseTicket(ctx context.Context, id int64) error {
+	_, err := r.db.conn.ExecContext(ctx,
+		`UPDATE tracked_findings SET ticket_key = '' WHERE id = ? AND ticket_key = ?`,
+		id, ticketPending,
+	)
+	return err
+}
+
+// SetTicket links a finding to the ticket opened for it and reports
+// whether the finding exists.
+func (r *FindingsRepository) SetTicket(ctx context.Context, id int64, key, url string) (bool, error) {
+	res, err := r.db.conn.ExecContext(ctx, `UPDATE tracked_findings SET ticket_key = ?, ticket_url = ? WHERE id = ?`, key, url, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Resolve marks findings as fixed by a scan.
+func (r *FindingsRepository) Resolve(ctx context.Context, ids []int64, snapshotID int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback findings resolution", "error", err)
+		}
+	}()
+
+	resolved := at.UTC().Format(time.RFC3339)
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE tracked_findings
+			SET state = 'resolved', resolved_at = ?, resolved_snapshot_id = ?
+			WHERE id = ? AND state <> 'resolved'
+		`, resolved, snapshotID, id); err != nil {
+			return fmt.Errorf("resolve finding %d: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+const trackedFindingColumns = `
+	SELECT id, service_name, metric_name, label_name, kind, state, description, series_count, baseline_series, severity, level,
+		first_seen, last_seen, last_snapshot_id, last_analysis_id, assignee, comment, acknowledged_at, resolved_at, resolved_snapshot_id, snoozed_until,
+		ticket_key, ticket_url
+	FROM tracked_findings
+`
+
+func scanTrackedFinding(row rowScanner) (*models.TrackedFinding, error) {
+	var f models.TrackedFinding
+	var baseline, resolvedSnapshot sql.NullInt64
+	var firstSeen, lastSeen string
+	var acknowledgedAt, resolvedAt, snoozedUntil sql.NullString
+	if err := row.Scan(
+		&f.ID,
+		&f.ServiceName,
+		&f.MetricName,
+		&f.LabelName,
+		&f.Kind,
+		&f.State,
+		&f.Description,
+		&f.SeriesCount,
+		&baseline,
+		&f.Severity,
+		&f.Level,
+		&firstSeen,
+		&lastSeen,
+		&f.LastSnapshotID,
+		&f.LastAnalysisID,
+		&f.Assignee,
+		&f.Comment,
+		&acknowledgedAt,
+		&resolvedAt,
+		&resolvedSnapshot,
+		&snoozedUntil,
+		&f.TicketKey,
+		&f.TicketURL,
+	); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if f.FirstSeen, err = time.Parse(time.RFC3339, firstSeen); err != nil {
+		return nil, err
+	}
+	if f.LastSeen, err = time.Parse(time.RFC3339, lastSeen); err != nil {
+		return nil, err
+	}
+	if baseline.Valid {
+		n := int(baseline.Int64)
+		f.BaselineSeries = &n
+	}
+	if acknowledgedAt.Valid {
+		t, err := time.Parse(time.RFC3339, acknowledgedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		f.AcknowledgedAt = &t
+	}
+	if resolvedAt.Valid {
+		t, err := time.Parse(time.RFC3339, resolvedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		f.ResolvedAt = &t
+	}
+	if resolvedSnapshot.Valid {
+		f.ResolvedSnapshotID = &resolvedSnapshot.Int64
+	}
+	if snoozedUntil.Valid {
+		t, err := time.Parse(time.RFC3339, snoozedUntil.String)
+		if err != nil {
+			return nil, err
+		}
+		f.SnoozedUntil = &t
+	}
+	return &f, nil
+}
+
+// ListIgnores returns the ignore rules, oldest first.
+func (r *FindingsRepository) ListIgnores(ctx context.Context) ([]models.IgnoreRule, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT id, service_name, metric_name, label_name, reason, created_at
+		FROM ignore_rules
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.IgnoreRule
+	for rows.Next() {
+		var rule models.IgnoreRule
+		var createdAt string
+		if err := rows.Scan(&rule.ID, &rule.Service, &rule.Metric, &rule.Label, &rule.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		if rule.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// CreateIgnore adds an ignore rule, or updates the reason of an identical
+// one, and returns its ID.
+func (r *FindingsRepository) CreateIgnore(ctx context.Context, rule *models.IgnoreRule) (int64, error) {
+	var id int64
+	err := r.db.conn.QueryRowContext(ctx, `
+		INSERT INTO ignore_rules (service_name, metric_name, label_name, reason, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(service_name, metric_name, label_name) DO UPDATE SET reason = excluded.reason
+		RETURNING id
+	`, rule.Service, rule.Metric, rule.Label, rule.Reason, rule.CreatedAt.UTC().Format(time.RFC3339)).Scan(&id)
+	return id, err
+}
+
+// DeleteIgnore removes an ignore rule and reports whether it existed.
+func (r *FindingsRepository) DeleteIgnore(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.conn.ExecContext(ctx, `DELETE FROM ignore_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func ignored(rules []models.IgnoreRule, service, metric, label string) bool {
+	for _, rule := range rules {
+		if rule.Matches(service, metric, label) {
+			return true
+		}
+	}
+	return false
+}
@@ -10,19 +10,43 @@ import (
 type SnapshotsRepo interface {
 	Create(ctx context.Context, s *models.Snapshot) (int64, error)
 	Update(ctx context.Context, s *models.Snapshot) error
+	AbortRunning(ctx context.Context) (int64, error)
 	GetLatest(ctx context.Context) (*models.Snapshot, error)
+	GetLatestAnyStatus(ctx context.Context) (*models.Snapshot, error)
 	GetByID(ctx context.Context, id int64) (*models.Snapshot, error)
 	List(ctx context.Context, limit int) ([]models.Snapshot, error)
+	Trend(ctx context.Context, since time.Time) ([]models.TrendPoint, error)
 	GetByDate(ctx context.Context, date time.Time) (*models.Snapshot, error)
 	GetNDaysAgo(ctx context.Context, days int) (*models.Snapshot, error)
+	GetNearest(ctx context.Context, t time.Time) (*models.Snapshot, error)
+	GetPrevious(ctx context.Context, id int64) (*models.Snapshot, error)
+	SetBaseline(ctx context.Context, id int64) (bool, error)
+	ClearBaseline(ctx context.Context) error
+	GetBaseline(ctx context.Context) (*models.Snapshot, error)
 	DeleteOlderThan(ctx context.Context, days int) (int64, error)
+	SetServiceError(ctx context.Context, snapshotID int64, serviceName, errMsg string) error
+	ClearServiceError(ctx context.Context, snapshotID int64, serviceName string) error
+	ListServiceErrors(ctx context.Context, snapshotID int64) ([]models.ServiceError, error)
+	SetTSDBStats(ctx context.Context, snapshotID int64, stats *models.TSDBStats) error
+	GetTSDBStats(ctx context.Context, snapshotID int64) (*models.TSDBStats, error)
+	Export(ctx context.Context, id int64) (*models.SnapshotBundle, error)
+	Import(ctx context.Context, b *models.SnapshotBundle) (int64, error)
 }
 
 type ServicesRepo interface {
 	Create(ctx context.Context, s *models.ServiceSnapshot) (int64, error)
 	CreateBatch(ctx context.Context, services []*models.ServiceSnapshot) error
 	List(ctx context.Context, snapshotID int64, opts ServiceListOptions) ([]models.ServiceSnapshot, error)
+	ListBySnapshots(ctx context.Context, snapshotIDs []int64, opts ServiceListOptions) (map[int64][]models.ServiceSnapshot, error)
 	GetByName(ctx context.Context, snapshotID int64, name string) (*models.ServiceSnapshot, error)
+	ListTeams(ctx context.Context, snapshotID int64) ([]models.TeamSummary, error)
+	Trend(ctx context.Context, name string, since time.Time) ([]models.TrendPoint, error)
+	TeamTrend(ctx context.Context, team string, since time.Time) ([]models.TrendPoint, error)
+	Diff(ctx context.Context, fromID, toID int64) ([]models.ServiceDiff, error)
+	Delete(ctx context.Context, id int64) error
+	Replace(ctx context.Context, snapshotID int64, name string, id int64) error
+	CopyToSnapshot(ctx context.Context, serviceSnapshotID, snapshotID int64, totalSeries int, team string) error
+	CollectedSeries(ctx context.Context, snapshotID int64) (map[string]int, error)
 }
 
 type MetricsRepo interface {
@@ -30,6 +54,12 @@ type MetricsRepo interface {
 	CreateBatch(ctx context.Context, metrics []*models.MetricSnapshot) error
 	List(ctx context.Context, serviceSnapshotID int64, opts MetricListOptions) ([]models.MetricSnapshot, error)
 	GetByName(ctx context.Context, serviceSnapshotID int64, name string) (*models.MetricSnapshot, error)
+	Trend(ctx context.Context, metricName, serviceName string, since time.Time) ([]models.TrendPoint, error)
+	History(ctx context.Context, serviceName, metricName string, limit int) ([]models.MetricHistoryPoint, error)
+	Top(ctx context.Context, snapshotID, previousID int64, by string, limit int) ([]models.TopMetric, error)
+	Above(ctx context.Context, snapshotID int64, minSeries int) ([]models.TopMetric, error)
+	Match(ctx context.Context, snapshotID int64, pattern string, limit int) ([]models.TopMetric, error)
+	Changes(ctx context.Context, fromID, toID int64, limit int) ([]models.MetricDiff, error)
 }
 
 type LabelsRepo interface {
@@ -39,11 +69,68 @@ type LabelsRepo interface {
 	GetByName(ctx context.Context, metricSnapshotID int64, name string) (*models.LabelSnapshot, error)
 }
 
+type LogStreamsRepo interface {
+	Create(ctx context.Context, s *models.LogServiceSnapshot, labels []*models.LogLabelSnapshot) (int64, error)
+	List(ctx context.Context, snapshotID int64) ([]models.LogServiceSnapshot, error)
+	GetByName(ctx context.Context, snapshotID int64, name string) (*models.LogServiceSnapshot, error)
+	ListLabels(ctx context.Context, logServiceSnapshotID int64) ([]models.LogLabelSnapshot, error)
+	Trend(ctx context.Context, name string, since time.Time) ([]models.TrendPoint, error)
+}
+
+type SearchRepo interface {
+	Search(ctx context.Context, snapshotID int64, q string, limit int) ([]models.SearchResult, error)
+}
+
 type AnalysisRepo interface {
 	Create(ctx context.Context, currentID, previousID int64) (*models.SnapshotAnalysis, error)
 	GetByPair(ctx context.Context, currentID, previousID int64) (*models.SnapshotAnalysis, error)
 	GetByID(ctx context.Context, id int64) (*models.SnapshotAnalysis, error)
 	ListBySnapshot(ctx context.Context, snapshotID int64) ([]models.SnapshotAnalysis, error)
 	Update(ctx context.Context, analysis *models.SnapshotAnalysis) error
+	Usage(ctx context.Context, since time.Time) ([]models.AnalysisUsage, error)
 	Delete(ctx context.Context, currentID, previousID int64) error
 }
+
+type FindingsRepo interface {
+	Replace(ctx context.Context, analysisID int64, findings []models.Finding) error
+	List(ctx context.Context, opts FindingListOptions) ([]models.Finding, error)
+	Track(ctx context.Context, findings []models.Finding) error
+	ListTracked(ctx context.Context, opts TrackedFindingListOptions) ([]models.TrackedFinding, error)
+	GetTracked(ctx context.Context, id int64) (*models.TrackedFinding, error)
+	Acknowledge(ctx context.Context, id int64, comment, assignee string, at time.Time) (bool, error)
+	Resolve(ctx context.Context, ids []int64, snapshotID int64, at time.Time) error
+	Snooze(ctx context.Context, id int64, until *time.Time) (bool, error)
+	ReserveTicket(ctx context.Context, id int64) (bool, error)
+	ReleaseTicket(ctx context.Context, id int64) error
+	SetTicket(ctx context.Context, id int64, key, url string) (bool, error)
+	ListIgnores(ctx context.Context) ([]models.IgnoreRule, error)
+	CreateIgnore(ctx context.Context, rule *models.IgnoreRule) (int64, error)
+	DeleteIgnore(ctx context.Context, id int64) (bool, error)
+}
+
+type SettingsRepo interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+type AuditRepo interface {
+	Create(ctx context.Context, e *models.AuditEntry) (int64, error)
+	List(ctx context.Context, limit int) ([]models.AuditEntry, error)
+}
+
+type ScanRunsRepo interface {
+	Create(ctx context.Context, run *models.ScanRun) (int64, error)
+	Update(ctx context.Context, run *models.ScanRun) error
+	AbortRunning(ctx context.Context) (int64, error)
+	List(ctx context.Context, limit int) ([]models.ScanRun, error)
+}
+
+type RegressionsRepo interface {
+	Replace(ctx context.Context, snapshotID int64, regressions []models.Regression) error
+	List(ctx context.Context, snapshotID int64) ([]models.Regression, error)
+}
+
+type ViolationsRepo interface {
+	Record(ctx context.Context, snapshotID int64, at time.Time, violations []models.Violation, evaluated []string) error
+	List(ctx context.Context, includeResolved bool) ([]models.Violation, error)
+}
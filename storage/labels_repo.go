@@ -20,25 +20,40 @@ func NewLabelsRepository(db *DB) *LabelsRepository {
 }
 
 func (r *LabelsRepository) Create(ctx context.Context, l *models.LabelSnapshot) (int64, error) {
-	sampleJSON, err := json.Marshal(l.SampleValues)
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback label insert", "error", err)
+		}
+	}()
+
+	valuesID, err := putLabelValues(ctx, tx, l.LabelName, l.UniqueValuesCount, l.SampleValues, l.Redacted)
 	if err != nil {
-		return 0, fmt.Errorf("marshal sample values: %w", err)
+		return 0, err
 	}
 
 	query := `
-		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, sample_values)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, values_id, truncated)
+		VALUES (?, ?, ?, ?, ?)
 	`
-	result, err := r.db.conn.ExecContext(ctx, query,
+	result, err := tx.ExecContext(ctx, query,
 		l.MetricSnapshotID,
 		l.LabelName,
 		l.UniqueValuesCount,
-		string(sampleJSON),
+		valuesID,
+		l.Truncated,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert label snapshot: %w", err)
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
 func (r *LabelsRepository) CreateBatch(ctx context.Context, labels []*models.LabelSnapshot) error {
@@ -53,8 +68,8 @@ func (r *LabelsRepository) CreateBatch(ctx context.Context, labels []*models.Lab
 	}()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, sample_values)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, values_id, truncated)
+		VALUES (?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("prepare stmt: %w", err)
@@ -62,11 +77,11 @@ func (r *LabelsRepository) CreateBatch(ctx context.Context, labels []*models.Lab
 	defer stmt.Close()
 
 	for _, l := range labels {
-		sampleJSON, err := json.Marshal(l.SampleValues)
+		valuesID, err := putLabelValues(ctx, tx, l.LabelName, l.UniqueValuesCount, l.SampleValues, l.Redacted)
 		if err != nil {
-			return fmt.Errorf("marshal sample values for %s: %w", l.LabelName, err)
+			return fmt.Errorf("label %s: %w", l.LabelName, err)
 		}
-		if _, err = stmt.ExecContext(ctx, l.MetricSnapshotID, l.LabelName, l.UniqueValuesCount, string(sampleJSON)); err != nil {
+		if _, err = stmt.ExecContext(ctx, l.MetricSnapshotID, l.LabelName, l.UniqueValuesCount, valuesID, l.Truncated); err != nil {
 			return fmt.Errorf("insert label %s: %w", l.LabelName, err)
 		}
 	}
@@ -76,10 +91,11 @@ func (r *LabelsRepository) CreateBatch(ctx context.Context, labels []*models.Lab
 
 func (r *LabelsRepository) List(ctx context.Context, metricSnapshotID int64) ([]models.LabelSnapshot, error) {
 	query := `
-		SELECT id, metric_snapshot_id, label_name, unique_values_count, sample_values
-		FROM label_snapshots
-		WHERE metric_snapshot_id = ?
-		ORDER BY unique_values_count DESC
+		SELECT ls.id, ls.metric_snapshot_id, ls.label_name, ls.unique_values_count, lv.sample_values, lv.redacted, ls.truncated
+		FROM label_snapshots ls
+		LEFT JOIN label_values lv ON lv.id = ls.values_id
+		WHERE ls.metric_snapshot_id = ?
+		ORDER BY ls.unique_values_count DESC
 	`
 	rows, err := r.db.conn.QueryContext(ctx, query, metricSnapshotID)
 	if err != nil {
@@ -100,42 +116,67 @@ func (r *LabelsRepository) List(ctx context.Context, metricSnapshotID int64) ([]
 
 func (r *LabelsRepository) GetByName(ctx context.Context, metricSnapshotID int64, name string) (*models.LabelSnapshot, error) {
 	query := `
-		SELECT id, metric_snapshot_id, label_name, unique_values_count, sample_values
-		FROM label_snapshots
-		WHERE metric_snapshot_id = ? AND label_name = ?
+		SELECT ls.id, ls.metric_snapshot_id, ls.label_name, ls.unique_values_count, lv.sample_values, lv.redacted, ls.truncated
+		FROM label_snapshots ls
+		LEFT JOIN label_values lv ON lv.id = ls.values_id
+		WHERE ls.metric_snapshot_id = ? AND ls.label_name = ?
 	`
 	row := r.db.conn.QueryRowContext(ctx, query, metricSnapshotID, name)
 
 	var l models.LabelSnapshot
-	var sampleJSON sql.NullString
-	err := row.Scan(&l.ID, &l.MetricSnapshotID, &l.LabelName, &l.UniqueValuesCount, &sampleJSON)
+	var samples []byte
+	var redacted sql.NullString
+	err := row.Scan(&l.ID, &l.MetricSnapshotID, &l.LabelName, &l.UniqueValuesCount, &samples, &redacted, &l.Truncated)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	if sampleJSON.Valid && sampleJSON.String != "" {
-		if err := json.Unmarshal([]byte(sampleJSON.String), &l.SampleValues); err != nil {
-			return nil, err
-		}
+	if err := unmarshalLabelJSON(&l, samples, redacted); err != nil {
+		return nil, err
 	}
 	return &l, nil
 }
 
 func (r *LabelsRepository) scanFromRows(rows *sql.Rows) (*models.LabelSnapshot, error) {
 	var l models.LabelSnapshot
-	var sampleJSON sql.NullString
+	var samples []byte
+	var redacted sql.NullString
 
-	err := rows.Scan(&l.ID, &l.MetricSnapshotID, &l.LabelName, &l.UniqueValuesCount, &sampleJSON)
+	err := rows.Scan(&l.ID, &l.MetricSnapshotID, &l.LabelName, &l.UniqueValuesCount, &samples, &redacted, &l.Truncated)
 	if err != nil {
 		return nil, err
 	}
 
-	if sampleJSON.Valid && sampleJSON.String != "" {
-		if err := json.Unmarshal([]byte(sampleJSON.String), &l.SampleValues); err != nil {
-			return nil, err
-		}
+	if err := unmarshalLabelJSON(&l, samples, redacted); err != nil {
+		return nil, err
 	}
 	return &l, nil
 }
+
+func unmarshalLabelJSON(l *models.LabelSnapshot, samples []byte, redacted sql.NullString) error {
+	values, err := decodeSampleValues(samples)
+	if err != nil {
+		return err
+	}
+	l.SampleValues = values
+	if redacted.Valid && redacted.String != "" {
+		if err := json.Unmarshal([]byte(redacted.String), &l.Redacted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalRedacted stores NULL for labels nothing was redacted from.
+func marshalRedacted(classes []string) (sql.NullString, error) {
+	if len(classes) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(classes)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("marshal redacted classes: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
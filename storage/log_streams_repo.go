@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type LogStreamsRepository struct {
+	db *DB
+}
+
+func NewLogStreamsRepository(db *DB) *LogStreamsRepository {
+	return &LogStreamsRepository{db: db}
+}
+
+// Create stores a service's streams together with its labels in one
+// transaction, so a service is never visible half written. Storing a
+// service again for the same snapshot replaces it.
+func (r *LogStreamsRepository) Create(ctx context.Context, s *models.LogServiceSnapshot, labels []*models.LogLabelSnapshot) (int64, error) {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback log streams insert", "error", err)
+		}
+	}()
+
+	// A service rescan reruns the post-scan hooks on the same snapshot, so
+	// the service may already be stored; its labels are then replaced.
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO log_service_snapshots (snapshot_id, service_name, stream_count, label_count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(snapshot_id, service_name) DO UPDATE SET
+			stream_count = excluded.stream_count,
+			label_count = excluded.label_count
+		RETURNING id
+	`, s.SnapshotID, s.ServiceName, s.StreamCount, s.LabelCount).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert log service snapshot: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM log_label_snapshots WHERE log_service_snapshot_id = ?", id); err != nil {
+		return 0, fmt.Errorf("delete previous log labels: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO log_label_snapshots (log_service_snapshot_id, label_name, unique_values_count, values_id)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, l := range labels {
+		valuesID, err := putLabelValues(ctx, tx, l.LabelName, l.UniqueValuesCount, l.SampleValues, l.Redacted)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.ExecContext(ctx, id, l.LabelName, l.UniqueValuesCount, valuesID); err != nil {
+			return 0, fmt.Errorf("insert log label %s: %w", l.LabelName, err)
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *LogStreamsRepository) List(ctx context.Context, snapshotID int64) ([]models.LogServiceSnapshot, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT id, snapshot_id, service_name, stream_count, label_count
+		FROM log_service_snapshots
+		WHERE snapshot_id = ?
+		ORDER BY stream_count DESC
+	`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []models.LogServiceSnapshot
+	for rows.Next() {
+		var s models.LogServiceSnapshot
+		if err := rows.Scan(&s.ID, &s.SnapshotID, &s.ServiceName, &s.StreamCount, &s.LabelCount); err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+	}
+	return services, rows.Err()
+}
+
+func (r *LogStreamsRepository) GetByName(ctx context.Context, snapshotID int64, name string) (*models.LogServiceSnapshot, error) {
+	var s models.LogServiceSnapshot
+	err := r.db.conn.QueryRowContext(ctx, `
+		SELECT id, snapshot_id, service_name, stream_count, label_count
+		FROM log_service_snapshots
+		WHERE snapshot_id = ? AND service_name = ?
+	`, snapshotID, name).Scan(&s.ID, &s.SnapshotID, &s.ServiceName, &s.StreamCount, &s.LabelCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *LogStreamsRepository) ListLabels(ctx context.Context, logServiceSnapshotID int64) ([]models.LogLabelSnapshot, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT ll.id, ll.log_service_snapshot_id, ll.label_name, ll.unique_values_count, lv.sample_values, lv.redacted
+		FROM log_label_snapshots ll
+		LEFT JOIN label_values lv ON lv.id = ll.values_id
+		WHERE ll.log_service_snapshot_id = ?
+		ORDER BY ll.unique_values_count DESC
+	`, logServiceSnapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []models.LogLabelSnapshot
+	for rows.Next() {
+		var l models.LogLabelSnapshot
+		var samples []byte
+		var redacted sql.NullString
+		if err := rows.Scan(&l.ID, &l.LogServiceSnapshotID, &l.LabelName, &l.UniqueValuesCount, &samples, &redacted); err != nil {
+			return nil, err
+		}
+		// Same payload format as metric labels.
+		var decoded models.LabelSnapshot
+		if err := unmarshalLabelJSON(&decoded, samples, redacted); err != nil {
+			return nil, err
+		}
+		l.SampleValues, l.Redacted = decoded.SampleValues, decoded.Redacted
+		labels = append(labels, l)
+	}
+	return labels, rows.Err()
+}
+
+// Trend returns the service's stream count in every usable snapshot since
+// the given time, oldest first. Series carries the stream count.
+func (r *LogStreamsRepository) Trend(ctx context.Context, name string, since time.Time) ([]models.TrendPoint, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT s.id, s.collected_at, ls.stream_count
+		FROM log_service_snapshots ls
+		JOIN snapshots s ON s.id = ls.snapshot_id
+		WHERE ls.service_name = ? AND s.collected_at >= ? AND s.status IN ('completed', 'partial')
+		ORDER BY s.collected_at ASC
+	`, name, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTrend(rows)
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/illenko/whodidthis/models"
 )
@@ -20,14 +22,19 @@ func NewMetricsRepository(db *DB) *MetricsRepository {
 
 func (r *MetricsRepository) Create(ctx context.Context, m *models.MetricSnapshot) (int64, error) {
 	query := `
-		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	result, err := r.db.conn.ExecContext(ctx, query,
 		m.ServiceSnapshotID,
 		m.MetricName,
 		m.SeriesCount,
 		m.LabelCount,
+		m.MetricType,
+		m.Help,
+		m.Unit,
+		m.NativeHistogram,
+		m.ExemplarCount,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert metric snapshot: %w", err)
@@ -47,8 +54,8 @@ func (r *MetricsRepository) CreateBatch(ctx context.Context, metrics []*models.M
 	}()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("prepare stmt: %w", err)
@@ -56,7 +63,7 @@ func (r *MetricsRepository) CreateBatch(ctx context.Context, metrics []*models.M
 	defer stmt.Close()
 
 	for _, m := range metrics {
-		if _, err = stmt.ExecContext(ctx, m.ServiceSnapshotID, m.MetricName, m.SeriesCount, m.LabelCount); err != nil {
+		if _, err = stmt.ExecContext(ctx, m.ServiceSnapshotID, m.MetricName, m.SeriesCount, m.LabelCount, m.MetricType, m.Help, m.Unit, m.NativeHistogram, m.ExemplarCount); err != nil {
 			return fmt.Errorf("insert metric %s: %w", m.MetricName, err)
 		}
 	}
@@ -71,7 +78,7 @@ type MetricListOptions struct {
 
 func (r *MetricsRepository) List(ctx context.Context, serviceSnapshotID int64, opts MetricListOptions) ([]models.MetricSnapshot, error) {
 	query := `
-		SELECT id, service_snapshot_id, metric_name, series_count, label_count
+		SELECT id, service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count
 		FROM metric_snapshots
 		WHERE service_snapshot_id = ?
 	`
@@ -100,7 +107,7 @@ func (r *MetricsRepository) List(ctx context.Context, serviceSnapshotID int64, o
 	var metrics []models.MetricSnapshot
 	for rows.Next() {
 		var m models.MetricSnapshot
-		if err := rows.Scan(&m.ID, &m.ServiceSnapshotID, &m.MetricName, &m.SeriesCount, &m.LabelCount); err != nil {
+		if err := rows.Scan(&m.ID, &m.ServiceSnapshotID, &m.MetricName, &m.SeriesCount, &m.LabelCount, &m.MetricType, &m.Help, &m.Unit, &m.NativeHistogram, &m.ExemplarCount); err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, m)
@@ -110,13 +117,13 @@ func (r *MetricsRepository) List(ctx context.Context, serviceSnapshotID int64, o
 
 func (r *MetricsRepository) GetByName(ctx context.Context, serviceSnapshotID int64, name string) (*models.MetricSnapshot, error) {
 	query := `
-		SELECT id, service_snapshot_id, metric_name, series_count, label_count
+		SELECT id, service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count
 		FROM metric_snapshots
 		WHERE service_snapshot_id = ? AND metric_name = ?
 	`
 	var m models.MetricSnapshot
 	err := r.db.conn.QueryRowContext(ctx, query, serviceSnapshotID, name).Scan(
-		&m.ID, &m.ServiceSnapshotID, &m.MetricName, &m.SeriesCount, &m.LabelCount,
+		&m.ID, &m.ServiceSnapshotID, &m.MetricName, &m.SeriesCount, &m.LabelCount, &m.MetricType, &m.Help, &m.Unit, &m.NativeHistogram, &m.ExemplarCount,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -126,3 +133,228 @@ func (r *MetricsRepository) GetByName(ctx context.Context, serviceSnapshotID int
 	}
 	return &m, nil
 }
+
+// Trend returns the metric's series count summed across services (or for
+// one service when given) in every usable snapshot since the given time,
+// oldest first.
+func (r *MetricsRepository) Trend(ctx context.Context, metricName, serviceName string, since time.Time) ([]models.TrendPoint, error) {
+	query := `
+		SELECT s.id, s.collected_at, SUM(ms.series_count)
+		FROM metric_snapshots ms
+		JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+		JOIN snapshots s ON s.id = ss.snapshot_id
+		WHERE ms.metric_name = ? AND s.collected_at >= ? AND s.status IN ('completed', 'partial')
+	`
+	args := []interface{}{metricName, since.Format(time.RFC3339)}
+
+	if serviceName != "" {
+		query += " AND ss.service_name = ?"
+		args = append(args, serviceName)
+	}
+
+	query += " GROUP BY s.id, s.collected_at ORDER BY s.collected_at ASC"
+
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTrend(rows)
+}
+
+// History returns a service metric's series and label counts in the most
+// recent usable snapshots that contain it, oldest first.
+func (r *MetricsRepository) History(ctx context.Context, serviceName, metricName string, limit int) ([]models.MetricHistoryPoint, error) {
+	query := `
+		SELECT id, collected_at, series_count, label_count FROM (
+			SELECT s.id, s.collected_at, ms.series_count, ms.label_count
+			FROM metric_snapshots ms
+			JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+			JOIN snapshots s ON s.id = ss.snapshot_id
+			WHERE ss.service_name = ? AND ms.metric_name = ? AND s.status IN ('completed', 'partial')
+			ORDER BY s.collected_at DESC
+			LIMIT ?
+		)
+		ORDER BY collected_at ASC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, serviceName, metricName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []models.MetricHistoryPoint
+	for rows.Next() {
+		var p models.MetricHistoryPoint
+		var collectedAt string
+		if err := rows.Scan(&p.SnapshotID, &collectedAt, &p.SeriesCount, &p.LabelCount); err != nil {
+			return nil, err
+		}
+		if p.CollectedAt, err = time.Parse(time.RFC3339, collectedAt); err != nil {
+			return nil, err
+		}
+		if n := len(points); n > 0 {
+			p.SeriesDelta = p.SeriesCount - points[n-1].SeriesCount
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// Top ranks every service metric in a snapshot by series count, label count
+// or growth since previousID, which may be zero when there is nothing to
+// compare against.
+func (r *MetricsRepository) Top(ctx context.Context, snapshotID, previousID int64, by string, limit int) ([]models.TopMetric, error) {
+	query := `
+		SELECT ss.service_name, ms.metric_name, ms.series_count, ms.label_count, COALESCE(pm.series_count, 0)
+		FROM metric_snapshots ms
+		JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+		LEFT JOIN (
+			SELECT pss.service_name, pms.metric_name, pms.series_count
+			FROM metric_snapshots pms
+			JOIN service_snapshots pss ON pss.id = pms.service_snapshot_id
+			WHERE pss.snapshot_id = ?
+		) pm ON pm.service_name = ss.service_name AND pm.metric_name = ms.metric_name
+		WHERE ss.snapshot_id = ?
+	`
+
+	switch by {
+	case "labels":
+		query += " ORDER BY ms.label_count DESC, ms.series_count DESC"
+	case "growth":
+		query += " ORDER BY ms.series_count - COALESCE(pm.series_count, 0) DESC, ms.series_count DESC"
+	default:
+		query += " ORDER BY ms.series_count DESC"
+	}
+	query += " LIMIT ?"
+
+	rows, err := r.db.conn.QueryContext(ctx, query, previousID, snapshotID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var top []models.TopMetric
+	for rows.Next() {
+		var m models.TopMetric
+		var previous int
+		if err := rows.Scan(&m.ServiceName, &m.MetricName, &m.SeriesCount, &m.LabelCount, &previous); err != nil {
+			return nil, err
+		}
+		if previousID != 0 {
+			delta := m.SeriesCount - previous
+			m.PreviousSeries = &previous
+			m.SeriesDelta = &delta
+		}
+		top = append(top, m)
+	}
+	return top, rows.Err()
+}
+
+// Above returns every service metric in a snapshot with more than
+// minSeries series, largest first.
+func (r *MetricsRepository) Above(ctx context.Context, snapshotID int64, minSeries int) ([]models.TopMetric, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT ss.service_name, ms.metric_name, ms.series_count, ms.label_count
+		FROM metric_snapshots ms
+		JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+		WHERE ss.snapshot_id = ? AND ms.series_count > ?
+		ORDER BY ms.series_count DESC
+	`, snapshotID, minSeries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.TopMetric
+	for rows.Next() {
+		var m models.TopMetric
+		if err := rows.Scan(&m.ServiceName, &m.MetricName, &m.SeriesCount, &m.LabelCount); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// Match returns up to limit service metrics in a snapshot whose name
+// matches a glob (*, ?, [...]), largest first. A pattern without wildcards
+// matches anywhere in the name.
+func (r *MetricsRepository) Match(ctx context.Context, snapshotID int64, pattern string, limit int) ([]models.TopMetric, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		pattern = "*" + pattern + "*"
+	}
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT ss.service_name, ms.metric_name, ms.series_count, ms.label_count
+		FROM metric_snapshots ms
+		JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+		WHERE ss.snapshot_id = ? AND ms.metric_name GLOB ?
+		ORDER BY ms.series_count DESC, ss.service_name, ms.metric_name
+		LIMIT ?
+	`, snapshotID, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.TopMetric
+	for rows.Next() {
+		var m models.TopMetric
+		if err := rows.Scan(&m.ServiceName, &m.MetricName, &m.SeriesCount, &m.LabelCount); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// Changes compares every service metric of two snapshots and returns the
+// limit biggest absolute series changes, metrics that came or went
+// included.
+func (r *MetricsRepository) Changes(ctx context.Context, fromID, toID int64, limit int) ([]models.MetricDiff, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT COALESCE(c.service_name, p.service_name), COALESCE(c.metric_name, p.metric_name),
+			p.service_name IS NOT NULL, c.service_name IS NOT NULL,
+			COALESCE(p.series_count, 0), COALESCE(c.series_count, 0)
+		FROM (
+			SELECT ss.service_name, ms.metric_name, ms.series_count
+			FROM metric_snapshots ms
+			JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+			WHERE ss.snapshot_id = ?
+		) c
+		FULL OUTER JOIN (
+			SELECT ss.service_name, ms.metric_name, ms.series_count
+			FROM metric_snapshots ms
+			JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+			WHERE ss.snapshot_id = ?
+		) p ON p.service_name = c.service_name AND p.metric_name = c.metric_name
+		WHERE COALESCE(c.series_count, 0) <> COALESCE(p.series_count, 0)
+		ORDER BY ABS(COALESCE(c.series_count, 0) - COALESCE(p.series_count, 0)) DESC, 1, 2
+		LIMIT ?
+	`, toID, fromID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var diffs []models.MetricDiff
+	for rows.Next() {
+		var d models.MetricDiff
+		var inPrevious, inCurrent bool
+		if err := rows.Scan(&d.ServiceName, &d.MetricName, &inPrevious, &inCurrent, &d.PreviousSeries, &d.CurrentSeries); err != nil {
+			return nil, err
+		}
+		d.SeriesDelta = d.CurrentSeries - d.PreviousSeries
+		switch {
+		case !inPrevious:
+			d.Status = models.DiffAdded
+		case !inCurrent:
+			d.Status = models.DiffRemoved
+		default:
+			d.Status = models.DiffChanged
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, rows.Err()
+}
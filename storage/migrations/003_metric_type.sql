@@ -0,0 +1,4 @@
+-- Metric type from Prometheus metadata, plus histogram/exemplar details
+ALTER TABLE metric_snapshots ADD COLUMN metric_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE metric_snapshots ADD COLUMN native_histogram INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE metric_snapshots ADD COLUMN exemplar_count INTEGER NOT NULL DEFAULT 0;
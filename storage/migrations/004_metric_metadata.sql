@@ -0,0 +1,3 @@
+-- HELP and UNIT from Prometheus metric metadata
+ALTER TABLE metric_snapshots ADD COLUMN help TEXT NOT NULL DEFAULT '';
+ALTER TABLE metric_snapshots ADD COLUMN unit TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Number of metrics dropped by scan.metric_exclude patterns
+ALTER TABLE snapshots ADD COLUMN skipped_metrics INTEGER NOT NULL DEFAULT 0;
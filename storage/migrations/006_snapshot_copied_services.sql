@@ -0,0 +1,2 @@
+-- Number of services carried forward unchanged by an incremental scan
+ALTER TABLE snapshots ADD COLUMN copied_services INTEGER NOT NULL DEFAULT 0;
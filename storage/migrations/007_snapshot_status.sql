@@ -0,0 +1,2 @@
+-- Lifecycle status of a snapshot: running, completed, aborted, failed
+ALTER TABLE snapshots ADD COLUMN status TEXT NOT NULL DEFAULT 'completed';
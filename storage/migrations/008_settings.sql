@@ -0,0 +1,6 @@
+-- Runtime state that must survive restarts (e.g. scheduler pause)
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
@@ -0,0 +1,15 @@
+-- History of scan executions, including failed and cancelled ones
+CREATE TABLE IF NOT EXISTS scan_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trigger TEXT NOT NULL,
+    service TEXT NOT NULL DEFAULT '',
+    snapshot_id INTEGER,
+    status TEXT NOT NULL,
+    started_at TEXT NOT NULL,
+    finished_at TEXT,
+    total_services INTEGER NOT NULL DEFAULT 0,
+    total_series INTEGER NOT NULL DEFAULT 0,
+    service_errors TEXT,
+    error TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_scan_runs_started ON scan_runs(started_at DESC);
@@ -0,0 +1,10 @@
+-- Services that failed to collect within a snapshot, and why
+CREATE TABLE IF NOT EXISTS service_errors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    service_name TEXT NOT NULL,
+    error TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    UNIQUE(snapshot_id, service_name)
+);
+CREATE INDEX IF NOT EXISTS idx_service_errors_snapshot ON service_errors(snapshot_id);
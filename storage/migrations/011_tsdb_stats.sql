@@ -0,0 +1,11 @@
+-- Head block stats from /api/v1/status/tsdb, captured at the start of a scan
+CREATE TABLE IF NOT EXISTS snapshot_tsdb_stats (
+    snapshot_id INTEGER PRIMARY KEY REFERENCES snapshots(id) ON DELETE CASCADE,
+    head_series INTEGER NOT NULL,
+    head_label_pairs INTEGER NOT NULL,
+    head_chunks INTEGER NOT NULL,
+    min_time TEXT NOT NULL,
+    max_time TEXT NOT NULL,
+    top_metrics TEXT NOT NULL,
+    top_label_names TEXT NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Set when a metric exceeded scan.max_series_per_metric and its label counts
+-- only cover the series that were fetched
+ALTER TABLE label_snapshots ADD COLUMN truncated INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Redaction classes applied to sample_values, as a JSON array
+ALTER TABLE label_snapshots ADD COLUMN redacted TEXT;
@@ -0,0 +1,2 @@
+-- Discovery label values a service key was built from, as a JSON object
+ALTER TABLE service_snapshots ADD COLUMN labels TEXT;
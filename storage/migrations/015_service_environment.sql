@@ -0,0 +1,3 @@
+-- Value of discovery.environment_label for the service, if configured
+ALTER TABLE service_snapshots ADD COLUMN environment TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_service_snapshots_environment ON service_snapshots(snapshot_id, environment);
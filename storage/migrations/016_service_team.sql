@@ -0,0 +1,3 @@
+-- Owning team from the teams config, stamped at collection time
+ALTER TABLE service_snapshots ADD COLUMN team TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_service_snapshots_team ON service_snapshots(snapshot_id, team);
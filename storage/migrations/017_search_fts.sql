@@ -0,0 +1,30 @@
+-- Trigram full-text indexes backing snapshot search. Rowids mirror the
+-- source tables and triggers keep them in step, including cascaded deletes.
+CREATE VIRTUAL TABLE IF NOT EXISTS metric_search USING fts5(metric_name, tokenize='trigram');
+CREATE VIRTUAL TABLE IF NOT EXISTS label_search USING fts5(label_name, sample_values, tokenize='trigram');
+
+CREATE TRIGGER IF NOT EXISTS metric_search_insert AFTER INSERT ON metric_snapshots BEGIN
+    INSERT INTO metric_search (rowid, metric_name) VALUES (new.id, new.metric_name);
+END;
+
+CREATE TRIGGER IF NOT EXISTS metric_search_delete AFTER DELETE ON metric_snapshots BEGIN
+    DELETE FROM metric_search WHERE rowid = old.id;
+END;
+
+-- Sample values are indexed one per line rather than as the stored JSON so
+-- escaped characters still match.
+CREATE TRIGGER IF NOT EXISTS label_search_insert AFTER INSERT ON label_snapshots BEGIN
+    INSERT INTO label_search (rowid, label_name, sample_values)
+    VALUES (new.id, new.label_name, (SELECT group_concat(value, char(10)) FROM json_each(COALESCE(new.sample_values, '[]'))));
+END;
+
+CREATE TRIGGER IF NOT EXISTS label_search_delete AFTER DELETE ON label_snapshots BEGIN
+    DELETE FROM label_search WHERE rowid = old.id;
+END;
+
+INSERT INTO metric_search (rowid, metric_name)
+SELECT id, metric_name FROM metric_snapshots;
+
+INSERT INTO label_search (rowid, label_name, sample_values)
+SELECT id, label_name, (SELECT group_concat(value, char(10)) FROM json_each(COALESCE(sample_values, '[]')))
+FROM label_snapshots;
@@ -0,0 +1,12 @@
+-- Sample values may now be stored zstd-compressed, so the search trigger
+-- decodes them through sample_values_text() instead of json_each().
+DROP TRIGGER IF EXISTS label_search_insert;
+
+CREATE TRIGGER IF NOT EXISTS label_search_insert AFTER INSERT ON label_snapshots BEGIN
+    INSERT INTO label_search (rowid, label_name, sample_values)
+    VALUES (new.id, new.label_name, sample_values_text(new.sample_values));
+END;
+
+UPDATE label_snapshots
+SET sample_values = sample_values_compress(sample_values)
+WHERE typeof(sample_values) = 'text' AND length(sample_values) > 128;
@@ -0,0 +1,56 @@
+-- Label samples move to a content-addressed table so labels that don't
+-- change between scans share one stored payload.
+CREATE TABLE IF NOT EXISTS label_values (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash TEXT NOT NULL UNIQUE,
+    sample_values BLOB,
+    redacted TEXT
+);
+
+ALTER TABLE label_snapshots ADD COLUMN values_id INTEGER REFERENCES label_values(id);
+
+INSERT OR IGNORE INTO label_values (hash, sample_values, redacted)
+SELECT label_values_hash(sample_values, redacted), sample_values, redacted
+FROM label_snapshots
+ORDER BY id;
+
+UPDATE label_snapshots
+SET values_id = (
+    SELECT id FROM label_values
+    WHERE hash = label_values_hash(label_snapshots.sample_values, label_snapshots.redacted)
+);
+
+CREATE INDEX IF NOT EXISTS idx_label_snapshots_values ON label_snapshots(values_id);
+
+-- Sample values are now searched once per payload rather than per label.
+DROP TRIGGER IF EXISTS label_search_insert;
+DROP TRIGGER IF EXISTS label_search_delete;
+DROP TABLE IF EXISTS label_search;
+
+ALTER TABLE label_snapshots DROP COLUMN sample_values;
+ALTER TABLE label_snapshots DROP COLUMN redacted;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS label_search USING fts5(label_name, tokenize='trigram');
+CREATE VIRTUAL TABLE IF NOT EXISTS value_search USING fts5(sample_values, tokenize='trigram');
+
+CREATE TRIGGER IF NOT EXISTS label_search_insert AFTER INSERT ON label_snapshots BEGIN
+    INSERT INTO label_search (rowid, label_name) VALUES (new.id, new.label_name);
+END;
+
+CREATE TRIGGER IF NOT EXISTS label_search_delete AFTER DELETE ON label_snapshots BEGIN
+    DELETE FROM label_search WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS value_search_insert AFTER INSERT ON label_values BEGIN
+    INSERT INTO value_search (rowid, sample_values) VALUES (new.id, sample_values_text(new.sample_values));
+END;
+
+CREATE TRIGGER IF NOT EXISTS value_search_delete AFTER DELETE ON label_values BEGIN
+    DELETE FROM value_search WHERE rowid = old.id;
+END;
+
+INSERT INTO label_search (rowid, label_name)
+SELECT id, label_name FROM label_snapshots;
+
+INSERT INTO value_search (rowid, sample_values)
+SELECT id, sample_values_text(sample_values) FROM label_values;
@@ -0,0 +1,2 @@
+-- Services the discovery backend expects but that reported no series
+ALTER TABLE service_snapshots ADD COLUMN missing INTEGER NOT NULL DEFAULT 0;
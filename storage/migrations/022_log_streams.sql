@@ -0,0 +1,21 @@
+-- Loki stream cardinality, parallel to service_snapshots/label_snapshots and
+-- attached to the same snapshots
+CREATE TABLE IF NOT EXISTS log_service_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    service_name TEXT NOT NULL,
+    stream_count INTEGER NOT NULL DEFAULT 0,
+    label_count INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(snapshot_id, service_name)
+);
+CREATE INDEX IF NOT EXISTS idx_log_service_snapshots_name ON log_service_snapshots(service_name);
+
+CREATE TABLE IF NOT EXISTS log_label_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    log_service_snapshot_id INTEGER NOT NULL REFERENCES log_service_snapshots(id) ON DELETE CASCADE,
+    label_name TEXT NOT NULL,
+    unique_values_count INTEGER NOT NULL DEFAULT 0,
+    values_id INTEGER REFERENCES label_values(id),
+    UNIQUE(log_service_snapshot_id, label_name)
+);
+CREATE INDEX IF NOT EXISTS idx_log_label_snapshots_values ON log_label_snapshots(values_id);
@@ -0,0 +1,15 @@
+-- At most one snapshot is the baseline that later scans are compared with;
+-- retention and downsampling keep it
+ALTER TABLE snapshots ADD COLUMN baseline INTEGER NOT NULL DEFAULT 0;
+
+-- Services that grew past the regression thresholds since the baseline
+CREATE TABLE IF NOT EXISTS regressions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    baseline_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    service_name TEXT NOT NULL,
+    baseline_series INTEGER NOT NULL,
+    current_series INTEGER NOT NULL,
+    UNIQUE(snapshot_id, service_name)
+);
+CREATE INDEX IF NOT EXISTS idx_regressions_snapshot ON regressions(snapshot_id);
@@ -0,0 +1,16 @@
+-- Service metrics over their configured series limit. A violation lives
+-- across scans: first_seen is when it started, last_seen the latest scan
+-- that still found it, and it turns inactive once a scan no longer does
+CREATE TABLE IF NOT EXISTS violations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    metric_name TEXT NOT NULL,
+    max_series INTEGER NOT NULL,
+    series_count INTEGER NOT NULL,
+    first_seen TEXT NOT NULL,
+    last_seen TEXT NOT NULL,
+    last_snapshot_id INTEGER NOT NULL,
+    active INTEGER NOT NULL DEFAULT 1,
+    UNIQUE(service_name, metric_name)
+);
+CREATE INDEX IF NOT EXISTS idx_violations_active ON violations(active);
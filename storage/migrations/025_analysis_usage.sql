@@ -0,0 +1,3 @@
+-- Gemini token usage per analysis, for cost accounting
+ALTER TABLE snapshot_analyses ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE snapshot_analyses ADD COLUMN response_tokens INTEGER NOT NULL DEFAULT 0;
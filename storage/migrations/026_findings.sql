@@ -0,0 +1,18 @@
+-- Issues reported by an analysis, scored 0-100 by series impact and growth
+CREATE TABLE IF NOT EXISTS analysis_findings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    analysis_id INTEGER NOT NULL,
+    snapshot_id INTEGER NOT NULL,
+    service_name TEXT NOT NULL,
+    metric_name TEXT NOT NULL,
+    label_name TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    series_count INTEGER NOT NULL,
+    previous_series INTEGER,
+    severity INTEGER NOT NULL,
+    level TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    FOREIGN KEY (analysis_id) REFERENCES snapshot_analyses(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_findings_analysis ON analysis_findings(analysis_id, severity);
@@ -0,0 +1,27 @@
+-- Findings tracked across analyses, one per service metric, label and kind.
+-- A finding is open until someone acknowledges it, and resolved once a
+-- later scan shows the cardinality fixed; reporting it again reopens it
+CREATE TABLE IF NOT EXISTS tracked_findings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL,
+    metric_name TEXT NOT NULL,
+    label_name TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'open',
+    description TEXT NOT NULL DEFAULT '',
+    series_count INTEGER NOT NULL,
+    baseline_series INTEGER,
+    severity INTEGER NOT NULL,
+    level TEXT NOT NULL,
+    first_seen TEXT NOT NULL,
+    last_seen TEXT NOT NULL,
+    last_snapshot_id INTEGER NOT NULL,
+    last_analysis_id INTEGER NOT NULL,
+    assignee TEXT NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    acknowledged_at TEXT,
+    resolved_at TEXT,
+    resolved_snapshot_id INTEGER,
+    UNIQUE(service_name, metric_name, label_name, kind)
+);
+CREATE INDEX IF NOT EXISTS idx_tracked_findings_state ON tracked_findings(state, severity);
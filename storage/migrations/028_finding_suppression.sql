@@ -0,0 +1,15 @@
+-- Snoozed findings stay hidden until snoozed_until passes
+ALTER TABLE tracked_findings ADD COLUMN snoozed_until TEXT;
+
+-- Cardinality operators have accepted. Service, metric and label are globs;
+-- an empty label covers every label of the metric, and issues matching a
+-- rule are left out of analyses and the findings list
+CREATE TABLE IF NOT EXISTS ignore_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    service_name TEXT NOT NULL DEFAULT '*',
+    metric_name TEXT NOT NULL,
+    label_name TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    UNIQUE(service_name, metric_name, label_name)
+);
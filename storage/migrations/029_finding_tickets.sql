@@ -0,0 +1,3 @@
+-- The issue tracker ticket opened for a finding
+ALTER TABLE tracked_findings ADD COLUMN ticket_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE tracked_findings ADD COLUMN ticket_url TEXT NOT NULL DEFAULT '';
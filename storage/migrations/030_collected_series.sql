@@ -0,0 +1,3 @@
+-- Series total of the last full collection a copied service's data comes
+-- from; NULL on services collected in their own snapshot
+ALTER TABLE service_snapshots ADD COLUMN collected_series INTEGER;
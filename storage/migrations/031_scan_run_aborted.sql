@@ -0,0 +1,2 @@
+-- Cancelled scan runs are recorded as aborted, like their snapshots.
+UPDATE scan_runs SET status = 'aborted' WHERE status = 'cancelled';
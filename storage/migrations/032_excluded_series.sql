@@ -0,0 +1,3 @@
+-- Series of the metrics scan.metric_exclude left out of a service, which
+-- total_series no longer counts
+ALTER TABLE service_snapshots ADD COLUMN excluded_series INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type RegressionsRepository struct {
+	db *DB
+}
+
+func NewRegressionsRepository(db *DB) *RegressionsRepository {
+	return &RegressionsRepository{db: db}
+}
+
+// Replace stores a snapshot's regressions in place of any found before, so
+// rescanning a service into the snapshot doesn't leave stale entries.
+func (r *RegressionsRepository) Replace(ctx context.Context, snapshotID int64, regressions []models.Regression) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback regressions update", "error", err)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM regressions WHERE snapshot_id = ?", snapshotID); err != nil {
+		return fmt.Errorf("delete regressions: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO regressions (snapshot_id, baseline_id, service_name, baseline_series, current_series)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, reg := range regressions {
+		if _, err := stmt.ExecContext(ctx, snapshotID, reg.BaselineID, reg.ServiceName, reg.BaselineSeries, reg.CurrentSeries); err != nil {
+			return fmt.Errorf("insert regression %s: %w", reg.ServiceName, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// List returns a snapshot's regressions, biggest growth first.
+func (r *RegressionsRepository) List(ctx context.Context, snapshotID int64) ([]models.Regression, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT id, snapshot_id, baseline_id, service_name, baseline_series, current_series
+		FROM regressions
+		WHERE snapshot_id = ?
+		ORDER BY current_series - baseline_series DESC, service_name
+	`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var regressions []models.Regression
+	for rows.Next() {
+		var reg models.Regression
+		if err := rows.Scan(&reg.ID, &reg.SnapshotID, &reg.BaselineID, &reg.ServiceName, &reg.BaselineSeries, &reg.CurrentSeries); err != nil {
+			return nil, err
+		}
+		reg.SeriesDelta = reg.CurrentSeries - reg.BaselineSeries
+		if reg.BaselineSeries > 0 {
+			pct := float64(reg.SeriesDelta) * 100 / float64(reg.BaselineSeries)
+			reg.SeriesDeltaPct = &pct
+		}
+		regressions = append(regressions, reg)
+	}
+	return regressions, rows.Err()
+}
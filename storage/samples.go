@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"modernc.org/sqlite"
+)
+
+// Sample values are stored as JSON, zstd-compressed once they're large
+// enough to benefit. Both forms live in the same column and are told apart
+// by the zstd frame magic, so older uncompressed rows keep reading fine.
+const compressSamplesAbove = 128
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	samplesEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	samplesDecoder, _ = zstd.NewReader(nil)
+)
+
+func init() {
+	// Used by the search triggers, which can't decompress on their own.
+	sqlite.MustRegisterDeterministicScalarFunction("sample_values_text", 1, sampleValuesText)
+	// Used by migrations that rewrite existing rows.
+	sqlite.MustRegisterDeterministicScalarFunction("sample_values_compress", 1, sampleValuesCompress)
+	sqlite.MustRegisterDeterministicScalarFunction("label_values_hash", 2, labelValuesHashSQL)
+}
+
+// encodeSampleValues returns the column value for a label's samples.
+func encodeSampleValues(values []string) (any, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("marshal sample values: %w", err)
+	}
+	return compressSamples(data), nil
+}
+
+func compressSamples(data []byte) any {
+	if len(data) <= compressSamplesAbove {
+		return string(data)
+	}
+	return samplesEncoder.EncodeAll(data, nil)
+}
+
+func decodeSampleValues(raw []byte) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if bytes.HasPrefix(raw, zstdMagic) {
+		var err error
+		if raw, err = samplesDecoder.DecodeAll(raw, nil); err != nil {
+			return nil, fmt.Errorf("decompress sample values: %w", err)
+		}
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("unmarshal sample values: %w", err)
+	}
+	return values, nil
+}
+
+func columnBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+// sampleValuesText renders stored samples one per line.
+func sampleValuesText(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	values, err := decodeSampleValues(columnBytes(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Join(values, "\n"), nil
+}
+
+func sampleValuesCompress(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	raw := columnBytes(args[0])
+	if raw == nil || bytes.HasPrefix(raw, zstdMagic) {
+		return args[0], nil
+	}
+	return compressSamples(raw), nil
+}
+
+// labelValuesHash identifies a label's stored payload so an unchanged label
+// is kept once no matter how many snapshots reference it. The name and the
+// unique count's power of two go into the hash as well as the samples, so
+// unrelated labels that happen to share samples, e.g. both empty, don't
+// share a row, while small cardinality drift doesn't break the sharing.
+func labelValuesHash(name string, uniqueCount int, samples, redacted []string) (string, error) {
+	if len(samples) == 0 {
+		samples = nil
+	}
+	if len(redacted) == 0 {
+		redacted = nil
+	}
+	data, err := json.Marshal(struct {
+		Name     string   `json:"n"`
+		Bucket   int      `json:"b"`
+		Samples  []string `json:"s"`
+		Redacted []string `json:"r"`
+	}{name, countBucket(uniqueCount), samples, redacted})
+	if err != nil {
+		return "", fmt.Errorf("hash label values: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// countBucket is the bit length of n: 0, 1, 2-3, 4-7 and so on share a
+// bucket.
+func countBucket(n int) int {
+	return bits.Len(uint(max(n, 0)))
+}
+
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// putLabelValues stores a label's samples and redaction classes, reusing an
+// existing row with the same content, and returns its ID.
+func putLabelValues(ctx context.Context, q execQuerier, name string, uniqueCount int, samples, redacted []string) (int64, error) {
+	hash, err := labelValuesHash(name, uniqueCount, samples, redacted)
+	if err != nil {
+		return 0, err
+	}
+	encoded, err := encodeSampleValues(samples)
+	if err != nil {
+		return 0, err
+	}
+	redactedJSON, err := marshalRedacted(redacted)
+	if err != nil {
+		return 0, err
+	}
+
+	// The no-op update makes RETURNING yield the existing row's ID too.
+	var id int64
+	err = q.QueryRowContext(ctx, `
+		INSERT INTO label_values (hash, sample_values, redacted)
+		VALUES (?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET hash = excluded.hash
+		RETURNING id
+	`, hash, encoded, redactedJSON).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert label values: %w", err)
+	}
+	return id, nil
+}
+
+// labelValuesHashSQL is label_values_hash() for the migration that moved
+// samples out of label_snapshots. That migration keys rows by payload
+// alone, as an unnamed label; no stored label has an empty name, so its
+// rows never collide with later ones.
+func labelValuesHashSQL(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	samples, err := decodeSampleValues(columnBytes(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	var redacted []string
+	if raw := columnBytes(args[1]); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &redacted); err != nil {
+			return nil, fmt.Errorf("unmarshal redacted classes: %w", err)
+		}
+	}
+	return labelValuesHash("", 0, samples, redacted)
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type ScanRunsRepository struct {
+	db *DB
+}
+
+func NewScanRunsRepository(db *DB) *ScanRunsRepository {
+	return &ScanRunsRepository{db: db}
+}
+
+func (r *ScanRunsRepository) Create(ctx context.Context, run *models.ScanRun) (int64, error) {
+	query := `
+		INSERT INTO scan_runs (trigger, service, status, started_at)
+		VALUES (?, ?, ?, ?)
+	`
+	result, err := r.db.conn.ExecContext(ctx, query,
+		run.Trigger,
+		run.Service,
+		run.Status,
+		run.StartedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *ScanRunsRepository) Update(ctx context.Context, run *models.ScanRun) error {
+	var serviceErrors *string
+	if len(run.ServiceErrors) > 0 {
+		data, err := json.Marshal(run.ServiceErrors)
+		if err != nil {
+			return err
+		}
+		s := string(data)
+		serviceErrors = &s
+	}
+
+	var finishedAt *string
+	if run.FinishedAt != nil {
+		t := run.FinishedAt.Format(time.RFC3339)
+		finishedAt = &t
+	}
+
+	var snapshotID *int64
+	if run.SnapshotID != 0 {
+		snapshotID = &run.SnapshotID
+	}
+
+	query := `
+		UPDATE scan_runs
+		SET snapshot_id = ?, status = ?, finished_at = ?, total_services = ?, total_series = ?, service_errors = ?, error = ?
+		WHERE id = ?
+	`
+	_, err := r.db.conn.ExecContext(ctx, query,
+		snapshotID,
+		run.Status,
+		finishedAt,
+		run.TotalServices,
+		run.TotalSeries,
+		serviceErrors,
+		run.Error,
+		run.ID,
+	)
+	return err
+}
+
+// AbortRunning marks runs still recorded as running as aborted. Only one
+// process scans a database, so at startup these are runs it was killed
+// during; they would otherwise show as running forever.
+func (r *ScanRunsRepository) AbortRunning(ctx context.Context) (int64, error) {
+	res, err := r.db.conn.ExecContext(ctx,
+		`UPDATE scan_runs SET status = ?, finished_at = ?, error = ? WHERE status = ?`,
+		models.ScanRunStatusAborted,
+		time.Now().UTC().Format(time.RFC3339),
+		"interrupted by a restart",
+		models.ScanRunStatusRunning,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *ScanRunsRepository) List(ctx context.Context, limit int) ([]models.ScanRun, error) {
+	query := `
+		SELECT id, trigger, service, snapshot_id, status, started_at, finished_at, total_services, total_series, service_errors, error
+		FROM scan_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.ScanRun
+	for rows.Next() {
+		var run models.ScanRun
+		var snapshotID sql.NullInt64
+		var startedAt string
+		var finishedAt, serviceErrors, errStr sql.NullString
+
+		if err := rows.Scan(
+			&run.ID,
+			&run.Trigger,
+			&run.Service,
+			&snapshotID,
+			&run.Status,
+			&startedAt,
+			&finishedAt,
+			&run.TotalServices,
+			&run.TotalSeries,
+			&serviceErrors,
+			&errStr,
+		); err != nil {
+			return nil, err
+		}
+
+		run.StartedAt, err = time.Parse(time.RFC3339, startedAt)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			t, err := time.Parse(time.RFC3339, finishedAt.String)
+			if err != nil {
+				return nil, err
+			}
+			run.FinishedAt = &t
+		}
+		if snapshotID.Valid {
+			run.SnapshotID = snapshotID.Int64
+		}
+		if serviceErrors.Valid && serviceErrors.String != "" {
+			if err := json.Unmarshal([]byte(serviceErrors.String), &run.ServiceErrors); err != nil {
+				return nil, err
+			}
+		}
+		if errStr.Valid {
+			run.Error = errStr.String
+		}
+
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
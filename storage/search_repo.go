@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type SearchRepository struct {
+	db *DB
+}
+
+func NewSearchRepository(db *DB) *SearchRepository {
+	return &SearchRepository{db: db}
+}
+
+// Search matches q against service names, metric names, label names and
+// sample values in a snapshot. Matching is a case-insensitive substring
+// match; results come back grouped by type in that order.
+func (r *SearchRepository) Search(ctx context.Context, snapshotID int64, q string, limit int) ([]models.SearchResult, error) {
+	pattern := "%" + escapeLike(q) + "%"
+
+	// The trigram index can't serve needles shorter than three characters,
+	// so those fall back to scanning.
+	query, args := likeSearchQuery, []any{
+		snapshotID, pattern,
+		snapshotID, pattern,
+		snapshotID, pattern,
+		snapshotID, pattern,
+	}
+	if utf8.RuneCountInString(q) >= 3 {
+		phrase := `"` + strings.ReplaceAll(q, `"`, `""`) + `"`
+		query, args = ftsSearchQuery, []any{
+			snapshotID, pattern,
+			snapshotID, "metric_name : " + phrase,
+			snapshotID, phrase,
+			snapshotID, phrase,
+		}
+	}
+
+	rows, err := r.db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	needle := strings.ToLower(q)
+	var results []models.SearchResult
+	for len(results) < limit && rows.Next() {
+		var res models.SearchResult
+		var samples sql.NullString
+		if err := rows.Scan(&res.Type, &res.Service, &res.Metric, &res.Label, &samples); err != nil {
+			return nil, err
+		}
+		if res.Type != models.SearchResultValue {
+			results = append(results, res)
+			continue
+		}
+
+		// The match is per label, so pick out the values that actually
+		// match. The index holds them one per line.
+		for _, v := range strings.Split(samples.String, "\n") {
+			if len(results) >= limit {
+				break
+			}
+			if strings.Contains(strings.ToLower(v), needle) {
+				res.Value = v
+				results = append(results, res)
+			}
+		}
+	}
+	return results, rows.Err()
+}
+
+const likeSearchQuery = `
+	SELECT 'service', service_name, '', '', NULL
+	FROM service_snapshots
+	WHERE snapshot_id = ? AND service_name LIKE ? ESCAPE '\'
+	UNION ALL
+	SELECT 'metric', ss.service_name, ms.metric_name, '', NULL
+	FROM metric_snapshots ms
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND ms.metric_name LIKE ? ESCAPE '\'
+	UNION ALL
+	SELECT 'label', ss.service_name, ms.metric_name, ls.label_name, NULL
+	FROM label_snapshots ls
+	JOIN metric_snapshots ms ON ms.id = ls.metric_snapshot_id
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND ls.label_name LIKE ? ESCAPE '\'
+	UNION ALL
+	SELECT 'value', ss.service_name, ms.metric_name, ls.label_name, f.sample_values
+	FROM value_search f
+	JOIN label_snapshots ls ON ls.values_id = f.rowid
+	JOIN metric_snapshots ms ON ms.id = ls.metric_snapshot_id
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND f.sample_values LIKE ? ESCAPE '\'
+`
+
+// Services are few enough per snapshot that they're always scanned.
+const ftsSearchQuery = `
+	SELECT 'service', service_name, '', '', NULL
+	FROM service_snapshots
+	WHERE snapshot_id = ? AND service_name LIKE ? ESCAPE '\'
+	UNION ALL
+	SELECT 'metric', ss.service_name, ms.metric_name, '', NULL
+	FROM metric_search f
+	JOIN metric_snapshots ms ON ms.id = f.rowid
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND metric_search MATCH ?
+	UNION ALL
+	SELECT 'label', ss.service_name, ms.metric_name, ls.label_name, NULL
+	FROM label_search f
+	JOIN label_snapshots ls ON ls.id = f.rowid
+	JOIN metric_snapshots ms ON ms.id = ls.metric_snapshot_id
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND label_search MATCH ?
+	UNION ALL
+	SELECT 'value', ss.service_name, ms.metric_name, ls.label_name, f.sample_values
+	FROM value_search f
+	JOIN label_snapshots ls ON ls.values_id = f.rowid
+	JOIN metric_snapshots ms ON ms.id = ls.metric_snapshot_id
+	JOIN service_snapshots ss ON ss.id = ms.service_snapshot_id
+	WHERE ss.snapshot_id = ? AND value_search MATCH ?
+`
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
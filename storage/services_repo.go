@@ -3,9 +3,12 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/illenko/whodidthis/models"
 )
@@ -20,14 +23,23 @@ func NewServicesRepository(db *DB) *ServicesRepository {
 
 func (r *ServicesRepository) Create(ctx context.Context, s *models.ServiceSnapshot) (int64, error) {
 	query := `
-		INSERT INTO service_snapshots (snapshot_id, service_name, total_series, metric_count)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO service_snapshots (snapshot_id, service_name, labels, environment, team, total_series, metric_count, missing, excluded_series)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	labels, err := marshalServiceLabels(s.Labels)
+	if err != nil {
+		return 0, err
+	}
 	result, err := r.db.conn.ExecContext(ctx, query,
 		s.SnapshotID,
 		s.ServiceName,
+		labels,
+		s.Environment,
+		s.Team,
 		s.TotalSeries,
 		s.MetricCount,
+		s.Missing,
+		s.ExcludedSeries,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert service snapshot: %w", err)
@@ -47,8 +59,8 @@ func (r *ServicesRepository) CreateBatch(ctx context.Context, services []*models
 	}()
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO service_snapshots (snapshot_id, service_name, total_series, metric_count)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO service_snapshots (snapshot_id, service_name, labels, environment, team, total_series, metric_count, missing, excluded_series)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("prepare stmt: %w", err)
@@ -56,7 +68,11 @@ func (r *ServicesRepository) CreateBatch(ctx context.Context, services []*models
 	defer stmt.Close()
 
 	for _, s := range services {
-		if _, err = stmt.ExecContext(ctx, s.SnapshotID, s.ServiceName, s.TotalSeries, s.MetricCount); err != nil {
+		labels, err := marshalServiceLabels(s.Labels)
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.ExecContext(ctx, s.SnapshotID, s.ServiceName, labels, s.Environment, s.Team, s.TotalSeries, s.MetricCount, s.Missing, s.ExcludedSeries); err != nil {
 			return fmt.Errorf("insert service %s: %w", s.ServiceName, err)
 		}
 	}
@@ -65,24 +81,62 @@ func (r *ServicesRepository) CreateBatch(ctx context.Context, services []*models
 }
 
 type ServiceListOptions struct {
-	Sort   string // "series", "name"
-	Order  string // "asc", "desc"
-	Search string
+	Sort        string // "series", "name"
+	Order       string // "asc", "desc"
+	Search      string
+	Environment string
+	Team        string
 }
 
 func (r *ServicesRepository) List(ctx context.Context, snapshotID int64, opts ServiceListOptions) ([]models.ServiceSnapshot, error) {
+	return r.list(ctx, "snapshot_id = ?", []any{snapshotID}, opts)
+}
+
+// ListBySnapshots is List for several snapshots in one query, keyed by
+// snapshot ID. Snapshots without matching services are absent.
+func (r *ServicesRepository) ListBySnapshots(ctx context.Context, snapshotIDs []int64, opts ServiceListOptions) (map[int64][]models.ServiceSnapshot, error) {
+	bySnapshot := make(map[int64][]models.ServiceSnapshot)
+	if len(snapshotIDs) == 0 {
+		return bySnapshot, nil
+	}
+	args := make([]any, len(snapshotIDs))
+	for i, id := range snapshotIDs {
+		args[i] = id
+	}
+	where := "snapshot_id IN (?" + strings.Repeat(", ?", len(snapshotIDs)-1) + ")"
+
+	services, err := r.list(ctx, where, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		bySnapshot[s.SnapshotID] = append(bySnapshot[s.SnapshotID], s)
+	}
+	return bySnapshot, nil
+}
+
+// list applies the filters and order of opts to the services matching where.
+func (r *ServicesRepository) list(ctx context.Context, where string, args []any, opts ServiceListOptions) ([]models.ServiceSnapshot, error) {
 	query := `
-		SELECT id, snapshot_id, service_name, total_series, metric_count
+		SELECT id, snapshot_id, service_name, labels, environment, team, total_series, metric_count, missing, excluded_series
 		FROM service_snapshots
-		WHERE snapshot_id = ?
-	`
-	args := []interface{}{snapshotID}
+		WHERE ` + where
 
 	if opts.Search != "" {
 		query += " AND service_name LIKE ?"
 		args = append(args, "%"+opts.Search+"%")
 	}
 
+	if opts.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, opts.Environment)
+	}
+
+	if opts.Team != "" {
+		query += " AND team = ?"
+		args = append(args, opts.Team)
+	}
+
 	switch opts.Sort {
 	case "name":
 		if opts.Order == "asc" {
@@ -106,30 +160,277 @@ func (r *ServicesRepository) List(ctx context.Context, snapshotID int64, opts Se
 
 	var services []models.ServiceSnapshot
 	for rows.Next() {
-		var s models.ServiceSnapshot
-		if err := rows.Scan(&s.ID, &s.SnapshotID, &s.ServiceName, &s.TotalSeries, &s.MetricCount); err != nil {
+		s, err := scanService(rows)
+		if err != nil {
 			return nil, err
 		}
-		services = append(services, s)
+		services = append(services, *s)
 	}
 	return services, rows.Err()
 }
 
 func (r *ServicesRepository) GetByName(ctx context.Context, snapshotID int64, name string) (*models.ServiceSnapshot, error) {
 	query := `
-		SELECT id, snapshot_id, service_name, total_series, metric_count
+		SELECT id, snapshot_id, service_name, labels, environment, team, total_series, metric_count, missing, excluded_series
 		FROM service_snapshots
 		WHERE snapshot_id = ? AND service_name = ?
 	`
-	var s models.ServiceSnapshot
-	err := r.db.conn.QueryRowContext(ctx, query, snapshotID, name).Scan(
-		&s.ID, &s.SnapshotID, &s.ServiceName, &s.TotalSeries, &s.MetricCount,
-	)
+	s, err := scanService(r.db.conn.QueryRowContext(ctx, query, snapshotID, name))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	return s, nil
+}
+
+func (r *ServicesRepository) ListTeams(ctx context.Context, snapshotID int64) ([]models.TeamSummary, error) {
+	query := `
+		SELECT team, COUNT(*), COALESCE(SUM(total_series), 0), COALESCE(SUM(metric_count), 0)
+		FROM service_snapshots
+		WHERE snapshot_id = ?
+		GROUP BY team
+		ORDER BY SUM(total_series) DESC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []models.TeamSummary
+	for rows.Next() {
+		var t models.TeamSummary
+		if err := rows.Scan(&t.Team, &t.ServiceCount, &t.TotalSeries, &t.MetricCount); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// Trend returns the service's series count in every usable snapshot since
+// the given time, oldest first.
+func (r *ServicesRepository) Trend(ctx context.Context, name string, since time.Time) ([]models.TrendPoint, error) {
+	query := `
+		SELECT s.id, s.collected_at, ss.total_series
+		FROM service_snapshots ss
+		JOIN snapshots s ON s.id = ss.snapshot_id
+		WHERE ss.service_name = ? AND s.collected_at >= ? AND s.status IN ('completed', 'partial')
+		ORDER BY s.collected_at ASC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, name, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTrend(rows)
+}
+
+// TeamTrend sums the team's services in every usable snapshot since the
+// given time, oldest first. An empty team is the services without one.
+func (r *ServicesRepository) TeamTrend(ctx context.Context, team string, since time.Time) ([]models.TrendPoint, error) {
+	query := `
+		SELECT s.id, s.collected_at, SUM(ss.total_series)
+		FROM service_snapshots ss
+		JOIN snapshots s ON s.id = ss.snapshot_id
+		WHERE ss.team = ? AND s.collected_at >= ? AND s.status IN ('completed', 'partial')
+		GROUP BY s.id
+		ORDER BY s.collected_at ASC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, team, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTrend(rows)
+}
+
+// Diff compares every service of two snapshots, biggest absolute series
+// change first. The team is taken from the newer side.
+func (r *ServicesRepository) Diff(ctx context.Context, fromID, toID int64) ([]models.ServiceDiff, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT COALESCE(c.service_name, p.service_name), COALESCE(c.team, p.team),
+			p.id IS NOT NULL, c.id IS NOT NULL,
+			COALESCE(p.total_series, 0), COALESCE(c.total_series, 0),
+			COALESCE(p.metric_count, 0), COALESCE(c.metric_count, 0)
+		FROM (SELECT * FROM service_snapshots WHERE snapshot_id = ?) c
+		FULL OUTER JOIN (SELECT * FROM service_snapshots WHERE snapshot_id = ?) p
+			ON p.service_name = c.service_name
+		ORDER BY ABS(COALESCE(c.total_series, 0) - COALESCE(p.total_series, 0)) DESC, 1
+	`, toID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var diffs []models.ServiceDiff
+	for rows.Next() {
+		var d models.ServiceDiff
+		var inPrevious, inCurrent bool
+		if err := rows.Scan(&d.ServiceName, &d.Team, &inPrevious, &inCurrent,
+			&d.PreviousSeries, &d.CurrentSeries, &d.PreviousMetrics, &d.CurrentMetrics); err != nil {
+			return nil, err
+		}
+		d.SeriesDelta = d.CurrentSeries - d.PreviousSeries
+		switch {
+		case !inPrevious:
+			d.Status = models.DiffAdded
+		case !inCurrent:
+			d.Status = models.DiffRemoved
+		case d.SeriesDelta != 0 || d.CurrentMetrics != d.PreviousMetrics:
+			d.Status = models.DiffChanged
+		default:
+			d.Status = models.DiffUnchanged
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, rows.Err()
+}
+
+// Delete removes a service snapshot with its metrics and labels.
+func (r *ServicesRepository) Delete(ctx context.Context, id int64) error {
+	_, err := r.db.conn.ExecContext(ctx, `DELETE FROM service_snapshots WHERE id = ?`, id)
+	return err
+}
+
+// Replace makes the service snapshot id the only one of its service in the
+// snapshot. The rows it replaces are dropped in a single statement, so
+// readers see either the old collection or the new one.
+func (r *ServicesRepository) Replace(ctx context.Context, snapshotID int64, name string, id int64) error {
+	_, err := r.db.conn.ExecContext(ctx,
+		`DELETE FROM service_snapshots WHERE snapshot_id = ? AND service_name = ? AND id != ?`,
+		snapshotID, name, id,
+	)
+	return err
+}
+
+// CopyToSnapshot duplicates a service snapshot with all its metrics and labels
+// into another snapshot. Used by incremental scans for unchanged services.
+// The team is passed in rather than copied so config changes still apply.
+// The copy remembers the total of the collection its data comes from, see
+// CollectedSeries.
+func (r *ServicesRepository) CopyToSnapshot(ctx context.Context, serviceSnapshotID, snapshotID int64, totalSeries int, team string) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback service copy", "error", err)
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO service_snapshots (snapshot_id, service_name, labels, environment, team, total_series, metric_count, excluded_series, collected_series)
+		SELECT ?, service_name, labels, environment, ?, ?, metric_count, excluded_series, COALESCE(collected_series, total_series + excluded_series)
+		FROM service_snapshots
+		WHERE id = ?
+	`, snapshotID, team, totalSeries, serviceSnapshotID)
+	if err != nil {
+		return fmt.Errorf("copy service snapshot: %w", err)
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO metric_snapshots (service_snapshot_id, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count)
+		SELECT ?, metric_name, series_count, label_count, metric_type, help, unit, native_histogram, exemplar_count
+		FROM metric_snapshots
+		WHERE service_snapshot_id = ?
+	`, newID, serviceSnapshotID); err != nil {
+		return fmt.Errorf("copy metric snapshots: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO label_snapshots (metric_snapshot_id, label_name, unique_values_count, values_id, truncated)
+		SELECT nm.id, l.label_name, l.unique_values_count, l.values_id, l.truncated
+		FROM label_snapshots l
+		JOIN metric_snapshots om ON om.id = l.metric_snapshot_id
+		JOIN metric_snapshots nm ON nm.service_snapshot_id = ? AND nm.metric_name = om.metric_name
+		WHERE om.service_snapshot_id = ?
+	`, newID, serviceSnapshotID); err != nil {
+		return fmt.Errorf("copy label snapshots: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// CollectedSeries returns, per service of a snapshot, the series total
+// discovery reported for the full collection its data comes from: its own,
+// excluded series included, unless it was copied forward by an incremental
+// scan.
+func (r *ServicesRepository) CollectedSeries(ctx context.Context, snapshotID int64) (map[string]int, error) {
+	rows, err := r.db.conn.QueryContext(ctx, `
+		SELECT service_name, COALESCE(collected_series, total_series + excluded_series)
+		FROM service_snapshots
+		WHERE snapshot_id = ?
+	`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var total int
+		if err := rows.Scan(&name, &total); err != nil {
+			return nil, err
+		}
+		totals[name] = total
+	}
+	return totals, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanService(row rowScanner) (*models.ServiceSnapshot, error) {
+	var s models.ServiceSnapshot
+	var labels sql.NullString
+	if err := row.Scan(&s.ID, &s.SnapshotID, &s.ServiceName, &labels, &s.Environment, &s.Team, &s.TotalSeries, &s.MetricCount, &s.Missing, &s.ExcludedSeries); err != nil {
+		return nil, err
+	}
+	if labels.Valid && labels.String != "" {
+		if err := json.Unmarshal([]byte(labels.String), &s.Labels); err != nil {
+			return nil, fmt.Errorf("unmarshal service labels: %w", err)
+		}
+	}
 	return &s, nil
 }
+
+func marshalServiceLabels(labels map[string]string) (sql.NullString, error) {
+	if len(labels) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("marshal service labels: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func scanTrend(rows *sql.Rows) ([]models.TrendPoint, error) {
+	var points []models.TrendPoint
+	for rows.Next() {
+		var p models.TrendPoint
+		var collectedAt string
+		if err := rows.Scan(&p.SnapshotID, &collectedAt, &p.Series); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, collectedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.CollectedAt = t
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
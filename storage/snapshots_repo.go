@@ -3,7 +3,10 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/illenko/whodidthis/models"
@@ -19,14 +22,21 @@ func NewSnapshotsRepository(db *DB) *SnapshotsRepository {
 
 func (r *SnapshotsRepository) Create(ctx context.Context, s *models.Snapshot) (int64, error) {
 	query := `
-		INSERT INTO snapshots (collected_at, scan_duration_ms, total_services, total_series)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO snapshots (collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
+	status := s.Status
+	if status == "" {
+		status = models.SnapshotStatusCompleted
+	}
 	result, err := r.db.conn.ExecContext(ctx, query,
 		s.CollectedAt.Format(time.RFC3339),
+		status,
 		s.ScanDurationMs,
 		s.TotalServices,
 		s.TotalSeries,
+		s.SkippedMetrics,
+		s.CopiedServices,
 	)
 	if err != nil {
 		return 0, err
@@ -37,21 +47,53 @@ func (r *SnapshotsRepository) Create(ctx context.Context, s *models.Snapshot) (i
 func (r *SnapshotsRepository) Update(ctx context.Context, s *models.Snapshot) error {
 	query := `
 		UPDATE snapshots
-		SET scan_duration_ms = ?, total_services = ?, total_series = ?
+		SET status = ?, scan_duration_ms = ?, total_services = ?, total_series = ?, skipped_metrics = ?, copied_services = ?
 		WHERE id = ?
 	`
 	_, err := r.db.conn.ExecContext(ctx, query,
+		s.Status,
 		s.ScanDurationMs,
 		s.TotalServices,
 		s.TotalSeries,
+		s.SkippedMetrics,
+		s.CopiedServices,
 		s.ID,
 	)
 	return err
 }
 
+// AbortRunning marks snapshots still recorded as running as aborted; at
+// startup these were left behind by a scan the process was killed during.
+func (r *SnapshotsRepository) AbortRunning(ctx context.Context) (int64, error) {
+	res, err := r.db.conn.ExecContext(ctx,
+		`UPDATE snapshots SET status = ? WHERE status = ?`,
+		models.SnapshotStatusAborted, models.SnapshotStatusRunning,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetLatest returns the most recent usable snapshot. Like GetPrevious it
+// skips running, aborted and failed snapshots, so readers never see a
+// half-built or broken scan as the current state.
 func (r *SnapshotsRepository) GetLatest(ctx context.Context) (*models.Snapshot, error) {
 	query := `
-		SELECT id, collected_at, scan_duration_ms, total_services, total_series
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
+		FROM snapshots
+		WHERE status IN ('completed', 'partial')
+		ORDER BY collected_at DESC
+		LIMIT 1
+	`
+	return r.scanOne(r.db.conn.QueryRowContext(ctx, query))
+}
+
+// GetLatestAnyStatus returns the most recent snapshot whatever its status,
+// including one that is still running.
+func (r *SnapshotsRepository) GetLatestAnyStatus(ctx context.Context) (*models.Snapshot, error) {
+	query := `
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
 		FROM snapshots
 		ORDER BY collected_at DESC
 		LIMIT 1
@@ -61,7 +103,7 @@ func (r *SnapshotsRepository) GetLatest(ctx context.Context) (*models.Snapshot,
 
 func (r *SnapshotsRepository) GetByID(ctx context.Context, id int64) (*models.Snapshot, error) {
 	query := `
-		SELECT id, collected_at, scan_duration_ms, total_services, total_series
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
 		FROM snapshots
 		WHERE id = ?
 	`
@@ -70,7 +112,7 @@ func (r *SnapshotsRepository) GetByID(ctx context.Context, id int64) (*models.Sn
 
 func (r *SnapshotsRepository) List(ctx context.Context, limit int) ([]models.Snapshot, error) {
 	query := `
-		SELECT id, collected_at, scan_duration_ms, total_services, total_series
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
 		FROM snapshots
 		ORDER BY collected_at DESC
 		LIMIT ?
@@ -92,13 +134,31 @@ func (r *SnapshotsRepository) List(ctx context.Context, limit int) ([]models.Sna
 	return snapshots, rows.Err()
 }
 
+// Trend returns the total series of every usable snapshot since the given
+// time, oldest first.
+func (r *SnapshotsRepository) Trend(ctx context.Context, since time.Time) ([]models.TrendPoint, error) {
+	query := `
+		SELECT id, collected_at, total_series
+		FROM snapshots
+		WHERE collected_at >= ? AND status IN ('completed', 'partial')
+		ORDER BY collected_at ASC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, since.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTrend(rows)
+}
+
 func (r *SnapshotsRepository) GetByDate(ctx context.Context, date time.Time) (*models.Snapshot, error) {
 	// Find snapshot closest to the given date (same day)
 	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
 	query := `
-		SELECT id, collected_at, scan_duration_ms, total_services, total_series
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
 		FROM snapshots
 		WHERE collected_at >= ? AND collected_at < ?
 		ORDER BY collected_at DESC
@@ -115,10 +175,38 @@ func (r *SnapshotsRepository) GetNDaysAgo(ctx context.Context, days int) (*model
 	return r.GetByDate(ctx, targetDate)
 }
 
+// GetNearest returns the usable snapshot collected closest to t, before or
+// after it.
+func (r *SnapshotsRepository) GetNearest(ctx context.Context, t time.Time) (*models.Snapshot, error) {
+	query := `
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
+		FROM snapshots
+		WHERE status IN ('completed', 'partial')
+		ORDER BY ABS(julianday(collected_at) - julianday(?)), collected_at DESC
+		LIMIT 1
+	`
+	return r.scanOne(r.db.conn.QueryRowContext(ctx, query, t.Format(time.RFC3339)))
+}
+
+// GetPrevious returns the last usable snapshot collected before the given
+// one. Running, aborted and failed snapshots are skipped since their totals
+// would make every delta look like a collapse.
+func (r *SnapshotsRepository) GetPrevious(ctx context.Context, id int64) (*models.Snapshot, error) {
+	query := `
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
+		FROM snapshots
+		WHERE collected_at < (SELECT collected_at FROM snapshots WHERE id = ?)
+			AND status IN ('completed', 'partial')
+		ORDER BY collected_at DESC
+		LIMIT 1
+	`
+	return r.scanOne(r.db.conn.QueryRowContext(ctx, query, id))
+}
+
 func (r *SnapshotsRepository) DeleteOlderThan(ctx context.Context, days int) (int64, error) {
 	cutoff := time.Now().AddDate(0, 0, -days)
 	result, err := r.db.conn.ExecContext(ctx,
-		"DELETE FROM snapshots WHERE collected_at < ?",
+		"DELETE FROM snapshots WHERE collected_at < ? AND baseline = 0",
 		cutoff.Format(time.RFC3339),
 	)
 	if err != nil {
@@ -127,12 +215,171 @@ func (r *SnapshotsRepository) DeleteOlderThan(ctx context.Context, days int) (in
 	return result.RowsAffected()
 }
 
+// SetBaseline makes the snapshot the one regressions are measured against,
+// replacing any previous baseline. It reports false when the snapshot
+// doesn't exist.
+func (r *SnapshotsRepository) SetBaseline(ctx context.Context, id int64) (bool, error) {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback baseline update", "error", err)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE snapshots SET baseline = 0 WHERE baseline = 1"); err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx, "UPDATE snapshots SET baseline = 1 WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+func (r *SnapshotsRepository) ClearBaseline(ctx context.Context) error {
+	_, err := r.db.conn.ExecContext(ctx, "UPDATE snapshots SET baseline = 0 WHERE baseline = 1")
+	return err
+}
+
+// GetBaseline returns nil when no baseline is set.
+func (r *SnapshotsRepository) GetBaseline(ctx context.Context) (*models.Snapshot, error) {
+	query := `
+		SELECT id, collected_at, status, scan_duration_ms, total_services, total_series, skipped_metrics, copied_services
+		FROM snapshots
+		WHERE baseline = 1
+		LIMIT 1
+	`
+	return r.scanOne(r.db.conn.QueryRowContext(ctx, query))
+}
+
+func (r *SnapshotsRepository) SetServiceError(ctx context.Context, snapshotID int64, serviceName, errMsg string) error {
+	query := `
+		INSERT INTO service_errors (snapshot_id, service_name, error, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(snapshot_id, service_name) DO UPDATE SET error = excluded.error, created_at = excluded.created_at
+	`
+	_, err := r.db.conn.ExecContext(ctx, query, snapshotID, serviceName, errMsg, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (r *SnapshotsRepository) ClearServiceError(ctx context.Context, snapshotID int64, serviceName string) error {
+	_, err := r.db.conn.ExecContext(ctx,
+		"DELETE FROM service_errors WHERE snapshot_id = ? AND service_name = ?",
+		snapshotID, serviceName,
+	)
+	return err
+}
+
+func (r *SnapshotsRepository) ListServiceErrors(ctx context.Context, snapshotID int64) ([]models.ServiceError, error) {
+	query := `
+		SELECT service_name, error
+		FROM service_errors
+		WHERE snapshot_id = ?
+		ORDER BY service_name ASC
+	`
+	rows, err := r.db.conn.QueryContext(ctx, query, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var serviceErrors []models.ServiceError
+	for rows.Next() {
+		var e models.ServiceError
+		if err := rows.Scan(&e.Service, &e.Error); err != nil {
+			return nil, err
+		}
+		serviceErrors = append(serviceErrors, e)
+	}
+	return serviceErrors, rows.Err()
+}
+
+func (r *SnapshotsRepository) SetTSDBStats(ctx context.Context, snapshotID int64, stats *models.TSDBStats) error {
+	topMetrics, err := json.Marshal(stats.TopMetrics)
+	if err != nil {
+		return fmt.Errorf("marshal top metrics: %w", err)
+	}
+	topLabelNames, err := json.Marshal(stats.TopLabelNames)
+	if err != nil {
+		return fmt.Errorf("marshal top label names: %w", err)
+	}
+
+	query := `
+		INSERT INTO snapshot_tsdb_stats (snapshot_id, head_series, head_label_pairs, head_chunks, min_time, max_time, top_metrics, top_label_names)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(snapshot_id) DO UPDATE SET
+			head_series = excluded.head_series,
+			head_label_pairs = excluded.head_label_pairs,
+			head_chunks = excluded.head_chunks,
+			min_time = excluded.min_time,
+			max_time = excluded.max_time,
+			top_metrics = excluded.top_metrics,
+			top_label_names = excluded.top_label_names
+	`
+	_, err = r.db.conn.ExecContext(ctx, query,
+		snapshotID,
+		stats.HeadSeries,
+		stats.HeadLabelPairs,
+		stats.HeadChunks,
+		stats.MinTime.Format(time.RFC3339),
+		stats.MaxTime.Format(time.RFC3339),
+		string(topMetrics),
+		string(topLabelNames),
+	)
+	return err
+}
+
+func (r *SnapshotsRepository) GetTSDBStats(ctx context.Context, snapshotID int64) (*models.TSDBStats, error) {
+	query := `
+		SELECT head_series, head_label_pairs, head_chunks, min_time, max_time, top_metrics, top_label_names
+		FROM snapshot_tsdb_stats
+		WHERE snapshot_id = ?
+	`
+	var stats models.TSDBStats
+	var minTime, maxTime, topMetrics, topLabelNames string
+	err := r.db.conn.QueryRowContext(ctx, query, snapshotID).Scan(
+		&stats.HeadSeries,
+		&stats.HeadLabelPairs,
+		&stats.HeadChunks,
+		&minTime,
+		&maxTime,
+		&topMetrics,
+		&topLabelNames,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.MinTime, err = time.Parse(time.RFC3339, minTime); err != nil {
+		return nil, err
+	}
+	if stats.MaxTime, err = time.Parse(time.RFC3339, maxTime); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(topMetrics), &stats.TopMetrics); err != nil {
+		return nil, fmt.Errorf("unmarshal top metrics: %w", err)
+	}
+	if err := json.Unmarshal([]byte(topLabelNames), &stats.TopLabelNames); err != nil {
+		return nil, fmt.Errorf("unmarshal top label names: %w", err)
+	}
+	return &stats, nil
+}
+
 func (r *SnapshotsRepository) scanOne(row *sql.Row) (*models.Snapshot, error) {
 	var s models.Snapshot
 	var collectedAt string
 	var scanDuration sql.NullInt64
 
-	err := row.Scan(&s.ID, &collectedAt, &scanDuration, &s.TotalServices, &s.TotalSeries)
+	err := row.Scan(&s.ID, &collectedAt, &s.Status, &scanDuration, &s.TotalServices, &s.TotalSeries, &s.SkippedMetrics, &s.CopiedServices)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -155,7 +402,7 @@ func (r *SnapshotsRepository) scanFromRows(rows *sql.Rows) (*models.Snapshot, er
 	var collectedAt string
 	var scanDuration sql.NullInt64
 
-	err := rows.Scan(&s.ID, &collectedAt, &scanDuration, &s.TotalServices, &s.TotalSeries)
+	err := rows.Scan(&s.ID, &collectedAt, &s.Status, &scanDuration, &s.TotalServices, &s.TotalSeries, &s.SkippedMetrics, &s.CopiedServices)
 	if err != nil {
 		return nil, err
 	}
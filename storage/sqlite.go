@@ -116,6 +116,42 @@ func (db *DB) migrate() error {
 	return nil
 }
 
+// PendingMigrations lists the embedded migrations not recorded as applied,
+// which is none once New has succeeded unless the database was swapped or
+// restored underneath.
+func (db *DB) PendingMigrations(ctx context.Context) ([]string, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	applied := make(map[string]bool)
+	rows, err := db.conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !applied[entry.Name()] {
+			pending = append(pending, entry.Name())
+		}
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
 func (db *DB) Stats(ctx context.Context) (*DBStats, error) {
 	var stats DBStats
 
@@ -158,9 +194,10 @@ type DBStats struct {
 func (db *DB) Cleanup(ctx context.Context, retention time.Duration) (int64, error) {
 	cutoff := time.Now().Add(-retention).Format(time.RFC3339)
 
-	// Due to CASCADE deletes, we only need to delete from snapshots
+	// Due to CASCADE deletes, we only need to delete from snapshots. The
+	// baseline is kept however old it is.
 	result, err := db.conn.ExecContext(ctx,
-		"DELETE FROM snapshots WHERE collected_at < ?",
+		"DELETE FROM snapshots WHERE collected_at < ? AND baseline = 0",
 		cutoff,
 	)
 	if err != nil {
@@ -168,6 +205,15 @@ func (db *DB) Cleanup(ctx context.Context, retention time.Duration) (int64, erro
 	}
 	deleted, _ := result.RowsAffected()
 
+	if err := db.pruneLabelValues(ctx); err != nil {
+		return deleted, err
+	}
+
+	// The audit log follows the same retention as the snapshots it covers.
+	if _, err := db.conn.ExecContext(ctx, "DELETE FROM audit_log WHERE created_at < ?", cutoff); err != nil {
+		return deleted, fmt.Errorf("failed to prune audit log: %w", err)
+	}
+
 	if _, err := db.conn.ExecContext(ctx, "VACUUM"); err != nil {
 		slog.Warn("failed to vacuum database", "error", err)
 	}
@@ -175,6 +221,46 @@ func (db *DB) Cleanup(ctx context.Context, retention time.Duration) (int64, erro
 	return deleted, nil
 }
 
+// Downsample thins snapshots older than age to one per week, keeping the
+// baseline or else the latest usable snapshot of each week. It doesn't
+// vacuum; Cleanup does.
+func (db *DB) Downsample(ctx context.Context, age time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-age).Format(time.RFC3339)
+
+	result, err := db.conn.ExecContext(ctx, `
+		DELETE FROM snapshots WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY strftime('%Y-%W', collected_at)
+					ORDER BY baseline DESC, status IN ('completed', 'partial') DESC, collected_at DESC
+				) AS rank
+				FROM snapshots
+				WHERE collected_at < ?
+			)
+			WHERE rank > 1
+		)
+	`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to downsample snapshots: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	return deleted, db.pruneLabelValues(ctx)
+}
+
+// pruneLabelValues drops shared label payloads no snapshot refers to any more.
+func (db *DB) pruneLabelValues(ctx context.Context) error {
+	_, err := db.conn.ExecContext(ctx, `
+		DELETE FROM label_values
+		WHERE NOT EXISTS (SELECT 1 FROM label_snapshots WHERE values_id = label_values.id)
+		  AND NOT EXISTS (SELECT 1 FROM log_label_snapshots WHERE values_id = label_values.id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prune label values: %w", err)
+	}
+	return nil
+}
+
 func (db *DB) Conn() *sql.DB {
 	return db.conn
 }
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/illenko/whodidthis/models"
+)
+
+type ViolationsRepository struct {
+	db *DB
+}
+
+func NewViolationsRepository(db *DB) *ViolationsRepository {
+	return &ViolationsRepository{db: db}
+}
+
+// Record stores what a scan found: each violation is opened or carried
+// forward, and the ones of the evaluated services the scan no longer found
+// are resolved. Violations of other services are left alone. A violation
+// that comes back after being resolved starts over with a new first_seen.
+func (r *ViolationsRepository) Record(ctx context.Context, snapshotID int64, at time.Time, violations []models.Violation, evaluated []string) error {
+	tx, err := r.db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("failed to rollback violations update", "error", err)
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO violations (service_name, metric_name, max_series, series_count, first_seen, last_seen, last_snapshot_id, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+		ON CONFLICT(service_name, metric_name) DO UPDATE SET
+			max_series = excluded.max_series,
+			series_count = excluded.series_count,
+			first_seen = CASE WHEN violations.active THEN violations.first_seen ELSE excluded.first_seen END,
+			last_seen = excluded.last_seen,
+			last_snapshot_id = excluded.last_snapshot_id,
+			active = 1
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare stmt: %w", err)
+	}
+	defer stmt.Close()
+
+	seen := at.UTC().Format(time.RFC3339)
+	for _, v := range violations {
+		if _, err := stmt.ExecContext(ctx, v.ServiceName, v.MetricName, v.MaxSeries, v.SeriesCount, seen, seen, snapshotID); err != nil {
+			return fmt.Errorf("upsert violation %s/%s: %w", v.ServiceName, v.MetricName, err)
+		}
+	}
+
+	resolve, err := tx.PrepareContext(ctx, "UPDATE violations SET active = 0 WHERE active = 1 AND last_snapshot_id <> ? AND service_name = ?")
+	if err != nil {
+		return fmt.Errorf("prepare resolve stmt: %w", err)
+	}
+	defer resolve.Close()
+
+	for _, service := range evaluated {
+		if _, err := resolve.ExecContext(ctx, snapshotID, service); err != nil {
+			return fmt.Errorf("resolve violations of %s: %w", service, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// List returns the active violations, furthest over their limit first,
+// followed by the resolved ones, most recent first, when includeResolved
+// is set.
+func (r *ViolationsRepository) List(ctx context.Context, includeResolved bool) ([]models.Violation, error) {
+	query := `
+		SELECT id, service_name, metric_name, max_series, series_count, first_seen, last_seen, last_snapshot_id, active
+		FROM violations
+	`
+	if !includeResolved {
+		query += " WHERE active = 1"
+	}
+	query += `
+		ORDER BY active DESC,
+			CASE WHEN active THEN series_count - max_series END DESC,
+			last_seen DESC, service_name, metric_name
+	`
+
+	rows, err := r.db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var violations []models.Violation
+	for rows.Next() {
+		var v models.Violation
+		var firstSeen, lastSeen string
+		if err := rows.Scan(&v.ID, &v.ServiceName, &v.MetricName, &v.MaxSeries, &v.SeriesCount, &firstSeen, &lastSeen, &v.LastSnapshotID, &v.Active); err != nil {
+			return nil, err
+		}
+		if v.FirstSeen, err = time.Parse(time.RFC3339, firstSeen); err != nil {
+			return nil, err
+		}
+		if v.LastSeen, err = time.Parse(time.RFC3339, lastSeen); err != nil {
+			return nil, err
+		}
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
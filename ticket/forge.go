@@ -0,0 +1,145 @@
+package ticket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// ErrNoRepository means the finding's service has no owning team with a
+// repository configured.
+var ErrNoRepository = errors.New("no repository configured for the service's team")
+
+// Forge opens issues in a code hosting platform's repositories.
+type Forge interface {
+	CreateIssue(ctx context.Context, repository string, d *Draft) (*Ticket, error)
+}
+
+// TeamRepositories is a Tracker that opens each finding's issue in the
+// repository of the team owning its service.
+type TeamRepositories struct {
+	teams    []config.TeamConfig
+	services storage.ServicesRepo
+	forges   map[config.RepositoryProvider]Forge
+}
+
+func NewTeamRepositories(teams []config.TeamConfig, services storage.ServicesRepo, github config.GitHubConfig, gitlab config.GitLabConfig) *TeamRepositories {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return &TeamRepositories{
+		teams:    teams,
+		services: services,
+		forges: map[config.RepositoryProvider]Forge{
+			config.ProviderGitHub: &GitHub{cfg: github, client: client},
+			config.ProviderGitLab: &GitLab{cfg: gitlab, client: client},
+		},
+	}
+}
+
+// Enabled reports whether any team has a repository.
+func (t *TeamRepositories) Enabled() bool {
+	for _, team := range t.teams {
+		if team.Repository.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *TeamRepositories) Create(ctx context.Context, d *Draft) (*Ticket, error) {
+	repo, err := t.repositoryFor(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return t.forges[repo.Provider].CreateIssue(ctx, repo.Name, d)
+}
+
+// repositoryFor finds the owning team from the snapshot the finding was
+// last seen in, falling back to the team globs when the service is gone.
+func (t *TeamRepositories) repositoryFor(ctx context.Context, d *Draft) (config.TeamRepository, error) {
+	f := d.Finding
+	service, err := t.services.GetByName(ctx, f.LastSnapshotID, f.ServiceName)
+	if err != nil {
+		return config.TeamRepository{}, fmt.Errorf("get service: %w", err)
+	}
+	var team string
+	if service != nil {
+		team = service.Team
+	}
+	for _, tc := range t.teams {
+		if (team != "" && tc.Name == team) || (team == "" && matchesAny(f.ServiceName, tc.Services)) {
+			if tc.Repository.Name == "" {
+				return config.TeamRepository{}, fmt.Errorf("%w: team %s", ErrNoRepository, tc.Name)
+			}
+			return tc.Repository, nil
+		}
+	}
+	return config.TeamRepository{}, ErrNoRepository
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type GitHub struct {
+	cfg    config.GitHubConfig
+	client *http.Client
+}
+
+func (g *GitHub) CreateIssue(ctx context.Context, repository string, d *Draft) (*Ticket, error) {
+	body := map[string]any{"title": d.Summary(), "body": d.Markdown()}
+	if len(g.cfg.Labels) > 0 {
+		body["labels"] = g.cfg.Labels
+	}
+	endpoint := strings.TrimSuffix(g.cfg.APIURL, "/") + "/repos/" + strings.Trim(repository, "/") + "/issues"
+	headers := map[string]string{
+		"Authorization":        "Bearer " + g.cfg.Token,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := postJSON(ctx, g.client, "github", endpoint, headers, body, &created); err != nil {
+		return nil, err
+	}
+	return &Ticket{Key: fmt.Sprintf("%s#%d", strings.Trim(repository, "/"), created.Number), URL: created.HTMLURL}, nil
+}
+
+type GitLab struct {
+	cfg    config.GitLabConfig
+	client *http.Client
+}
+
+func (g *GitLab) CreateIssue(ctx context.Context, repository string, d *Draft) (*Ticket, error) {
+	body := map[string]any{"title": d.Summary(), "description": d.Markdown()}
+	if len(g.cfg.Labels) > 0 {
+		body["labels"] = strings.Join(g.cfg.Labels, ",")
+	}
+	project := strings.Trim(repository, "/")
+	endpoint := strings.TrimSuffix(g.cfg.URL, "/") + "/api/v4/projects/" + url.PathEscape(project) + "/issues"
+	headers := map[string]string{"PRIVATE-TOKEN": g.cfg.Token}
+
+	var created struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := postJSON(ctx, g.client, "gitlab", endpoint, headers, body, &created); err != nil {
+		return nil, err
+	}
+	return &Ticket{Key: fmt.Sprintf("%s#%d", project, created.IID), URL: created.WebURL}, nil
+}
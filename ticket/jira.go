@@ -0,0 +1,80 @@
+package ticket
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/illenko/whodidthis/config"
+)
+
+// Jira opens issues through the Jira REST API v2, which Jira Cloud and
+// Data Center both serve.
+type Jira struct {
+	cfg    config.JiraConfig
+	client *http.Client
+}
+
+func NewJira(cfg config.JiraConfig) *Jira {
+	return &Jira{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (j *Jira) Create(ctx context.Context, d *Draft) (*Ticket, error) {
+	fields := map[string]any{
+		"project":     map[string]string{"key": j.cfg.Project},
+		"issuetype":   map[string]string{"name": j.cfg.IssueType},
+		"summary":     d.Summary(),
+		"description": jiraDescription(d),
+	}
+	if len(j.cfg.Labels) > 0 {
+		fields["labels"] = j.cfg.Labels
+	}
+	base := strings.TrimSuffix(j.cfg.URL, "/")
+	auth := "Bearer " + j.cfg.Token
+	if j.cfg.Email != "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(j.cfg.Email+":"+j.cfg.Token))
+	}
+	headers := map[string]string{"Authorization": auth, "Accept": "application/json"}
+
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := postJSON(ctx, j.client, "jira", base+"/rest/api/2/issue", headers, map[string]any{"fields": fields}, &created); err != nil {
+		return nil, err
+	}
+	return &Ticket{Key: created.Key, URL: base + "/browse/" + created.Key}, nil
+}
+
+// jiraDescription renders the draft in Jira wiki markup.
+func jiraDescription(d *Draft) string {
+	f := d.Finding
+	var b strings.Builder
+	b.WriteString(f.Description + "\n\n")
+	fmt.Fprintf(&b, "*Service:* %s\n", f.ServiceName)
+	fmt.Fprintf(&b, "*Metric:* {{%s}}\n", f.MetricName)
+	if f.LabelName != "" {
+		fmt.Fprintf(&b, "*Label:* {{%s}}\n", f.LabelName)
+	}
+	fmt.Fprintf(&b, "*Kind:* %s\n", f.Kind)
+	fmt.Fprintf(&b, "*Severity:* %d (%s)\n", f.Severity, f.Level)
+
+	if len(d.Samples) > 0 {
+		b.WriteString("\nh3. Label samples\n{noformat}\n")
+		b.WriteString(strings.Join(d.Samples, "\n"))
+		b.WriteString("\n{noformat}\n")
+	}
+	b.WriteString("\nh3. Estimated impact\n")
+	for _, line := range d.Impact() {
+		fmt.Fprintf(&b, "* %s\n", line)
+	}
+	b.WriteString("\nh3. Suggested fix\n")
+	b.WriteString(d.Fix + "\n")
+	fmt.Fprintf(&b, "\n_Opened from whodidthis finding #%d._\n", f.ID)
+	return b.String()
+}
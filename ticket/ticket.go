@@ -0,0 +1,205 @@
+// Package ticket opens issue tracker tickets for findings, pre-filled with
+// what a team needs to fix them.
+package ticket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/illenko/whodidthis/config"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// maxSamples is how many label values a ticket quotes.
+const maxSamples = 10
+
+// Ticket is an issue opened in a tracker.
+type Ticket struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// Tracker opens tickets in one issue tracker.
+type Tracker interface {
+	Create(ctx context.Context, d *Draft) (*Ticket, error)
+}
+
+// Draft is what a ticket says about a finding; each tracker renders it in
+// its own markup.
+type Draft struct {
+	Finding models.TrackedFinding
+	// Samples are values of the offending label from the snapshot the
+	// finding was last seen in.
+	Samples     []string
+	MonthlyCost *float64
+	// DropSavings is the monthly saving of dropping the label, nil without
+	// pricing or a label.
+	DropSavings *float64
+	Currency    string
+	Fix         string
+}
+
+// Summary is the ticket title.
+func (d *Draft) Summary() string {
+	f := d.Finding
+	if f.LabelName != "" {
+		return fmt.Sprintf("Cardinality: %s %s label %s (%s)", f.ServiceName, f.MetricName, f.LabelName, f.Kind)
+	}
+	return fmt.Sprintf("Cardinality: %s %s (%s)", f.ServiceName, f.MetricName, f.Kind)
+}
+
+// Impact describes the metric's size and, with pricing, its cost.
+func (d *Draft) Impact() []string {
+	impact := []string{fmt.Sprintf("%d active series", d.Finding.SeriesCount)}
+	if d.Finding.BaselineSeries != nil {
+		impact = append(impact, fmt.Sprintf("up from %d series before the issue", *d.Finding.BaselineSeries))
+	}
+	if d.MonthlyCost != nil {
+		impact = append(impact, fmt.Sprintf("about %.2f %s per month", *d.MonthlyCost, d.Currency))
+	}
+	if d.DropSavings != nil {
+		impact = append(impact, fmt.Sprintf("dropping %s saves about %.2f %s per month", d.Finding.LabelName, *d.DropSavings, d.Currency))
+	}
+	return impact
+}
+
+// Markdown renders the draft as an issue body for GitHub and GitLab.
+func (d *Draft) Markdown() string {
+	f := d.Finding
+	var b strings.Builder
+	b.WriteString(f.Description + "\n\n")
+	fmt.Fprintf(&b, "- **Service:** %s\n", f.ServiceName)
+	fmt.Fprintf(&b, "- **Metric:** `%s`\n", f.MetricName)
+	if f.LabelName != "" {
+		fmt.Fprintf(&b, "- **Label:** `%s`\n", f.LabelName)
+	}
+	fmt.Fprintf(&b, "- **Kind:** %s\n", f.Kind)
+	fmt.Fprintf(&b, "- **Severity:** %d (%s)\n", f.Severity, f.Level)
+
+	if len(d.Samples) > 0 {
+		b.WriteString("\n### Label samples\n\n```\n")
+		b.WriteString(strings.Join(d.Samples, "\n"))
+		b.WriteString("\n```\n")
+	}
+	b.WriteString("\n### Estimated impact\n\n")
+	for _, line := range d.Impact() {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+	b.WriteString("\n### Suggested fix\n\n")
+	b.WriteString(d.Fix + "\n")
+	fmt.Fprintf(&b, "\n_Opened from whodidthis finding #%d._\n", f.ID)
+	return b.String()
+}
+
+// Drafter gathers the details of a finding from its snapshot.
+type Drafter struct {
+	services storage.ServicesRepo
+	metrics  storage.MetricsRepo
+	labels   storage.LabelsRepo
+	cost     config.CostConfig
+}
+
+func NewDrafter(services storage.ServicesRepo, metrics storage.MetricsRepo, labels storage.LabelsRepo, cost config.CostConfig) *Drafter {
+	return &Drafter{
+		services: services,
+		metrics:  metrics,
+		labels:   labels,
+		cost:     cost,
+	}
+}
+
+// Draft describes a finding. Samples and prices are left out when the
+// snapshot no longer has the metric or label.
+func (d *Drafter) Draft(ctx context.Context, f models.TrackedFinding) (*Draft, error) {
+	draft := &Draft{
+		Finding:     f,
+		MonthlyCost: d.cost.MonthlyCostPtr(int64(f.SeriesCount)),
+		Currency:    d.cost.Currency,
+		Fix:         suggestedFix(f),
+	}
+	if f.LabelName == "" {
+		return draft, nil
+	}
+
+	service, err := d.services.GetByName(ctx, f.LastSnapshotID, f.ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("get service: %w", err)
+	}
+	if service == nil {
+		return draft, nil
+	}
+	metric, err := d.metrics.GetByName(ctx, service.ID, f.MetricName)
+	if err != nil {
+		return nil, fmt.Errorf("get metric: %w", err)
+	}
+	if metric == nil {
+		return draft, nil
+	}
+	label, err := d.labels.GetByName(ctx, metric.ID, f.LabelName)
+	if err != nil {
+		return nil, fmt.Errorf("get label: %w", err)
+	}
+	if label == nil {
+		return draft, nil
+	}
+
+	draft.Samples = label.SampleValues[:min(len(label.SampleValues), maxSamples)]
+	if d.cost.Enabled() && label.UniqueValuesCount > 1 {
+		remaining := int64(metric.SeriesCount / label.UniqueValuesCount)
+		savings := d.cost.MonthlyCost(int64(metric.SeriesCount) - remaining)
+		draft.DropSavings = &savings
+	}
+	return draft, nil
+}
+
+func suggestedFix(f models.TrackedFinding) string {
+	switch {
+	case f.Kind == "bucket_explosion":
+		return "Cut the histogram down to the buckets dashboards and alerts use, or migrate it to a native histogram."
+	case f.LabelName == "":
+		return "Find what added the series since the previous snapshot, usually a new label or a deploy, and bound it."
+	case f.Kind == "url":
+		return fmt.Sprintf("Record the route template (e.g. /users/{id}) in %s instead of the raw path.", f.LabelName)
+	default:
+		var b strings.Builder
+		fmt.Fprintf(&b, "Remove the %s label or replace it with a bounded value; keep per-request detail in logs or traces.", f.LabelName)
+		fmt.Fprintf(&b, " Until the code changes, a labeldrop metric_relabel_configs rule for %s stops the growth at scrape time.", f.LabelName)
+		return b.String()
+	}
+}
+
+// postJSON posts body and decodes a 201 response into out.
+func postJSON(ctx context.Context, client *http.Client, name, endpoint string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned HTTP %d: %s", name, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: decode response: %w", name, err)
+	}
+	return nil
+}
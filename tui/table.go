@@ -0,0 +1,187 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+type column struct {
+	title string
+	width int // 0 takes the remaining width
+	right bool
+	// delta colors growth red and shrinkage green, outside the selection.
+	delta bool
+}
+
+// row holds the rendered cells plus the raw values they sort by, and the
+// key a drill-down uses to find the item.
+type row struct {
+	key    string
+	id     int64
+	cells  []string
+	values []any // string or int per column
+}
+
+// table is a scrolling, sortable list with one selected row.
+type table struct {
+	title   string
+	columns []column
+	rows    []row
+	cursor  int
+	offset  int
+	sortCol int
+	desc    bool
+}
+
+var (
+	headerStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	growthStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	shrinkStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+)
+
+func (t *table) sort() {
+	slices.SortStableFunc(t.rows, func(a, b row) int {
+		var c int
+		switch av := a.values[t.sortCol].(type) {
+		case int:
+			c = cmp.Compare(av, b.values[t.sortCol].(int))
+		case string:
+			c = strings.Compare(av, b.values[t.sortCol].(string))
+		}
+		if t.desc {
+			return -c
+		}
+		return c
+	})
+}
+
+// cycleSort moves to the next column; numbers sort biggest first.
+func (t *table) cycleSort() {
+	t.sortCol = (t.sortCol + 1) % len(t.columns)
+	_, numeric := t.rows[0].values[t.sortCol].(int)
+	t.desc = numeric
+	t.sort()
+}
+
+func (t *table) reverse() {
+	t.desc = !t.desc
+	t.sort()
+}
+
+func (t *table) move(delta, height int) {
+	if len(t.rows) == 0 {
+		return
+	}
+	t.cursor = min(max(t.cursor+delta, 0), len(t.rows)-1)
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	}
+	if t.cursor >= t.offset+height {
+		t.offset = t.cursor - height + 1
+	}
+}
+
+func (t *table) selected() (row, bool) {
+	if t.cursor >= len(t.rows) {
+		return row{}, false
+	}
+	return t.rows[t.cursor], true
+}
+
+func (t *table) render(width, height int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(t.title))
+	b.WriteString("\n")
+
+	widths := make([]int, len(t.columns))
+	fixed := 0
+	for i, c := range t.columns {
+		widths[i] = c.width
+		fixed += c.width + 1
+	}
+	for i, c := range t.columns {
+		if c.width == 0 {
+			widths[i] = max(width-fixed, 10)
+		}
+	}
+
+	var header []string
+	for i, c := range t.columns {
+		title := c.title
+		if i == t.sortCol {
+			title += map[bool]string{true: " ▼", false: " ▲"}[t.desc]
+		}
+		header = append(header, pad(title, widths[i], c.right))
+	}
+	b.WriteString(headerStyle.Render(strings.Join(header, " ")))
+	b.WriteString("\n")
+
+	if len(t.rows) == 0 {
+		b.WriteString(dimStyle.Render("  (empty)"))
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	end := min(t.offset+height, len(t.rows))
+	for i := t.offset; i < end; i++ {
+		var cells []string
+		for j, c := range t.columns {
+			cell := pad(t.rows[i].cells[j], widths[j], c.right)
+			if c.delta && i != t.cursor {
+				cell = deltaStyle(t.rows[i].cells[j]).Render(cell)
+			}
+			cells = append(cells, cell)
+		}
+		line := strings.Join(cells, " ")
+		if i == t.cursor {
+			line = selectedStyle.Render(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if len(t.rows) > height {
+		b.WriteString(dimStyle.Render(fmt.Sprintf("  %d-%d of %d", t.offset+1, end, len(t.rows))))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func pad(s string, width int, right bool) string {
+	if r := []rune(s); len(r) > width {
+		s = string(r[:max(width-1, 0)]) + "…"
+	}
+	if right {
+		return fmt.Sprintf("%*s", width, s)
+	}
+	return fmt.Sprintf("%-*s", width, s)
+}
+
+// formatDelta renders a change in series; known is false when the item
+// didn't exist in the previous snapshot.
+func formatDelta(delta int, known bool) string {
+	if !known {
+		return "new"
+	}
+	if delta == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%+d", delta)
+}
+
+func deltaStyle(cell string) lipgloss.Style {
+	switch {
+	case cell == "new" || strings.HasPrefix(cell, "+"):
+		return growthStyle
+	case strings.HasPrefix(cell, "-"):
+		return shrinkStyle
+	}
+	return lipgloss.NewStyle()
+}
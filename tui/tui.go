@@ -0,0 +1,410 @@
+// Package tui is a terminal dashboard over the snapshot database: the
+// services of the latest snapshot, drill-down into their metrics and
+// labels, and scans with live progress.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/illenko/whodidthis/collector"
+	"github.com/illenko/whodidthis/models"
+	"github.com/illenko/whodidthis/scheduler"
+	"github.com/illenko/whodidthis/storage"
+)
+
+// Scanner runs a scan in the foreground and reports its progress while it
+// runs; *scheduler.Scheduler implements it.
+type Scanner interface {
+	RunOnce(ctx context.Context, req scheduler.ScanRequest) (*collector.CollectResult, error)
+	GetStatus() scheduler.ScanStatus
+}
+
+type Config struct {
+	Snapshots storage.SnapshotsRepo
+	Services  storage.ServicesRepo
+	Metrics   storage.MetricsRepo
+	Labels    storage.LabelsRepo
+	// Scanner runs scans from the s key; optional.
+	Scanner Scanner
+}
+
+// Run shows the dashboard until the user quits or ctx is done.
+func Run(ctx context.Context, cfg Config) error {
+	m := &model{ctx: ctx, cfg: cfg}
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	return err
+}
+
+const progressInterval = 250 * time.Millisecond
+
+type (
+	// loadedMsg carries a table to show: the services table, replacing the
+	// stack along with the snapshots it compares, or a drill-down on top.
+	loadedMsg struct {
+		table    *table
+		item     item
+		snapshot *models.Snapshot
+		previous *models.Snapshot
+		replace  bool
+	}
+	errMsg      struct{ err error }
+	scanTickMsg struct{}
+	scanDoneMsg struct{ err error }
+)
+
+// item is what a drilled-in table lists the contents of.
+type item struct {
+	service string
+	metric  string
+	id      int64
+}
+
+type model struct {
+	ctx    context.Context
+	cfg    Config
+	width  int
+	height int
+
+	snapshot *models.Snapshot
+	previous *models.Snapshot
+	// stack holds the services table and whatever was drilled into.
+	stack []*table
+	// path is the item each table in stack belongs to.
+	path []item
+
+	scanning bool
+	progress *scheduler.ScanProgress
+	message  string
+	err      error
+}
+
+func (m *model) Init() tea.Cmd {
+	return m.loadServices()
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case loadedMsg:
+		m.err = nil
+		if msg.replace {
+			m.snapshot, m.previous = msg.snapshot, msg.previous
+			m.stack = []*table{msg.table}
+			m.path = []item{{}}
+		} else {
+			m.stack = append(m.stack, msg.table)
+			m.path = append(m.path, msg.item)
+		}
+
+	case errMsg:
+		m.err = msg.err
+
+	case scanTickMsg:
+		if !m.scanning {
+			return m, nil
+		}
+		m.progress = m.cfg.Scanner.GetStatus().Progress
+		return m, tick()
+
+	case scanDoneMsg:
+		m.scanning, m.progress = false, nil
+		if msg.err != nil {
+			m.err = fmt.Errorf("scan failed: %w", msg.err)
+			return m, nil
+		}
+		m.message = "scan complete"
+		return m, m.loadServices()
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.message = ""
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc", "backspace", "left", "h":
+		if len(m.stack) > 1 {
+			m.stack = m.stack[:len(m.stack)-1]
+			m.path = m.path[:len(m.path)-1]
+		}
+		return m, nil
+	case "s":
+		if m.cfg.Scanner == nil || m.scanning {
+			return m, nil
+		}
+		m.scanning = true
+		m.err = nil
+		return m, tea.Batch(m.scan(), tick())
+	case "R":
+		return m, m.loadServices()
+	}
+
+	t := m.current()
+	if t == nil {
+		return m, nil
+	}
+	switch msg.String() {
+	case "up", "k":
+		t.move(-1, m.tableHeight())
+	case "down", "j":
+		t.move(1, m.tableHeight())
+	case "pgup":
+		t.move(-m.tableHeight(), m.tableHeight())
+	case "pgdown", " ":
+		t.move(m.tableHeight(), m.tableHeight())
+	case "home", "g":
+		t.move(-len(t.rows), m.tableHeight())
+	case "end", "G":
+		t.move(len(t.rows), m.tableHeight())
+	case "o":
+		if len(t.rows) > 0 {
+			t.cycleSort()
+		}
+	case "r":
+		t.reverse()
+	case "enter", "right", "l":
+		return m, m.drill()
+	}
+	return m, nil
+}
+
+func (m *model) current() *table {
+	if len(m.stack) == 0 {
+		return nil
+	}
+	return m.stack[len(m.stack)-1]
+}
+
+// tableHeight is how many rows fit between the header and the footer.
+func (m *model) tableHeight() int {
+	return max(m.height-6, 1)
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	header := "whodidthis"
+	if m.snapshot != nil {
+		header += fmt.Sprintf(" — snapshot %d, %s", m.snapshot.ID, m.snapshot.CollectedAt.Local().Format("2006-01-02 15:04"))
+	}
+	b.WriteString(titleStyle.Render(header))
+	b.WriteString("\n")
+
+	if t := m.current(); t != nil {
+		b.WriteString(t.render(m.width, m.tableHeight()))
+	} else if m.err == nil {
+		b.WriteString("loading…\n")
+	}
+
+	switch {
+	case m.err != nil:
+		b.WriteString(errorStyle.Render(m.err.Error()))
+	case m.scanning:
+		status := "scanning…"
+		if p := m.progress; p != nil {
+			status = fmt.Sprintf("scanning: %s", p.Phase)
+			if p.Total > 0 {
+				status += fmt.Sprintf(" %d/%d", p.Current, p.Total)
+			}
+			if p.Detail != "" {
+				status += " — " + p.Detail
+			}
+		}
+		b.WriteString(status)
+	case m.message != "":
+		b.WriteString(m.message)
+	}
+	b.WriteString("\n")
+
+	keys := "↑/↓ move  enter open  esc back  o sort  r reverse  R reload  q quit"
+	if m.cfg.Scanner != nil {
+		keys = "↑/↓ move  enter open  esc back  o sort  r reverse  s scan  R reload  q quit"
+	}
+	b.WriteString(dimStyle.Render(keys))
+	return b.String()
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(progressInterval, func(time.Time) tea.Msg { return scanTickMsg{} })
+}
+
+func (m *model) scan() tea.Cmd {
+	return func() tea.Msg {
+		_, err := m.cfg.Scanner.RunOnce(m.ctx, scheduler.ScanRequest{Trigger: models.ScanTriggerCLI})
+		return scanDoneMsg{err: err}
+	}
+}
+
+// loadServices reloads the latest snapshot and replaces the whole stack.
+func (m *model) loadServices() tea.Cmd {
+	return func() tea.Msg {
+		snap, err := m.cfg.Snapshots.GetLatest(m.ctx)
+		if err != nil {
+			return errMsg{err}
+		}
+		if snap == nil {
+			return errMsg{fmt.Errorf("no snapshots yet — press s to scan")}
+		}
+		previous, err := m.cfg.Snapshots.GetPrevious(m.ctx, snap.ID)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		services, err := m.cfg.Services.List(m.ctx, snap.ID, storage.ServiceListOptions{Sort: "series", Order: "desc"})
+		if err != nil {
+			return errMsg{err}
+		}
+		deltas := make(map[string]models.ServiceDiff)
+		if previous != nil {
+			diffs, err := m.cfg.Services.Diff(m.ctx, previous.ID, snap.ID)
+			if err != nil {
+				return errMsg{err}
+			}
+			for _, d := range diffs {
+				deltas[d.ServiceName] = d
+			}
+		}
+
+		t := &table{
+			title: fmt.Sprintf("Services (%d)", len(services)),
+			columns: []column{
+				{title: "SERVICE"},
+				{title: "TEAM", width: 16},
+				{title: "SERIES", width: 10, right: true},
+				{title: "METRICS", width: 8, right: true},
+				{title: "DELTA", width: 9, right: true, delta: true},
+			},
+			sortCol: 2,
+			desc:    true,
+		}
+		for _, s := range services {
+			d, ok := deltas[s.ServiceName]
+			known := ok && d.Status != models.DiffAdded
+			name := s.ServiceName
+			if s.Missing {
+				name += " (missing)"
+			}
+			t.rows = append(t.rows, row{
+				key:    s.ServiceName,
+				id:     s.ID,
+				cells:  []string{name, s.Team, strconv.Itoa(s.TotalSeries), strconv.Itoa(s.MetricCount), formatDelta(d.SeriesDelta, known || previous == nil)},
+				values: []any{s.ServiceName, s.Team, s.TotalSeries, s.MetricCount, d.SeriesDelta},
+			})
+		}
+		return loadedMsg{table: t, snapshot: snap, previous: previous, replace: true}
+	}
+}
+
+// drill opens the selected row: a service's metrics or a metric's labels.
+func (m *model) drill() tea.Cmd {
+	t := m.current()
+	sel, ok := t.selected()
+	if !ok {
+		return nil
+	}
+	switch len(m.stack) {
+	case 1:
+		return m.loadMetrics(item{service: sel.key, id: sel.id}, m.previous)
+	case 2:
+		return m.loadLabels(item{service: m.path[1].service, metric: sel.key, id: sel.id})
+	}
+	return nil
+}
+
+func (m *model) loadMetrics(it item, previousSnap *models.Snapshot) tea.Cmd {
+	return func() tea.Msg {
+		metrics, err := m.cfg.Metrics.List(m.ctx, it.id, storage.MetricListOptions{Sort: "series", Order: "desc"})
+		if err != nil {
+			return errMsg{err}
+		}
+
+		// previous stays nil without a snapshot to compare with, and is
+		// empty when the service is new, so every metric reads as new.
+		var previous map[string]int
+		if previousSnap != nil {
+			previous = make(map[string]int)
+			prev, err := m.cfg.Services.GetByName(m.ctx, previousSnap.ID, it.service)
+			if err != nil {
+				return errMsg{err}
+			}
+			if prev != nil {
+				prevMetrics, err := m.cfg.Metrics.List(m.ctx, prev.ID, storage.MetricListOptions{})
+				if err != nil {
+					return errMsg{err}
+				}
+				for _, pm := range prevMetrics {
+					previous[pm.MetricName] = pm.SeriesCount
+				}
+			}
+		}
+
+		t := &table{
+			title: fmt.Sprintf("%s › metrics (%d)", it.service, len(metrics)),
+			columns: []column{
+				{title: "METRIC"},
+				{title: "TYPE", width: 10},
+				{title: "SERIES", width: 10, right: true},
+				{title: "LABELS", width: 7, right: true},
+				{title: "DELTA", width: 9, right: true, delta: true},
+			},
+			sortCol: 2,
+			desc:    true,
+		}
+		for _, mt := range metrics {
+			prev, known := previous[mt.MetricName]
+			delta := mt.SeriesCount - prev
+			t.rows = append(t.rows, row{
+				key:    mt.MetricName,
+				id:     mt.ID,
+				cells:  []string{mt.MetricName, mt.MetricType, strconv.Itoa(mt.SeriesCount), strconv.Itoa(mt.LabelCount), formatDelta(delta, known || previous == nil)},
+				values: []any{mt.MetricName, mt.MetricType, mt.SeriesCount, mt.LabelCount, delta},
+			})
+		}
+		return loadedMsg{table: t, item: it}
+	}
+}
+
+func (m *model) loadLabels(it item) tea.Cmd {
+	return func() tea.Msg {
+		labels, err := m.cfg.Labels.List(m.ctx, it.id)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		t := &table{
+			title: fmt.Sprintf("%s › %s › labels (%d)", it.service, it.metric, len(labels)),
+			columns: []column{
+				{title: "LABEL", width: 28},
+				{title: "VALUES", width: 8, right: true},
+				{title: "SAMPLES"},
+			},
+			sortCol: 1,
+			desc:    true,
+		}
+		for _, l := range labels {
+			values := strconv.Itoa(l.UniqueValuesCount)
+			if l.Truncated {
+				values += "+"
+			}
+			t.rows = append(t.rows, row{
+				key:    l.LabelName,
+				id:     l.ID,
+				cells:  []string{l.LabelName, values, strings.Join(l.SampleValues, ", ")},
+				values: []any{l.LabelName, l.UniqueValuesCount, strings.Join(l.SampleValues, ", ")},
+			})
+		}
+		t.sort()
+		return loadedMsg{table: t, item: it}
+	}
+}
@@ -77,11 +77,19 @@ export interface SnapshotAnalysis {
   completed_at?: string
 }
 
+export interface AnalysisProgress {
+  current_snapshot_id: number
+  previous_snapshot_id: number
+  progress: string
+}
+
 export interface AnalysisGlobalStatus {
   running: boolean
   current_snapshot_id?: number
   previous_snapshot_id?: number
   progress?: string
+  full: boolean
+  analyses: AnalysisProgress[]
 }
 
 async function fetchJSON<T>(url: string): Promise<T> {
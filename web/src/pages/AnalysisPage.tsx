@@ -178,10 +178,11 @@ export function AnalysisPage({ currentId: initialCurrentId, previousId: initialP
     )
   }
 
-  const canAnalyze = currentId && previousId && currentId !== previousId && !globalStatus?.running
-  const isCurrentPairRunning = globalStatus?.running &&
-    globalStatus.current_snapshot_id === currentId &&
-    globalStatus.previous_snapshot_id === previousId
+  const currentPairRun = globalStatus?.analyses.find(
+    (a) => a.current_snapshot_id === currentId && a.previous_snapshot_id === previousId
+  )
+  const isCurrentPairRunning = currentPairRun !== undefined
+  const canAnalyze = currentId && previousId && currentId !== previousId && !isCurrentPairRunning && !globalStatus?.full
 
   return (
     <div className="space-y-6">
@@ -242,7 +243,12 @@ export function AnalysisPage({ currentId: initialCurrentId, previousId: initialP
         {globalStatus?.running && (
           <div className="flex items-center gap-2 text-sm text-gray-500 dark:text-gray-400">
             <span className="w-2 h-2 bg-green-500 rounded-full animate-pulse" aria-hidden="true" />
-            <span aria-live="polite">{globalStatus.progress || 'Running analysis...'}</span>
+            <span aria-live="polite">
+              {currentPairRun
+                ? currentPairRun.progress || 'Running analysis...'
+                : `${globalStatus.analyses.length} ${globalStatus.analyses.length === 1 ? 'analysis' : 'analyses'} running for other snapshots`}
+              {globalStatus.full && !currentPairRun && ', wait for one to finish'}
+            </span>
           </div>
         )}
       </div>
@@ -251,7 +257,7 @@ export function AnalysisPage({ currentId: initialCurrentId, previousId: initialP
         <div className="bg-white dark:bg-gray-900 border border-gray-200 dark:border-gray-700 rounded-lg p-6 space-y-4">
           <div className="flex items-center justify-between">
             <h2 className="text-lg font-semibold text-gray-900 dark:text-gray-100">Analysis Result</h2>
-            <StatusBadge status={analysis.status} progress={isCurrentPairRunning ? globalStatus?.progress : undefined} />
+            <StatusBadge status={analysis.status} progress={currentPairRun?.progress} />
           </div>
 
           <div className="space-y-2 text-sm text-gray-500 dark:text-gray-400">
@@ -318,7 +324,7 @@ export function AnalysisPage({ currentId: initialCurrentId, previousId: initialP
               <Button
                 variant="ghost"
                 onClick={handleRegenerate}
-                disabled={globalStatus?.running}
+                disabled={isCurrentPairRunning || globalStatus?.full}
                 aria-label="Regenerate analysis"
               >
                 Regenerate